@@ -2,10 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
 	"time"
 
@@ -20,21 +20,41 @@ const (
 	APP                = "askToAllModels"
 	defaultTemperature = 0.2
 	defaultTimeout     = 90 * time.Second
+	defaultConcurrency = 4
+	// defaultOutputBase is the name of the results file without extension, the -format is appended
+	defaultOutputBase = "model_comparison_results"
 )
 
 type argumentsToAskToAll struct {
 	Provider     string
 	SystemPrompt string
 	UserPrompt   string
+	PromptsFile  string
 	Temperature  float64
+	Sample       int
+	Weighted     bool
+	Seed         uint64
+	Timeout      time.Duration
+	Concurrency  int
+	Output       string
+	Format       string
 }
 
 type llmResult struct {
-	Provider     string `json:"provider,omitempty"`
-	ModelName    string `json:"model_name,omitempty"`
-	SystemPrompt string `json:"system_prompt,omitempty"`
-	UserPrompt   string `json:"user_prompt,omitempty"`
-	Response     string `json:"response,omitempty"`
+	Provider     string     `json:"provider,omitempty"`
+	ModelName    string     `json:"model_name,omitempty"`
+	PromptName   string     `json:"prompt_name,omitempty"`
+	SystemPrompt string     `json:"system_prompt,omitempty"`
+	UserPrompt   string     `json:"user_prompt,omitempty"`
+	Response     string     `json:"response,omitempty"`
+	Usage        *llm.Usage `json:"usage,omitempty"`
+	// DurationMs is the wall-clock time of the query, TokensPerSecond the generation throughput when the usage is known
+	DurationMs      int64   `json:"duration_ms"`
+	TokensPerSecond float64 `json:"tokens_per_second,omitempty"`
+	// Cost is the estimated dollar cost of the query, Unpriced is true when it is unknown
+	// because the catalog has no pricing for the model or the provider didn't report the usage
+	Cost     float64 `json:"cost"`
+	Unpriced bool    `json:"unpriced,omitempty"`
 }
 
 // usage provides a more detailed help message for the CLI tool.
@@ -42,11 +62,19 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s -provider=<provider> [options]\n\n", os.Args[0])
 	fmt.Fprintln(os.Stderr, "A powerful and flexible CLI to query all models from a provider ans save the result.")
 	fmt.Fprintln(os.Stderr, "\nRequired Flags:")
-	fmt.Fprintf(os.Stderr, "  -provider\tProvider to use (ollama, gemini, xai, openai, openrouter)\n")
+	fmt.Fprintf(os.Stderr, "  -provider\tProvider to use (ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere), defaults to env LLM_PROVIDER.\n")
 	fmt.Fprintf(os.Stderr, "  -prompt\tThe prompt to send to LLM model.\n")
+	fmt.Fprintf(os.Stderr, "  -prompts-file\tA JSON array of prompts to run against every model instead of -prompt.\n")
 	fmt.Fprintf(os.Stderr, "  -system\tThe system role for the assistant.\n")
 	fmt.Fprintln(os.Stderr, "\nOptional Flags:")
 	fmt.Fprintf(os.Stderr, "  -temperature\tThe temperature of the model. Increasing the temperature will make the model answer more creatively(value range 0.0 - 2.0).\n")
+	fmt.Fprintf(os.Stderr, "  -timeout\tTimeout for each LLM request in seconds (default: env LLM_TIMEOUT or %d).\n", int(defaultTimeout/time.Second))
+	fmt.Fprintf(os.Stderr, "  -sample\tOnly query N models picked at random instead of all of them.\n")
+	fmt.Fprintf(os.Stderr, "  -sample-weighted\tWeight the random pick by the catalog priority of each model.\n")
+	fmt.Fprintf(os.Stderr, "  -seed\tSeed of the random generator used by -sample, to get reproducible runs (default: random).\n")
+	fmt.Fprintf(os.Stderr, "  -concurrency\tNumber of models queried in parallel (default: %d).\n", defaultConcurrency)
+	fmt.Fprintf(os.Stderr, "  -format\tFormat of the results file: json (overwrites the file), jsonl or csv (append to the file) (default: json).\n")
+	fmt.Fprintf(os.Stderr, "  -output\tPath of the results file, written after each model (default: %s.<format>).\n", defaultOutputBase)
 }
 
 func main() {
@@ -60,28 +88,54 @@ func main() {
 		log.Fatalf("💥💥 error creating logger: %v\n", err)
 	}
 
+	// the config file gives the defaults of the flags, see config.LoadCLIConfig for the precedence
+	cliConfig, err := config.LoadDefaultCLIConfig()
+	if err == nil {
+		err = cliConfig.ApplyBaseURLs()
+	}
+	if err != nil {
+		l.Error("💥💥 %v", err)
+		os.Exit(1)
+	}
+
+	// LLM_TIMEOUT and LLM_PROVIDER env variables give the defaults, explicit flags override them
+	envTimeout, err := config.GetDefaultTimeout(defaultTimeout)
+	if err != nil {
+		l.Error("💥💥 %v", err)
+		os.Exit(1)
+	}
+
 	flag.Usage = usage
-	providerFlag := flag.String("provider", "", "Provider to use (ollama, gemini, xai, openai, openrouter)")
-	systemPromptFlag := flag.String("system", "", "The system role for your assistant, it default to an helpful shell assistant")
+	providerFlag := flag.String("provider", config.GetDefaultProvider(cliConfig.Provider), "Provider to use (ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere), default from env LLM_PROVIDER")
+	timeoutFlag := flag.Int("timeout", int(envTimeout.Round(time.Second)/time.Second), "Timeout for each LLM request in seconds, default from env LLM_TIMEOUT")
+	systemPromptFlag := flag.String("system", cliConfig.SystemPrompt, "The system role for your assistant, it default to an helpful shell assistant")
 	userPromptFlag := flag.String("prompt", "", "The prompt to send to the LLM")
-	temperatureFlag := flag.Float64("temperature", defaultTemperature, fmt.Sprintf("The temperature for the LLM response (0.0 - 2.0) default value is : %f", defaultTemperature))
+	promptsFileFlag := flag.String("prompts-file", "", "JSON array of prompts (strings or {name, system, prompt} objects) to run against every model")
+	temperatureFlag := flag.Float64("temperature", cliConfig.GetTemperature(defaultTemperature), fmt.Sprintf("The temperature for the LLM response (0.0 - 2.0) default value is : %f", defaultTemperature))
+
+	sampleFlag := flag.Int("sample", 0, "Only query N models picked at random (0 means all models)")
+	sampleWeightedFlag := flag.Bool("sample-weighted", false, "Weight the random pick of -sample by the catalog priority of each model")
+	seedFlag := flag.Uint64("seed", 0, "Seed of the random generator used by -sample (0 means a random seed)")
+	concurrencyFlag := flag.Int("concurrency", defaultConcurrency, "Number of models queried in parallel")
+	formatFlag := flag.String("format", formatJSON, "Format of the results file: json (overwrites the file), jsonl or csv (a line appended per model)")
+	outputFlag := flag.String("output", "", "Path of the results file, written after each model (default: "+defaultOutputBase+".<format>)")
 
 	flag.Parse()
 
 	if *providerFlag == "" {
-		l.Error("💥💥 Error: -provider flag is required.")
+		l.Error("💥💥 Error: -provider flag (or env LLM_PROVIDER) is required.")
 		flag.Usage()
 		os.Exit(1)
 	}
 	l.Info("you asked for provider: %s", *providerFlag)
 
-	if *userPromptFlag == "" {
-		l.Error("💥💥 Error: user  -prompt flag is required.")
+	if (*userPromptFlag == "") == (*promptsFileFlag == "") {
+		l.Error("💥💥 Error: either the user -prompt flag or the -prompts-file flag is required.")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if *systemPromptFlag == "" {
+	if *systemPromptFlag == "" && *promptsFileFlag == "" {
 		l.Error("💥💥 Error:  -system flag is required.")
 		flag.Usage()
 		os.Exit(1)
@@ -91,7 +145,18 @@ func main() {
 		Provider:     *providerFlag,
 		SystemPrompt: *systemPromptFlag,
 		UserPrompt:   *userPromptFlag,
+		PromptsFile:  *promptsFileFlag,
 		Temperature:  *temperatureFlag,
+		Sample:       *sampleFlag,
+		Weighted:     *sampleWeightedFlag,
+		Seed:         *seedFlag,
+		Timeout:      time.Duration(*timeoutFlag) * time.Second,
+		Concurrency:  *concurrencyFlag,
+		Output:       *outputFlag,
+		Format:       *formatFlag,
+	}
+	if params.Output == "" {
+		params.Output = defaultOutputBase + "." + params.Format
 	}
 
 	if err := run(l, params); err != nil {
@@ -100,6 +165,26 @@ func main() {
 	}
 }
 
+// getModelsToQuery returns all the provider models, or a random sample of them when params.Sample > 0.
+func getModelsToQuery(l golog.MyLogger, provider llm.Provider, params argumentsToAskToAll) ([]llm.ModelInfo, error) {
+	l.Info("Fetching available models...")
+	ctx, cancel := context.WithTimeout(context.Background(), params.Timeout)
+	defer cancel()
+	models, err := provider.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching models from provider: %w", err)
+	}
+	if params.Sample <= 0 {
+		return models, nil
+	}
+	seed := params.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	l.Info("sampling %d of %d models (weighted: %t, seed: %d)", params.Sample, len(models), params.Weighted, seed)
+	return llm.SampleModels(models, params.Sample, params.Weighted, rand.New(rand.NewPCG(seed, seed))), nil
+}
+
 func run(l golog.MyLogger, params argumentsToAskToAll) error {
 	l.Info("🚀🚀 Starting App:'%s', ver:%s, build:%s, git: %s", APP, version.VERSION, version.BuildStamp, version.REPOSITORY)
 	kind, defModel, err := llm.GetProviderKindAndDefaultModel(params.Provider)
@@ -107,59 +192,102 @@ func run(l golog.MyLogger, params argumentsToAskToAll) error {
 		return fmt.Errorf("💥💥  error getting provider %s kind :%v", params.Provider, err)
 	}
 
-	provider, err := llm.NewProvider(kind, defModel, l)
+	prompts := []suitePrompt{{System: params.SystemPrompt, Prompt: params.UserPrompt}}
+	if params.PromptsFile != "" {
+		prompts, err = loadPromptsFile(params.PromptsFile, params.SystemPrompt)
+		if err != nil {
+			return fmt.Errorf("💥💥 error loading prompts: %w", err)
+		}
+	}
+
+	// the http.Client timeout is the one of each query, so that -timeout isn't capped by llm.DefaultHTTPTimeout
+	provider, err := llm.NewProviderWithConfig(llm.ProviderConfig{Kind: kind, Model: defModel, Timeout: params.Timeout}, l)
 	if err != nil {
 		return fmt.Errorf("💥💥 error creating provider '%s': %v", params.Provider, err)
 	}
-	modelsList, err := llm.GetModelsList(l, provider, defaultTimeout)
+	modelsList, err := getModelsToQuery(l, provider, params)
 	if err != nil {
 		return fmt.Errorf("error getting list of models for provider %s. err: %w", params.Provider, err)
 	}
 	temperature := llm.Clamp(params.Temperature, 0.0, 2.0)
-	allResults := make([]llmResult, 0, len(modelsList))
-	// Loop through each model and query it
-	for i, currentModel := range modelsList {
-		req := &llm.LLMRequest{
-			Model: currentModel, // Use the validated or default model
-			Messages: []llm.LLMMessage{
-				{Role: llm.RoleSystem, Content: params.SystemPrompt},
-				{Role: llm.RoleUser, Content: params.UserPrompt},
-			},
-			Temperature: temperature,
-			Stream:      false,
+	// the matrix of prompts × models is flattened prompt by prompt, so that all the queries share the worker pool
+	reqs := make([]*llm.LLMRequest, 0, len(prompts)*len(modelsList))
+	for _, prompt := range prompts {
+		for _, modelInfo := range modelsList {
+			reqs = append(reqs, &llm.LLMRequest{
+				Model: modelInfo.Name,
+				Messages: []llm.LLMMessage{
+					{Role: llm.RoleSystem, Content: prompt.System},
+					{Role: llm.RoleUser, Content: prompt.Prompt},
+				},
+				Temperature: temperature,
+				Stream:      false,
+				Timeout:     params.Timeout, // bounds each model query
+			})
 		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-		defer cancel()
-
-		l.Info("Sending prompt to %s LLM, model: %s (%d of %d)...\n", params.Provider, currentModel, i, len(modelsList))
-		resp, err := provider.Query(ctx, req)
-		if err != nil {
-			l.Warn("error querying model %s LLM: %w", currentModel, err)
-			continue // let's skip this one
+	}
+	writer, err := newResultWriter(params.Output, params.Format)
+	if err != nil {
+		return fmt.Errorf("💥💥 error opening results file: %w", err)
+	}
+	l.Info("Sending %d prompt(s) to %d models of %s LLM, %d at a time...\n", len(prompts), len(modelsList), params.Provider, max(params.Concurrency, 1))
+	totalCost := 0.0
+	unpricedModels := 0
+	var writeErr error
+	// each result is saved as soon as the model answered, so that an interrupted run keeps its progress
+	llm.QueryRequestsFunc(context.Background(), provider, reqs, params.Concurrency, func(i int, result llm.ModelResult) {
+		prompt := prompts[i/len(modelsList)]
+		modelInfo := modelsList[i%len(modelsList)]
+		if result.Err != nil {
+			l.Warn("error querying model %s LLM: %v", result.Model, result.Err)
+			return // let's skip this one
 		}
+		resp := result.Response
+		l.Info("model %s answered %s in %s (%.1f tokens/s)", result.Model, prompt.Name, result.Elapsed.Round(time.Millisecond), resp.TokensPerSecond())
 		currentResult := llmResult{
-			Provider:     params.Provider,
-			ModelName:    currentModel,
-			SystemPrompt: params.SystemPrompt,
-			UserPrompt:   params.UserPrompt,
-			Response:     resp.Text,
+			Provider:        params.Provider,
+			ModelName:       result.Model,
+			PromptName:      prompt.Name,
+			SystemPrompt:    prompt.System,
+			UserPrompt:      prompt.Prompt,
+			Response:        resp.Text,
+			Usage:           resp.Usage,
+			DurationMs:      result.Elapsed.Milliseconds(),
+			TokensPerSecond: resp.TokensPerSecond(),
+		}
+		if resp.Usage == nil {
+			// not every server reports the usage, it's then estimated with the token counter of the provider
+			estimator := llm.TokenEstimatorForProvider(kind, result.Model)
+			usage := &llm.Usage{PromptTokens: estimator.EstimateMessages(reqs[i].Messages), CompletionTokens: estimator.EstimateText(resp.Text), Estimated: true}
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			currentResult.Usage = usage
+		}
+		cost, priced := llm.EstimateCost(modelInfo, *currentResult.Usage)
+		currentResult.Cost = cost
+		currentResult.Unpriced = !priced
+		totalCost += cost
+		if !priced {
+			unpricedModels++
+		}
+		if err := writer.Write(currentResult); err != nil && writeErr == nil {
+			writeErr = err
+			l.Error("error saving the result of model %s to %s: %v", result.Model, params.Output, err)
 		}
-		allResults = append(allResults, currentResult)
 
 		l.Info("\nLLM Response: \n%s", resp.Text)
+	})
+	if err := writer.Close(); err != nil && writeErr == nil {
+		writeErr = err
 	}
-	// Save the allResults to a file (e.g., JSON)
-	jsonData, err := json.MarshalIndent(allResults, "", "  ")
-	if err != nil {
-		log.Fatalf("Failed to marshal allResults: %v", err)
+	if writeErr != nil {
+		return fmt.Errorf("💥💥 error writing results file %s: %w", params.Output, writeErr)
 	}
 
-	err = os.WriteFile("model_comparison_results.json", jsonData, 0644)
-	if err != nil {
-		log.Fatalf("Failed to write allResults file: %v", err)
+	fmt.Printf("Comparison completed. Results saved to %s\n", params.Output)
+	fmt.Printf("Estimated cost of the run: $%.6f", totalCost)
+	if unpricedModels > 0 {
+		fmt.Printf(" (%d model(s) without pricing not counted)", unpricedModels)
 	}
-
-	fmt.Println("Comparison completed. Results saved to model_comparison_results.json")
+	fmt.Println()
 	return nil
 }
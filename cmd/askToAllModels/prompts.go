@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// suitePrompt is a prompt of a -prompts-file, run against every model.
+type suitePrompt struct {
+	// Name identifies the prompt in the results, it defaults to prompt-<index> (starting at 1)
+	Name string `json:"name,omitempty"`
+	// System overrides the -system flag for this prompt
+	System string `json:"system,omitempty"`
+	Prompt string `json:"prompt"`
+}
+
+// loadPromptsFile reads a JSON array of prompts, each one either a plain string or a suitePrompt object like
+// {"name": "haiku", "system": "You are a poet", "prompt": "Write a haiku about Go"}.
+// The prompts without system prompt get defaultSystem, it is an error when both are empty.
+func loadPromptsFile(path, defaultSystem string) ([]suitePrompt, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("prompts file %s must contain a JSON array: %w", path, err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("prompts file %s is empty", path)
+	}
+	prompts := make([]suitePrompt, 0, len(items))
+	for i, item := range items {
+		var p suitePrompt
+		if err := json.Unmarshal(item, &p.Prompt); err != nil {
+			if err := json.Unmarshal(item, &p); err != nil {
+				return nil, fmt.Errorf("prompt %d of %s must be a string or an object: %w", i+1, path, err)
+			}
+		}
+		if strings.TrimSpace(p.Prompt) == "" {
+			return nil, fmt.Errorf("prompt %d of %s is empty", i+1, path)
+		}
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("prompt-%d", i+1)
+		}
+		if p.System == "" {
+			p.System = defaultSystem
+		}
+		if p.System == "" {
+			return nil, errors.New("prompt " + p.Name + " has no system prompt and the -system flag is empty")
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPromptsFile(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "prompts.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("StringsAndObjects", func(t *testing.T) {
+		path := write(`["What is Go?", {"name": "haiku", "system": "You are a poet", "prompt": "Write a haiku"}]`)
+		prompts, err := loadPromptsFile(path, "You are helpful")
+		if err != nil {
+			t.Fatalf("loadPromptsFile failed: %v", err)
+		}
+		want := []suitePrompt{
+			{Name: "prompt-1", System: "You are helpful", Prompt: "What is Go?"},
+			{Name: "haiku", System: "You are a poet", Prompt: "Write a haiku"},
+		}
+		if len(prompts) != len(want) || prompts[0] != want[0] || prompts[1] != want[1] {
+			t.Errorf("Expected %#v, got %#v", want, prompts)
+		}
+	})
+
+	invalid := []struct {
+		name    string
+		content string
+		system  string
+	}{
+		{name: "NotAnArray", content: `{"prompt": "hi"}`, system: "sys"},
+		{name: "Empty", content: `[]`, system: "sys"},
+		{name: "EmptyPrompt", content: `[{"name": "blank"}]`, system: "sys"},
+		{name: "MissingSystem", content: `["hi"]`},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadPromptsFile(write(tt.content), tt.system); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// output formats of the -format flag
+const (
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+)
+
+// resultWriter saves each result as soon as the model answered, so that the progress of a long run
+// survives an interruption.
+type resultWriter interface {
+	Write(result llmResult) error
+	Close() error
+}
+
+// newResultWriter returns the writer of format to path. The json format overwrites the file with the whole
+// array after each result to keep a valid file, while the jsonl and csv formats append a line to it (the csv header is
+// only written to an empty file), so that a run can be resumed in the same file.
+func newResultWriter(path, format string) (resultWriter, error) {
+	switch format {
+	case formatJSON:
+		return &jsonResultWriter{path: path, results: []llmResult{}}, nil
+	case formatJSONL, formatCSV:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if format == formatJSONL {
+			return &jsonlResultWriter{f: f, enc: json.NewEncoder(f)}, nil
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &csvResultWriter{f: f, w: csv.NewWriter(f), header: info.Size() == 0}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected %s, %s or %s", format, formatJSON, formatJSONL, formatCSV)
+	}
+}
+
+type jsonResultWriter struct {
+	path    string
+	results []llmResult
+}
+
+func (w *jsonResultWriter) Write(result llmResult) error {
+	w.results = append(w.results, result)
+	jsonData, err := json.MarshalIndent(w.results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(w.path, jsonData)
+}
+
+// Close writes the empty array when no model answered, so that the file always exists after a run.
+func (w *jsonResultWriter) Close() error {
+	if len(w.results) > 0 {
+		return nil
+	}
+	return writeFileAtomic(w.path, []byte("[]"))
+}
+
+// writeFileAtomic writes data to a temporary file of the directory of path and renames it to path,
+// so that a crash while writing leaves the previous content of path intact. When path is a symlink, its target
+// is replaced, and the mode of an existing file is kept, a new file being created with the mode 0644.
+func writeFileAtomic(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type jsonlResultWriter struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func (w *jsonlResultWriter) Write(result llmResult) error {
+	return w.enc.Encode(result)
+}
+
+func (w *jsonlResultWriter) Close() error {
+	return w.f.Close()
+}
+
+var csvHeader = []string{
+	"provider", "model_name", "prompt_name", "system_prompt", "user_prompt", "response",
+	"prompt_tokens", "completion_tokens", "total_tokens", "duration_ms", "tokens_per_second", "cost", "unpriced",
+}
+
+type csvResultWriter struct {
+	f      *os.File
+	w      *csv.Writer
+	header bool // true while the header still has to be written
+}
+
+func (w *csvResultWriter) Write(result llmResult) error {
+	if w.header {
+		if err := w.w.Write(csvHeader); err != nil {
+			return err
+		}
+		w.header = false
+	}
+	var promptTokens, completionTokens, totalTokens string
+	if result.Usage != nil {
+		promptTokens = strconv.Itoa(result.Usage.PromptTokens)
+		completionTokens = strconv.Itoa(result.Usage.CompletionTokens)
+		totalTokens = strconv.Itoa(result.Usage.TotalTokens)
+	}
+	if err := w.w.Write([]string{
+		result.Provider, result.ModelName, result.PromptName, result.SystemPrompt, result.UserPrompt, result.Response,
+		promptTokens, completionTokens, totalTokens,
+		strconv.FormatInt(result.DurationMs, 10),
+		strconv.FormatFloat(result.TokensPerSecond, 'f', 1, 64),
+		strconv.FormatFloat(result.Cost, 'f', 6, 64),
+		strconv.FormatBool(result.Unpriced),
+	}); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvResultWriter) Close() error {
+	return w.f.Close()
+}
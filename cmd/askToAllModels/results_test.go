@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-ai-llm-query/pkg/llm"
+)
+
+func TestResultWriter(t *testing.T) {
+	results := []llmResult{
+		{Provider: "ollama", ModelName: "qwen3", Response: "Hello, \"world\"", Usage: &llm.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}, DurationMs: 120},
+		{Provider: "ollama", ModelName: "gemma3", Response: "line 1\nline 2", Unpriced: true},
+	}
+	// write saves the results one by one, checking that the file is up to date after each of them
+	write := func(t *testing.T, path, format string, check func(written int)) {
+		w, err := newResultWriter(path, format)
+		if err != nil {
+			t.Fatalf("newResultWriter failed: %v", err)
+		}
+		for i, result := range results {
+			if err := w.Write(result); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			check(i + 1)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+	read := func(t *testing.T, path string) string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		return string(data)
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.json")
+		write(t, path, formatJSON, func(written int) {
+			var got []llmResult
+			if err := json.Unmarshal([]byte(read(t, path)), &got); err != nil || len(got) != written {
+				t.Errorf("Expected a valid array of %d results, got %d (%v)", written, len(got), err)
+			}
+		})
+		if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+			t.Errorf("Expected only the results file, without temporary files, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("JSONKeepsModeAndSymlink", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target.json")
+		if err := os.WriteFile(target, []byte("[]"), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", target, err)
+		}
+		link := filepath.Join(dir, "results.json")
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		write(t, link, formatJSON, func(int) {})
+		if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("Expected the results file to stay a symlink, got %v (%v)", info, err)
+		}
+		info, err := os.Stat(target)
+		if err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("Expected the target to keep the mode 0600, got %v (%v)", info, err)
+		}
+		var got []llmResult
+		if err := json.Unmarshal([]byte(read(t, target)), &got); err != nil || len(got) != len(results) {
+			t.Errorf("Expected the results in the target of the symlink, got %d (%v)", len(got), err)
+		}
+	})
+
+	t.Run("JSONLAppends", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.jsonl")
+		for run := range 2 {
+			write(t, path, formatJSONL, func(written int) {
+				lines := strings.Split(strings.TrimSpace(read(t, path)), "\n")
+				if len(lines) != run*len(results)+written {
+					t.Errorf("Expected %d lines, got %d", run*len(results)+written, len(lines))
+				}
+				var last llmResult
+				if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil || last.ModelName != results[written-1].ModelName {
+					t.Errorf("Expected the last line to be the result of %s, got %#v (%v)", results[written-1].ModelName, last, err)
+				}
+			})
+		}
+	})
+
+	t.Run("CSVHeaderOnce", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.csv")
+		for range 2 {
+			write(t, path, formatCSV, func(int) {})
+		}
+		records, err := csv.NewReader(strings.NewReader(read(t, path))).ReadAll()
+		if err != nil {
+			t.Fatalf("Expected a valid CSV file, got %v", err)
+		}
+		if len(records) != 1+2*len(results) || records[0][1] != "model_name" {
+			t.Fatalf("Expected one header and %d rows, got %v", 2*len(results), records)
+		}
+		if row := records[1]; row[5] != results[0].Response || row[6] != "5" || row[9] != "120" {
+			t.Errorf("Expected the response, tokens and duration of the first result, got %v", row)
+		}
+		if row := records[2]; row[5] != results[1].Response || row[6] != "" || row[12] != "true" {
+			t.Errorf("Expected the multiline response without usage, got %v", row)
+		}
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		if _, err := newResultWriter(filepath.Join(t.TempDir(), "results.xml"), "xml"); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
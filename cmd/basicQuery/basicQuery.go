@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -40,17 +39,19 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s -provider=<provider> [options]\n\n", os.Args[0])
 	fmt.Fprintln(os.Stderr, "A powerful and flexible CLI to query various Large Language Models.")
 	fmt.Fprintln(os.Stderr, "\nRequired Flags:")
-	fmt.Fprintf(os.Stderr, "  -provider\tProvider to use (ollama, gemini, xai, openai, openrouter)\n")
+	fmt.Fprintf(os.Stderr, "  -provider\tProvider to use (ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere), defaults to env LLM_PROVIDER.\n")
 	fmt.Fprintln(os.Stderr, "\nOptions for querying:")
 	fmt.Fprintf(os.Stderr, "  -model\tModel to use. If blank, a default for the provider is chosen.\n")
 	fmt.Fprintf(os.Stderr, "  -prompt\tThe prompt to send to the LLM. Required for querying.\n")
 	fmt.Fprintf(os.Stderr, "  -system\tThe system role for the assistant.\n")
 	fmt.Fprintf(os.Stderr, "  -temperature\tThe temperature of the model. Increasing the temperature will make the model answer more creatively(value range 0.0 - 2.0).\n")
 	fmt.Fprintf(os.Stderr, "  -stream\tEnable streaming the response.\n")
-	fmt.Fprintf(os.Stderr, "  -timeout\tTimeout for the LLM request in seconds (default: %d).\n", defaultTimeout)
+	fmt.Fprintf(os.Stderr, "  -timeout\tTimeout for the LLM request in seconds (default: env LLM_TIMEOUT or %d).\n", defaultTimeout)
 	fmt.Fprintln(os.Stderr, "\nOptions for listing models:")
 	fmt.Fprintf(os.Stderr, "  -list-models\tLists available models for the specified provider and exits.\n")
-	fmt.Fprintf(os.Stderr, "  -json-output\tUse with -list-models to output in JSON format.\n\n")
+	fmt.Fprintf(os.Stderr, "  -format\tOutput format of -list-models: list, table, csv, markdown or json (default: list).\n")
+	fmt.Fprintf(os.Stderr, "  -json-output\tUse with -list-models to output in JSON format, same as -format=json.\n")
+	fmt.Fprintf(os.Stderr, "  -verify\tSends a minimal prompt to check the provider and model work end to end, and exits.\n\n")
 }
 
 func main() {
@@ -64,36 +65,60 @@ func main() {
 		log.Fatalf("💥💥 error creating logger: %v\n", err)
 	}
 
+	// the config file gives the defaults of the flags, see config.LoadCLIConfig for the precedence
+	cliConfig, err := config.LoadDefaultCLIConfig()
+	if err == nil {
+		err = cliConfig.ApplyBaseURLs()
+	}
+	if err != nil {
+		l.Error("💥💥 %v", err)
+		os.Exit(1)
+	}
+
+	// LLM_TIMEOUT and LLM_PROVIDER env variables give the defaults, explicit flags override them
+	envTimeout, err := config.GetDefaultTimeout(defaultTimeout * time.Second)
+	if err != nil {
+		l.Error("💥💥 %v", err)
+		os.Exit(1)
+	}
+	timeoutSeconds := int(envTimeout.Round(time.Second) / time.Second)
+
 	// Flag definitions and set custom usage function
 	flag.Usage = usage
-	providerFlag := flag.String("provider", "", "Provider to use (ollama, gemini, xai, openai, openrouter)")
+	providerFlag := flag.String("provider", config.GetDefaultProvider(cliConfig.Provider), "Provider to use (ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere), default from env LLM_PROVIDER")
 	modelFlag := flag.String("model", "", "Model to use, depends on chosen provider, leave blank for a default valid choice")
-	systemPromptFlag := flag.String("system", defaultRole, "The system role for your assistant, it default to an helpful shell assistant")
+	systemPromptFlag := flag.String("system", llm.FirstNonEmpty(cliConfig.SystemPrompt, defaultRole), "The system role for your assistant, it default to an helpful shell assistant")
 	userPromptFlag := flag.String("prompt", "", "The prompt to send to the LLM")
 	listModelsFlag := flag.Bool("list-models", false, "List available models for the provider and exit")
-	jsonOutputFlag := flag.Bool("json-output", false, "Use with -list-models for JSON output")
-	temperatureFlag := flag.Float64("temperature", defaultTemperature, fmt.Sprintf("The temperature for the LLM response (0.0 - 2.0) default value is : %f", defaultTemperature))
+	formatFlag := flag.String("format", listFormatList, "Use with -list-models, output format: list, table, csv, markdown or json")
+	jsonOutputFlag := flag.Bool("json-output", false, "Use with -list-models for JSON output, same as -format=json")
+	verifyFlag := flag.Bool("verify", false, "Send a minimal prompt to check the provider and model work, then exit")
+	temperatureFlag := flag.Float64("temperature", cliConfig.GetTemperature(defaultTemperature), fmt.Sprintf("The temperature for the LLM response (0.0 - 2.0) default value is : %f", defaultTemperature))
 	streamFlag := flag.Bool("stream", false, "Enable streaming the response")
-	timeoutFlag := flag.Int("timeout", defaultTimeout, fmt.Sprintf("Timeout for the LLM request in seconds (default: %d)", defaultTimeout))
+	timeoutFlag := flag.Int("timeout", timeoutSeconds, fmt.Sprintf("Timeout for the LLM request in seconds (default: env LLM_TIMEOUT or %d)", defaultTimeout))
 	flag.Parse()
+	if *modelFlag == "" {
+		*modelFlag = cliConfig.ModelFor(*providerFlag)
+	}
 
 	// Make the -provider flag mandatory
 	if *providerFlag == "" {
-		l.Error("💥💥 Error: -provider flag is required.")
+		l.Error("💥💥 Error: -provider flag (or env LLM_PROVIDER) is required.")
 		flag.Usage()
 		os.Exit(1)
 	}
 	l.Info("you asked for provider: %s", *providerFlag)
 
 	// Create the provider instance early to use it for listing or querying
-	kind, _, err := llm.GetProviderKindAndDefaultModel(*providerFlag)
+	kind, defaultModel, err := llm.GetProviderKindAndDefaultModel(*providerFlag)
 	if err != nil {
 		l.Error("💥💥 %v", err)
 		flag.Usage()
 		os.Exit(1)
 	}
 	// The model will be set properly in the run() function, we can use a dummy value here.
-	provider, err := llm.NewProvider(kind, "default", l)
+	// the http.Client timeout is the one of the requests, so that -timeout isn't capped by llm.DefaultHTTPTimeout
+	provider, err := llm.NewProviderWithConfig(llm.ProviderConfig{Kind: kind, Model: "default", Timeout: time.Duration(*timeoutFlag) * time.Second}, l)
 	if err != nil {
 		l.Error("💥💥 Error creating provider '%s': %v", *providerFlag, err)
 		os.Exit(1)
@@ -101,13 +126,27 @@ func main() {
 
 	// Handle the -list-models functionality
 	if *listModelsFlag {
-		if err := handleListModels(l, provider, *jsonOutputFlag, *timeoutFlag); err != nil {
+		format := *formatFlag
+		if *jsonOutputFlag {
+			format = listFormatJSON // kept for backward compatibility
+		}
+		if err := handleListModels(l, provider, format, *timeoutFlag); err != nil {
 			l.Error("💥💥 Could not list models: %v", err)
 			os.Exit(1)
 		}
 		return // Exit successfully after listing models
 	}
 
+	// Handle the -verify preflight
+	if *verifyFlag {
+		model := llm.FirstNonEmpty(*modelFlag, defaultModel)
+		if err := handleVerify(l, kind, model, *timeoutFlag); err != nil {
+			l.Error("💥💥 %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// For querying, a prompt is now mandatory
 	if *userPromptFlag == "" {
 		l.Error("💥💥 Error: -prompt flag is required for querying.")
@@ -132,8 +171,11 @@ func main() {
 	}
 }
 
-// handleListModels fetches and displays the models from a provider.
-func handleListModels(l golog.MyLogger, provider llm.Provider, jsonOutput bool, timeout int) error {
+// handleListModels fetches and displays the models from a provider in format (see writeModels).
+func handleListModels(l golog.MyLogger, provider llm.Provider, format string, timeout int) error {
+	if !slices.Contains(listFormats, format) {
+		return fmt.Errorf("unknown format %q, expected one of %v", format, listFormats)
+	}
 	l.Info("Fetching available models...")
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
 	defer cancel()
@@ -143,18 +185,22 @@ func handleListModels(l golog.MyLogger, provider llm.Provider, jsonOutput bool,
 		return fmt.Errorf("error fetching models from provider: %w", err)
 	}
 
-	if jsonOutput {
-		jsonBytes, err := json.MarshalIndent(models, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal models to JSON: %w", err)
-		}
-		fmt.Println(string(jsonBytes))
-	} else {
-		fmt.Println("Available models:")
-		for _, m := range models {
-			fmt.Printf("- %s\n", m.Name)
-		}
+	return writeModels(os.Stdout, models, format)
+}
+
+// handleVerify checks that the model of the provider answers a minimal prompt.
+func handleVerify(l golog.MyLogger, kind llm.ProviderKind, model string, timeout int) error {
+	provider, err := llm.NewProviderWithConfig(llm.ProviderConfig{Kind: kind, Model: model, Timeout: time.Duration(timeout) * time.Second}, l)
+	if err != nil {
+		return fmt.Errorf("error creating provider %s: %w", kind, err)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	l.Info("Verifying model '%s' of provider %s...", model, kind)
+	if err := llm.Verify(ctx, provider, model); err != nil {
+		return err
+	}
+	fmt.Printf("✅ provider %s model %s is working\n", kind, model)
 	return nil
 }
 
@@ -178,7 +224,7 @@ func run(l golog.MyLogger, params argumentsToBasicQuery, out io.Writer) error {
 		l.Info("using default model for provider: %s", modelToUse)
 	}
 
-	provider, err := llm.NewProvider(kind, modelToUse, l)
+	provider, err := llm.NewProviderWithConfig(llm.ProviderConfig{Kind: kind, Model: modelToUse, Timeout: time.Duration(params.Timeout) * time.Second}, l)
 	if err != nil {
 		return fmt.Errorf("💥💥 error creating provider '%s': %v", params.Provider, err)
 	}
@@ -186,7 +232,7 @@ func run(l golog.MyLogger, params argumentsToBasicQuery, out io.Writer) error {
 	// 4. Add model validation logic before querying
 	timeoutForListing := time.Duration(params.Timeout) * time.Second
 	l.Info("Validating model '%s' with provider...", modelToUse)
-	modelsList, err := llm.GetModelsList(l, provider, timeoutForListing)
+	modelsList, err := llm.GetModelsListCached(l, provider, timeoutForListing, false)
 	if err != nil {
 		return fmt.Errorf("error getting list of models for provider %s. err: %w", params.Provider, err)
 	}
@@ -205,6 +251,8 @@ func run(l golog.MyLogger, params argumentsToBasicQuery, out io.Writer) error {
 		Temperature: temperature,
 		Stream:      params.Streaming,
 	}
+	// counted with the token counter registered for the provider, if any, and the default heuristic otherwise
+	l.Info("prompt of ~%d tokens", llm.TokenEstimatorForProvider(kind, modelToUse).EstimateMessages(req.Messages))
 	timeoutDuration := time.Duration(params.Timeout) * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
 	defer cancel()
@@ -212,15 +260,12 @@ func run(l golog.MyLogger, params argumentsToBasicQuery, out io.Writer) error {
 	if params.Streaming {
 		l.Info("Sending prompt to %s LLM (streaming)...\n", params.Provider)
 		fmt.Fprintln(out, "\nLLM Response (Streaming):")
-		// Call the decoupled StreamQuery function to get a channel of deltas.
-		deltaChan, err := llm.StreamQuery(ctx, provider, req)
-		if err != nil {
-			return fmt.Errorf("error starting LLM stream: %w", err)
-		}
-		// Range over the channel to process each delta as it arrives.
-		// This loop will automatically end when the channel is closed by StreamQuery.
-		for delta := range deltaChan {
-			fmt.Fprint(out, delta.Text)
+		// The reader blocks until the next text delta arrives and returns io.EOF once the stream is done.
+		reader := llm.NewStreamReader(ctx, provider, req)
+		defer reader.Close()
+		if _, err := io.Copy(out, reader); err != nil {
+			fmt.Fprintln(out)
+			return fmt.Errorf("error during LLM stream: %w", err)
 		}
 		fmt.Fprintln(out) // Add a final newline for clean output
 	} else {
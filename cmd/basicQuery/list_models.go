@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lao-tseu-is-alive/go-ai-llm-query/pkg/llm"
+)
+
+// output formats of -list-models, chosen with the -format flag
+const (
+	listFormatList     = "list"
+	listFormatTable    = "table"
+	listFormatCSV      = "csv"
+	listFormatMarkdown = "markdown"
+	listFormatJSON     = "json"
+)
+
+var listFormats = []string{listFormatList, listFormatTable, listFormatCSV, listFormatMarkdown, listFormatJSON}
+
+// modelColumn is a column of the table, csv and markdown formats.
+type modelColumn struct {
+	header string
+	value  func(m llm.ModelInfo) string
+}
+
+// yesNo renders the feature flags of the tables, left empty when unsupported to keep them readable.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return ""
+}
+
+// orEmpty renders the numbers of the tables, left empty when unknown (zero).
+func orEmpty[T int | int64 | float64](v T, format func(T) string) string {
+	if v == 0 {
+		return ""
+	}
+	return format(v)
+}
+
+var modelColumns = []modelColumn{
+	{"Name", func(m llm.ModelInfo) string { return m.Name }},
+	{"Family", func(m llm.ModelInfo) string { return m.Family }},
+	{"ParameterSize", func(m llm.ModelInfo) string { return m.ParameterSize }},
+	{"ContextSize", func(m llm.ModelInfo) string { return orEmpty(m.ContextSize, strconv.Itoa) }},
+	{"Size", func(m llm.ModelInfo) string {
+		return orEmpty(m.Size, func(v int64) string { return strconv.FormatInt(v, 10) })
+	}},
+	{"SupportsTools", func(m llm.ModelInfo) string { return yesNo(m.SupportsTools) }},
+	{"SupportsThinking", func(m llm.ModelInfo) string { return yesNo(m.SupportsThinking) }},
+	{"SupportsInputImage", func(m llm.ModelInfo) string { return yesNo(m.SupportsInputImage) }},
+	{"SupportsStreaming", func(m llm.ModelInfo) string { return yesNo(m.SupportsStreaming) }},
+	{"SupportsJSONMode", func(m llm.ModelInfo) string { return yesNo(m.SupportsJSONMode) }},
+	{"SupportsStructured", func(m llm.ModelInfo) string { return yesNo(m.SupportsStructured) }},
+	{"InputCostPer1M", func(m llm.ModelInfo) string {
+		return orEmpty(m.InputCostPer1M, func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) })
+	}},
+	{"OutputCostPer1M", func(m llm.ModelInfo) string {
+		return orEmpty(m.OutputCostPer1M, func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) })
+	}},
+}
+
+// writeModels renders models to out in format, one of listFormats.
+func writeModels(out io.Writer, models []llm.ModelInfo, format string) error {
+	headers := make([]string, len(modelColumns))
+	for i, c := range modelColumns {
+		headers[i] = c.header
+	}
+	row := func(m llm.ModelInfo) []string {
+		cells := make([]string, len(modelColumns))
+		for i, c := range modelColumns {
+			cells[i] = c.value(m)
+		}
+		return cells
+	}
+
+	switch format {
+	case listFormatList:
+		fmt.Fprintln(out, "Available models:")
+		for _, m := range models {
+			fmt.Fprintf(out, "- %s\n", m.Name)
+		}
+	case listFormatJSON:
+		jsonBytes, err := json.MarshalIndent(models, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal models to JSON: %w", err)
+		}
+		fmt.Fprintln(out, string(jsonBytes))
+	case listFormatTable:
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+		for _, m := range models {
+			fmt.Fprintln(w, strings.Join(row(m), "\t"))
+		}
+		return w.Flush()
+	case listFormatCSV:
+		w := csv.NewWriter(out)
+		w.Write(headers)
+		for _, m := range models {
+			w.Write(row(m))
+		}
+		w.Flush()
+		return w.Error()
+	case listFormatMarkdown:
+		// a GitHub table, the pipes of the cells are escaped so they don't split the columns
+		escape := strings.NewReplacer("|", `\|`, "\n", " ")
+		writeRow := func(cells []string) {
+			for i := range cells {
+				cells[i] = escape.Replace(cells[i])
+			}
+			fmt.Fprintf(out, "| %s |\n", strings.Join(cells, " | "))
+		}
+		writeRow(headers)
+		separators := make([]string, len(headers))
+		for i := range separators {
+			separators[i] = "---"
+		}
+		writeRow(separators)
+		for _, m := range models {
+			writeRow(row(m))
+		}
+	default:
+		return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(listFormats, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-ai-llm-query/pkg/llm"
+)
+
+func TestWriteModels(t *testing.T) {
+	models := []llm.ModelInfo{
+		{Name: "qwen3:latest", Family: "qwen3", ParameterSize: "8.2B", ContextSize: 40960, SupportsTools: true, SupportsStreaming: true},
+		{Name: "odd|name", InputCostPer1M: 0.15, OutputCostPer1M: 0.6},
+	}
+	render := func(t *testing.T, format string) string {
+		var out bytes.Buffer
+		if err := writeModels(&out, models, format); err != nil {
+			t.Fatalf("writeModels failed: %v", err)
+		}
+		return out.String()
+	}
+
+	t.Run("List", func(t *testing.T) {
+		if got := render(t, listFormatList); got != "Available models:\n- qwen3:latest\n- odd|name\n" {
+			t.Errorf("Expected the plain list of names, got %q", got)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var got []llm.ModelInfo
+		if err := json.Unmarshal([]byte(render(t, listFormatJSON)), &got); err != nil || len(got) != 2 || got[0].ContextSize != 40960 {
+			t.Errorf("Expected the models as JSON, got %#v (%v)", got, err)
+		}
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		records, err := csv.NewReader(strings.NewReader(render(t, listFormatCSV))).ReadAll()
+		if err != nil {
+			t.Fatalf("Expected a valid CSV, got %v", err)
+		}
+		if len(records) != 3 || records[0][0] != "Name" || records[0][5] != "SupportsTools" {
+			t.Fatalf("Expected a header and 2 rows, got %v", records)
+		}
+		if row := records[1]; row[2] != "8.2B" || row[3] != "40960" || row[5] != "yes" || row[6] != "" {
+			t.Errorf("Expected the parameter size, context size and tools support of qwen3, got %v", row)
+		}
+		if row := records[2]; row[0] != "odd|name" || row[11] != "0.15" || row[12] != "0.6" {
+			t.Errorf("Expected the pricing of the second model, got %v", row)
+		}
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(render(t, listFormatMarkdown)), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("Expected a header, a separator and 2 rows, got %q", lines)
+		}
+		columns := len(modelColumns)
+		if !strings.HasPrefix(lines[1], "| --- |") || strings.Count(lines[1], "---") != columns {
+			t.Errorf("Expected a separator of %d columns, got %q", columns, lines[1])
+		}
+		// the escaped pipe of the model name must not add a column
+		for _, line := range lines {
+			if got := strings.Count(line, "|") - strings.Count(line, `\|`); got != columns+1 {
+				t.Errorf("Expected %d cells in %q, got %d pipes", columns, line, got)
+			}
+		}
+		if !strings.HasPrefix(lines[3], `| odd\|name |`) {
+			t.Errorf("Expected the pipe of the name to be escaped, got %q", lines[3])
+		}
+	})
+
+	t.Run("Table", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(render(t, listFormatTable)), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "Name  ") || strings.Index(lines[0], "Family") != strings.Index(lines[1], "qwen3 ") {
+			t.Errorf("Expected aligned columns, got %q", lines)
+		}
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		if err := writeModels(&bytes.Buffer{}, models, "xml"); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
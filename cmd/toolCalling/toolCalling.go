@@ -20,6 +20,7 @@ const (
 	defaultSystemPrompt = "You are a helpful weather assistant. Use tools when asked for weather data."
 	defaultPrompt       = "What's the weather right now in Lausanne in Switzerland?"
 	defaultLogName      = "stderr"
+	maxToolRounds       = 5
 )
 
 func check(err error, msg string, l golog.MyLogger) {
@@ -94,23 +95,34 @@ func main() {
 	}
 	l.Info("🚀🚀 Starting App:'%s', ver:%s, build:%s, from: %s", version.APP, version.VERSION, version.BuildStamp, version.REPOSITORY)
 
+	// the config file gives the default provider, model and base URLs, see config.LoadCLIConfig for the precedence
+	cliConfig, err := config.LoadDefaultCLIConfig()
+	if err == nil {
+		err = cliConfig.ApplyBaseURLs()
+	}
+	if err != nil {
+		l.Error("💥💥 %v", err)
+		os.Exit(1)
+	}
+
 	// Define command-line flags for provider selection and prompt
-	providerFlag := flag.String("provider", "openai", "Provider to use (ollama, gemini, xai, openai, openrouter)")
+	providerFlag := flag.String("provider", llm.FirstNonEmpty(cliConfig.Provider, "openai"), "Provider to use (ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere)")
 	systemRoleFlag := flag.String("system", defaultSystemPrompt, "The system prompt, it default here to a weather assistant")
 	promptFlag := flag.String("prompt", defaultPrompt, "The prompt to send to the LLM")
 	flag.Parse()
 
 	if *promptFlag == "" {
 		fmt.Println("Usage: go run basicQuery.go -provider=<provider> -prompt='your prompt'")
-		fmt.Println("Available providers: ollama, gemini, xai, openai, openrouter")
+		fmt.Println("Available providers: ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere")
 		os.Exit(1)
 	}
 
 	kind, model, err := llm.GetProviderKindAndDefaultModel(*providerFlag)
 	if err != nil {
-		fmt.Printf("## 💥💥 Error: Unknown provider '%s'. Available: ollama, gemini, xai, openai, openrouter\n", *providerFlag)
+		fmt.Printf("## 💥💥 Error: Unknown provider '%s'. Available: ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere\n", *providerFlag)
 		os.Exit(1)
 	}
+	model = llm.FirstNonEmpty(cliConfig.ModelFor(*providerFlag), model)
 	l.Info("will create provider llm.NewProvider(kind:%s, model:%s)", kind, model)
 	provider, err := llm.NewProvider(kind, model, l)
 	if err != nil {
@@ -150,57 +162,22 @@ func main() {
 	err = convo.AddUserMessage(*promptFlag)
 	check(err, "adding user message", l)
 
-	l.Info("step 2: First API call to let the model decide on tools.")
+	l.Info("step 2: running the tool loop, the model decides on tools and gets their results until it answers.")
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	l.Info("calling LLM for tool decision", "model", model)
-	req := &llm.LLMRequest{
-		Messages:   convo.MessagesCopy(), // Use thread-safe copy from Conversation.
-		Tools:      []llm.Tool{weatherTool},
-		ToolChoice: "auto",
-	}
-	resp, err := provider.Query(ctx, req)
-	check(err, "first query", l)
-	l.Info("LLM returned first response: %s, finishReason: %s, toolsCalls: %#v", resp.Text, resp.FinishReason, resp.ToolCalls)
-	// Add the assistant's response (could include tool calls).
-	convo.AddAssistantResponse(resp)
-
-	// Step 3: If tool calls were made, execute them and collect results.
-	if len(resp.ToolCalls) > 0 {
-		for _, tc := range resp.ToolCalls {
-			l.Info("LLM returned requested tool call: %s(%s)\n", tc.Name, string(tc.Arguments))
-
-			// Execute the tool: Use the WeatherTool struct (no more undefined function).
-			tool := WeatherTool{l: l} // Instantiate the tool.
-			result, err := tool.Execute(tc.Arguments)
-			if err != nil {
-				result = fmt.Sprintf(`{"error": %q}`, err.Error()) // JSON-safe error response.
-				l.Warn("Tool execution failed", "tool", tc.Name, "error", err)
-			}
-			l.Info("Result of tool call %s(%s): %v\n", tc.Name, string(tc.Arguments), result)
-
-			// Add the tool's result back to the conversation.
-			convo.AddToolResultMessage(tc.ID, result)
+	registry := llm.ExampleToolRegistry{"get_current_weather": WeatherTool{l: l}}
+	result, err := llm.RunToolLoopWithTrace(ctx, provider, convo, []llm.Tool{weatherTool}, registry, maxToolRounds)
+	check(err, "tool loop", l)
+	for _, step := range result.Trace {
+		if step.Err != nil {
+			l.Warn("Tool execution failed, tool: %s, error: %v", step.ToolCall.Name, step.Err)
 		}
-
-		l.Info("step 4: Second API call with tool results for the final response.")
-		l.Info("Calling LLM for final answer with tool results")
-		req2 := &llm.LLMRequest{
-			Model:    "gpt-4o-mini",
-			Messages: convo.MessagesCopy(),    // Safe copy again.
-			Tools:    []llm.Tool{weatherTool}, // Include tools if needed for consistency.
-		}
-		resp2, err := provider.Query(ctx, req2)
-		check(err, "second query", l)
-
-		l.Info("\nAssistant's Final Response:")
-		fmt.Println(resp2.Text)
-	} else {
-		// No tool calls: Just print the direct response.
-		l.Info("\nAssistant's Direct Response (no tool calls):")
-		fmt.Println(resp.Text)
+		l.Info("Result of tool call %s(%s): %v\n", step.ToolCall.Name, string(step.ToolCall.Arguments), step.Result)
 	}
 
+	l.Info("\nAssistant's Final Response (after %d tool round(s)):", result.Rounds)
+	fmt.Println(result.Response.Text)
+
 	l.Info("Tool calling example completed successfully")
 }
@@ -5,6 +5,7 @@ go 1.25.0
 require (
 	github.com/google/uuid v1.6.0
 	github.com/lao-tseu-is-alive/go-cloud-k8s-common v0.5.3
+	golang.org/x/oauth2 v0.34.0
 )
 
 require (
@@ -5,6 +5,7 @@ import (
 	"log/slog" // Use slog for optional, structured logging
 	"net/url"
 	"os"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
@@ -13,7 +14,16 @@ import (
 const minKeyLength = 35
 
 func getApiKey(envVar, providerName string) (string, error) {
-	apiKey, exists := os.LookupEnv(envVar)
+	return getApiKeyWithMinLength(envVar, providerName, minKeyLength)
+}
+
+// getApiKeyWithMinLength returns the key of envVar from the secrets file of LLM_SECRETS_FILE or the environment,
+// checking it has at least minKeyLength characters. The key value is never logged nor included in the errors.
+func getApiKeyWithMinLength(envVar, providerName string, minKeyLength int) (string, error) {
+	apiKey, exists, err := lookupSecret(envVar)
+	if err != nil {
+		return "", err
+	}
 	if !exists {
 		slog.Error(fmt.Sprintf("%s API key not set", providerName), "env_var", envVar)
 		return "", fmt.Errorf("%s API key not set", providerName)
@@ -45,13 +55,49 @@ func GetOpenRouterApiKey() (string, error) {
 	return getApiKey("OPENROUTER_API_KEY", "OpenRouter")
 }
 
+// GetMistralApiKey returns the Mistral API key from the environment.
+func GetMistralApiKey() (string, error) {
+	return getApiKey("MISTRAL_API_KEY", "Mistral")
+}
+
+// GetDeepSeekApiKey returns the DeepSeek API key from the environment.
+func GetDeepSeekApiKey() (string, error) {
+	return getApiKey("DEEPSEEK_API_KEY", "DeepSeek")
+}
+
+// GetGroqApiKey returns the Groq API key from the environment.
+func GetGroqApiKey() (string, error) {
+	return getApiKey("GROQ_API_KEY", "Groq")
+}
+
+// GetCohereApiKey returns the Cohere API key from the environment.
+func GetCohereApiKey() (string, error) {
+	return getApiKey("COHERE_API_KEY", "Cohere")
+}
+
+// azureMinKeyLength is the length of the legacy 32 hex characters Azure OpenAI keys, shorter than minKeyLength.
+const azureMinKeyLength = 32
+
+// GetAzureOpenAIApiKey returns the Azure OpenAI API key from the environment.
+func GetAzureOpenAIApiKey() (string, error) {
+	return getApiKeyWithMinLength("AZURE_OPENAI_API_KEY", "Azure OpenAI", azureMinKeyLength)
+}
+
+// NormalizeBaseURL trims surrounding spaces and trailing slashes from a base URL,
+// so that concatenating it with an endpoint like "/chat/completions" never produces "//".
+// A path suffix like "/v1" is kept as is.
+func NormalizeBaseURL(baseURL string) string {
+	return strings.TrimRight(strings.TrimSpace(baseURL), "/")
+}
+
 // GetApiBase retrieves a base URL from a given environment variable.
 // It validates that the URL is well-formed. If the environment variable is not set,
 // is empty, or contains an invalid URL, it logs a warning and returns the
-// provided defaultURL as a safe fallback.
+// provided defaultURL as a safe fallback. The returned URL is normalized with NormalizeBaseURL.
 func GetApiBase(envVar, defaultURL string, l golog.MyLogger) string {
+	defaultURL = NormalizeBaseURL(defaultURL)
 	// 1. Get the URL from the environment variable.
-	envURL := os.Getenv(envVar)
+	envURL := NormalizeBaseURL(os.Getenv(envVar))
 	// 2. If the environment variable is not set, use the default.
 	if envURL == "" {
 		return defaultURL
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"io"
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
 )
 
 func TestGetApiKey(t *testing.T) {
@@ -53,3 +56,31 @@ func TestGetApiKey(t *testing.T) {
 		}
 	})
 }
+
+func TestGetApiBase(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	envVar := "TEST_API_BASE"
+
+	testCases := []struct {
+		name       string
+		envValue   string
+		defaultURL string
+		expected   string
+	}{
+		{"UnsetUsesDefault", "", "https://api.openai.com/v1", "https://api.openai.com/v1"},
+		{"DefaultWithTrailingSlash", "", "http://localhost:11434/", "http://localhost:11434"},
+		{"WithV1Suffix", "https://api.x.ai/v1", "https://default/v1", "https://api.x.ai/v1"},
+		{"WithV1SuffixAndTrailingSlash", "https://api.x.ai/v1/", "https://default/v1", "https://api.x.ai/v1"},
+		{"WithoutSuffixAndTrailingSlashes", "http://localhost:11434//", "https://default", "http://localhost:11434"},
+		{"InvalidFallsBackToDefault", "not a url", "https://default/v1/", "https://default/v1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envVar, tc.envValue)
+			if got := GetApiBase(envVar, tc.defaultURL, l); got != tc.expected {
+				t.Errorf("Expected '%s', but got '%s'", tc.expected, got)
+			}
+		})
+	}
+}
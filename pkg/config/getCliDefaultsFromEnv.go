@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetDefaultProvider returns the provider to use by default in the CLIs from the env variable :
+// LLM_PROVIDER : the provider name (ollama, gemini, xai, openai, openrouter, mistral, deepseek, groq, azure, cohere), if unset or empty defaultProvider is returned
+func GetDefaultProvider(defaultProvider string) string {
+	val := strings.TrimSpace(os.Getenv("LLM_PROVIDER"))
+	if val == "" {
+		return defaultProvider
+	}
+	return val
+}
+
+// GetDefaultTimeout returns the request timeout to use by default in the CLIs from the env variable :
+// LLM_TIMEOUT : a duration like "90s" or "5m", or a number of seconds like "120", if unset or empty defaultTimeout is returned
+// Returns an error if the value is not a valid positive duration.
+func GetDefaultTimeout(defaultTimeout time.Duration) (time.Duration, error) {
+	val := strings.TrimSpace(os.Getenv("LLM_TIMEOUT"))
+	if val == "" {
+		return defaultTimeout, nil
+	}
+	timeout, err := time.ParseDuration(val)
+	if err != nil {
+		seconds, errAtoi := strconv.Atoi(val)
+		if errAtoi != nil {
+			return 0, fmt.Errorf("invalid LLM_TIMEOUT %q, expected a duration like 90s or a number of seconds: %w", val, err)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid LLM_TIMEOUT %q, it must be positive", val)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDefaultProvider(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "")
+	if got := GetDefaultProvider("ollama"); got != "ollama" {
+		t.Errorf("Expected default 'ollama', got '%s'", got)
+	}
+	t.Setenv("LLM_PROVIDER", " gemini ")
+	if got := GetDefaultProvider("ollama"); got != "gemini" {
+		t.Errorf("Expected 'gemini' from env, got '%s'", got)
+	}
+}
+
+func TestGetDefaultTimeout(t *testing.T) {
+	testCases := []struct {
+		name     string
+		envValue string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"UnsetUsesDefault", "", 90 * time.Second, false},
+		{"Duration", "5m", 5 * time.Minute, false},
+		{"Seconds", "120", 120 * time.Second, false},
+		{"Invalid", "soon", 0, true},
+		{"Negative", "-1s", 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("LLM_TIMEOUT", tc.envValue)
+			got, err := GetDefaultTimeout(90 * time.Second)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil || got != tc.expected {
+				t.Errorf("Expected %s, got %s (err: %v)", tc.expected, got, err)
+			}
+		})
+	}
+}
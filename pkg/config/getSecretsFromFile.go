@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretsFileEnvVar is the env variable giving the path of a file holding all the provider keys,
+// e.g. a secret mounted in a container, consulted before the individual env variables.
+const SecretsFileEnvVar = "LLM_SECRETS_FILE"
+
+// lookupSecret returns the value of the secret name (e.g. OPENAI_API_KEY) from the secrets file of LLM_SECRETS_FILE
+// when it defines it, and from the env variable of the same name otherwise.
+// It returns an error when the secrets file is set but cannot be loaded, never including any secret value.
+func lookupSecret(name string) (string, bool, error) {
+	if path := strings.TrimSpace(os.Getenv(SecretsFileEnvVar)); path != "" {
+		secrets, err := LoadSecretsFile(path)
+		if err != nil {
+			return "", false, err
+		}
+		if value, ok := secrets[name]; ok {
+			return value, true, nil
+		}
+	}
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+// LoadSecretsFile reads the secrets of path, either a JSON object of strings like {"OPENAI_API_KEY": "..."}
+// or a dotenv file with a KEY=value per line (empty lines, # comments, "export " prefixes and quotes are allowed).
+func LoadSecretsFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading secrets file %s: %w", path, err)
+	}
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		secrets := map[string]string{}
+		if err := json.Unmarshal(trimmed, &secrets); err != nil {
+			// the error of encoding/json never quotes the values, only their type and offset
+			return nil, fmt.Errorf("error parsing JSON secrets file %s: %w", path, err)
+		}
+		return secrets, nil
+	}
+	return parseDotenv(path, data)
+}
+
+// parseDotenv parses the KEY=value lines of a dotenv file, the error messages only give the line numbers.
+func parseDotenv(path string, data []byte) (map[string]string, error) {
+	secrets := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid line %d in secrets file %s, expected KEY=value", lineNum, path)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		secrets[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading secrets file %s: %w", path, err)
+	}
+	return secrets, nil
+}
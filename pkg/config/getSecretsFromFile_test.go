@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetApiKeyFromSecretsFile(t *testing.T) {
+	validKey := "a_very_long_and_valid_api_key_for_testing_purposes"
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+		return path
+	}
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"secrets.env", "# LLM keys\nexport TEST_API_KEY=\"" + validKey + "\"\n\nOTHER_API_KEY=x\n"},
+		{"secrets.json", `{"TEST_API_KEY": "` + validKey + `", "OTHER_API_KEY": "x"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(SecretsFileEnvVar, writeFile(tc.name, tc.content))
+			t.Setenv("TEST_API_KEY", "the_env_variable_is_only_a_fallback_of_the_file")
+			key, err := getApiKey("TEST_API_KEY", "TestProvider")
+			if err != nil || key != validKey {
+				t.Errorf("Expected the key of the secrets file, got %q, %v", key, err)
+			}
+			_, err = getApiKey("OTHER_API_KEY", "Other")
+			if err == nil || !strings.Contains(err.Error(), "at least") {
+				t.Errorf("Expected the length validation of the secrets file keys, got %v", err)
+			}
+		})
+	}
+
+	t.Run("FallbackToEnv", func(t *testing.T) {
+		t.Setenv(SecretsFileEnvVar, writeFile("other.env", "OTHER_API_KEY=x\n"))
+		t.Setenv("TEST_API_KEY", validKey)
+		if key, err := getApiKey("TEST_API_KEY", "TestProvider"); err != nil || key != validKey {
+			t.Errorf("Expected the key of the env variable, got %q, %v", key, err)
+		}
+	})
+
+	t.Run("InvalidFileDoesNotLeakSecrets", func(t *testing.T) {
+		t.Setenv(SecretsFileEnvVar, writeFile("invalid.env", "TEST_API_KEY="+validKey+"\n"+validKey+"\n"))
+		_, err := getApiKey("TEST_API_KEY", "TestProvider")
+		if err == nil || !strings.Contains(err.Error(), "line 2") || strings.Contains(err.Error(), validKey) {
+			t.Errorf("Expected an error on line 2 without the secret, got %v", err)
+		}
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		t.Setenv(SecretsFileEnvVar, filepath.Join(dir, "missing.env"))
+		if _, err := getApiKey("TEST_API_KEY", "TestProvider"); err == nil {
+			t.Error("Expected an error for a missing secrets file, got nil")
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CLIConfigEnvVar is the env variable giving the path of the CLI config file, instead of the default
+// ~/.go-ai-llm-query.yaml (or ~/.go-ai-llm-query.json).
+const CLIConfigEnvVar = "LLM_CONFIG_FILE"
+
+// cliConfigBaseName is the name of the default CLI config file in the home directory, without extension
+const cliConfigBaseName = ".go-ai-llm-query"
+
+// baseURLEnvVars gives the env variable of the base URL of each provider, as read by llm.NewProvider
+var baseURLEnvVars = map[string]string{
+	"openai":     "OPENAI_API_BASE",
+	"openrouter": "OPENROUTER_API_BASE",
+	"gemini":     "GEMINI_API_BASE",
+	"xai":        "XAI_API_BASE",
+	"mistral":    "MISTRAL_API_BASE",
+	"deepseek":   "DEEPSEEK_API_BASE",
+	"groq":       "GROQ_API_BASE",
+	"azure":      "AZURE_OPENAI_ENDPOINT",
+	"cohere":     "COHERE_API_BASE",
+	"ollama":     "OLLAMA_API_BASE",
+}
+
+// CLIConfig holds the defaults of the CLIs read from a config file. The precedence is:
+// flags > env variables > config file > hardcoded defaults, the empty fields leave the next level apply.
+type CLIConfig struct {
+	Provider     string `json:"provider,omitempty"`
+	Model        string `json:"model,omitempty"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Temperature is nil when unset, since 0 is a valid temperature
+	Temperature *float64 `json:"temperature,omitempty"`
+	// BaseURLs gives the base URL of providers by name (ollama, openai, azure, ...), used unless their env variable is set
+	BaseURLs map[string]string `json:"base_urls,omitempty"`
+}
+
+// LoadCLIConfig reads the CLI config of path, either a JSON object like {"provider": "ollama", "temperature": 0.3}
+// or a YAML file of "key: value" lines, with the base URLs indented under a "base_urls:" line:
+//
+//	provider: ollama
+//	model: qwen3:latest
+//	system_prompt: "You are a helpful assistant"
+//	temperature: 0.3
+//	base_urls:
+//	  ollama: http://gpu-box:11434
+//
+// Only this YAML subset is supported: a multi-line system prompt is written as a double-quoted string with \n escapes,
+// the block scalars (| and >) are rejected. Unknown keys and providers are rejected, to catch the typos.
+func LoadCLIConfig(path string) (*CLIConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	cfg := &CLIConfig{}
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("error parsing JSON config file %s: %w", path, err)
+		}
+	} else if err := parseCLIConfigYAML(path, data, cfg); err != nil {
+		return nil, err
+	}
+	if _, ok := baseURLEnvVars[strings.ToLower(cfg.Provider)]; cfg.Provider != "" && !ok {
+		return nil, fmt.Errorf("unknown provider %q in config file %s", cfg.Provider, path)
+	}
+	for name := range cfg.BaseURLs {
+		if _, ok := baseURLEnvVars[name]; !ok {
+			return nil, fmt.Errorf("unknown provider %q in base_urls of config file %s", name, path)
+		}
+	}
+	return cfg, nil
+}
+
+// parseCLIConfigYAML parses the YAML subset described by LoadCLIConfig.
+func parseCLIConfigYAML(path string, data []byte, cfg *CLIConfig) error {
+	inBaseURLs := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return fmt.Errorf("invalid line %d in config file %s, expected key: value", lineNum, path)
+		}
+		if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "|") || strings.HasPrefix(trimmed, ">") {
+			return fmt.Errorf("unsupported block scalar for %s line %d in config file %s, write the value on one double-quoted line with \\n escapes", key, lineNum, path)
+		}
+		value = yamlScalar(value)
+		if indented := raw[0] == ' ' || raw[0] == '\t'; indented {
+			if !inBaseURLs {
+				return fmt.Errorf("invalid indentation line %d in config file %s, only base_urls has nested keys", lineNum, path)
+			}
+			cfg.BaseURLs[key] = value
+			continue
+		}
+		inBaseURLs = false
+		switch key {
+		case "provider":
+			cfg.Provider = value
+		case "model":
+			cfg.Model = value
+		case "system_prompt":
+			cfg.SystemPrompt = value
+		case "temperature":
+			temperature, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid temperature line %d in config file %s: %w", lineNum, path, err)
+			}
+			cfg.Temperature = &temperature
+		case "base_urls":
+			if value != "" {
+				return fmt.Errorf("invalid base_urls line %d in config file %s, expected the URLs on the next lines", lineNum, path)
+			}
+			inBaseURLs = true
+			cfg.BaseURLs = map[string]string{}
+		default:
+			return fmt.Errorf("unknown key %q line %d in config file %s", key, lineNum, path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// yamlScalar returns the value of a YAML scalar, without its quotes or its trailing comment when unquoted.
+func yamlScalar(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+		}
+		return value[1 : len(value)-1]
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// LoadDefaultCLIConfig loads the CLI config file of LLM_CONFIG_FILE, or else ~/.go-ai-llm-query.yaml
+// or ~/.go-ai-llm-query.json when it exists. It returns an empty config when there is no config file,
+// and an error when the file of LLM_CONFIG_FILE is missing or a config file is invalid.
+func LoadDefaultCLIConfig() (*CLIConfig, error) {
+	if path := strings.TrimSpace(os.Getenv(CLIConfigEnvVar)); path != "" {
+		return LoadCLIConfig(path)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return &CLIConfig{}, nil
+	}
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		path := filepath.Join(home, cliConfigBaseName+ext)
+		if _, err := os.Stat(path); err == nil {
+			return LoadCLIConfig(path)
+		}
+	}
+	return &CLIConfig{}, nil
+}
+
+// ApplyBaseURLs sets the base URL env variables of the providers (e.g. OLLAMA_API_BASE) from BaseURLs,
+// except those already set in the environment, which take precedence over the config file.
+func (c *CLIConfig) ApplyBaseURLs() error {
+	for name, url := range c.BaseURLs {
+		envVar := baseURLEnvVars[name]
+		if envVar == "" {
+			return fmt.Errorf("unknown provider %q in base_urls", name)
+		}
+		if strings.TrimSpace(os.Getenv(envVar)) != "" {
+			continue
+		}
+		if err := os.Setenv(envVar, url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTemperature returns the temperature of the config file, or defaultTemperature when unset.
+func (c *CLIConfig) GetTemperature(defaultTemperature float64) float64 {
+	if c.Temperature == nil {
+		return defaultTemperature
+	}
+	return *c.Temperature
+}
+
+// ModelFor returns the model of the config file when provider is its provider (or it has none),
+// so that a model of the file isn't sent to another provider chosen with a flag. It returns "" otherwise.
+func (c *CLIConfig) ModelFor(provider string) string {
+	if c.Provider == "" || strings.EqualFold(c.Provider, provider) {
+		return c.Model
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCLIConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+		return path
+	}
+	temperature := 0.3
+	want := &CLIConfig{
+		Provider:     "ollama",
+		Model:        "qwen3:latest",
+		SystemPrompt: "You are a helpful # assistant",
+		Temperature:  &temperature,
+		BaseURLs:     map[string]string{"ollama": "http://gpu-box:11434"},
+	}
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{"config.yaml", "# CLI defaults\nprovider: ollama\nmodel: qwen3:latest # the local default\n" +
+			"system_prompt: \"You are a helpful # assistant\"\ntemperature: 0.3\nbase_urls:\n  ollama: http://gpu-box:11434\n"},
+		{"config.json", `{"provider": "ollama", "model": "qwen3:latest", "system_prompt": "You are a helpful # assistant",
+			"temperature": 0.3, "base_urls": {"ollama": "http://gpu-box:11434"}}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := LoadCLIConfig(writeFile(tc.name, tc.content))
+			if err != nil {
+				t.Fatalf("LoadCLIConfig failed: %v", err)
+			}
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("Expected %+v, got %+v", want, cfg)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name    string
+		content string
+	}{
+		{"unknown_key.yaml", "providr: ollama\n"},
+		{"unknown_key.json", `{"providr": "ollama"}`},
+		{"bad_temperature.yaml", "temperature: warm\n"},
+		{"unknown_provider.yaml", "base_urls:\n  olama: http://localhost:11434\n"},
+		{"nested_key.yaml", "model:\n  name: qwen3\n"},
+		{"unknown_config_provider.yaml", "provider: olama\n"},
+		{"unknown_config_provider.json", `{"provider": "olama"}`},
+		{"literal_block_scalar.yaml", "system_prompt: |\n  You are a helpful assistant.\n  Be brief.\n"},
+		{"folded_block_scalar.yaml", "system_prompt: >-\n  You are a helpful assistant.\n"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := LoadCLIConfig(writeFile(tc.name, tc.content)); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestCLIConfigPrecedence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(CLIConfigEnvVar, "")
+	cfg, err := LoadDefaultCLIConfig()
+	if err != nil || !reflect.DeepEqual(cfg, &CLIConfig{}) {
+		t.Fatalf("Expected an empty config without config file, got %+v, %v", cfg, err)
+	}
+	if got := cfg.GetTemperature(0.2); got != 0.2 {
+		t.Errorf("Expected the hardcoded temperature, got %v", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "cli.yaml")
+	if err := os.WriteFile(path, []byte("provider: ollama\nmodel: qwen3\ntemperature: 0\nbase_urls:\n  ollama: http://file:11434\n  groq: http://file-groq\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(CLIConfigEnvVar, path)
+	cfg, err = LoadDefaultCLIConfig()
+	if err != nil {
+		t.Fatalf("LoadDefaultCLIConfig failed: %v", err)
+	}
+	if got := cfg.GetTemperature(0.2); got != 0 {
+		t.Errorf("Expected the zero temperature of the file, got %v", got)
+	}
+	if cfg.ModelFor("ollama") != "qwen3" || cfg.ModelFor("openai") != "" {
+		t.Errorf("Expected the model of the file only for its provider, got %q and %q", cfg.ModelFor("ollama"), cfg.ModelFor("openai"))
+	}
+
+	t.Setenv("OLLAMA_API_BASE", "http://env:11434")
+	t.Setenv("GROQ_API_BASE", "")
+	if err := cfg.ApplyBaseURLs(); err != nil {
+		t.Fatalf("ApplyBaseURLs failed: %v", err)
+	}
+	if got := os.Getenv("OLLAMA_API_BASE"); got != "http://env:11434" {
+		t.Errorf("Expected the env variable to take precedence over the file, got %q", got)
+	}
+	if got := os.Getenv("GROQ_API_BASE"); got != "http://file-groq" {
+		t.Errorf("Expected the base URL of the file, got %q", got)
+	}
+	if got := GetDefaultProvider(cfg.Provider); got != "ollama" {
+		t.Errorf("Expected the provider of the file without LLM_PROVIDER, got %q", got)
+	}
+	t.Setenv("LLM_PROVIDER", "groq")
+	if got := GetDefaultProvider(cfg.Provider); got != "groq" {
+		t.Errorf("Expected LLM_PROVIDER to take precedence over the file, got %q", got)
+	}
+
+	t.Setenv(CLIConfigEnvVar, filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := LoadDefaultCLIConfig(); err == nil {
+		t.Error("Expected an error for a missing LLM_CONFIG_FILE, got nil")
+	}
+}
@@ -0,0 +1,265 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AuditLogger records every request sent by a provider and the matching response or error,
+// for persistent audit trails. It is distinct from the debug logging and is set with ProviderConfig.AuditLogger.
+// Implementations must be safe for concurrent use and must not modify the request or the response.
+type AuditLogger interface {
+	LogRequest(req *LLMRequest)
+	LogResponse(resp *LLMResponse, err error)
+}
+
+// NoopAuditLogger is the default AuditLogger, discarding everything.
+type NoopAuditLogger struct{}
+
+func (NoopAuditLogger) LogRequest(*LLMRequest)          {}
+func (NoopAuditLogger) LogResponse(*LLMResponse, error) {}
+
+// auditLoggerOrNoop returns a, or a NoopAuditLogger when a is nil.
+func auditLoggerOrNoop(a AuditLogger) AuditLogger {
+	if a == nil {
+		return NoopAuditLogger{}
+	}
+	return a
+}
+
+// AuditRedaction selects what is removed from the audit entries, token counts and metadata are always kept.
+type AuditRedaction struct {
+	// MessageContent drops the content and reasoning of the request messages, and every content of the response:
+	// text, reasoning, parts, choices, log probabilities, original text, sent messages and raw body
+	MessageContent bool
+	// ToolArguments drops the arguments of the tool calls, in the request messages and in the response
+	// (choices and sent messages included)
+	ToolArguments bool
+	// Fields drops top level fields of the logged request and response by their JSON name, e.g. "tools"
+	Fields []string
+}
+
+// redactedValue replaces the dropped strings, so that the entries still show that there was a value.
+const redactedValue = "[REDACTED]"
+
+// redactToolCalls returns a copy of calls without their arguments.
+func redactToolCalls(calls []ToolCall) []ToolCall {
+	redacted := slices.Clone(calls)
+	for i := range redacted {
+		redacted[i].Arguments = nil
+	}
+	return redacted
+}
+
+// request returns a redacted copy of req.
+func (r AuditRedaction) request(req *LLMRequest) *LLMRequest {
+	redacted := *req
+	redacted.Messages = r.messages(req.Messages)
+	return &redacted
+}
+
+// messages returns a redacted copy of msgs.
+func (r AuditRedaction) messages(msgs []LLMMessage) []LLMMessage {
+	redacted := slices.Clone(msgs)
+	for i := range redacted {
+		msg := &redacted[i]
+		if r.MessageContent {
+			if msg.Content != "" {
+				msg.Content = redactedValue
+			}
+			if msg.Reasoning != "" {
+				msg.Reasoning = redactedValue
+			}
+		}
+		if r.ToolArguments {
+			msg.ToolCalls = redactToolCalls(msg.ToolCalls)
+		}
+	}
+	return redacted
+}
+
+// response returns a redacted copy of resp.
+func (r AuditRedaction) response(resp *LLMResponse) *LLMResponse {
+	redacted := *resp
+	redacted.SentMessages = r.messages(resp.SentMessages)
+	redacted.Choices = slices.Clone(resp.Choices)
+	for i := range redacted.Choices {
+		choice := &redacted.Choices[i]
+		if r.MessageContent {
+			if choice.Text != "" {
+				choice.Text = redactedValue
+			}
+			choice.LogProbs = nil
+		}
+		if r.ToolArguments {
+			choice.ToolCalls = redactToolCalls(choice.ToolCalls)
+		}
+	}
+	if r.MessageContent {
+		if redacted.Text != "" {
+			redacted.Text = redactedValue
+		}
+		if redacted.Reasoning != "" {
+			redacted.Reasoning = redactedValue
+		}
+		if redacted.OriginalText != "" {
+			redacted.OriginalText = redactedValue
+		}
+		redacted.Parts = nil
+		redacted.LogProbs = nil
+		redacted.Raw = nil
+	}
+	if r.ToolArguments {
+		redacted.ToolCalls = redactToolCalls(resp.ToolCalls)
+		redacted.Raw = nil
+	}
+	return &redacted
+}
+
+// marshal returns v as JSON without the redacted top level Fields.
+func (r AuditRedaction) marshal(v any) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(r.Fields) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, field := range r.Fields {
+		delete(fields, field)
+	}
+	return json.Marshal(fields)
+}
+
+// auditEntry is a line of the JSONL audit log.
+type auditEntry struct {
+	Time     time.Time       `json:"time"`
+	Type     string          `json:"type"` // "request" or "response"
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// JSONLAuditLogger is an AuditLogger writing one JSON object per line, a "request" or a "response" entry.
+type JSONLAuditLogger struct {
+	mu        sync.Mutex
+	w         io.Writer
+	closer    io.Closer
+	redaction AuditRedaction
+	now       func() time.Time
+}
+
+// NewJSONLAuditLogger returns a JSONLAuditLogger writing to w with the given redaction.
+func NewJSONLAuditLogger(w io.Writer, redaction AuditRedaction) *JSONLAuditLogger {
+	return &JSONLAuditLogger{w: w, redaction: redaction, now: time.Now}
+}
+
+// OpenJSONLAuditLogger returns a JSONLAuditLogger appending to the file at path, created if needed.
+// Close must be called to close the file.
+func OpenJSONLAuditLogger(path string, redaction AuditRedaction) (*JSONLAuditLogger, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	a := NewJSONLAuditLogger(f, redaction)
+	a.closer = f
+	return a, nil
+}
+
+// LogRequest writes a "request" entry for req.
+func (a *JSONLAuditLogger) LogRequest(req *LLMRequest) {
+	entry := auditEntry{Type: "request"}
+	if req != nil {
+		data, err := a.redaction.marshal(a.redaction.request(req))
+		if err != nil {
+			entry.Error = fmt.Sprintf("failed to marshal request: %v", err)
+		}
+		entry.Request = data
+	}
+	a.write(entry)
+}
+
+// LogResponse writes a "response" entry for resp and err.
+func (a *JSONLAuditLogger) LogResponse(resp *LLMResponse, err error) {
+	entry := auditEntry{Type: "response"}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if resp != nil {
+		data, marshalErr := a.redaction.marshal(a.redaction.response(resp))
+		if marshalErr != nil && entry.Error == "" {
+			entry.Error = fmt.Sprintf("failed to marshal response: %v", marshalErr)
+		}
+		entry.Response = data
+	}
+	a.write(entry)
+}
+
+func (a *JSONLAuditLogger) write(entry auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.Time = a.now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	a.w.Write(append(line, '\n'))
+}
+
+// Close closes the file opened by OpenJSONLAuditLogger, it does nothing for a logger created with NewJSONLAuditLogger.
+func (a *JSONLAuditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// callHooks are the ProviderConfig.OnRequest and OnResponse hooks of a provider, both can be nil.
+type callHooks struct {
+	onRequest  func(req *LLMRequest)
+	onResponse func(resp *LLMResponse, err error)
+}
+
+// hooksFromConfig returns the hooks configured in cfg.
+func hooksFromConfig(cfg ProviderConfig) callHooks {
+	return callHooks{onRequest: cfg.OnRequest, onResponse: cfg.OnResponse}
+}
+
+// auditCall runs the request hook, records req, runs call, records its outcome with a and runs the response hook.
+func auditCall(a AuditLogger, h callHooks, req *LLMRequest, call func() (*LLMResponse, error)) (*LLMResponse, error) {
+	if h.onRequest != nil && req != nil {
+		h.onRequest(req)
+	}
+	a.LogRequest(req)
+	resp, err := call()
+	a.LogResponse(resp, err)
+	if h.onResponse != nil {
+		h.onResponse(resp, err)
+	}
+	return resp, err
+}
+
+// queryFunc adapts the unaudited query of a provider to a Provider, so that the QueryAsStream
+// fallback of an audited Stream doesn't record the same call twice.
+type queryFunc func(ctx context.Context, req *LLMRequest) (*LLMResponse, error)
+
+func (f queryFunc) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return f(ctx, req)
+}
+
+func (f queryFunc) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	return QueryAsStream(ctx, f, req, onDelta)
+}
+
+func (f queryFunc) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,221 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// readAuditEntries decodes the JSONL audit log in data.
+func readAuditEntries(t *testing.T, data []byte) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Expected a JSON object per line, got %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestJSONLAuditLoggerRedaction(t *testing.T) {
+	req := &LLMRequest{
+		Model: "test-model",
+		Messages: []LLMMessage{
+			{Role: RoleUser, Content: "my secret prompt"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call-1", Name: "lookup", Arguments: []byte(`{"ssn": "123"}`)}}},
+		},
+		Tools: []Tool{{Type: "function", Function: ToolSpec{Name: "lookup"}}},
+	}
+	resp := &LLMResponse{
+		Text:      "my secret answer",
+		ToolCalls: []ToolCall{{ID: "call-2", Name: "lookup", Arguments: []byte(`{"ssn": "456"}`)}},
+		Usage:     &Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16},
+		Raw:       []byte(`{"secret": true}`),
+	}
+
+	tests := []struct {
+		name      string
+		redaction AuditRedaction
+		hidden    []string
+		visible   []string
+	}{
+		{"NoRedaction", AuditRedaction{}, nil, []string{"my secret prompt", "my secret answer", "ssn", `"total_tokens":16`}},
+		{"MessageContent", AuditRedaction{MessageContent: true}, []string{"my secret prompt", "my secret answer", `"raw"`}, []string{redactedValue, "ssn", `"total_tokens":16`}},
+		{"ToolArguments", AuditRedaction{ToolArguments: true}, []string{"ssn"}, []string{"my secret prompt", "lookup"}},
+		{"Fields", AuditRedaction{Fields: []string{"tools", "raw"}}, []string{`"tools"`, `"raw"`}, []string{"my secret prompt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			audit := NewJSONLAuditLogger(&buf, tt.redaction)
+			audit.LogRequest(req)
+			audit.LogResponse(resp, nil)
+			out := buf.String()
+			for _, s := range tt.hidden {
+				if strings.Contains(out, s) {
+					t.Errorf("Expected %q to be redacted, got %s", s, out)
+				}
+			}
+			for _, s := range tt.visible {
+				if !strings.Contains(out, s) {
+					t.Errorf("Expected %q in the audit log, got %s", s, out)
+				}
+			}
+			entries := readAuditEntries(t, buf.Bytes())
+			if len(entries) != 2 || entries[0]["type"] != "request" || entries[1]["type"] != "response" {
+				t.Fatalf("Expected a request then a response entry, got %v", entries)
+			}
+		})
+	}
+	if req.Messages[0].Content != "my secret prompt" || resp.Text != "my secret answer" || len(resp.ToolCalls[0].Arguments) == 0 {
+		t.Error("Expected the redaction to leave the original request and response unchanged")
+	}
+}
+
+func TestAuditRedactionEveryResponseField(t *testing.T) {
+	secretCall := func(n string) []ToolCall {
+		return []ToolCall{{ID: "call-" + n, Name: "lookup", Arguments: json.RawMessage(`{"q": "secret-args-` + n + `"}`)}}
+	}
+	resp := &LLMResponse{
+		Text:             "secret-text",
+		ToolCalls:        secretCall("1"),
+		FinishReason:     "stop",
+		Usage:            &Usage{TotalTokens: 7},
+		Choices:          []Choice{{Text: "secret-choice", ToolCalls: secretCall("2"), LogProbs: []TokenLogProb{{Token: "secret-choice-token"}}}},
+		LogProbs:         []TokenLogProb{{Token: "secret-token", TopLogProbs: []TokenLogProb{{Token: "secret-top-token"}}}},
+		Reasoning:        "secret-reasoning",
+		ServiceTier:      "default",
+		Status:           StatusIncomplete,
+		IncompleteReason: IncompleteReasonMaxOutputTokens,
+		Parts:            []ContentPart{{Type: ContentPartText, Text: "secret-part"}},
+		OriginalText:     "secret-original",
+		Safety:           &SafetyInfo{BlockReason: "SAFETY"},
+		Metrics:          &Metrics{},
+		SentMessages:     []LLMMessage{{Role: RoleAssistant, Content: "secret-sent", Reasoning: "secret-sent-reasoning", ToolCalls: secretCall("3")}},
+		Raw:              json.RawMessage(`{"secret": "secret-raw"}`),
+	}
+	// a new field of LLMResponse must be filled here, and redacted when it holds content
+	v := reflect.ValueOf(*resp)
+	for i := range v.NumField() {
+		if v.Field(i).IsZero() {
+			t.Fatalf("Expected every LLMResponse field to be filled, %s is empty", v.Type().Field(i).Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	NewJSONLAuditLogger(&buf, AuditRedaction{MessageContent: true, ToolArguments: true}).LogResponse(resp, nil)
+	if out := buf.String(); strings.Contains(out, "secret") {
+		t.Errorf("Expected no content in the audit log, got %s", out)
+	}
+	if !strings.Contains(buf.String(), `"total_tokens":7`) || resp.Choices[0].Text != "secret-choice" || resp.SentMessages[0].Content != "secret-sent" {
+		t.Errorf("Expected the metadata to be kept and the response left unchanged, got %s", buf.String())
+	}
+}
+
+func TestProviderAuditLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer bad-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"message": "invalid key"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "Hi"}}], "usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := OpenJSONLAuditLogger(path, AuditRedaction{MessageContent: true})
+	if err != nil {
+		t.Fatalf("OpenJSONLAuditLogger failed: %v", err)
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}
+	for _, key := range []string{"good-key", "bad-key"} {
+		provider, err := NewOpenAICompatAdapter(ProviderConfig{Model: "m", APIKey: key, AuditLogger: audit}, ProviderOpenAI, server.URL, l)
+		if err != nil {
+			t.Fatalf("NewOpenAICompatAdapter failed: %v", err)
+		}
+		provider.Query(context.Background(), req)
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the audit log: %v", err)
+	}
+	entries := readAuditEntries(t, data)
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 audit entries, got %d: %s", len(entries), data)
+	}
+	if usage := entries[1]["response"].(map[string]any)["usage"].(map[string]any); usage["total_tokens"] != float64(4) {
+		t.Errorf("Expected the token counts to be kept, got %v", usage)
+	}
+	if entries[3]["error"] == nil || entries[3]["response"] != nil {
+		t.Errorf("Expected an error entry without response for the failed call, got %v", entries[3])
+	}
+}
+
+func TestProviderHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "john@example.com") {
+			t.Errorf("Expected the PII to be stripped by OnRequest before sending, got %s", body)
+		}
+		if r.Header.Get("Authorization") == "Bearer bad-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": {"message": "invalid key"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "Hi"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	var requests int
+	var outcomes []error
+	cfg := ProviderConfig{
+		Model: "m",
+		OnRequest: func(req *LLMRequest) {
+			requests++
+			for i := range req.Messages {
+				req.Messages[i].Content = strings.ReplaceAll(req.Messages[i].Content, "john@example.com", "[EMAIL]")
+			}
+		},
+		OnResponse: func(resp *LLMResponse, err error) { outcomes = append(outcomes, err) },
+	}
+	for _, key := range []string{"good-key", "bad-key"} {
+		cfg.APIKey = key
+		provider, err := NewOpenAICompatAdapter(cfg, ProviderOpenAI, server.URL, l)
+		if err != nil {
+			t.Fatalf("NewOpenAICompatAdapter failed: %v", err)
+		}
+		req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Write to john@example.com"}}}
+		provider.Query(context.Background(), req)
+		provider.Stream(context.Background(), req, func(Delta) {})
+	}
+	if requests != 4 || len(outcomes) != 4 {
+		t.Fatalf("Expected the hooks to run for the 4 calls, got %d requests and %d responses", requests, len(outcomes))
+	}
+	if outcomes[0] != nil || outcomes[2] == nil || outcomes[3] == nil {
+		t.Errorf("Expected the errors of the failed calls in OnResponse, got %v", outcomes)
+	}
+}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// ProviderExtraAzureDeployment is the ProviderConfig.Extras key holding the Azure OpenAI deployment name,
+// it defaults to the model name as deployments are usually named after their model.
+const ProviderExtraAzureDeployment = "deployment"
+
+// ProviderExtraAzureAPIVersion is the ProviderConfig.Extras key holding the Azure OpenAI api-version query parameter,
+// DefaultAzureAPIVersion when missing.
+const ProviderExtraAzureAPIVersion = "api_version"
+
+// DefaultAzureAPIVersion is the Azure OpenAI GA api-version used when none is configured.
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// NewAzureOpenAIAdapter returns a provider for an Azure OpenAI resource, cfg.BaseURL being its endpoint
+// like https://my-resource.openai.azure.com. The requests go to the deployment based URL
+// {endpoint}/openai/deployments/{deployment}/chat/completions?api-version=... with the api-key header,
+// the request and response formats being the OpenAI ones. ListModels returns the deployment,
+// as an Azure deployment serves a single model, and Embed uses the deployment too, so the embeddings need
+// an adapter whose deployment is an embeddings model.
+func NewAzureOpenAIAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("azure openai: missing API key")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("azure openai: missing model")
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("azure openai: missing endpoint")
+	}
+	deployment, err := stringFromExtras(cfg.Extras, ProviderExtraAzureDeployment, cfg.Model)
+	if err != nil {
+		return nil, err
+	}
+	apiVersion, err := stringFromExtras(cfg.Extras, ProviderExtraAzureAPIVersion, DefaultAzureAPIVersion)
+	if err != nil {
+		return nil, err
+	}
+	azureCfg := cfg
+	azureCfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/") + "/openai/deployments/" + url.PathEscape(deployment)
+	apiVersionQuery := "?api-version=" + url.QueryEscape(apiVersion)
+	azureCfg.Endpoint = endpointPath(cfg.Endpoint, defaultChatEndpoint) + apiVersionQuery
+	provider, err := NewOpenAICompatAdapter(azureCfg, ProviderAzureOpenAI, azureCfg.BaseURL, l)
+	if err != nil {
+		return nil, err
+	}
+	p := provider.(*openAICompatibleProvider)
+	p.AuthHeader = "api-key"
+	p.EmbeddingsEndpoint = defaultEmbeddingsEndpoint + apiVersionQuery
+	return p, nil
+}
+
+// azureDeployments returns the deployment of an Azure OpenAI provider as its only model.
+func (p *openAICompatibleProvider) azureDeployments() []ModelInfo {
+	info, ok := p.modelInfo(p.Model)
+	if !ok {
+		info = ModelInfo{Name: p.Model}
+	}
+	return []ModelInfo{info}
+}
+
+// stringFromExtras returns the string value of key in the provider extras, defaultValue when missing or empty.
+func stringFromExtras(extras map[string]any, key, defaultValue string) (string, error) {
+	value, ok := extras[key]
+	if !ok || value == nil {
+		return defaultValue, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s: expected a string, got %T", key, value)
+	}
+	return FirstNonEmpty(s, defaultValue), nil
+}
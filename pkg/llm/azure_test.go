@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestAzureOpenAIProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-gpt/chat/completions" {
+			t.Errorf("Expected the deployment chat completions path, got %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2025-01-01-preview" {
+			t.Errorf("Expected api-version 2025-01-01-preview, got %q", got)
+		}
+		if r.Header.Get("api-key") != "test-azure-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected the api-key header without bearer auth, got api-key %q and Authorization %q", r.Header.Get("api-key"), r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Accept") == "text/event-stream" {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "Hello"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	cfg := ProviderConfig{
+		Model:   "gpt-4o-mini",
+		APIKey:  "test-azure-key",
+		BaseURL: server.URL + "/",
+		Extras:  map[string]any{ProviderExtraAzureDeployment: "my-gpt", ProviderExtraAzureAPIVersion: "2025-01-01-preview"},
+	}
+	provider, err := NewAzureOpenAIAdapter(cfg, l)
+	if err != nil {
+		t.Fatalf("NewAzureOpenAIAdapter failed: %v", err)
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil || resp.Text != "Hello" {
+		t.Fatalf("Expected the Query answer 'Hello', got %v, %v", resp, err)
+	}
+	resp, err = provider.Stream(context.Background(), req, func(Delta) {})
+	if err != nil || resp.Text != "Hello" {
+		t.Fatalf("Expected the streamed answer 'Hello', got %v, %v", resp, err)
+	}
+	models, err := provider.ListModels(context.Background())
+	if err != nil || len(models) != 1 || models[0].Name != "gpt-4o-mini" {
+		t.Errorf("Expected the deployment model as only model, got %v, %v", models, err)
+	}
+
+	if _, err := NewAzureOpenAIAdapter(ProviderConfig{Model: "gpt-4o-mini", APIKey: "key"}, l); err == nil {
+		t.Error("Expected an error without endpoint, got nil")
+	}
+}
+
+func TestAzureOpenAIEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-embeddings/embeddings" {
+			t.Errorf("Expected the deployment embeddings path, got %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != DefaultAzureAPIVersion {
+			t.Errorf("Expected api-version %s, got %q", DefaultAzureAPIVersion, got)
+		}
+		if r.Header.Get("api-key") != "test-azure-key" {
+			t.Errorf("Expected the api-key header, got %q", r.Header.Get("api-key"))
+		}
+		fmt.Fprintln(w, `{"data": [{"index": 0, "embedding": [0.6, 0.8]}], "usage": {"prompt_tokens": 2, "total_tokens": 2}}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	cfg := ProviderConfig{
+		Model:   "text-embedding-3-small",
+		APIKey:  "test-azure-key",
+		BaseURL: server.URL,
+		Extras:  map[string]any{ProviderExtraAzureDeployment: "my-embeddings"},
+	}
+	provider, err := NewAzureOpenAIAdapter(cfg, l)
+	if err != nil {
+		t.Fatalf("NewAzureOpenAIAdapter failed: %v", err)
+	}
+	embedder, ok := provider.(Embedder)
+	if !ok {
+		t.Fatal("Expected the Azure OpenAI provider to be an Embedder")
+	}
+	resp, err := embedder.Embed(context.Background(), &EmbedRequest{Model: "text-embedding-3-small", Input: []string{"Grüezi"}})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if len(resp.Embeddings) != 1 || len(resp.Embeddings[0]) != 2 {
+		t.Errorf("Expected one embedding of 2 dimensions, got %v", resp.Embeddings)
+	}
+}
@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// MaxTokensCheckMode controls the opt-in check of LLMRequest.MaxTokens against the model context window.
+type MaxTokensCheckMode string
+
+const (
+	// MaxTokensCheckOff disables the check (default).
+	MaxTokensCheckOff MaxTokensCheckMode = ""
+	// MaxTokensCheckWarn logs a warning but still sends the request.
+	MaxTokensCheckWarn MaxTokensCheckMode = "warn"
+	// MaxTokensCheckError refuses to send the request.
+	MaxTokensCheckError MaxTokensCheckMode = "error"
+)
+
+// charsPerToken is the usual rule of thumb for english text with BPE tokenizers.
+const charsPerToken = 4
+
+// perMessageTokens approximates the tokens used by the chat template around each message (role, separators).
+const perMessageTokens = 4
+
+// EstimateTokens returns a rough estimation of the number of tokens in text (about 4 characters per token).
+func EstimateTokens(text string) int {
+	n := utf8.RuneCountInString(text)
+	return (n + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateMessagesTokens returns a rough estimation of the number of prompt tokens used by msgs,
+// including tool calls arguments and a small overhead per message.
+func EstimateMessagesTokens(msgs []LLMMessage) int {
+	return estimateMessages(msgs, EstimateTokens)
+}
+
+// estimateMessages sums the tokens of msgs counted with countText and a small overhead per message.
+func estimateMessages(msgs []LLMMessage, countText func(string) int) int {
+	total := 0
+	for _, msg := range msgs {
+		total += perMessageTokens + countText(msg.Content) + countText(msg.Reasoning)
+		for _, tc := range msg.ToolCalls {
+			total += countText(tc.Name) + countText(string(tc.Arguments))
+		}
+	}
+	return total
+}
+
+// ValidateContextFit checks, before sending req, that its messages likely fit in the context window of the model
+// (info.ContextSize) once req.MaxTokens are reserved for the answer. The prompt tokens are counted with estimator,
+// the one registered for the model when nil (see TokenEstimatorFor). It returns an *ErrContextTooLarge when they don't fit,
+// and nil when the context size of the model is unknown.
+func ValidateContextFit(info ModelInfo, req *LLMRequest, estimator TokenEstimator) error {
+	if req == nil {
+		return errors.New("request cannot be nil")
+	}
+	if info.ContextSize <= 0 {
+		return nil
+	}
+	if estimator == nil {
+		estimator = TokenEstimatorFor(info.Name)
+	}
+	estimated := estimator.EstimateMessages(req.Messages)
+	allowed := info.ContextSize - max(req.MaxTokens, 0)
+	if estimated <= allowed {
+		return nil
+	}
+	return &ErrContextTooLarge{Model: info.Name, Estimated: estimated, Allowed: allowed}
+}
+
+// RemainingContext returns the tokens left for the answer in the context window of the model once the messages
+// of req are counted with estimator (the one registered for the model when nil), i.e. a sensible upper bound for
+// req.MaxTokens. The value is negative when the prompt already exceeds the window and needs trimming
+// (see Conversation.TrimToTokenBudget), and math.MaxInt when the context size of the model is unknown.
+func RemainingContext(req *LLMRequest, info ModelInfo, estimator TokenEstimator) int {
+	if info.ContextSize <= 0 {
+		return math.MaxInt
+	}
+	if req == nil {
+		return info.ContextSize
+	}
+	if estimator == nil {
+		estimator = TokenEstimatorFor(info.Name)
+	}
+	return info.ContextSize - estimator.EstimateMessages(req.Messages)
+}
+
+// CheckMaxTokensBudget verifies that req.MaxTokens fits in the model context window alongside the estimated prompt.
+// It returns nil when MaxTokens or the model context size are unknown, otherwise an error suggesting a smaller value.
+func CheckMaxTokensBudget(req *LLMRequest, info ModelInfo) error {
+	if req.MaxTokens <= 0 || info.ContextSize <= 0 {
+		return nil
+	}
+	promptTokens := TokenEstimatorFor(info.Name).EstimateMessages(req.Messages)
+	available := info.ContextSize - promptTokens
+	if req.MaxTokens <= available {
+		return nil
+	}
+	if available <= 0 {
+		return fmt.Errorf("prompt (~%d estimated tokens) already exceeds the %d tokens context window of model %s",
+			promptTokens, info.ContextSize, info.Name)
+	}
+	return fmt.Errorf("max_tokens %d doesn't fit in the %d tokens context window of model %s alongside ~%d estimated prompt tokens, use max_tokens <= %d",
+		req.MaxTokens, info.ContextSize, info.Name, promptTokens, available)
+}
+
+// applyMaxTokensCheck runs CheckMaxTokensBudget according to req.MaxTokensCheck,
+// logging the problem in warn mode and returning it in error mode.
+func applyMaxTokensCheck(req *LLMRequest, info ModelInfo, l golog.MyLogger) error {
+	if req.MaxTokensCheck == MaxTokensCheckOff {
+		return nil
+	}
+	err := CheckMaxTokensBudget(req, info)
+	if err == nil {
+		return nil
+	}
+	if req.MaxTokensCheck == MaxTokensCheckError {
+		return err
+	}
+	l.Warn("max tokens check: %v", err)
+	return nil
+}
+
+// completeStreamUsage makes sure resp.Usage is populated after a stream, whatever the provider reported.
+// Missing prompt or completion counts are estimated with estimator from the messages sent, language hint included
+// (before their conversion to the wire format of the provider, which only adds a few structural tokens),
+// and the streamed text, in which case Usage.Estimated is set because the values are only approximate.
+func completeStreamUsage(resp *LLMResponse, req *LLMRequest, streamedText string, estimator TokenEstimator) {
+	if resp.Usage == nil {
+		resp.Usage = &Usage{}
+	}
+	u := resp.Usage
+	if u.PromptTokens == 0 {
+		u.PromptTokens = estimator.EstimateMessages(preparedMessages(req))
+		u.Estimated = true
+	}
+	if u.CompletionTokens == 0 && streamedText != "" {
+		u.CompletionTokens = estimator.EstimateText(streamedText)
+		u.Estimated = true
+	}
+	if u.TotalTokens < u.PromptTokens+u.CompletionTokens {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+}
+
+// FinishReasonGeneratedTokensLimit is the FinishReason of a response cut by StreamWithMaxGeneratedTokens.
+const FinishReasonGeneratedTokensLimit = "generated_tokens_limit"
+
+// StreamWithMaxGeneratedTokens streams req like provider.Stream, but cancels the stream once about
+// maxGeneratedTokens tokens were generated, as a hard cap across providers independent of req.MaxTokens.
+// As the providers only report the usage at the end of a stream, the generated tokens are estimated
+// from the streamed reasoning, text and tool call arguments (see EstimateTokens).
+// When the cap is reached, the deltas stop being forwarded to onDelta and the partial response is returned
+// without error, with FinishReason set to FinishReasonGeneratedTokensLimit and an estimated usage.
+// A maxGeneratedTokens <= 0 disables the cap.
+func StreamWithMaxGeneratedTokens(ctx context.Context, provider Provider, req *LLMRequest, maxGeneratedTokens int, onDelta func(Delta)) (*LLMResponse, error) {
+	if maxGeneratedTokens <= 0 {
+		return provider.Stream(ctx, req, onDelta)
+	}
+	if onDelta == nil {
+		return nil, errors.New("onDelta callback cannot be nil for streaming")
+	}
+	generatedChars := 0
+	return streamWithStop(ctx, provider, req, FinishReasonGeneratedTokensLimit, func(d Delta) bool {
+		generatedChars += utf8.RuneCountInString(d.Text) + utf8.RuneCountInString(d.Reasoning)
+		if d.ToolCallArgsFragment != nil {
+			generatedChars += utf8.RuneCountInString(d.ToolCallArgsFragment.Arguments)
+		}
+		onDelta(d)
+		return (generatedChars+charsPerToken-1)/charsPerToken < maxGeneratedTokens
+	})
+}
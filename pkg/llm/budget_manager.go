@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BudgetManager enforces a global cap on the tokens and the dollar cost spent over a sliding time window,
+// e.g. at most 1M tokens or $5 per hour across all the providers of a service. It is safe for concurrent use.
+// Providers consult it through the wrapper returned by Wrap. The budget is checked before each call
+// and decremented by the usage of each response, so concurrent calls in flight may overshoot it slightly.
+type BudgetManager struct {
+	maxTokens int
+	maxCost   float64
+	window    time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries []budgetEntry
+	// total is the spending when there is no window, kept as running totals instead of entries
+	total budgetEntry
+}
+
+// budgetEntry is the spending of a response.
+type budgetEntry struct {
+	at     time.Time
+	tokens int
+	cost   float64
+}
+
+// NewBudgetManager returns a BudgetManager allowing maxTokens tokens and maxCost dollars over the sliding window,
+// a limit <= 0 disables it and a window <= 0 makes the budget a total that never resets.
+func NewBudgetManager(maxTokens int, maxCost float64, window time.Duration) *BudgetManager {
+	return &BudgetManager{maxTokens: maxTokens, maxCost: maxCost, window: window, now: time.Now}
+}
+
+// prune drops the entries out of the window, b.mu must be held.
+func (b *BudgetManager) prune() {
+	if b.window <= 0 {
+		return
+	}
+	cutoff := b.now().Add(-b.window)
+	i := 0
+	for i < len(b.entries) && !b.entries[i].at.After(cutoff) {
+		i++
+	}
+	b.entries = b.entries[i:]
+}
+
+// Used returns the tokens and the cost spent in the current window.
+func (b *BudgetManager) Used() (tokens int, cost float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.window <= 0 {
+		return b.total.tokens, b.total.cost
+	}
+	b.prune()
+	for _, e := range b.entries {
+		tokens += e.tokens
+		cost += e.cost
+	}
+	return tokens, cost
+}
+
+// Allow returns an *ErrBudgetExceeded when the token or cost budget of the current window is exhausted.
+func (b *BudgetManager) Allow() error {
+	tokens, cost := b.Used()
+	if b.maxTokens > 0 && tokens >= b.maxTokens {
+		return &ErrBudgetExceeded{Resource: "tokens", Used: float64(tokens), Limit: float64(b.maxTokens), Window: b.window}
+	}
+	if b.maxCost > 0 && cost >= b.maxCost {
+		return &ErrBudgetExceeded{Resource: "cost", Used: cost, Limit: b.maxCost, Window: b.window}
+	}
+	return nil
+}
+
+// Record decrements the budget by the total tokens of usage and cost.
+func (b *BudgetManager) Record(usage Usage, cost float64) {
+	tokens := max(usage.TotalTokens, usage.PromptTokens+usage.CompletionTokens)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.window <= 0 {
+		b.total.tokens += tokens
+		b.total.cost += cost
+		return
+	}
+	b.entries = append(b.entries, budgetEntry{at: b.now(), tokens: tokens, cost: cost})
+}
+
+// Wrap returns a Provider rejecting the calls with an *ErrBudgetExceeded once the budget is exhausted,
+// and recording the usage of the responses. pricing returns the model information used to estimate the cost
+// of a response with EstimateCost, e.g. ProviderModelsInfo.ModelInfo of the catalog, it receives req.Model,
+// or the default model of provider when req.Model is empty (see DefaultModelProvider).
+// A nil pricing, or a model without pricing, only counts the tokens.
+func (b *BudgetManager) Wrap(provider Provider, pricing func(model string) ModelInfo) Provider {
+	return &budgetedProvider{Provider: provider, budget: b, pricing: pricing}
+}
+
+// budgetedProvider is the Provider returned by BudgetManager.Wrap.
+type budgetedProvider struct {
+	Provider
+	budget  *BudgetManager
+	pricing func(model string) ModelInfo
+}
+
+// record decrements the budget by the usage of resp.
+func (p *budgetedProvider) record(req *LLMRequest, resp *LLMResponse) {
+	if resp == nil || resp.Usage == nil {
+		return
+	}
+	cost := 0.0
+	if p.pricing != nil {
+		cost, _ = EstimateCost(p.pricing(requestModel(p.Provider, req)), *resp.Usage)
+	}
+	p.budget.Record(*resp.Usage, cost)
+}
+
+// DefaultModel returns the default model of the wrapped provider, "" when unknown.
+func (p *budgetedProvider) DefaultModel() string {
+	return requestModel(p.Provider, &LLMRequest{})
+}
+
+// Query sends req when the budget allows it.
+func (p *budgetedProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	if err := p.budget.Allow(); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.Query(ctx, req)
+	p.record(req, resp)
+	return resp, err
+}
+
+// Stream streams req when the budget allows it.
+func (p *budgetedProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	if err := p.budget.Allow(); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.Stream(ctx, req, onDelta)
+	p.record(req, resp)
+	return resp, err
+}
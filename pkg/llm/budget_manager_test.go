@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// usageProvider answers every query with the same usage.
+type usageProvider struct {
+	usage Usage
+}
+
+func (p *usageProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	usage := p.usage
+	return &LLMResponse{Text: "ok", Usage: &usage}, nil
+}
+
+func (p *usageProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	return p.Query(ctx, req)
+}
+
+func (p *usageProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return nil, nil
+}
+
+// defaultModelUsageProvider is a usageProvider with a default model, like the providers of this package.
+type defaultModelUsageProvider struct {
+	usageProvider
+	model string
+}
+
+func (p *defaultModelUsageProvider) DefaultModel() string {
+	return p.model
+}
+
+func TestBudgetManager(t *testing.T) {
+	req := &LLMRequest{Model: "m", Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}
+	usage := Usage{PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100}
+
+	t.Run("TokenBudgetSlidingWindow", func(t *testing.T) {
+		clock := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+		budget := NewBudgetManager(200, 0, time.Hour)
+		budget.now = func() time.Time { return clock }
+		provider := budget.Wrap(&usageProvider{usage: usage}, nil)
+
+		for i := range 2 {
+			if _, err := provider.Query(context.Background(), req); err != nil {
+				t.Fatalf("Expected query %d to be allowed, got %v", i, err)
+			}
+			clock = clock.Add(10 * time.Minute)
+		}
+		var exceeded *ErrBudgetExceeded
+		if _, err := provider.Stream(context.Background(), req, func(Delta) {}); !errors.As(err, &exceeded) || exceeded.Resource != "tokens" {
+			t.Fatalf("Expected an *ErrBudgetExceeded on tokens, got %v", err)
+		}
+		// the first response leaves the window
+		clock = clock.Add(41 * time.Minute)
+		if tokens, _ := budget.Used(); tokens != 100 {
+			t.Errorf("Expected 100 tokens used in the window, got %d", tokens)
+		}
+		if _, err := provider.Query(context.Background(), req); err != nil {
+			t.Errorf("Expected the budget to be available again, got %v", err)
+		}
+	})
+
+	t.Run("CostBudget", func(t *testing.T) {
+		budget := NewBudgetManager(0, 0.0001, 0)
+		pricing := func(model string) ModelInfo {
+			return ModelInfo{Name: model, InputCostPer1M: 1, OutputCostPer1M: 1}
+		}
+		provider := budget.Wrap(&usageProvider{usage: usage}, pricing)
+		if _, err := provider.Query(context.Background(), req); err != nil {
+			t.Fatalf("Expected the first query to be allowed, got %v", err)
+		}
+		var exceeded *ErrBudgetExceeded
+		if _, err := provider.Query(context.Background(), req); !errors.As(err, &exceeded) || exceeded.Resource != "cost" {
+			t.Errorf("Expected an *ErrBudgetExceeded on cost, got %v", err)
+		}
+	})
+
+	t.Run("CostOfTheDefaultModel", func(t *testing.T) {
+		budget := NewBudgetManager(0, 0.0001, 0)
+		pricing := func(model string) ModelInfo {
+			if model != "priced-default" {
+				return ModelInfo{Name: model}
+			}
+			return ModelInfo{Name: model, InputCostPer1M: 1, OutputCostPer1M: 1}
+		}
+		provider := NewCachedProvider(budget.Wrap(&defaultModelUsageProvider{usageProvider: usageProvider{usage: usage}, model: "priced-default"}, pricing), time.Minute, nil)
+		noModel := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}
+		if _, err := provider.Query(context.Background(), noModel); err != nil {
+			t.Fatalf("Expected the first query to be allowed, got %v", err)
+		}
+		if _, cost := budget.Used(); cost <= 0 {
+			t.Errorf("Expected the default model to be priced, got a cost of %f", cost)
+		}
+		if got := provider.DefaultModel(); got != "priced-default" {
+			t.Errorf("Expected the wrappers to give the default model, got %q", got)
+		}
+		var exceeded *ErrBudgetExceeded
+		if _, err := provider.Query(context.Background(), noModel); !errors.As(err, &exceeded) || exceeded.Resource != "cost" {
+			t.Errorf("Expected an *ErrBudgetExceeded on cost, got %v", err)
+		}
+	})
+
+	t.Run("TotalsWithoutWindow", func(t *testing.T) {
+		budget := NewBudgetManager(0, 0, 0)
+		for range 100 {
+			budget.Record(usage, 0.01)
+		}
+		if tokens, _ := budget.Used(); tokens != 10000 || len(budget.entries) != 0 {
+			t.Errorf("Expected 10000 tokens kept as running totals, got %d tokens and %d entries", tokens, len(budget.entries))
+		}
+	})
+
+	t.Run("ConcurrentRecords", func(t *testing.T) {
+		budget := NewBudgetManager(0, 0, time.Hour)
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				budget.Record(usage, 0.01)
+			}()
+		}
+		wg.Wait()
+		if tokens, cost := budget.Used(); tokens != 5000 || cost < 0.4999 || cost > 0.5001 {
+			t.Errorf("Expected 5000 tokens and $0.50 used, got %d and %f", tokens, cost)
+		}
+	})
+}
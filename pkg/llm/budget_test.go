@@ -0,0 +1,210 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestCheckMaxTokensBudget(t *testing.T) {
+	info := ModelInfo{Name: "small-model", ContextSize: 1000}
+	prompt := strings.Repeat("a", 400*charsPerToken) // ~400 tokens
+
+	testCases := []struct {
+		name        string
+		maxTokens   int
+		info        ModelInfo
+		expectError bool
+	}{
+		{"NoMaxTokens", 0, info, false},
+		{"UnknownContextSize", 5000, ModelInfo{Name: "unknown"}, false},
+		{"Fits", 500, info, false},
+		{"TooLarge", 900, info, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &LLMRequest{
+				Messages:  []LLMMessage{{Role: RoleUser, Content: prompt}},
+				MaxTokens: tc.maxTokens,
+			}
+			err := CheckMaxTokensBudget(req, tc.info)
+			if (err != nil) != tc.expectError {
+				t.Fatalf("Expected error: %v, got %v", tc.expectError, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "use max_tokens <=") {
+				t.Errorf("Expected the error to suggest a smaller value, got %v", err)
+			}
+		})
+	}
+
+	t.Run("ModeOffSkipsTheCheck", func(t *testing.T) {
+		req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: prompt}}, MaxTokens: 900}
+		if err := applyMaxTokensCheck(req, info, l); err != nil {
+			t.Errorf("Expected no error when the check is off, got %v", err)
+		}
+		req.MaxTokensCheck = MaxTokensCheckWarn
+		if err := applyMaxTokensCheck(req, info, l); err != nil {
+			t.Errorf("Expected only a warning in warn mode, got %v", err)
+		}
+		req.MaxTokensCheck = MaxTokensCheckError
+		if err := applyMaxTokensCheck(req, info, l); err == nil {
+			t.Error("Expected an error in error mode, got nil")
+		}
+	})
+}
+
+// wordTokenEstimator counts one token per word, standing for a real tokenizer.
+type wordTokenEstimator struct{}
+
+func (wordTokenEstimator) EstimateText(s string) int { return len(strings.Fields(s)) }
+
+func (e wordTokenEstimator) EstimateMessages(msgs []LLMMessage) int {
+	total := 0
+	for _, msg := range msgs {
+		total += e.EstimateText(msg.Content)
+	}
+	return total
+}
+
+func TestValidateContextFit(t *testing.T) {
+	prompt := []LLMMessage{{Role: RoleUser, Content: strings.Repeat("word ", 100)}}
+	tests := []struct {
+		name          string
+		info          ModelInfo
+		maxTokens     int
+		estimator     TokenEstimator
+		wantEstimated int
+		wantAllowed   int
+	}{
+		{name: "Fits", info: ModelInfo{Name: "m", ContextSize: 1000}, maxTokens: 500},
+		{name: "UnknownContextSize", info: ModelInfo{Name: "m"}, maxTokens: 500},
+		{name: "TooLargeWithReservedAnswer", info: ModelInfo{Name: "m", ContextSize: 200}, maxTokens: 150, wantEstimated: 129, wantAllowed: 50},
+		{name: "CustomEstimator", info: ModelInfo{Name: "m", ContextSize: 120}, maxTokens: 30, estimator: wordTokenEstimator{}, wantEstimated: 100, wantAllowed: 90},
+		{name: "CustomEstimatorFits", info: ModelInfo{Name: "m", ContextSize: 120}, estimator: wordTokenEstimator{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateContextFit(tt.info, &LLMRequest{Messages: prompt, MaxTokens: tt.maxTokens}, tt.estimator)
+			if tt.wantAllowed == 0 {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			var tooLarge *ErrContextTooLarge
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("Expected an *ErrContextTooLarge, got %v", err)
+			}
+			if tooLarge.Estimated != tt.wantEstimated || tooLarge.Allowed != tt.wantAllowed {
+				t.Errorf("Expected %d estimated and %d allowed tokens, got %d and %d", tt.wantEstimated, tt.wantAllowed, tooLarge.Estimated, tooLarge.Allowed)
+			}
+		})
+	}
+}
+
+func TestRemainingContext(t *testing.T) {
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: strings.Repeat("word ", 100)}}}
+	tests := []struct {
+		name      string
+		info      ModelInfo
+		estimator TokenEstimator
+		want      int
+	}{
+		{name: "DefaultEstimator", info: ModelInfo{Name: "m", ContextSize: 1000}, want: 871},
+		{name: "CustomEstimator", info: ModelInfo{Name: "m", ContextSize: 1000}, estimator: wordTokenEstimator{}, want: 900},
+		{name: "PromptExceedsWindow", info: ModelInfo{Name: "m", ContextSize: 100}, want: -29},
+		{name: "UnknownContextSize", info: ModelInfo{Name: "m"}, want: math.MaxInt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RemainingContext(req, tt.info, tt.estimator); got != tt.want {
+				t.Errorf("Expected %d remaining tokens, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompleteStreamUsage(t *testing.T) {
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "one two"}}, Language: "French"}
+	resp := &LLMResponse{}
+	completeStreamUsage(resp, req, "un deux", wordTokenEstimator{})
+	want := wordTokenEstimator{}.EstimateMessages(preparedMessages(req))
+	if want <= 2 {
+		t.Fatalf("Expected the language hint to add tokens, got %d", want)
+	}
+	if resp.Usage.PromptTokens != want || resp.Usage.CompletionTokens != 2 || !resp.Usage.Estimated {
+		t.Errorf("Expected %d prompt tokens with the language hint and 2 completion tokens, got %#v", want, resp.Usage)
+	}
+}
+
+func TestStreamWithMaxGeneratedTokens(t *testing.T) {
+	deltas := []string{"aaaa", "bbbb", "cccc", "dddd", "eeee"} // one estimated token each
+	req := func() *LLMRequest {
+		return &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Write"}}}
+	}
+
+	t.Run("Capped", func(t *testing.T) {
+		var received []Delta
+		resp, err := StreamWithMaxGeneratedTokens(context.Background(), &scriptedStreamProvider{deltas: deltas}, req(), 3, func(d Delta) {
+			received = append(received, d)
+		})
+		if err != nil {
+			t.Fatalf("StreamWithMaxGeneratedTokens failed: %v", err)
+		}
+		if resp.Text != "aaaabbbbcccc" || resp.FinishReason != FinishReasonGeneratedTokensLimit {
+			t.Errorf("Expected the partial text cut at the limit, got %q (%s)", resp.Text, resp.FinishReason)
+		}
+		if resp.Usage == nil || resp.Usage.CompletionTokens != 3 || !resp.Usage.Estimated {
+			t.Errorf("Expected an estimated usage of 3 completion tokens, got %#v", resp.Usage)
+		}
+		if len(received) != 4 || !received[3].Done || received[3].FinishReason != FinishReasonGeneratedTokensLimit {
+			t.Errorf("Expected 3 text deltas followed by done, got %#v", received)
+		}
+	})
+
+	t.Run("UnderTheLimit", func(t *testing.T) {
+		resp, err := StreamWithMaxGeneratedTokens(context.Background(), &scriptedStreamProvider{deltas: deltas}, req(), 100, func(Delta) {})
+		if err != nil {
+			t.Fatalf("StreamWithMaxGeneratedTokens failed: %v", err)
+		}
+		if resp.Text != strings.Join(deltas, "") || resp.FinishReason != "stop" {
+			t.Errorf("Expected the full provider response, got %#v", resp)
+		}
+	})
+
+	t.Run("CancelsTheStream", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; ; i++ {
+				if _, err := fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"word \"}}]}\n\n"); err != nil {
+					return
+				}
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}))
+		defer server.Close()
+		l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+		provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+		resp, err := StreamWithMaxGeneratedTokens(context.Background(), provider, req(), 10, func(Delta) {})
+		if err != nil {
+			t.Fatalf("StreamWithMaxGeneratedTokens failed: %v", err)
+		}
+		if resp.FinishReason != FinishReasonGeneratedTokensLimit || resp.Text != strings.Repeat("word ", 8) {
+			t.Errorf("Expected the stream to be cut after 8 words, got %q (%s)", resp.Text, resp.FinishReason)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// Capabilities lists the features a model must support to serve a request.
+type Capabilities struct {
+	Tools      bool
+	JSONMode   bool
+	Structured bool
+	InputImage bool
+	Thinking   bool
+}
+
+// Missing returns the names of the required capabilities that the model does not support.
+func (c Capabilities) Missing(info ModelInfo) []string {
+	var missing []string
+	if c.Tools && !info.SupportsTools {
+		missing = append(missing, "tools")
+	}
+	if c.JSONMode && !info.SupportsJSONMode {
+		missing = append(missing, "json_mode")
+	}
+	if c.Structured && !info.SupportsStructured {
+		missing = append(missing, "structured")
+	}
+	if c.InputImage && !info.SupportsInputImage {
+		missing = append(missing, "input_image")
+	}
+	if c.Thinking && !info.SupportsThinking {
+		missing = append(missing, "thinking")
+	}
+	return missing
+}
+
+// capabilityProvidersOrder is the order in which providers are tried by QueryWithCapabilities.
+var capabilityProvidersOrder = []ProviderKind{ProviderOpenAI, ProviderGemini, ProviderXAI, ProviderOpenRouter, ProviderMistral, ProviderDeepSeek, ProviderGroq, ProviderAzureOpenAI, ProviderCohere, ProviderOllama}
+
+// QueryWithCapabilities picks a model satisfying the required capabilities among all the configured providers
+// (the ones with an API key, and the local Ollama) and runs req with it, req.Model is ignored.
+// Providers are tried in a fixed order and the first matching model of each provider is queried,
+// falling back to the next provider if the query fails.
+// When no available model satisfies the requirements, the error lists the capabilities that couldn't be satisfied.
+func QueryWithCapabilities(ctx context.Context, req *LLMRequest, required Capabilities, l golog.MyLogger) (*LLMResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	wanted := required.Missing(ModelInfo{})
+	var queryErrs []error
+	// supported keeps track of every wanted capability offered by at least one available model
+	supported := map[string]bool{}
+	for _, kind := range capabilityProvidersOrder {
+		_, defaultModel, err := GetProviderKindAndDefaultModel(strings.ToLower(string(kind)))
+		if err != nil {
+			return nil, err
+		}
+		provider, err := NewProvider(kind, defaultModel, l)
+		if err != nil {
+			l.Debug("skipping provider %s not configured: %v", kind, err)
+			continue
+		}
+		models, err := provider.ListModels(ctx)
+		if err != nil {
+			l.Warn("skipping provider %s, cannot list models: %v", kind, err)
+			continue
+		}
+		for _, m := range models {
+			missing := required.Missing(m)
+			for _, c := range wanted {
+				if !slices.Contains(missing, c) {
+					supported[c] = true
+				}
+			}
+			if len(missing) > 0 {
+				continue
+			}
+			l.Info("using provider %s model %s for the required capabilities", kind, m.Name)
+			modelReq := *req
+			modelReq.Model = m.Name
+			resp, err := provider.Query(ctx, &modelReq)
+			if err != nil {
+				l.Warn("provider %s model %s failed, trying next provider: %v", kind, m.Name, err)
+				queryErrs = append(queryErrs, fmt.Errorf("%s %s: %w", kind, m.Name, err))
+				break
+			}
+			return resp, nil
+		}
+	}
+	if len(queryErrs) > 0 {
+		return nil, fmt.Errorf("all providers matching the required capabilities failed: %w", errors.Join(queryErrs...))
+	}
+	var unsatisfied []string
+	for _, c := range wanted {
+		if !supported[c] {
+			unsatisfied = append(unsatisfied, c)
+		}
+	}
+	if len(unsatisfied) > 0 {
+		return nil, fmt.Errorf("no available provider supports: %s", strings.Join(unsatisfied, ", "))
+	}
+	return nil, fmt.Errorf("no single available model supports all of: %s", strings.Join(wanted, ", "))
+}
@@ -0,0 +1,482 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-ai-llm-query/pkg/config"
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// CohereProvider implements the Provider interface for the Cohere v2 chat API,
+// see https://docs.cohere.com/reference/chat
+type CohereProvider struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	ModelsInfo ProviderModelsInfo
+	Client     *http.Client
+	// ExtraHeaders are sent with every request, merged from the catalog and ProviderConfig.ExtraHeaders
+	ExtraHeaders map[string]string
+	RetryPolicy  RetryPolicy
+	GzipRequests bool
+	audit        AuditLogger
+	hooks        callHooks
+	l            golog.MyLogger
+}
+
+// cohereRequest represents the request payload for Cohere's /v2/chat API.
+type cohereRequest struct {
+	Model            string           `json:"model"`
+	Messages         []map[string]any `json:"messages"`
+	Stream           bool             `json:"stream"`
+	Tools            []Tool           `json:"tools,omitempty"`
+	ResponseFormat   map[string]any   `json:"response_format,omitempty"`
+	Temperature      float64          `json:"temperature,omitempty"`
+	P                float64          `json:"p,omitempty"`
+	MaxTokens        int              `json:"max_tokens,omitempty"`
+	FrequencyPenalty float64          `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64          `json:"presence_penalty,omitempty"`
+}
+
+// cohereResponse represents the response payload of Cohere's /v2/chat API.
+type cohereResponse struct {
+	ID           string `json:"id"`
+	FinishReason string `json:"finish_reason"`
+	Message      struct {
+		Role    string `json:"role"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		ToolPlan  string               `json:"tool_plan"`
+		ToolCalls []openAIToolCallWire `json:"tool_calls"`
+	} `json:"message"`
+	Usage *cohereUsage `json:"usage"`
+}
+
+// cohereUsage holds the billed and the actual token counts of a Cohere answer.
+type cohereUsage struct {
+	BilledUnits cohereTokens `json:"billed_units"`
+	Tokens      cohereTokens `json:"tokens"`
+}
+
+type cohereTokens struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// usage converts the Cohere token counts, preferring the actual tokens over the billed units.
+func (u *cohereUsage) usage() *Usage {
+	if u == nil {
+		return nil
+	}
+	tokens := u.Tokens
+	if tokens.InputTokens == 0 && tokens.OutputTokens == 0 {
+		tokens = u.BilledUnits
+	}
+	if tokens.InputTokens == 0 && tokens.OutputTokens == 0 {
+		return nil
+	}
+	return &Usage{
+		PromptTokens:     tokens.InputTokens,
+		CompletionTokens: tokens.OutputTokens,
+		TotalTokens:      tokens.InputTokens + tokens.OutputTokens,
+	}
+}
+
+// cohereStreamEvent is an event of a Cohere chat stream, the type tells which delta fields are set:
+// "content-delta" carries a piece of the answer text, "tool-call-start" and "tool-call-delta" the tool calls
+// and "message-end" the finish reason and the usage.
+type cohereStreamEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	Delta struct {
+		Message struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			ToolPlan  string             `json:"tool_plan"`
+			ToolCalls streamToolCallWire `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+		Usage        *cohereUsage `json:"usage"`
+	} `json:"delta"`
+}
+
+// NewCohereAdapter creates a new CohereProvider from config.
+func NewCohereAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("cohere: API key required")
+	}
+	if cfg.Model == "" {
+		return nil, errors.New("cohere: model required")
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("cohere: missing baseURl")
+	}
+	filepath := config.GetProviderInfoFilePathFromEnv(defaultModelInfoFilePath)
+	// Load only once the external model configuration
+	catalog, err := LoadModelCatalog(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load model catalog: %w", err)
+	}
+	providerConfig, ok := catalog.Providers[string(ProviderCohere)]
+	if !ok {
+		return nil, errors.New("cohere provider configuration not found in models.json")
+	}
+	retryPolicy, err := retryPolicyFromExtras(cfg.Extras)
+	if err != nil {
+		return nil, err
+	}
+	gzipRequests, err := gzipRequestsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &CohereProvider{
+		BaseURL:      config.NormalizeBaseURL(cfg.BaseURL),
+		APIKey:       cfg.APIKey,
+		Model:        cfg.Model,
+		ExtraHeaders: mergeHeaders(providerConfig.Headers, cfg.ExtraHeaders),
+		ModelsInfo:   providerConfig,
+		Client:       client,
+		RetryPolicy:  retryPolicy,
+		audit:        auditLoggerOrNoop(cfg.AuditLogger),
+		hooks:        hooksFromConfig(cfg),
+		GzipRequests: gzipRequests,
+		l:            l,
+	}, nil
+}
+
+// Query sends req and returns the complete response, recording the call with the audit logger and the hooks.
+func (c *CohereProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return auditCall(auditLoggerOrNoop(c.audit), c.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := c.query(ctx, req)
+		return finishResponse(req, start, resp, err, c.l)
+	})
+}
+
+// Stream sends req and emits the answer deltas to onDelta, recording the call with the audit logger and the hooks.
+func (c *CohereProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	onDelta = withDeltaTimestamps(req, onDelta)
+	return auditCall(auditLoggerOrNoop(c.audit), c.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := runStream(ctx, req, onDelta, c.stream)
+		return finishResponse(req, start, resp, err, c.l)
+	})
+}
+
+// headers returns the headers of a Cohere request.
+func (c *CohereProvider) headers(req *LLMRequest) http.Header {
+	headers := http.Header{
+		"Content-Type":  []string{"application/json"},
+		"Authorization": []string{"Bearer " + c.APIKey},
+	}
+	setExtraHeaders(headers, c.ExtraHeaders, req.ExtraHeaders)
+	return headers
+}
+
+func (c *CohereProvider) query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	l := contextLogger(ctx, c.l)
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
+
+	if err := applyMaxTokensCheck(req, c.ModelsInfo.ModelInfo(FirstNonEmpty(req.Model, c.Model)), l); err != nil {
+		return nil, err
+	}
+	payload := c.buildPayload(req, false)
+	l.Debug("about to send request to %s", c.BaseURL)
+	responseData, rawResp, err := httpPostRequest[cohereRequest, cohereResponse](ctx, c.Client, c.BaseURL+"/v2/chat", c.headers(req), payload, c.RetryPolicy, c.GzipRequests, l)
+	if err != nil {
+		l.Warn("got error during HttpRequest: %q", err)
+		setAPIErrorProvider(err, ProviderCohere)
+		return nil, fmt.Errorf("cohere request failed: %w (raw body: %s)", err, string(rawResp))
+	}
+	l.Debug("successful HttpRequest, rawbody: %s", string(rawResp))
+
+	var buf strings.Builder
+	for _, part := range responseData.Message.Content {
+		if part.Type == "" || part.Type == "text" {
+			buf.WriteString(part.Text)
+		}
+	}
+	toolCalls, err := unmarshalToolCalls(responseData.Message.ToolCalls)
+	if err != nil {
+		return nil, err
+	}
+	return &LLMResponse{
+		Text:         buf.String(),
+		Reasoning:    responseData.Message.ToolPlan,
+		ToolCalls:    toolCalls,
+		FinishReason: responseData.FinishReason,
+		Usage:        responseData.Usage.usage(),
+		Raw:          json.RawMessage(rawResp),
+	}, nil
+}
+
+// BuildRequestPayload returns the HTTP request that Query, or Stream when req.Stream is set, would send for req.
+func (c *CohereProvider) BuildRequestPayload(req *LLMRequest) (*RequestPayload, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	dryReq := dryRunRequest(req, c.hooks)
+	if err := applyMaxTokensCheck(dryReq, c.ModelsInfo.ModelInfo(FirstNonEmpty(dryReq.Model, c.Model)), c.l); err != nil {
+		return nil, err
+	}
+	headers := c.headers(dryReq)
+	if req.Stream {
+		headers.Set("Accept", "text/event-stream")
+	}
+	return newRequestPayload(c.BaseURL+"/v2/chat", headers, c.buildPayload(dryReq, req.Stream))
+}
+
+// buildPayload creates the /v2/chat payload shared by Query and Stream.
+func (c *CohereProvider) buildPayload(req *LLMRequest, stream bool) cohereRequest {
+	modelName := FirstNonEmpty(req.Model, c.Model)
+	req = withSamplingDefaults(req, c.ModelsInfo.SamplingDefaults(modelName))
+	return cohereRequest{
+		Model:            modelName,
+		Messages:         toCohereMessages(preparedMessages(req)),
+		Stream:           stream,
+		Tools:            req.Tools,
+		ResponseFormat:   toCohereResponseFormat(req.ResponseFormat),
+		Temperature:      req.Temperature,
+		P:                req.TopP,
+		MaxTokens:        req.MaxTokens,
+		FrequencyPenalty: req.FrequencyPenalty,
+		PresencePenalty:  req.PresencePenalty,
+	}
+}
+
+// toCohereMessages converts LLM messages to Cohere's messages format.
+// The text of an assistant message with tool calls is sent as its tool_plan,
+// and tool results are matched to the tool call by tool_call_id.
+func toCohereMessages(msgs []LLMMessage) []map[string]any {
+	out := make([]map[string]any, 0, len(msgs))
+	for _, msg := range msgs {
+		item := map[string]any{"role": msg.Role}
+		switch {
+		case msg.Role == RoleAssistant && len(msg.ToolCalls) > 0:
+			calls := make([]map[string]any, len(msg.ToolCalls))
+			for i, tc := range msg.ToolCalls {
+				calls[i] = map[string]any{
+					"id":   tc.ID,
+					"type": "function",
+					"function": map[string]any{
+						"name":      tc.Name,
+						"arguments": toolArgumentsString(tc.Arguments),
+					},
+				}
+			}
+			item["tool_calls"] = calls
+			if msg.Content != "" {
+				item["tool_plan"] = msg.Content
+			}
+		case msg.Role == RoleTool:
+			item["tool_call_id"] = msg.ToolCallID
+			item["content"] = msg.Content
+		default:
+			item["content"] = msg.Content
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// toolArgumentsString returns the tool call arguments as a JSON object string,
+// whether they are stored as a JSON object or as a JSON string like in OpenAI responses.
+func toolArgumentsString(args json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(args, &s); err == nil {
+		return s
+	}
+	if len(args) == 0 {
+		return "{}"
+	}
+	return string(args)
+}
+
+// toCohereResponseFormat maps a ResponseFormat to Cohere's response_format,
+// where a JSON schema is given directly in the json_schema field.
+func toCohereResponseFormat(rf *ResponseFormat) map[string]any {
+	if rf == nil || (rf.Type != "json_object" && rf.Type != "json_schema") {
+		return nil
+	}
+	format := map[string]any{"type": "json_object"}
+	if rf.Type == "json_schema" {
+		// OpenAI wraps the schema as {"name": ..., "schema": {...}, "strict": true}
+		if schema, ok := rf.JSONSchema["schema"]; ok {
+			format["json_schema"] = schema
+		} else if len(rf.JSONSchema) > 0 {
+			format["json_schema"] = rf.JSONSchema
+		}
+	}
+	return format
+}
+
+func (c *CohereProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	url := c.BaseURL + "/v1/models?endpoint=chat"
+	headers := http.Header{
+		"Authorization": []string{"Bearer " + c.APIKey},
+	}
+	setExtraHeaders(headers, c.ExtraHeaders)
+
+	type cohereModelsResponse struct {
+		Models []struct {
+			Name          string `json:"name"`
+			ContextLength int    `json:"context_length"`
+		} `json:"models"`
+	}
+
+	resp, err := httpGetRequest[cohereModelsResponse](ctx, c.Client, url, headers, c.RetryPolicy, c.l)
+	if err != nil {
+		setAPIErrorProvider(err, ProviderCohere)
+		return nil, fmt.Errorf("failed to list cohere models: %w", err)
+	}
+	modelInfos := make([]ModelInfo, 0, len(resp.Models))
+	for _, model := range resp.Models {
+		if IsModelExcluded(model.Name, c.ModelsInfo.ExcludePatterns) {
+			c.l.Debug("cohere model %s discarded: %#v", model.Name, model)
+			continue
+		}
+		tempModelInfo := c.ModelsInfo.Defaults
+		if specificOverrides, exists := c.ModelsInfo.Models[model.Name]; exists {
+			tempModelInfo = MergeModelInfo(c.ModelsInfo.Defaults, specificOverrides)
+		}
+		tempModelInfo.Name = model.Name
+		if model.ContextLength > 0 {
+			tempModelInfo.ContextSize = model.ContextLength
+		}
+		modelInfos = append(modelInfos, tempModelInfo)
+	}
+	slices.SortStableFunc(modelInfos, func(i, j ModelInfo) int {
+		return cmp.Compare(i.Name, j.Name)
+	})
+	return modelInfos, nil
+}
+
+func (c *CohereProvider) stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	l := contextLogger(ctx, c.l)
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
+	firstChunk := firstChunkNotifier(req, time.Now())
+	if onDelta == nil {
+		return nil, errors.New("onDelta callback cannot be nil for streaming")
+	}
+	if modelName := FirstNonEmpty(req.Model, c.Model); req.FakeStreamIfUnsupported && !c.ModelsInfo.ModelInfo(modelName).SupportsStreaming {
+		l.Info("model %s doesn't support streaming, falling back to a regular query", modelName)
+		return QueryAsStream(ctx, queryFunc(c.query), req, onDelta)
+	}
+
+	if err := applyMaxTokensCheck(req, c.ModelsInfo.ModelInfo(FirstNonEmpty(req.Model, c.Model)), l); err != nil {
+		return nil, err
+	}
+	payload := c.buildPayload(req, true)
+	bodyBytes, err := marshalRequestBody(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cohere stream request: %w", err)
+	}
+	headers := c.headers(req)
+	headers.Set("Accept", "text/event-stream")
+	httpReq, err := newHTTPRequest(ctx, http.MethodPost, c.BaseURL+"/v2/chat", headers, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cohere stream request: %w", err)
+	}
+	resp, err := c.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send cohere stream request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("cohere stream failed: %w", newAPIError(resp.StatusCode, resp.Header, body, ProviderCohere, 1))
+	}
+
+	// Cohere sends SSE events named after their type, the data line holds the same type field
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
+	finalResponse := &LLMResponse{}
+	fullText := &strings.Builder{}
+	fullPlan := &strings.Builder{}
+	toolCalls := &streamToolCallAccumulator{}
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		firstChunk()
+		data = strings.TrimSpace(data)
+		var event cohereStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			l.Warn("failed to unmarshal cohere stream event: %v. data: %s", err, data)
+			continue
+		}
+		var raw json.RawMessage
+		if req.IncludeRawChunks {
+			raw = json.RawMessage(data)
+		}
+		emit := withRawChunk(onDelta, raw)
+
+		switch event.Type {
+		case "content-delta":
+			if text := event.Delta.Message.Content.Text; text != "" {
+				fullText.WriteString(text)
+				emit(Delta{Text: text})
+			}
+		case "tool-plan-delta":
+			if plan := event.Delta.Message.ToolPlan; plan != "" {
+				fullPlan.WriteString(plan)
+				emit(Delta{Reasoning: plan})
+			}
+		case "tool-call-start", "tool-call-delta":
+			frag := event.Delta.Message.ToolCalls
+			frag.Index = event.Index
+			call := toolCalls.add(frag)
+			if frag.Function.Arguments != "" {
+				emit(Delta{ToolCallArgsFragment: &ToolCallFragment{
+					Index:     call.Index,
+					ID:        call.ID,
+					Name:      call.Function.Name,
+					Arguments: frag.Function.Arguments,
+				}})
+			}
+		case "message-end":
+			finalResponse.FinishReason = event.Delta.FinishReason
+			finalResponse.Usage = event.Delta.Usage.usage()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading cohere stream: %w", err)
+	}
+
+	if calls := toolCalls.toolCalls(); len(calls) > 0 {
+		finalResponse.ToolCalls = calls
+		onDelta(Delta{ToolCalls: calls})
+	}
+	completeStreamUsage(finalResponse, req, fullText.String(), TokenEstimatorForProvider(ProviderCohere, FirstNonEmpty(req.Model, c.Model)))
+	onDelta(Delta{Done: true, FinishReason: finalResponse.FinishReason})
+	finalResponse.Text = fullText.String()
+	finalResponse.Reasoning = fullPlan.String()
+	return finalResponse, nil
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestCohereProvider(t *testing.T) {
+	var gotPayload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/chat" {
+			t.Errorf("Expected path /v2/chat, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-api-key" {
+			t.Errorf("Expected the bearer authorization, got %q", got)
+		}
+		gotPayload = nil
+		if err := json.NewDecoder(r.Body).Decode(&gotPayload); err != nil {
+			t.Fatalf("failed to decode payload: %v", err)
+		}
+		if gotPayload["stream"] == true {
+			fmt.Fprint(w, "event: message-start\ndata: {\"type\":\"message-start\",\"id\":\"1\"}\n\n")
+			fmt.Fprint(w, "event: content-delta\ndata: {\"type\":\"content-delta\",\"index\":0,\"delta\":{\"message\":{\"content\":{\"text\":\"Bon\"}}}}\n\n")
+			fmt.Fprint(w, "event: content-delta\ndata: {\"type\":\"content-delta\",\"index\":0,\"delta\":{\"message\":{\"content\":{\"text\":\"jour\"}}}}\n\n")
+			fmt.Fprint(w, "event: message-end\ndata: {\"type\":\"message-end\",\"delta\":{\"finish_reason\":\"COMPLETE\",\"usage\":{\"billed_units\":{\"input_tokens\":5,\"output_tokens\":2},\"tokens\":{\"input_tokens\":70,\"output_tokens\":2}}}}\n\n")
+			return
+		}
+		fmt.Fprintln(w, `{"id": "1", "finish_reason": "COMPLETE",
+			"message": {"role": "assistant", "content": [{"type": "text", "text": "Bon"}, {"type": "text", "text": "jour"}]},
+			"usage": {"billed_units": {"input_tokens": 5, "output_tokens": 2}}}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider, err := NewCohereAdapter(ProviderConfig{Model: "command-r-plus", APIKey: "test-api-key", BaseURL: server.URL}, l)
+	if err != nil {
+		t.Fatalf("NewCohereAdapter failed: %v", err)
+	}
+	req := &LLMRequest{Messages: []LLMMessage{
+		{Role: RoleSystem, Content: "Answer in French."},
+		{Role: RoleUser, Content: "Hello"},
+	}}
+
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Text != "Bonjour" || resp.FinishReason != "COMPLETE" {
+		t.Errorf("Expected the joined content text and finish reason, got %q and %q", resp.Text, resp.FinishReason)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 5 || resp.Usage.CompletionTokens != 2 || resp.Usage.TotalTokens != 7 {
+		t.Errorf("Expected the billed units usage, got %+v", resp.Usage)
+	}
+	messages, _ := gotPayload["messages"].([]any)
+	if len(messages) != 2 || messages[0].(map[string]any)["role"] != "system" {
+		t.Errorf("Expected the system and user messages, got %v", gotPayload["messages"])
+	}
+
+	var deltas string
+	resp, err = provider.Stream(context.Background(), req, func(d Delta) { deltas += d.Text })
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if deltas != "Bonjour" || resp.Text != "Bonjour" || resp.FinishReason != "COMPLETE" {
+		t.Errorf("Expected the content-delta texts, got deltas %q, text %q and finish reason %q", deltas, resp.Text, resp.FinishReason)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 70 || resp.Usage.Estimated {
+		t.Errorf("Expected the tokens usage of message-end, got %+v", resp.Usage)
+	}
+
+	if _, err := NewCohereAdapter(ProviderConfig{Model: "command-r-plus", BaseURL: server.URL}, l); err == nil {
+		t.Error("Expected an error without API key, got nil")
+	}
+}
+
+func TestToCohereMessages(t *testing.T) {
+	msgs := toCohereMessages([]LLMMessage{
+		{Role: RoleUser, Content: "Weather in Lausanne?"},
+		{Role: RoleAssistant, Content: "I will look it up.", ToolCalls: []ToolCall{
+			{ID: "call_1", Name: "get_weather", Arguments: json.RawMessage(`"{\"city\":\"Lausanne\"}"`)},
+		}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: "sunny"},
+	})
+	assistant := msgs[1]
+	if assistant["tool_plan"] != "I will look it up." || assistant["content"] != nil {
+		t.Errorf("Expected the assistant text as tool_plan without content, got %v", assistant)
+	}
+	calls := assistant["tool_calls"].([]map[string]any)
+	if args := calls[0]["function"].(map[string]any)["arguments"]; args != `{"city":"Lausanne"}` {
+		t.Errorf("Expected the arguments as a JSON object string, got %v", args)
+	}
+	if msgs[2]["tool_call_id"] != "call_1" || msgs[2]["content"] != "sunny" {
+		t.Errorf("Expected the tool result with its tool_call_id, got %v", msgs[2])
+	}
+}
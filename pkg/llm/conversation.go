@@ -1,7 +1,11 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"slices"
 	"sync"
@@ -9,10 +13,14 @@ import (
 
 // Conversation manages a thread-safe history of LLM messages.
 // It supports system prompts, user/assistant turns, and tool results.
+// All methods are safe for concurrent use; an assistant answer can be streamed in with BeginAssistantTurn
+// while other goroutines read MessagesCopy. The exported Messages field must not be accessed directly concurrently.
 type Conversation struct {
 	mu           sync.RWMutex
 	Messages     []LLMMessage
 	SystemPrompt string // Cache for easy access
+	// openTurns are the assistant turns being streamed, whose index follows the removals, guarded by mu
+	openTurns []*AssistantTurn
 }
 
 // NewConversation creates a new conversation with the given system prompt.
@@ -53,6 +61,7 @@ func (c *Conversation) AddAssistantResponse(resp *LLMResponse) {
 	c.Messages = append(c.Messages, LLMMessage{
 		Role:      RoleAssistant,
 		Content:   resp.Text,
+		Reasoning: resp.Reasoning,
 		ToolCalls: resp.ToolCalls,
 	})
 }
@@ -77,3 +86,240 @@ func (c *Conversation) MessagesCopy() []LLMMessage {
 	defer c.mu.RUnlock()
 	return slices.Clone(c.Messages) // Go 1.21+ for immutability
 }
+
+// conversationSnapshotVersion is the version of the format written by SaveTo.
+const conversationSnapshotVersion = 1
+
+// conversationSnapshot is the JSON checkpoint of a Conversation.
+type conversationSnapshot struct {
+	Version      int          `json:"version"`
+	SystemPrompt string       `json:"system_prompt"`
+	Messages     []LLMMessage `json:"messages"`
+}
+
+// SaveTo writes the conversation as JSON to w, to checkpoint it across process restarts.
+// The messages are copied under the read lock, so it is safe against concurrent appends.
+func (c *Conversation) SaveTo(w io.Writer) error {
+	c.mu.RLock()
+	snapshot := conversationSnapshot{
+		Version:      conversationSnapshotVersion,
+		SystemPrompt: c.SystemPrompt,
+		Messages:     slices.Clone(c.Messages),
+	}
+	c.mu.RUnlock()
+	// not indented, so that the tool call arguments are saved exactly as received
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	return nil
+}
+
+// LoadConversation reads a conversation written by SaveTo, ready to be continued with AddUserMessage etc.
+// Tool call IDs and tool result messages are restored as they were saved.
+func LoadConversation(r io.Reader) (*Conversation, error) {
+	var snapshot conversationSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to load conversation: %w", err)
+	}
+	if snapshot.Version != conversationSnapshotVersion {
+		return nil, fmt.Errorf("failed to load conversation: unsupported version %d", snapshot.Version)
+	}
+	if snapshot.SystemPrompt == "" {
+		return nil, errors.New("failed to load conversation: system prompt cannot be empty")
+	}
+	if len(snapshot.Messages) == 0 || snapshot.Messages[0].Role != RoleSystem {
+		return nil, errors.New("failed to load conversation: the first message must be the system prompt")
+	}
+	return &Conversation{Messages: snapshot.Messages, SystemPrompt: snapshot.SystemPrompt}, nil
+}
+
+// TrimToTokenBudget drops the oldest non-system messages until the estimated tokens of the conversation
+// fit in maxTokens, and returns the number of messages removed. System messages are always kept,
+// and an assistant message with tool calls is dropped along with its tool results so no result is orphaned.
+// estimator returns the tokens of a message, nil uses the default TokenEstimator (see RegisterTokenEstimator),
+// use MessageTokens to count them with the estimator of a provider.
+// Fewer messages than needed are removed when only system messages remain.
+func (c *Conversation) TrimToTokenBudget(maxTokens int, estimator func(LLMMessage) int) int {
+	if estimator == nil {
+		estimator = MessageTokens(TokenEstimatorFor(""))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := 0
+	for _, msg := range c.Messages {
+		total += estimator(msg)
+	}
+	removed := 0
+	for total > maxTokens {
+		start, end := c.oldestGroup()
+		if start == end {
+			break
+		}
+		for _, msg := range c.Messages[start:end] {
+			total -= estimator(msg)
+		}
+		c.removeMessages(start, end)
+		removed += end - start
+	}
+	return removed
+}
+
+// TrimToMessageCount drops the oldest non-system messages until at most n of them remain,
+// and returns the number of messages removed. As with TrimToTokenBudget, system messages are always kept
+// and tool calls are dropped with their results, so slightly more messages than needed can be removed.
+func (c *Conversation) TrimToMessageCount(n int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, msg := range c.Messages {
+		if msg.Role != RoleSystem {
+			count++
+		}
+	}
+	removed := 0
+	for count > max(n, 0) {
+		start, end := c.oldestGroup()
+		if start == end {
+			break
+		}
+		c.removeMessages(start, end)
+		count -= end - start
+		removed += end - start
+	}
+	return removed
+}
+
+// oldestGroup returns the bounds of the oldest non-system messages that must be removed together:
+// an assistant message with its following tool results, or a single message. start == end when there is none.
+// The caller must hold mu.
+func (c *Conversation) oldestGroup() (start, end int) {
+	start = slices.IndexFunc(c.Messages, func(msg LLMMessage) bool { return msg.Role != RoleSystem })
+	if start < 0 {
+		return 0, 0
+	}
+	end = start + 1
+	if c.Messages[start].Role == RoleAssistant && len(c.Messages[start].ToolCalls) > 0 {
+		for end < len(c.Messages) && c.Messages[end].Role == RoleTool {
+			end++
+		}
+	}
+	return start, end
+}
+
+// RegeneratePrep removes the turns following the last user message (the assistant answer and any tool turns),
+// leaving the conversation ready to be queried again, e.g. with a higher temperature.
+// The system prompt and the user turns are never removed.
+// Returns an error if there is no user message or nothing to remove after it.
+func (c *Conversation) RegeneratePrep() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lastUser := -1
+	for i := len(c.Messages) - 1; i >= 0; i-- {
+		if c.Messages[i].Role == RoleUser {
+			lastUser = i
+			break
+		}
+	}
+	if lastUser < 0 {
+		return errors.New("cannot regenerate: conversation has no user message")
+	}
+	if lastUser == len(c.Messages)-1 {
+		return errors.New("cannot regenerate: no assistant turn after the last user message")
+	}
+	c.removeMessages(lastUser+1, len(c.Messages))
+	return nil
+}
+
+// removeMessages deletes c.Messages[start:end], keeping the open assistant turns on their message:
+// the turns after the range are shifted, and the turns removed are finished. The caller must hold mu.
+func (c *Conversation) removeMessages(start, end int) {
+	c.Messages = slices.Delete(c.Messages, start, end)
+	c.openTurns = slices.DeleteFunc(c.openTurns, func(t *AssistantTurn) bool {
+		switch {
+		case t.index >= end:
+			t.index -= end - start
+		case t.index >= start:
+			t.finished = true
+			return true
+		}
+		return false
+	})
+}
+
+// Regenerate drops the last assistant turn with RegeneratePrep, queries provider again with req
+// using the remaining history as messages, and appends the new response to the conversation.
+func (c *Conversation) Regenerate(ctx context.Context, provider Provider, req *LLMRequest) (*LLMResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if err := c.RegeneratePrep(); err != nil {
+		return nil, err
+	}
+	regenReq := *req
+	regenReq.Messages = c.MessagesCopy()
+	resp, err := provider.Query(ctx, &regenReq)
+	if err != nil {
+		return nil, err
+	}
+	c.AddAssistantResponse(resp)
+	return resp, nil
+}
+
+// AssistantTurn is a handle on an assistant message being streamed into a Conversation,
+// as returned by BeginAssistantTurn.
+// AppendDelta and Finish are safe for concurrent use with each other and with the Conversation methods:
+// they take the conversation lock, so MessagesCopy always returns a consistent snapshot holding
+// the text received so far. The turn follows its message when older messages are trimmed or summarized,
+// and is finished when its message is removed. Once Finish has been called, further calls are no-ops.
+type AssistantTurn struct {
+	conv     *Conversation
+	index    int  // guarded by conv.mu
+	finished bool // guarded by conv.mu
+}
+
+// BeginAssistantTurn appends an empty assistant message and returns a handle to build it up
+// incrementally while a response is streamed, typically by calling AppendDelta from the onDelta callback
+// and Finish with the final response.
+func (c *Conversation) BeginAssistantTurn() *AssistantTurn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Messages = append(c.Messages, LLMMessage{Role: RoleAssistant})
+	turn := &AssistantTurn{conv: c, index: len(c.Messages) - 1}
+	c.openTurns = append(c.openTurns, turn)
+	return turn
+}
+
+// message returns the streamed message, or nil if the turn is finished or its message was removed
+// from the conversation (e.g. by RegeneratePrep). The caller must hold conv.mu.
+func (t *AssistantTurn) message() *LLMMessage {
+	if t.finished || t.index >= len(t.conv.Messages) {
+		return nil
+	}
+	return &t.conv.Messages[t.index]
+}
+
+// AppendDelta appends a text fragment to the assistant message.
+func (t *AssistantTurn) AppendDelta(text string) {
+	if text == "" {
+		return
+	}
+	t.conv.mu.Lock()
+	defer t.conv.mu.Unlock()
+	if msg := t.message(); msg != nil {
+		msg.Content += text
+	}
+}
+
+// Finish completes the assistant message with the final response text and tool calls.
+// When resp is nil (e.g. the stream failed), the text received so far is kept.
+func (t *AssistantTurn) Finish(resp *LLMResponse) {
+	t.conv.mu.Lock()
+	defer t.conv.mu.Unlock()
+	if msg := t.message(); msg != nil && resp != nil {
+		msg.Content = resp.Text
+		msg.Reasoning = resp.Reasoning
+		msg.ToolCalls = resp.ToolCalls
+	}
+	t.finished = true
+	t.conv.openTurns = slices.DeleteFunc(t.conv.openTurns, func(open *AssistantTurn) bool { return open == t })
+}
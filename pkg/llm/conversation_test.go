@@ -1,6 +1,13 @@
 package llm
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -72,4 +79,206 @@ func TestConversation(t *testing.T) {
 			t.Error("Original slice was modified when the copy changed, MessagesCopy is not returning a true copy.")
 		}
 	})
+
+	t.Run("RegeneratePrep", func(t *testing.T) {
+		convo, _ := NewConversation(systemPrompt)
+		if err := convo.RegeneratePrep(); err == nil {
+			t.Error("Expected error without user message, got nil")
+		}
+		convo.AddUserMessage("What's the weather?")
+		if err := convo.RegeneratePrep(); err == nil {
+			t.Error("Expected error when nothing follows the last user message, got nil")
+		}
+		convo.AddAssistantResponse(&LLMResponse{ToolCalls: []ToolCall{{ID: "call-1", Name: "get_weather"}}})
+		convo.AddToolResultMessage("call-1", `{"temp": 21}`)
+		convo.AddAssistantResponse(&LLMResponse{Text: "It's 21 degrees."})
+
+		if err := convo.RegeneratePrep(); err != nil {
+			t.Fatalf("RegeneratePrep failed: %v", err)
+		}
+		if len(convo.Messages) != 2 || convo.Messages[1].Role != RoleUser {
+			t.Errorf("Expected system and user messages to remain, got %#v", convo.Messages)
+		}
+	})
+
+	t.Run("Regenerate", func(t *testing.T) {
+		convo, _ := NewConversation(systemPrompt)
+		convo.AddUserMessage("Say hello")
+		convo.AddAssistantResponse(&LLMResponse{Text: "Hi"})
+
+		provider := &scriptedStreamProvider{deltas: []string{"Hello", "!"}}
+		resp, err := convo.Regenerate(context.Background(), provider, &LLMRequest{Temperature: 0.9})
+		if err != nil {
+			t.Fatalf("Regenerate failed: %v", err)
+		}
+		if resp.Text != "Hello!" {
+			t.Errorf("Expected 'Hello!', got '%s'", resp.Text)
+		}
+		if len(convo.Messages) != 3 || convo.Messages[2].Content != "Hello!" {
+			t.Errorf("Expected the regenerated answer to replace the previous one, got %#v", convo.Messages)
+		}
+	})
+	t.Run("AssistantTurn", func(t *testing.T) {
+		convo, _ := NewConversation(systemPrompt)
+		convo.AddUserMessage("Count to three")
+		turn := convo.BeginAssistantTurn()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for _, d := range []string{"one", " two", " three"} {
+				turn.AppendDelta(d)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				msgs := convo.MessagesCopy()
+				if last := msgs[len(msgs)-1]; last.Role != RoleAssistant {
+					t.Errorf("Expected the last message to be the streamed assistant turn, got %q", last.Role)
+					return
+				}
+			}
+		}()
+		wg.Wait()
+
+		msgs := convo.MessagesCopy()
+		if got := msgs[len(msgs)-1].Content; got != "one two three" {
+			t.Errorf("Expected the accumulated deltas 'one two three', got '%s'", got)
+		}
+		turn.Finish(&LLMResponse{Text: "one, two, three", ToolCalls: []ToolCall{{ID: "call-1", Name: "count"}}})
+		turn.AppendDelta(" four")
+		msgs = convo.MessagesCopy()
+		last := msgs[len(msgs)-1]
+		if len(msgs) != 3 || last.Content != "one, two, three" || len(last.ToolCalls) != 1 {
+			t.Errorf("Expected the final response to replace the streamed text, got %#v", msgs)
+		}
+	})
+
+	t.Run("AssistantTurnFinishNil", func(t *testing.T) {
+		convo, _ := NewConversation(systemPrompt)
+		convo.AddUserMessage("Hello")
+		turn := convo.BeginAssistantTurn()
+		turn.AppendDelta("Partial")
+		turn.Finish(nil)
+		if msgs := convo.MessagesCopy(); msgs[2].Content != "Partial" {
+			t.Errorf("Expected the partial text to be kept, got '%s'", msgs[2].Content)
+		}
+	})
+	t.Run("AssistantTurnAfterTrimming", func(t *testing.T) {
+		convo, _ := NewConversation(systemPrompt)
+		convo.AddUserMessage("Hi")
+		convo.AddAssistantResponse(&LLMResponse{Text: "Hello"})
+		convo.AddUserMessage("Count to two")
+		turn := convo.BeginAssistantTurn()
+		turn.AppendDelta("one")
+		if removed := convo.TrimToMessageCount(2); removed != 2 {
+			t.Fatalf("Expected the first turn to be trimmed, removed %d", removed)
+		}
+		turn.AppendDelta(" two")
+		turn.Finish(&LLMResponse{Text: "one, two"})
+		msgs := convo.MessagesCopy()
+		if len(msgs) != 3 || msgs[1].Content != "Count to two" || msgs[2].Content != "one, two" {
+			t.Errorf("Expected the streamed turn to follow its message after trimming, got %#v", msgs)
+		}
+
+		// a turn whose message was removed is finished, it doesn't write into another assistant message
+		convo.AddUserMessage("Again")
+		turn = convo.BeginAssistantTurn()
+		if err := convo.RegeneratePrep(); err != nil {
+			t.Fatalf("RegeneratePrep failed: %v", err)
+		}
+		convo.AddAssistantResponse(&LLMResponse{Text: "Regenerated"})
+		turn.AppendDelta("stale")
+		turn.Finish(&LLMResponse{Text: "stale"})
+		if msgs := convo.MessagesCopy(); msgs[len(msgs)-1].Content != "Regenerated" {
+			t.Errorf("Expected the removed turn to leave the new answer unchanged, got %#v", msgs)
+		}
+	})
+	t.Run("SaveAndLoad", func(t *testing.T) {
+		convo, _ := NewConversation(systemPrompt)
+		convo.AddUserMessage("What's the weather?")
+		convo.AddAssistantResponse(&LLMResponse{ToolCalls: []ToolCall{{ID: "call_abc123", Name: "get_weather", Arguments: json.RawMessage(`{"location":"Lausanne"}`)}}})
+		convo.AddToolResultMessage("call_abc123", `{"temp": 21}`)
+		convo.AddAssistantResponse(&LLMResponse{Text: "It's 21 degrees.", Reasoning: "The tool said 21."})
+
+		var buf bytes.Buffer
+		if err := convo.SaveTo(&buf); err != nil {
+			t.Fatalf("SaveTo failed: %v", err)
+		}
+		loaded, err := LoadConversation(&buf)
+		if err != nil {
+			t.Fatalf("LoadConversation failed: %v", err)
+		}
+		if loaded.SystemPrompt != systemPrompt || !reflect.DeepEqual(loaded.MessagesCopy(), convo.MessagesCopy()) {
+			t.Errorf("Expected the loaded conversation to match the saved one, got %#v", loaded.MessagesCopy())
+		}
+		if err := loaded.AddUserMessage("And tomorrow?"); err != nil {
+			t.Fatalf("AddUserMessage on loaded conversation failed: %v", err)
+		}
+		if msgs := loaded.MessagesCopy(); len(msgs) != 6 || msgs[3].ToolCallID != "call_abc123" {
+			t.Errorf("Expected the loaded conversation to be usable, got %#v", msgs)
+		}
+
+		for name, input := range map[string]string{
+			"InvalidJSON":     "{",
+			"UnknownVersion":  `{"version": 2, "system_prompt": "x", "messages": [{"role": "system", "content": "x"}]}`,
+			"NoSystemMessage": `{"version": 1, "system_prompt": "x", "messages": [{"role": "user", "content": "hi"}]}`,
+		} {
+			if _, err := LoadConversation(strings.NewReader(input)); err == nil {
+				t.Errorf("%s: expected an error, got nil", name)
+			}
+		}
+	})
+	t.Run("Trim", func(t *testing.T) {
+		newToolConvo := func() *Conversation {
+			convo, _ := NewConversation(systemPrompt)
+			convo.AddUserMessage("What's the weather?")
+			convo.AddAssistantResponse(&LLMResponse{ToolCalls: []ToolCall{{ID: "call-1", Name: "get_weather"}, {ID: "call-2", Name: "get_time"}}})
+			convo.AddToolResultMessage("call-1", `{"temp": 21}`)
+			convo.AddToolResultMessage("call-2", `{"time": "12:00"}`)
+			convo.AddAssistantResponse(&LLMResponse{Text: "It's 21 degrees at noon."})
+			convo.AddUserMessage("Thanks")
+			return convo
+		}
+		oneTokenPerMessage := func(LLMMessage) int { return 1 }
+
+		tests := []struct {
+			name        string
+			trim        func(c *Conversation) int
+			wantRemoved int
+			wantRoles   []Role
+		}{
+			{"BudgetFits", func(c *Conversation) int { return c.TrimToTokenBudget(7, oneTokenPerMessage) }, 0,
+				[]Role{RoleSystem, RoleUser, RoleAssistant, RoleTool, RoleTool, RoleAssistant, RoleUser}},
+			{"BudgetDropsUser", func(c *Conversation) int { return c.TrimToTokenBudget(6, oneTokenPerMessage) }, 1,
+				[]Role{RoleSystem, RoleAssistant, RoleTool, RoleTool, RoleAssistant, RoleUser}},
+			{"BudgetKeepsToolPairs", func(c *Conversation) int { return c.TrimToTokenBudget(5, oneTokenPerMessage) }, 4,
+				[]Role{RoleSystem, RoleAssistant, RoleUser}},
+			{"BudgetKeepsSystem", func(c *Conversation) int { return c.TrimToTokenBudget(0, oneTokenPerMessage) }, 6,
+				[]Role{RoleSystem}},
+			{"DefaultEstimator", func(c *Conversation) int { return c.TrimToTokenBudget(EstimateMessagesTokens(c.MessagesCopy()), nil) }, 0,
+				[]Role{RoleSystem, RoleUser, RoleAssistant, RoleTool, RoleTool, RoleAssistant, RoleUser}},
+			{"Count", func(c *Conversation) int { return c.TrimToMessageCount(2) }, 4,
+				[]Role{RoleSystem, RoleAssistant, RoleUser}},
+			{"CountZero", func(c *Conversation) int { return c.TrimToMessageCount(0) }, 6,
+				[]Role{RoleSystem}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				convo := newToolConvo()
+				if removed := tt.trim(convo); removed != tt.wantRemoved {
+					t.Errorf("Expected %d messages removed, got %d", tt.wantRemoved, removed)
+				}
+				var roles []Role
+				for _, msg := range convo.MessagesCopy() {
+					roles = append(roles, msg.Role)
+				}
+				if !slices.Equal(roles, tt.wantRoles) {
+					t.Errorf("Expected roles %v, got %v", tt.wantRoles, roles)
+				}
+			})
+		}
+	})
 }
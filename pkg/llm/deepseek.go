@@ -0,0 +1,22 @@
+package llm
+
+import (
+	"fmt"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// NewDeepSeekAdapter returns a provider for the OpenAI-compatible DeepSeek API.
+// The reasoning of deepseek-reasoner (R1) is returned in LLMResponse.Reasoning.
+func NewDeepSeekAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("deepseek: missing API key")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("deepseek: missing model")
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("deepseek: missing baseURl")
+	}
+	return NewOpenAICompatAdapter(cfg, ProviderDeepSeek, cfg.BaseURL, l)
+}
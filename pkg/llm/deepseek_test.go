@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestDeepSeekProviderReasoning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "reasoning_content": "9.11 < 9.8 since 0.11 < 0.8", "content": "9.8 is greater"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider, err := NewDeepSeekAdapter(ProviderConfig{Model: "deepseek-reasoner", APIKey: "test-api-key", BaseURL: server.URL}, l)
+	if err != nil {
+		t.Fatalf("NewDeepSeekAdapter failed: %v", err)
+	}
+	resp, err := provider.Query(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Which is greater, 9.11 or 9.8?"}}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Text != "9.8 is greater" {
+		t.Errorf("Expected the answer without the reasoning, got '%s'", resp.Text)
+	}
+	if resp.Reasoning != "9.11 < 9.8 since 0.11 < 0.8" {
+		t.Errorf("Expected the reasoning_content in Reasoning, got '%s'", resp.Reasoning)
+	}
+
+	if _, err := NewDeepSeekAdapter(ProviderConfig{Model: "deepseek-chat", BaseURL: server.URL}, l); err == nil {
+		t.Error("Expected an error without API key, got nil")
+	}
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// RequestPayload is the HTTP request a provider would send for an LLMRequest, as returned by BuildRequestPayload.
+// The body is the JSON before the optional gzip compression, and the X-Request-ID header is only set when sending.
+type RequestPayload struct {
+	Method string
+	URL    string
+	// Header holds the request headers, the credentials being replaced by "[REDACTED]"
+	Header http.Header
+	Body   json.RawMessage
+}
+
+// PayloadBuilder is implemented by the providers able to build their HTTP request without sending it.
+type PayloadBuilder interface {
+	BuildRequestPayload(req *LLMRequest) (*RequestPayload, error)
+}
+
+// credentialHeaders are the headers carrying the API key of a provider, redacted in a RequestPayload.
+var credentialHeaders = []string{"Authorization", "Api-Key", "X-Goog-Api-Key"}
+
+// BuildRequestPayload returns the HTTP request that provider would send for req without sending it (a "dry run"),
+// e.g. to inspect or diff the payloads of several providers. The streaming request is built when req.Stream is set.
+// The payload is built like Query and Stream do, after the OnRequest hook, so the same validation errors are returned.
+func BuildRequestPayload(provider Provider, req *LLMRequest) (*RequestPayload, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if cached, ok := provider.(*CachedProvider); ok {
+		provider = cached.Provider
+	}
+	builder, ok := provider.(PayloadBuilder)
+	if !ok {
+		return nil, fmt.Errorf("provider %T cannot build request payloads", provider)
+	}
+	return builder.BuildRequestPayload(req)
+}
+
+// dryRunRequest returns the copy of req whose payload a dry run builds, with the OnRequest hook of h applied
+// like Query and Stream do, req itself is left unchanged.
+func dryRunRequest(req *LLMRequest, h callHooks) *LLMRequest {
+	dryReq := *req
+	dryReq.Messages = slices.Clone(req.Messages)
+	dryReq.ExtraHeaders = maps.Clone(req.ExtraHeaders)
+	if h.onRequest != nil {
+		h.onRequest(&dryReq)
+	}
+	return &dryReq
+}
+
+// newRequestPayload marshals payload like the providers do and returns the POST request to url with a redacted copy of header.
+func newRequestPayload(url string, header http.Header, payload any) (*RequestPayload, error) {
+	body, err := marshalRequestBody(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
+	}
+	redacted := header.Clone()
+	for key := range redacted {
+		// some providers set their headers with a non canonical key, like x-goog-api-key
+		if slices.Contains(credentialHeaders, http.CanonicalHeaderKey(key)) {
+			redacted[key] = []string{redactedValue}
+		}
+	}
+	return &RequestPayload{Method: http.MethodPost, URL: url, Header: redacted, Body: body}, nil
+}
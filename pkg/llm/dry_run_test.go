@@ -0,0 +1,173 @@
+package llm
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestBuildRequestPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no request in a dry run, got %s %s", r.Method, r.URL)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	tests := []struct {
+		name       string
+		provider   Provider
+		wantURL    string
+		wantStream string
+		authHeader string
+	}{
+		{
+			name:       "OpenAICompatible",
+			provider:   &openAICompatibleProvider{BaseURL: server.URL, APIKey: "secret", Model: "gpt-4o-mini", Endpoint: "/chat/completions", StreamUsage: true, l: l},
+			wantURL:    server.URL + "/chat/completions",
+			wantStream: server.URL + "/chat/completions",
+			authHeader: "Authorization",
+		},
+		{
+			name:       "Gemini",
+			provider:   &GeminiProvider{BaseURL: server.URL, APIKey: "secret", Model: "gemini-2.5-flash", l: l},
+			wantURL:    server.URL + "/v1beta/models/gemini-2.5-flash/:generateContent",
+			wantStream: server.URL + "/v1beta/models/gemini-2.5-flash/:streamGenerateContent",
+			authHeader: "x-goog-api-key",
+		},
+		{
+			name:       "Ollama",
+			provider:   &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", l: l},
+			wantURL:    server.URL + "/api/chat",
+			wantStream: server.URL + "/api/chat",
+		},
+		{
+			name:       "Cohere",
+			provider:   &CohereProvider{BaseURL: server.URL, APIKey: "secret", Model: "command-r-plus", l: l},
+			wantURL:    server.URL + "/v2/chat",
+			wantStream: server.URL + "/v2/chat",
+			authHeader: "Authorization",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &LLMRequest{
+				Messages:     []LLMMessage{{Role: RoleUser, Content: "Hello"}},
+				ExtraHeaders: map[string]string{"X-Trace": "dry"},
+			}
+			payload, err := BuildRequestPayload(tt.provider, req)
+			if err != nil {
+				t.Fatalf("BuildRequestPayload failed: %v", err)
+			}
+			if payload.Method != http.MethodPost || payload.URL != tt.wantURL {
+				t.Errorf("Expected POST %s, got %s %s", tt.wantURL, payload.Method, payload.URL)
+			}
+			if !json.Valid(payload.Body) {
+				t.Errorf("Expected a JSON body, got %s", payload.Body)
+			}
+			if got := payload.Header.Get("X-Trace"); got != "dry" {
+				t.Errorf("Expected the request extra headers, got %q", got)
+			}
+			if tt.authHeader != "" {
+				// indexed as sent, the Gemini header key is not canonical
+				if got := payload.Header[tt.authHeader]; len(got) != 1 || got[0] != redactedValue {
+					t.Errorf("Expected the %s header to be redacted, got %q", tt.authHeader, got)
+				}
+			}
+
+			req.Stream = true
+			streamPayload, err := BuildRequestPayload(tt.provider, req)
+			if err != nil {
+				t.Fatalf("BuildRequestPayload failed for a stream: %v", err)
+			}
+			if streamPayload.URL != tt.wantStream {
+				t.Errorf("Expected the stream URL %s, got %s", tt.wantStream, streamPayload.URL)
+			}
+			if string(streamPayload.Body) == "" {
+				t.Error("Expected a stream body")
+			}
+		})
+	}
+
+	t.Run("StreamOptions", func(t *testing.T) {
+		provider := &openAICompatibleProvider{BaseURL: server.URL, Model: "gpt-4o-mini", Endpoint: "/chat/completions", StreamUsage: true, l: l}
+		req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, Stream: true}
+		payload, err := BuildRequestPayload(NewCachedProvider(provider, time.Minute, l), req)
+		if err != nil {
+			t.Fatalf("BuildRequestPayload failed: %v", err)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(payload.Body, &body); err != nil || body["stream"] != true || body["stream_options"] == nil {
+			t.Errorf("Expected a streaming body with stream_options, got %s", payload.Body)
+		}
+		if payload.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("Expected the SSE Accept header, got %v", payload.Header)
+		}
+	})
+
+	t.Run("Mistral", func(t *testing.T) {
+		provider, err := NewMistralAdapter(ProviderConfig{Model: "mistral-small-latest", APIKey: "secret", BaseURL: server.URL}, l)
+		if err != nil {
+			t.Fatalf("NewMistralAdapter failed: %v", err)
+		}
+		req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, Temperature: 1.6}
+		payload, err := BuildRequestPayload(provider, req)
+		if err != nil {
+			t.Fatalf("BuildRequestPayload failed: %v", err)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(payload.Body, &body); err != nil || body["temperature"] != 1.0 {
+			t.Errorf("Expected the temperature clamped to 1 like Query does, got %s", payload.Body)
+		}
+	})
+
+	t.Run("OnRequestHook", func(t *testing.T) {
+		hook := func(req *LLMRequest) {
+			req.Model = "hooked-model"
+			req.Messages[0].Content = "Hooked"
+			req.ExtraHeaders["X-Hooked"] = "yes"
+		}
+		providers := map[string]func() (Provider, error){
+			"OpenAICompatible": func() (Provider, error) {
+				return NewOpenAICompatAdapter(ProviderConfig{Model: "gpt-4o-mini", APIKey: "secret", OnRequest: hook}, ProviderOpenAI, server.URL, l)
+			},
+			"Mistral": func() (Provider, error) {
+				return NewMistralAdapter(ProviderConfig{Model: "mistral-small-latest", APIKey: "secret", BaseURL: server.URL, OnRequest: hook}, l)
+			},
+		}
+		for name, newProvider := range providers {
+			provider, err := newProvider()
+			if err != nil {
+				t.Fatalf("%s: failed to create the provider: %v", name, err)
+			}
+			req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, ExtraHeaders: map[string]string{"X-Trace": "dry"}}
+			payload, err := BuildRequestPayload(provider, req)
+			if err != nil {
+				t.Fatalf("%s: BuildRequestPayload failed: %v", name, err)
+			}
+			var body struct {
+				Model    string       `json:"model"`
+				Messages []LLMMessage `json:"messages"`
+			}
+			if err := json.Unmarshal(payload.Body, &body); err != nil || body.Model != "hooked-model" || len(body.Messages) != 1 || body.Messages[0].Content != "Hooked" {
+				t.Errorf("%s: Expected the payload of the hooked request, got %s", name, payload.Body)
+			}
+			if got := payload.Header.Get("X-Hooked"); got != "yes" {
+				t.Errorf("%s: Expected the header set by the hook, got %q", name, got)
+			}
+			if req.Model != "" || req.Messages[0].Content != "Hello" || len(req.ExtraHeaders) != 1 {
+				t.Errorf("%s: Expected the caller request to be left unchanged, got %#v", name, req)
+			}
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		if _, err := BuildRequestPayload(&scriptedStreamProvider{}, &LLMRequest{}); err == nil {
+			t.Error("Expected an error for a provider without payload builder, got nil")
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrNotSupported is returned when a provider doesn't support the requested feature.
+var ErrNotSupported = errors.New("not supported by this provider")
+
+// Default batching of the embeddings, see EmbedRequest.BatchSize and EmbedRequest.Concurrency.
+const (
+	// openAIEmbedBatchSize is the maximum number of inputs of an OpenAI /embeddings request
+	openAIEmbedBatchSize = 2048
+	// ollamaEmbedBatchSize is 1 because /api/embeddings takes a single prompt
+	ollamaEmbedBatchSize = 1
+	// defaultEmbedConcurrency bounds the requests sent at a time to the cloud providers,
+	// a local Ollama server gets them one at a time so that it isn't overloaded
+	defaultEmbedConcurrency = 4
+	ollamaEmbedConcurrency  = 1
+)
+
+// EmbedRequest asks for the embeddings of each Input string.
+// Large inputs lists are split in batches of BatchSize inputs, sent Concurrency at a time,
+// both defaulting to values suited to the provider when zero.
+// With Normalize, the vectors are L2-normalized (see NormalizeL2), so that their dot product is their cosine similarity.
+type EmbedRequest struct {
+	Model       string   `json:"model"`
+	Input       []string `json:"input"`
+	BatchSize   int      `json:"-"`
+	Concurrency int      `json:"-"`
+	Normalize   bool     `json:"-"`
+}
+
+// EmbedResponse holds one embedding vector per input, in the same order as EmbedRequest.Input.
+// When some batches failed, Errors holds the error of each input (nil for the embedded ones, whose vector is set)
+// and Embed returns the response along with an error.
+type EmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+	Usage      *Usage      `json:"usage,omitempty"`
+	Errors     []error     `json:"-"`
+}
+
+// Embedder is implemented by providers able to compute embeddings, use a type assertion to access it:
+//
+//	resp, err := provider.(llm.Embedder).Embed(ctx, &llm.EmbedRequest{Model: "text-embedding-3-small", Input: texts})
+type Embedder interface {
+	Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error)
+}
+
+// validateEmbedRequest checks the common EmbedRequest requirements.
+func validateEmbedRequest(req *EmbedRequest) error {
+	if req == nil {
+		return errors.New("request cannot be nil")
+	}
+	if req.Model == "" {
+		return errors.New("embed request must have a model")
+	}
+	if len(req.Input) == 0 {
+		return errors.New("embed request must have at least one input")
+	}
+	return nil
+}
+
+// embedInBatches splits the inputs of req in batches of req.BatchSize (or batchSize) inputs, embeds them
+// with embed, req.Concurrency (or concurrency) batches at a time, and reassembles the vectors in input order.
+// A failed batch doesn't stop the others, its error is set on each of its inputs in EmbedResponse.Errors
+// and the partial response is returned with an error telling how many inputs failed.
+// The vectors are normalized when req.Normalize is set.
+func embedInBatches(ctx context.Context, req *EmbedRequest, batchSize, concurrency int, embed func(context.Context, *EmbedRequest) (*EmbedResponse, error)) (*EmbedResponse, error) {
+	resp, err := embedBatches(ctx, req, batchSize, concurrency, embed)
+	if resp != nil && req.Normalize {
+		for _, embedding := range resp.Embeddings {
+			NormalizeL2(embedding)
+		}
+	}
+	return resp, err
+}
+
+// embedBatches does the batching of embedInBatches.
+func embedBatches(ctx context.Context, req *EmbedRequest, batchSize, concurrency int, embed func(context.Context, *EmbedRequest) (*EmbedResponse, error)) (*EmbedResponse, error) {
+	if req.BatchSize > 0 {
+		batchSize = req.BatchSize
+	}
+	if req.Concurrency > 0 {
+		concurrency = req.Concurrency
+	}
+	if len(req.Input) <= batchSize {
+		return embed(ctx, req)
+	}
+
+	var batches []*EmbedRequest
+	for start := 0; start < len(req.Input); start += batchSize {
+		batch := *req
+		batch.Input = req.Input[start:min(start+batchSize, len(req.Input))]
+		batches = append(batches, &batch)
+	}
+	result := &EmbedResponse{Embeddings: make([][]float32, len(req.Input)), Errors: make([]error, len(req.Input))}
+	var failed []error
+	var mu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(concurrency, 1), len(batches)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := i * batchSize
+				resp, err := embed(ctx, batches[i])
+				if err == nil && len(resp.Embeddings) != len(batches[i].Input) {
+					err = fmt.Errorf("expected %d embeddings, got %d", len(batches[i].Input), len(resp.Embeddings))
+				}
+				mu.Lock()
+				if err != nil {
+					err = fmt.Errorf("embeddings batch of inputs %d to %d failed: %w", start, start+len(batches[i].Input)-1, err)
+					failed = append(failed, err)
+					for j := range batches[i].Input {
+						result.Errors[start+j] = err
+					}
+				} else {
+					copy(result.Embeddings[start:], resp.Embeddings)
+					if resp.Usage != nil {
+						if result.Usage == nil {
+							result.Usage = &Usage{}
+						}
+						result.Usage.PromptTokens += resp.Usage.PromptTokens
+						result.Usage.CompletionTokens += resp.Usage.CompletionTokens
+						result.Usage.TotalTokens += resp.Usage.TotalTokens
+						result.Usage.Estimated = result.Usage.Estimated || resp.Usage.Estimated
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range batches {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failed) == 0 {
+		result.Errors = nil
+		return result, nil
+	}
+	failedInputs := 0
+	for _, err := range result.Errors {
+		if err != nil {
+			failedInputs++
+		}
+	}
+	return result, fmt.Errorf("embeddings of %d of %d inputs failed: %w", failedInputs, len(req.Input), errors.Join(failed...))
+}
+
+// Embed computes the embeddings by POSTing to the OpenAI-compatible /embeddings endpoint,
+// in batches of at most 2048 inputs by default.
+func (p *openAICompatibleProvider) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	if err := validateEmbedRequest(req); err != nil {
+		return nil, err
+	}
+	return embedInBatches(ctx, req, openAIEmbedBatchSize, defaultEmbedConcurrency, p.embed)
+}
+
+// embed sends a single /embeddings request with all the inputs of req.
+func (p *openAICompatibleProvider) embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+	p.setAuthHeader(headers)
+	setExtraHeaders(headers, p.ExtraHeaders)
+
+	type embeddingsResponse struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Usage *Usage `json:"usage,omitempty"`
+	}
+	resp, rawBody, err := httpPostRequest[EmbedRequest, embeddingsResponse](ctx, p.Client, p.BaseURL+endpointPath(p.EmbeddingsEndpoint, defaultEmbeddingsEndpoint), headers, *req, p.RetryPolicy, p.GzipRequests, p.l)
+	if err != nil {
+		setAPIErrorProvider(err, p.Kind)
+		return nil, fmt.Errorf("embeddings request failed: %w (raw body: %s)", err, string(rawBody))
+	}
+	if len(resp.Data) != len(req.Input) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(req.Input), len(resp.Data))
+	}
+	embeddings := make([][]float32, len(resp.Data))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(embeddings) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	return &EmbedResponse{Embeddings: embeddings, Usage: resp.Usage}, nil
+}
+
+// Embed computes the embeddings with Ollama's /api/embeddings endpoint, which takes a single prompt,
+// so one request is sent per input (one at a time by default).
+func (o *OllamaProvider) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	if err := validateEmbedRequest(req); err != nil {
+		return nil, err
+	}
+	return embedInBatches(ctx, req, ollamaEmbedBatchSize, ollamaEmbedConcurrency, o.embed)
+}
+
+// embed sends one /api/embeddings request per input of req.
+func (o *OllamaProvider) embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	type ollamaEmbeddingsRequest struct {
+		Model  string `json:"model"`
+		Prompt string `json:"prompt"`
+	}
+	type ollamaEmbeddingsResponse struct {
+		Embedding []float32 `json:"embedding"`
+	}
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+	setExtraHeaders(headers, o.ExtraHeaders)
+	embeddings := make([][]float32, 0, len(req.Input))
+	for i, input := range req.Input {
+		payload := ollamaEmbeddingsRequest{Model: req.Model, Prompt: input}
+		resp, rawBody, err := httpPostRequest[ollamaEmbeddingsRequest, ollamaEmbeddingsResponse](ctx, o.Client, o.BaseURL+"/api/embeddings", headers, payload, o.RetryPolicy, o.GzipRequests, o.l)
+		if err != nil {
+			setAPIErrorProvider(err, ProviderOllama)
+			return nil, fmt.Errorf("ollama embeddings request for input %d failed: %w (raw body: %s)", i, err, string(rawBody))
+		}
+		embeddings = append(embeddings, resp.Embedding)
+	}
+	return &EmbedResponse{Embeddings: embeddings}, nil
+}
+
+// Embed is not implemented for Gemini yet, it always returns ErrNotSupported.
+func (g *GeminiProvider) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	return nil, fmt.Errorf("gemini embeddings: %w", ErrNotSupported)
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestOpenAICompatProviderEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			t.Errorf("Expected path /embeddings, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Tenant"); got != "acme" {
+			t.Errorf("Expected the extra header X-Tenant: acme, got %q", got)
+		}
+		var req EmbedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "text-embedding-3-small" || len(req.Input) != 2 {
+			t.Errorf("Unexpected request: %#v", req)
+		}
+		// data is deliberately out of order, index must be honored
+		fmt.Fprint(w, `{"data": [{"index": 1, "embedding": [0.3, 0.4]}, {"index": 0, "embedding": [0.1, 0.2]}],
+			"usage": {"prompt_tokens": 4, "total_tokens": 4}}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	var provider Provider = &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), ExtraHeaders: map[string]string{"x-tenant": "acme"}, l: l}
+	resp, err := provider.(Embedder).Embed(context.Background(), &EmbedRequest{Model: "text-embedding-3-small", Input: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if len(resp.Embeddings) != 2 || resp.Embeddings[0][0] != 0.1 || resp.Embeddings[1][1] != 0.4 {
+		t.Errorf("Unexpected embeddings: %v", resp.Embeddings)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 4 {
+		t.Errorf("Expected usage total 4, got %#v", resp.Usage)
+	}
+}
+
+func TestOllamaProviderEmbed(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embeddings" {
+			t.Errorf("Expected path /api/embeddings, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Tenant"); got != "acme" {
+			t.Errorf("Expected the extra header X-Tenant: acme, got %q", got)
+		}
+		calls++
+		fmt.Fprintf(w, `{"embedding": [%d, 0.5]}`, calls)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &OllamaProvider{BaseURL: server.URL, Client: server.Client(), ExtraHeaders: map[string]string{"x-tenant": "acme"}, l: l}
+	resp, err := provider.Embed(context.Background(), &EmbedRequest{Model: "nomic-embed-text", Input: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if calls != 2 || len(resp.Embeddings) != 2 || resp.Embeddings[1][0] != 2 {
+		t.Errorf("Expected one request per input, got %d calls and %v", calls, resp.Embeddings)
+	}
+}
+
+func TestEmbedInBatches(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req EmbedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Input) > 2 {
+			t.Errorf("Expected batches of at most 2 inputs, got %d", len(req.Input))
+		}
+		var data []map[string]any
+		for i, input := range req.Input {
+			if input == "bad" {
+				http.Error(w, `{"error": "invalid input"}`, http.StatusBadRequest)
+				return
+			}
+			// the embedding of an input "<n>" is [n]
+			n, _ := strconv.Atoi(input)
+			data = append(data, map[string]any{"index": i, "embedding": []float32{float32(n)}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data, "usage": map[string]int{"prompt_tokens": len(req.Input), "total_tokens": len(req.Input)}})
+	}))
+	defer server.Close()
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), l: l}
+
+	t.Run("ReassembledInOrder", func(t *testing.T) {
+		calls.Store(0)
+		resp, err := provider.Embed(context.Background(), &EmbedRequest{Model: "m", Input: []string{"0", "1", "2", "3", "4"}, BatchSize: 2, Concurrency: 2})
+		if err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+		if calls.Load() != 3 {
+			t.Errorf("Expected 3 batches, got %d requests", calls.Load())
+		}
+		for i, embedding := range resp.Embeddings {
+			if len(embedding) != 1 || embedding[0] != float32(i) {
+				t.Errorf("Expected embedding %d to be [%d], got %v", i, i, embedding)
+			}
+		}
+		if resp.Errors != nil || resp.Usage == nil || resp.Usage.TotalTokens != 5 {
+			t.Errorf("Expected no errors and the summed usage, got %v and %#v", resp.Errors, resp.Usage)
+		}
+	})
+
+	t.Run("PartialFailure", func(t *testing.T) {
+		resp, err := provider.Embed(context.Background(), &EmbedRequest{Model: "m", Input: []string{"0", "1", "bad", "3", "4"}, BatchSize: 2})
+		if err == nil || resp == nil {
+			t.Fatalf("Expected the partial response with an error, got %v and %v", resp, err)
+		}
+		for i, inputErr := range resp.Errors {
+			failed := i == 2 || i == 3 // the batch of "bad"
+			if failed != (inputErr != nil) || failed != (resp.Embeddings[i] == nil) {
+				t.Errorf("Expected input %d failed: %t, got error %v and embedding %v", i, failed, inputErr, resp.Embeddings[i])
+			}
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected the APIError of the failed batch to be wrapped, got %v", err)
+		}
+	})
+}
+
+func TestGeminiProviderEmbedNotSupported(t *testing.T) {
+	_, err := (&GeminiProvider{}).Embed(context.Background(), &EmbedRequest{Model: "m", Input: []string{"a"}})
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported, got %v", err)
+	}
+}
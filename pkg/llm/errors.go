@@ -0,0 +1,213 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrProviderUnavailable matches with errors.Is the APIError of a provider temporarily unable to serve requests,
+// because of a maintenance or an overload (503 Service Unavailable or 529 Overloaded). Unlike a rate limit,
+// it doesn't depend on the caller, the request can be sent again later as is.
+var ErrProviderUnavailable = errors.New("provider temporarily unavailable")
+
+// statusOverloaded is the non-standard status returned by some providers when they are overloaded.
+const statusOverloaded = 529
+
+// APIError is returned when a provider answers with a non-2xx HTTP status.
+// Use errors.As to inspect it, or the IsRateLimited, IsAuthError and IsProviderUnavailable helpers.
+type APIError struct {
+	StatusCode int
+	Body       []byte
+	Provider   ProviderKind // empty when the provider couldn't be identified
+	// Message is the error message extracted from the body, or the raw body when it couldn't be parsed
+	Message string
+	// Attempts is the number of requests sent, more than 1 when the request was retried
+	Attempts int
+	// RetryAfter is the wait suggested by the Retry-After header of the response, zero when absent
+	RetryAfter time.Duration
+}
+
+// maxAPIErrorMessageLen limits the length of a raw body used as message.
+const maxAPIErrorMessageLen = 500
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Provider != "" {
+		b.WriteString(string(e.Provider) + ": ")
+	}
+	fmt.Fprintf(&b, "received non-2xx status code %d", e.StatusCode)
+	if e.Attempts > 1 {
+		fmt.Fprintf(&b, " after %d attempt(s)", e.Attempts)
+	}
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	if e.RetryAfter > 0 {
+		fmt.Fprintf(&b, " (retry after %s)", e.RetryAfter)
+	}
+	return b.String()
+}
+
+// Is makes errors.Is(err, ErrProviderUnavailable) true for the responses of an unavailable provider.
+func (e *APIError) Is(target error) bool {
+	return target == ErrProviderUnavailable &&
+		(e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == statusOverloaded)
+}
+
+// ErrContextTooLarge is returned by ValidateContextFit when the prompt likely exceeds the context window of the model.
+type ErrContextTooLarge struct {
+	Model string
+	// Estimated is the estimated prompt tokens, Allowed the context size minus the tokens reserved for the answer
+	Estimated int
+	Allowed   int
+}
+
+func (e *ErrContextTooLarge) Error() string {
+	return fmt.Sprintf("prompt of ~%d estimated tokens exceeds the %d tokens allowed by the context window of model %s",
+		e.Estimated, e.Allowed, e.Model)
+}
+
+// ErrBudgetExceeded is returned by the providers wrapped by a BudgetManager once its token or cost budget is exhausted.
+type ErrBudgetExceeded struct {
+	Resource string // "tokens" or "cost"
+	Used     float64
+	Limit    float64
+	// Window is the sliding window of the budget, zero for a total budget
+	Window time.Duration
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	period := "in total"
+	if e.Window > 0 {
+		period = "over the last " + e.Window.String()
+	}
+	if e.Resource == "cost" {
+		return fmt.Sprintf("budget exceeded: $%.4f spent %s, limit is $%.4f", e.Used, period, e.Limit)
+	}
+	return fmt.Sprintf("budget exceeded: %.0f %s used %s, limit is %.0f", e.Used, e.Resource, period, e.Limit)
+}
+
+// ContentBlockedError is returned when the provider refused to answer because of its content safety filters.
+type ContentBlockedError struct {
+	Provider ProviderKind
+	Safety   SafetyInfo
+}
+
+func (e *ContentBlockedError) Error() string {
+	reason := FirstNonEmpty(e.Safety.BlockReason, "SAFETY")
+	msg := fmt.Sprintf("%s blocked response: %s", strings.ToLower(string(e.Provider)), reason)
+	if categories := e.Safety.flaggedCategories(); len(categories) > 0 {
+		msg += " (" + strings.Join(categories, ", ") + ")"
+	}
+	return msg
+}
+
+// flaggedCategories returns the categories that caused a block,
+// or the ones rated with a MEDIUM or HIGH probability of harm when none is marked as blocked.
+func (s SafetyInfo) flaggedCategories() []string {
+	var blocked, likely []string
+	for _, r := range s.Ratings {
+		if r.Blocked {
+			blocked = append(blocked, r.Category)
+		}
+		if r.Probability == "MEDIUM" || r.Probability == "HIGH" {
+			likely = append(likely, r.Category)
+		}
+	}
+	if len(blocked) > 0 {
+		return blocked
+	}
+	return likely
+}
+
+// newAPIError creates an APIError from a response status, header and body,
+// extracting the message from the usual error bodies of the providers.
+func newAPIError(statusCode int, header http.Header, body []byte, kind ProviderKind, attempts int) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Body:       body,
+		Provider:   kind,
+		Message:    FirstNonEmpty(parseAPIErrorMessage(body), http.StatusText(statusCode)),
+		Attempts:   attempts,
+	}
+	if retryAfter, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+		apiErr.RetryAfter = retryAfter
+	}
+	return apiErr
+}
+
+// parseAPIErrorMessage extracts the message of an error body like {"error": {"message": "..."}} (OpenAI, Gemini),
+// {"error": "..."} (Ollama) or {"message": "..."}, and falls back to the (truncated) raw body.
+// For an HTML page, like the ones of a maintenance or a proxy error, it is the page title, if any.
+func parseAPIErrorMessage(body []byte) string {
+	var wire struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &wire); err == nil {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(wire.Error, &nested) == nil && nested.Message != "":
+			return nested.Message
+		case json.Unmarshal(wire.Error, &text) == nil && text != "":
+			return text
+		case wire.Message != "":
+			return wire.Message
+		}
+	}
+	msg := strings.TrimSpace(string(body))
+	if strings.HasPrefix(msg, "<") {
+		return htmlTitle(msg)
+	}
+	if len(msg) > maxAPIErrorMessageLen {
+		msg = msg[:maxAPIErrorMessageLen] + "..."
+	}
+	return msg
+}
+
+// htmlTitle returns the trimmed content of the title element of an HTML page, or "" when there is none.
+func htmlTitle(page string) string {
+	lower := strings.ToLower(page)
+	start := strings.Index(lower, "<title>")
+	if start < 0 {
+		return ""
+	}
+	start += len("<title>")
+	end := strings.Index(lower[start:], "</title>")
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(page[start : start+end])
+}
+
+// setAPIErrorProvider fills the provider of the APIError wrapped in err when it is unknown.
+func setAPIErrorProvider(err error, kind ProviderKind) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Provider == "" {
+		apiErr.Provider = kind
+	}
+}
+
+// IsRateLimited tells if err comes from a 429 Too Many Requests response.
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// IsProviderUnavailable tells if err comes from a provider in maintenance or overloaded (see ErrProviderUnavailable).
+func IsProviderUnavailable(err error) bool {
+	return errors.Is(err, ErrProviderUnavailable)
+}
+
+// IsAuthError tells if err comes from a 401 Unauthorized or 403 Forbidden response, e.g. an invalid API key.
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden)
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestParseAPIErrorMessage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"OpenAI", `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`, "Incorrect API key provided"},
+		{"Gemini", `{"error": {"code": 429, "message": "Quota exceeded", "status": "RESOURCE_EXHAUSTED"}}`, "Quota exceeded"},
+		{"Ollama", `{"error": "model 'foo' not found"}`, "model 'foo' not found"},
+		{"TopLevelMessage", `{"message": "Bad gateway"}`, "Bad gateway"},
+		{"PlainText", "upstream connect error\n", "upstream connect error"},
+		{"HTMLPage", "<html><head><TITLE> Down for maintenance </TITLE></head><body>...</body></html>", "Down for maintenance"},
+		{"HTMLPageWithoutTitle", "<html><body>503</body></html>", ""},
+		{"TruncatedBody", strings.Repeat("x", maxAPIErrorMessageLen+10), strings.Repeat("x", maxAPIErrorMessageLen) + "..."},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseAPIErrorMessage([]byte(tc.body)); got != tc.expected {
+				t.Errorf("Expected message %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAPIErrorFromProviders(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	newServer := func(status int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		}))
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}
+
+	t.Run("RateLimited", func(t *testing.T) {
+		server := newServer(http.StatusTooManyRequests, `{"error": {"message": "Rate limit reached"}}`)
+		defer server.Close()
+		provider := &openAICompatibleProvider{BaseURL: server.URL, Kind: ProviderOpenAI, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+		_, err := provider.Query(context.Background(), req)
+		if !IsRateLimited(err) || IsAuthError(err) {
+			t.Fatalf("Expected a rate limit error, got %v", err)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Provider != ProviderOpenAI || apiErr.Message != "Rate limit reached" {
+			t.Errorf("Unexpected APIError: %#v", apiErr)
+		}
+	})
+
+	t.Run("AuthErrorWhileStreaming", func(t *testing.T) {
+		server := newServer(http.StatusUnauthorized, `{"error": {"message": "API key not valid"}}`)
+		defer server.Close()
+		provider := &GeminiProvider{BaseURL: server.URL, APIKey: "bad-key", Model: "gemini-test", Client: server.Client(), l: l}
+		_, err := provider.Stream(context.Background(), req, func(Delta) {})
+		if !IsAuthError(err) {
+			t.Fatalf("Expected an auth error, got %v", err)
+		}
+		var apiErr *APIError
+		if errors.As(err, &apiErr); apiErr.Provider != ProviderGemini || apiErr.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Unexpected APIError: %#v", apiErr)
+		}
+	})
+
+	t.Run("ProviderUnavailable", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "<html><body>We'll be back soon</body></html>")
+		}))
+		defer server.Close()
+		provider := &openAICompatibleProvider{BaseURL: server.URL, Kind: ProviderOpenAI, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+		_, err := provider.Query(context.Background(), req)
+		if !IsProviderUnavailable(err) || IsRateLimited(err) {
+			t.Fatalf("Expected a provider unavailable error, got %v", err)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.RetryAfter != 2*time.Minute || apiErr.Message != "Service Unavailable" {
+			t.Errorf("Unexpected APIError: %#v", apiErr)
+		}
+		if _, err = provider.Stream(context.Background(), req, func(Delta) {}); !errors.Is(err, ErrProviderUnavailable) {
+			t.Errorf("Expected a provider unavailable error while streaming, got %v", err)
+		}
+	})
+
+	t.Run("OllamaNotFound", func(t *testing.T) {
+		server := newServer(http.StatusNotFound, `{"error": "model 'foo' not found"}`)
+		defer server.Close()
+		provider := &OllamaProvider{BaseURL: server.URL, Model: "foo", Client: server.Client(), l: l}
+		_, err := provider.Query(context.Background(), req)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Provider != ProviderOllama || string(apiErr.Body) != `{"error": "model 'foo' not found"}` {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if IsRateLimited(err) || IsAuthError(err) || IsProviderUnavailable(err) {
+			t.Errorf("Expected a 404 to be neither a rate limit nor an auth error")
+		}
+	})
+
+	t.Run("CohereStatusCode", func(t *testing.T) {
+		server := newServer(http.StatusBadRequest, `{"message": "invalid request: model 'foo' not found"}`)
+		defer server.Close()
+		provider := &CohereProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "foo", Client: server.Client(), l: l}
+		_, queryErr := provider.Query(context.Background(), req)
+		_, streamErr := provider.Stream(context.Background(), req, func(Delta) {})
+		for _, err := range []error{queryErr, streamErr} {
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Provider != ProviderCohere {
+				t.Errorf("Expected a 400 APIError from Cohere, got %v", err)
+			}
+		}
+	})
+}
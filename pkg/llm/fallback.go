@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// FallbackProvider is a Provider trying an ordered list of providers, failing over to the next one
+// when a provider is unavailable: rate limited, 5xx, timeout or connection error (see IsFailoverError).
+// Other errors, like an invalid request or API key, are returned at once as the next providers would likely fail too.
+// Leave LLMRequest.Model empty so that each provider uses its own configured model.
+type FallbackProvider struct {
+	providers []Provider
+	// OnFallback, when not nil, is called with the index of the provider that failed and its error,
+	// before trying the next one.
+	OnFallback func(index int, err error)
+	// OnServed, when not nil, is called with the index of the provider that served the call.
+	OnServed func(index int, provider Provider)
+}
+
+// NewFallbackProvider returns a FallbackProvider trying providers in order.
+func NewFallbackProvider(providers ...Provider) (*FallbackProvider, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("fallback provider needs at least one provider")
+	}
+	for i, p := range providers {
+		if p == nil {
+			return nil, fmt.Errorf("fallback provider %d is nil", i)
+		}
+	}
+	return &FallbackProvider{providers: providers}, nil
+}
+
+// IsFailoverError tells if err means the provider is unavailable and another one may succeed:
+// a rate limit or server APIError, a timeout or a connection error.
+func IsFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.StatusCode)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// try calls fn with each provider until one succeeds or returns an error that is not worth a failover.
+// It stops as soon as ctx is done, the error of the last provider tried is returned.
+func (f *FallbackProvider) try(ctx context.Context, fn func(Provider) error) error {
+	var err error
+	for i, p := range f.providers {
+		err = fn(p)
+		if err == nil {
+			if f.OnServed != nil {
+				f.OnServed(i, p)
+			}
+			return nil
+		}
+		if ctx.Err() != nil || !IsFailoverError(err) || i == len(f.providers)-1 {
+			return err
+		}
+		if f.OnFallback != nil {
+			f.OnFallback(i, err)
+		}
+	}
+	return err
+}
+
+// Query sends req to the first available provider.
+func (f *FallbackProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	var resp *LLMResponse
+	err := f.try(ctx, func(p Provider) error {
+		var err error
+		resp, err = p.Query(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// Stream streams req from the first available provider. Once a provider has emitted a delta,
+// its error is returned without failover, to avoid mixing the partial answers of several providers.
+func (f *FallbackProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	var resp *LLMResponse
+	emitted := false
+	forward := func(d Delta) {
+		emitted = true
+		onDelta(d)
+	}
+	err := f.try(ctx, func(p Provider) error {
+		var err error
+		resp, err = p.Stream(ctx, req, forward)
+		if err != nil && emitted {
+			return &noFailoverError{err}
+		}
+		return err
+	})
+	var noFailover *noFailoverError
+	if errors.As(err, &noFailover) {
+		err = noFailover.err
+	}
+	return resp, err
+}
+
+// ListModels returns the models of the first available provider.
+func (f *FallbackProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var models []ModelInfo
+	err := f.try(ctx, func(p Provider) error {
+		var err error
+		models, err = p.ListModels(ctx)
+		return err
+	})
+	return models, err
+}
+
+// noFailoverError wraps an error that must stop the failover, hiding it from IsFailoverError.
+type noFailoverError struct {
+	err error
+}
+
+func (e *noFailoverError) Error() string { return e.err.Error() }
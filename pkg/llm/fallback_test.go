@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// failingProvider fails every call with err, after emitting the deltas when streaming.
+type failingProvider struct {
+	err    error
+	deltas []string
+	calls  int
+}
+
+func (p *failingProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	p.calls++
+	return nil, p.err
+}
+
+func (p *failingProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	p.calls++
+	for _, d := range p.deltas {
+		onDelta(Delta{Text: d})
+	}
+	return nil, p.err
+}
+
+func (p *failingProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	p.calls++
+	return nil, p.err
+}
+
+func TestFallbackProvider(t *testing.T) {
+	rateLimited := &APIError{StatusCode: http.StatusTooManyRequests}
+	badRequest := &APIError{StatusCode: http.StatusBadRequest}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}
+
+	t.Run("QueryFailsOverOnRateLimit", func(t *testing.T) {
+		primary := &failingProvider{err: rateLimited}
+		secondary := &scriptedStreamProvider{deltas: []string{"from secondary"}}
+		f, err := NewFallbackProvider(primary, secondary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		served, fallbacks := -1, 0
+		f.OnServed = func(index int, p Provider) { served = index }
+		f.OnFallback = func(index int, err error) { fallbacks++ }
+		resp, err := f.Query(context.Background(), req)
+		if err != nil || resp.Text != "from secondary" {
+			t.Fatalf("Expected the answer of the secondary provider, got %v, %v", resp, err)
+		}
+		if served != 1 || fallbacks != 1 {
+			t.Errorf("Expected to be served by provider 1 after 1 fallback, got %d and %d", served, fallbacks)
+		}
+	})
+
+	t.Run("NoFailoverOnClientError", func(t *testing.T) {
+		secondary := &failingProvider{}
+		f, _ := NewFallbackProvider(&failingProvider{err: badRequest}, secondary)
+		if _, err := f.Query(context.Background(), req); !errors.Is(err, badRequest) {
+			t.Errorf("Expected the bad request error, got %v", err)
+		}
+		if secondary.calls != 0 {
+			t.Errorf("Expected the secondary provider not to be called, got %d calls", secondary.calls)
+		}
+	})
+
+	t.Run("AllProvidersFail", func(t *testing.T) {
+		last := &APIError{StatusCode: http.StatusServiceUnavailable}
+		f, _ := NewFallbackProvider(&failingProvider{err: rateLimited}, &failingProvider{err: last})
+		if _, err := f.ListModels(context.Background()); !errors.Is(err, last) {
+			t.Errorf("Expected the error of the last provider, got %v", err)
+		}
+	})
+
+	t.Run("StreamFailsOverBeforeFirstDelta", func(t *testing.T) {
+		f, _ := NewFallbackProvider(&failingProvider{err: rateLimited}, &scriptedStreamProvider{deltas: []string{"Hello"}})
+		var text string
+		resp, err := f.Stream(context.Background(), req, func(d Delta) { text += d.Text })
+		if err != nil || resp.Text != "Hello" || text != "Hello" {
+			t.Errorf("Expected the stream of the secondary provider, got %q, %v", text, err)
+		}
+	})
+
+	t.Run("StreamNoFailoverAfterDelta", func(t *testing.T) {
+		secondary := &scriptedStreamProvider{deltas: []string{"Hello"}}
+		f, _ := NewFallbackProvider(&failingProvider{err: rateLimited, deltas: []string{"partial"}}, secondary)
+		var text string
+		_, err := f.Stream(context.Background(), req, func(d Delta) { text += d.Text })
+		if !errors.Is(err, rateLimited) || text != "partial" {
+			t.Errorf("Expected the error of the primary provider after its partial answer, got %q, %v", text, err)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func FuzzUnmarshalResponse(f *testing.F) {
+	f.Add([]byte(`{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "Hello"}}]}`))
+	f.Add([]byte(`{"choices": [{"message": {"content": null, "tool_calls": [{"id": "call-1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"location\": \"Lausanne\"}"}}]}}]}`))
+	f.Add([]byte(`{"choices": [{"message": {"tool_calls": [{"function": null}]}}]}`))
+	f.Add([]byte(`{"choices": [{"message": null}], "usage": {"prompt_tokens": 1}}`))
+	f.Add([]byte(`{"choices": [{"text": "legacy", "finish_reason": "length"}]}`))
+	f.Add([]byte(`{"choices": []}`))
+	f.Add([]byte(`null`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for name, unmarshal := range map[string]func([]byte) (*LLMResponse, error){
+			"chat":   func(b []byte) (*LLMResponse, error) { return unmarshalResponse(b) },
+			"legacy": func(b []byte) (*LLMResponse, error) { return unmarshalLegacyResponse(b) },
+		} {
+			resp, err := unmarshal(data)
+			if err == nil && resp == nil {
+				t.Errorf("%s: Expected a response or an error, got neither for %q", name, data)
+			}
+			if err != nil && resp != nil {
+				t.Errorf("%s: Expected no response along with error %v, got %#v", name, err, resp)
+			}
+		}
+	})
+}
+
+// bodyTransport is an http.RoundTripper answering every request with status 200 and body.
+type bodyTransport struct {
+	body []byte
+}
+
+func (b bodyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(bytes.NewReader(b.body)),
+		Request:    r,
+	}, nil
+}
+
+func FuzzStreamChunk(f *testing.F) {
+	f.Add(`{"choices":[{"delta":{"content":"Hello"},"finish_reason":"stop"}]}`)
+	f.Add(`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call-1","function":{"name":"get_weather","arguments":"{\"loc"}}]}}]}`)
+	f.Add(`{"choices":[{"delta":{"tool_calls":[{"index":-1,"function":{"arguments":null}}]}}]}`)
+	f.Add(`{"choices":[{"delta":null,"finish_reason":null}],"usage":{"total_tokens":"many"}}`)
+	f.Add(`{"choices":[{"text":"legacy"}],"usage":null}`)
+	f.Add(`[DONE]`)
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	f.Fuzz(func(t *testing.T, chunk string) {
+		body := "data: " + strings.ReplaceAll(chunk, "\n", "\ndata: ") + "\n\ndata: [DONE]\n\n"
+		provider := &openAICompatibleProvider{
+			BaseURL:  "http://fuzz.test",
+			Client:   &http.Client{Transport: bodyTransport{body: []byte(body)}},
+			Endpoint: "/chat/completions",
+			l:        l,
+		}
+		resp, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}, func(Delta) {})
+		if err == nil && resp == nil {
+			t.Errorf("Expected a response or an error, got neither for %q", chunk)
+		}
+	})
+}
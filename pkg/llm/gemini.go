@@ -3,6 +3,7 @@ package llm
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +11,9 @@ import (
 	"net/http"
 	"path"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/lao-tseu-is-alive/go-ai-llm-query/pkg/config"
 	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
 )
@@ -22,26 +25,141 @@ type GeminiProvider struct {
 	Model      string
 	ModelsInfo ProviderModelsInfo
 	Client     *http.Client
-	l          golog.MyLogger
+	// ExtraHeaders are sent with every request, merged from the catalog and ProviderConfig.ExtraHeaders
+	ExtraHeaders map[string]string
+	RetryPolicy  RetryPolicy
+	GzipRequests bool
+	audit        AuditLogger
+	hooks        callHooks
+	l            golog.MyLogger
+	// vertex is set by NewVertexGeminiAdapter to send the requests to Vertex AI instead of the Gemini API
+	vertex *vertexTarget
 }
 
 // geminiRequest represents the request payload for Gemini's generateContent API.
 type geminiRequest struct {
-	Contents          []map[string]any `json:"contents"`
-	SystemInstruction *map[string]any  `json:"systemInstruction,omitempty"`
-	GenerationConfig  map[string]any   `json:"generationConfig,omitempty"`
+	Contents          []map[string]any      `json:"contents"`
+	SystemInstruction *map[string]any       `json:"systemInstruction,omitempty"`
+	GenerationConfig  map[string]any        `json:"generationConfig,omitempty"`
+	Tools             []geminiTool          `json:"tools,omitempty"`
+	ToolConfig        map[string]any        `json:"toolConfig,omitempty"`
+	SafetySettings    []GeminiSafetySetting `json:"safetySettings,omitempty"`
+}
+
+// ProviderExtraGeminiSafetySettings is the LLMRequest.ProviderExtras key holding Gemini safety settings.
+// The value can be a []GeminiSafetySetting or a slice of maps with the "category" and "threshold" keys.
+const ProviderExtraGeminiSafetySettings = "safety_settings"
+
+// GeminiSafetySetting overrides the blocking threshold of one harm category,
+// see https://ai.google.dev/gemini-api/docs/safety-settings
+// Valid categories are:
+//   - HARM_CATEGORY_HARASSMENT
+//   - HARM_CATEGORY_HATE_SPEECH
+//   - HARM_CATEGORY_SEXUALLY_EXPLICIT
+//   - HARM_CATEGORY_DANGEROUS_CONTENT
+//   - HARM_CATEGORY_CIVIC_INTEGRITY
+//
+// Valid thresholds are:
+//   - HARM_BLOCK_THRESHOLD_UNSPECIFIED: use the model default
+//   - BLOCK_LOW_AND_ABOVE: block when the probability is low, medium or high
+//   - BLOCK_MEDIUM_AND_ABOVE: block when the probability is medium or high
+//   - BLOCK_ONLY_HIGH: block only when the probability is high
+//   - BLOCK_NONE: never block, the ratings are still returned
+//   - OFF: turn off the safety filter for the category
+type GeminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// Validate checks the category and the threshold against the values accepted by Gemini.
+func (s GeminiSafetySetting) Validate() error {
+	switch s.Category {
+	case "HARM_CATEGORY_HARASSMENT", "HARM_CATEGORY_HATE_SPEECH", "HARM_CATEGORY_SEXUALLY_EXPLICIT",
+		"HARM_CATEGORY_DANGEROUS_CONTENT", "HARM_CATEGORY_CIVIC_INTEGRITY":
+	default:
+		return fmt.Errorf("gemini: invalid safety category %q", s.Category)
+	}
+	switch s.Threshold {
+	case "HARM_BLOCK_THRESHOLD_UNSPECIFIED", "BLOCK_LOW_AND_ABOVE", "BLOCK_MEDIUM_AND_ABOVE",
+		"BLOCK_ONLY_HIGH", "BLOCK_NONE", "OFF":
+	default:
+		return fmt.Errorf("gemini: invalid safety threshold %q for %s", s.Threshold, s.Category)
+	}
+	return nil
+}
+
+// geminiSafetySettings extracts and validates the safety settings from the request extras.
+// It returns nil when no settings were given, so Gemini applies its defaults.
+func geminiSafetySettings(extras map[string]any) ([]GeminiSafetySetting, error) {
+	value, ok := extras[ProviderExtraGeminiSafetySettings]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	var settings []GeminiSafetySetting
+	switch v := value.(type) {
+	case []GeminiSafetySetting:
+		settings = v
+	case []map[string]any, []map[string]string, []any:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("gemini: invalid %s: %w", ProviderExtraGeminiSafetySettings, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&settings); err != nil {
+			return nil, fmt.Errorf("gemini: invalid %s: %w", ProviderExtraGeminiSafetySettings, err)
+		}
+	default:
+		return nil, fmt.Errorf("gemini: %s must be a []GeminiSafetySetting or a slice of maps, got %T", ProviderExtraGeminiSafetySettings, value)
+	}
+	for _, setting := range settings {
+		if err := setting.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(settings) == 0 {
+		return nil, nil
+	}
+	return settings, nil
+}
+
+// geminiPart is a single part of a Gemini content, either text or a function call.
+type geminiPart struct {
+	Text string `json:"text,omitempty"`
+	// Thought is true when Text is a summary of the model reasoning, only returned with includeThoughts
+	Thought bool `json:"thought,omitempty"`
+	// InlineData is binary content like a generated image, Data is base64 encoded
+	InlineData *struct {
+		MimeType string `json:"mimeType"`
+		Data     string `json:"data"`
+	} `json:"inlineData,omitempty"`
+	FunctionCall *struct {
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args,omitempty"`
+	} `json:"functionCall,omitempty"`
+}
+
+// geminiSafetyRating is the harm probability of a content for a category.
+type geminiSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
 }
 
 // geminiResponse represents the response payload from Gemini's generateContent API.
 type geminiResponse struct {
 	Candidates []struct {
 		Content struct {
-			Parts []struct {
-				Text string `json:"text,omitempty"`
-			} `json:"parts"`
+			Parts []geminiPart `json:"parts"`
 		} `json:"content"`
-		FinishReason string `json:"finishReason,omitempty"`
+		FinishReason  string               `json:"finishReason,omitempty"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings,omitempty"`
 	} `json:"candidates"`
+	// PromptFeedback is set when the prompt itself was blocked, there are then no candidates
+	PromptFeedback *struct {
+		BlockReason   string               `json:"blockReason,omitempty"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings,omitempty"`
+	} `json:"promptFeedback,omitempty"`
 	Usage struct {
 		PromptTokenCount     int `json:"promptTokenCount"`
 		CandidatesTokenCount int `json:"candidatesTokenCount"`
@@ -49,6 +167,34 @@ type geminiResponse struct {
 	} `json:"usageMetadata"`
 }
 
+// safetyInfo returns the prompt feedback and the ratings of the first candidate, nil when there are none.
+func (r *geminiResponse) safetyInfo() *SafetyInfo {
+	var ratings []geminiSafetyRating
+	info := &SafetyInfo{}
+	if r.PromptFeedback != nil {
+		info.BlockReason = r.PromptFeedback.BlockReason
+		ratings = append(ratings, r.PromptFeedback.SafetyRatings...)
+	}
+	if len(r.Candidates) > 0 {
+		ratings = append(ratings, r.Candidates[0].SafetyRatings...)
+	}
+	for _, rating := range ratings {
+		info.Ratings = append(info.Ratings, SafetyRating(rating))
+	}
+	if info.BlockReason == "" && len(info.Ratings) == 0 {
+		return nil
+	}
+	return info
+}
+
+// blockedError returns a ContentBlockedError when the response has no candidates because it was blocked.
+func (r *geminiResponse) blockedError() error {
+	if len(r.Candidates) > 0 || r.PromptFeedback == nil || r.PromptFeedback.BlockReason == "" {
+		return nil
+	}
+	return &ContentBlockedError{Provider: ProviderGemini, Safety: *r.safetyInfo()}
+}
+
 // NewGeminiAdapter creates a new GeminiProvider from config.
 func NewGeminiAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
 	if cfg.APIKey == "" {
@@ -60,6 +206,12 @@ func NewGeminiAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
 	if cfg.BaseURL == "" {
 		return nil, fmt.Errorf("gemini: missing baseURl")
 	}
+	return newGeminiProvider(cfg, l)
+}
+
+// newGeminiProvider returns the provider of cfg with the Gemini section of the model catalog,
+// shared by NewGeminiAdapter and NewVertexGeminiAdapter which check their own credentials.
+func newGeminiProvider(cfg ProviderConfig, l golog.MyLogger) (*GeminiProvider, error) {
 	filepath := config.GetProviderInfoFilePathFromEnv(defaultModelInfoFilePath)
 	// Load only once the external model configuration
 	catalog, err := LoadModelCatalog(filepath)
@@ -70,23 +222,168 @@ func NewGeminiAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
 	if !ok {
 		return nil, errors.New("ollama provider configuration not found in models.json")
 	}
+	retryPolicy, err := retryPolicyFromExtras(cfg.Extras)
+	if err != nil {
+		return nil, err
+	}
+	gzipRequests, err := gzipRequestsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &GeminiProvider{
-		BaseURL:    cfg.BaseURL,
-		APIKey:     cfg.APIKey,
-		Model:      cfg.Model,
-		ModelsInfo: providerConfig,
-		Client:     &http.Client{},
-		l:          l,
+		BaseURL:      config.NormalizeBaseURL(cfg.BaseURL),
+		APIKey:       cfg.APIKey,
+		Model:        cfg.Model,
+		ExtraHeaders: mergeHeaders(providerConfig.Headers, cfg.ExtraHeaders),
+		ModelsInfo:   providerConfig,
+		Client:       client,
+		RetryPolicy:  retryPolicy,
+		audit:        auditLoggerOrNoop(cfg.AuditLogger),
+		hooks:        hooksFromConfig(cfg),
+		GzipRequests: gzipRequests,
+		l:            l,
 	}, nil
 }
 
+// Query sends req and returns the complete response, recording the call with the audit logger and the hooks.
 func (g *GeminiProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return auditCall(auditLoggerOrNoop(g.audit), g.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := g.query(ctx, req)
+		return finishResponse(req, start, resp, err, g.l)
+	})
+}
+
+// Stream sends req and emits the answer deltas to onDelta, recording the call with the audit logger and the hooks.
+func (g *GeminiProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	onDelta = withDeltaTimestamps(req, onDelta)
+	return auditCall(auditLoggerOrNoop(g.audit), g.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := runStream(ctx, req, onDelta, g.stream)
+		return finishResponse(req, start, resp, err, g.l)
+	})
+}
+
+func (g *GeminiProvider) query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	l := contextLogger(ctx, g.l)
 	if req == nil {
 		return nil, errors.New("request cannot be nil")
 	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
+
+	payload, url, headers, err := g.prepareRequest(req, false, l)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Debug("about to send request to %s", g.BaseURL)
+	responseData, rawResp, err := httpPostRequest[geminiRequest, geminiResponse](ctx, g.Client, url, headers, payload, g.RetryPolicy, g.GzipRequests, l)
+	if err != nil {
+		l.Warn("got error during HttpRequest: %q", err)
+		setAPIErrorProvider(err, ProviderGemini)
+		return nil, fmt.Errorf("gemini request failed: %w (raw body: %s)", err, string(rawResp))
+	}
+	l.Debug("successful HttpRequest, rawbody: %s", string(rawResp))
+
+	if err := responseData.blockedError(); err != nil {
+		return nil, err
+	}
+	llmResp := &LLMResponse{
+		Raw:    json.RawMessage(rawResp),
+		Safety: responseData.safetyInfo(),
+		Usage: &Usage{
+			PromptTokens:     responseData.Usage.PromptTokenCount,
+			CompletionTokens: responseData.Usage.CandidatesTokenCount,
+			TotalTokens:      responseData.Usage.TotalTokenCount,
+		},
+	}
+	if len(responseData.Candidates) > 0 {
+		var buf, reasoning bytes.Buffer
+		var parts []ContentPart
+		for _, part := range responseData.Candidates[0].Content.Parts {
+			if part.Thought {
+				reasoning.WriteString(part.Text)
+				continue
+			}
+			buf.WriteString(part.Text)
+			if tc, ok := part.toToolCall(); ok {
+				llmResp.ToolCalls = append(llmResp.ToolCalls, tc)
+			}
+			if cp, ok := part.toContentPart(); ok {
+				parts = append(parts, cp)
+			}
+		}
+		llmResp.Text = buf.String()
+		llmResp.Reasoning = reasoning.String()
+		llmResp.Parts = structuredParts(parts)
+		llmResp.FinishReason = responseData.Candidates[0].FinishReason
+	}
+
+	return llmResp, nil
+}
 
+// prepareRequest builds the payload, the URL and the headers of a generateContent request,
+// or of a streamGenerateContent one when stream is true, shared by query, stream and BuildRequestPayload.
+func (g *GeminiProvider) prepareRequest(req *LLMRequest, stream bool, l golog.MyLogger) (geminiRequest, string, http.Header, error) {
+	modelName := FirstNonEmpty(req.Model, g.Model)
+	if err := applyMaxTokensCheck(req, g.ModelsInfo.ModelInfo(modelName), l); err != nil {
+		return geminiRequest{}, "", nil, err
+	}
+	payload, err := buildGeminiPayload(withSamplingDefaults(req, g.ModelsInfo.SamplingDefaults(modelName)))
+	if err != nil {
+		return geminiRequest{}, "", nil, err
+	}
+	method := ":generateContent"
+	if stream {
+		method = ":streamGenerateContent"
+	}
+	headers, err := g.authHeaders()
+	if err != nil {
+		return geminiRequest{}, "", nil, err
+	}
+	headers.Set("Content-Type", "application/json")
+	setExtraHeaders(headers, g.ExtraHeaders, req.ExtraHeaders)
+	return payload, g.modelURL(modelName, method), headers, nil
+}
+
+// modelURL returns the URL of method (":generateContent" or ":streamGenerateContent") of modelName.
+func (g *GeminiProvider) modelURL(modelName, method string) string {
+	if g.vertex != nil {
+		return g.vertex.modelURL(g.BaseURL, modelName, method)
+	}
+	return g.BaseURL + "/v1beta/models/" + path.Join(modelName, method) // Safer path join
+}
+
+// authHeaders returns the headers authenticating a request, the API key or the OAuth token on Vertex AI.
+func (g *GeminiProvider) authHeaders() (http.Header, error) {
+	if g.vertex != nil {
+		return g.vertex.authHeaders()
+	}
+	return http.Header{"x-goog-api-key": []string{g.APIKey}}, nil
+}
+
+// BuildRequestPayload returns the HTTP request that Query, or Stream when req.Stream is set, would send for req.
+func (g *GeminiProvider) BuildRequestPayload(req *LLMRequest) (*RequestPayload, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	payload, url, headers, err := g.prepareRequest(dryRunRequest(req, g.hooks), req.Stream, g.l)
+	if err != nil {
+		return nil, err
+	}
+	return newRequestPayload(url, headers, payload)
+}
+
+// buildGeminiPayload creates the generateContent payload shared by Query and Stream.
+func buildGeminiPayload(req *LLMRequest) (geminiRequest, error) {
+	msgs := preparedMessages(req)
 	payload := geminiRequest{
-		Contents:         ToGeminiContents(req.Messages), // Exported helper
+		Contents:         ToGeminiContents(msgs), // Exported helper
 		GenerationConfig: map[string]any{},
 	}
 	if req.Temperature > 0 {
@@ -98,58 +395,107 @@ func (g *GeminiProvider) Query(ctx context.Context, req *LLMRequest) (*LLMRespon
 	if req.MaxTokens > 0 {
 		payload.GenerationConfig["maxOutputTokens"] = req.MaxTokens
 	}
-	if sys := FirstSystemMessage(req.Messages); sys != "" {
+	if req.FrequencyPenalty != 0 {
+		payload.GenerationConfig["frequencyPenalty"] = req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		payload.GenerationConfig["presencePenalty"] = req.PresencePenalty
+	}
+	includeReasoning, err := boolFromExtras(req.ProviderExtras, ProviderExtraIncludeReasoning, false)
+	if err != nil {
+		return geminiRequest{}, err
+	}
+	if includeReasoning {
+		payload.GenerationConfig["thinkingConfig"] = map[string]any{"includeThoughts": true}
+	}
+	if sys := FirstSystemMessage(msgs); sys != "" {
 		payload.SystemInstruction = &map[string]any{
 			"role":  "system",
 			"parts": []map[string]any{{"text": sys}},
 		}
 	}
-
-	url := g.BaseURL + "/v1beta/models/" + path.Join(FirstNonEmpty(req.Model, g.Model), ":generateContent") // Safer path join
-	headers := http.Header{
-		"Content-Type":   []string{"application/json"},
-		"x-goog-api-key": []string{g.APIKey},
-	}
-
-	g.l.Debug("about to send request to %s", g.BaseURL)
-	responseData, rawResp, err := HttpRequest[geminiRequest, geminiResponse](ctx, g.Client, url, headers, payload, g.l)
+	tools, err := toGeminiTools(req.Tools)
 	if err != nil {
-		g.l.Warn("got error during HttpRequest: %q", err)
-		return nil, fmt.Errorf("gemini request failed: %w (raw body: %s)", err, string(rawResp))
+		return geminiRequest{}, err
 	}
-	g.l.Debug("successful HttpRequest, rawbody: %s", string(rawResp))
-
-	llmResp := &LLMResponse{
-		Raw: json.RawMessage(rawResp),
-		Usage: &Usage{
-			PromptTokens:     responseData.Usage.PromptTokenCount,
-			CompletionTokens: responseData.Usage.CandidatesTokenCount,
-			TotalTokens:      responseData.Usage.TotalTokenCount,
-		},
+	payload.Tools = tools
+	if len(tools) > 0 {
+		payload.ToolConfig = toGeminiToolConfig(req.ToolChoice)
 	}
-	if len(responseData.Candidates) > 0 {
-		var buf bytes.Buffer
-		for _, part := range responseData.Candidates[0].Content.Parts {
-			buf.WriteString(part.Text)
+	if payload.SafetySettings, err = geminiSafetySettings(req.ProviderExtras); err != nil {
+		return geminiRequest{}, err
+	}
+	return payload, nil
+}
+
+// toContentPart converts a text or inline data part to a ContentPart, an inline data not base64 encoded is skipped.
+func (p geminiPart) toContentPart() (ContentPart, bool) {
+	switch {
+	case p.Text != "":
+		return ContentPart{Type: ContentPartText, Text: p.Text}, true
+	case p.InlineData != nil:
+		data, err := base64.StdEncoding.DecodeString(p.InlineData.Data)
+		if err != nil {
+			return ContentPart{}, false
 		}
-		llmResp.Text = buf.String()
-		llmResp.FinishReason = responseData.Candidates[0].FinishReason
+		partType := ContentPartType(strings.SplitN(p.InlineData.MimeType, "/", 2)[0])
+		return ContentPart{Type: partType, MIMEType: p.InlineData.MimeType, Data: data}, true
+	default:
+		return ContentPart{}, false
 	}
+}
 
-	return llmResp, nil
+// toToolCall converts a Gemini functionCall part into a ToolCall.
+// Gemini doesn't return tool call IDs, so we generate one like we do for Ollama.
+func (p geminiPart) toToolCall() (ToolCall, bool) {
+	if p.FunctionCall == nil {
+		return ToolCall{}, false
+	}
+	return ToolCall{
+		ID:        uuid.NewString(),
+		Name:      p.FunctionCall.Name,
+		Arguments: p.FunctionCall.Args,
+	}, true
 }
 
 // ToGeminiContents converts LLM messages to Gemini's content format.
+// Assistant messages use the "model" role, tool calls become functionCall parts
+// and tool results become functionResponse parts matched by tool call ID.
 func ToGeminiContents(msgs []LLMMessage) []map[string]any {
 	out := make([]map[string]any, 0, len(msgs))
+	toolNames := map[string]string{}
 	for _, msg := range msgs {
-		if msg.Role == RoleSystem {
+		switch msg.Role {
+		case RoleSystem:
 			continue
+		case RoleAssistant:
+			parts := []map[string]any{}
+			if msg.Content != "" || len(msg.ToolCalls) == 0 {
+				parts = append(parts, map[string]any{"text": msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Name
+				parts = append(parts, map[string]any{
+					"functionCall": map[string]any{"name": tc.Name, "args": geminiFunctionArgs(tc.Arguments)},
+				})
+			}
+			out = append(out, map[string]any{"role": "model", "parts": parts})
+		case RoleTool:
+			out = append(out, map[string]any{
+				"role": "user",
+				"parts": []map[string]any{{
+					"functionResponse": map[string]any{
+						"name":     FirstNonEmpty(msg.Name, toolNames[msg.ToolCallID]),
+						"response": geminiFunctionResponse(msg.Content),
+					},
+				}},
+			})
+		default:
+			out = append(out, map[string]any{
+				"role":  msg.Role,
+				"parts": []map[string]any{{"text": msg.Content}},
+			})
 		}
-		out = append(out, map[string]any{
-			"role":  msg.Role,
-			"parts": []map[string]any{{"text": msg.Content}},
-		})
 	}
 	return out
 }
@@ -165,10 +511,14 @@ func FirstSystemMessage(msgs []LLMMessage) string {
 }
 
 func (g *GeminiProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	if g.vertex != nil {
+		return g.vertexModels(), nil
+	}
 	url := g.BaseURL + "/v1beta/models"
 	headers := http.Header{
 		"x-goog-api-key": []string{g.APIKey},
 	}
+	setExtraHeaders(headers, g.ExtraHeaders)
 
 	type geminiModelsResponse struct {
 		Models []struct {
@@ -176,8 +526,9 @@ func (g *GeminiProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 		} `json:"models"`
 	}
 
-	resp, err := httpGetRequest[geminiModelsResponse](ctx, g.Client, url, headers, g.l)
+	resp, err := httpGetRequest[geminiModelsResponse](ctx, g.Client, url, headers, g.RetryPolicy, g.l)
 	if err != nil {
+		setAPIErrorProvider(err, ProviderGemini)
 		return nil, fmt.Errorf("failed to list gemini models: %w", err)
 	}
 	modelInfos := make([]ModelInfo, 0, len(resp.Models))
@@ -209,61 +560,54 @@ func (g *GeminiProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	return modelInfos, nil
 }
 
-func (g *GeminiProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+func (g *GeminiProvider) stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	l := contextLogger(ctx, g.l)
 	// 1. Validate inputs and build the request payload
 	if req == nil {
 		return nil, errors.New("request cannot be nil")
 	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
+	firstChunk := firstChunkNotifier(req, time.Now())
 	if onDelta == nil {
 		return nil, errors.New("onDelta callback cannot be nil for streaming")
 	}
-
-	payload := geminiRequest{
-		Contents:         ToGeminiContents(req.Messages),
-		GenerationConfig: map[string]any{},
+	if modelName := FirstNonEmpty(req.Model, g.Model); req.FakeStreamIfUnsupported && !g.ModelsInfo.ModelInfo(modelName).SupportsStreaming {
+		l.Info("model %s doesn't support streaming, falling back to a regular query", modelName)
+		return QueryAsStream(ctx, queryFunc(g.query), req, onDelta)
 	}
-	if req.Temperature > 0 {
-		payload.GenerationConfig["temperature"] = req.Temperature
-	}
-	if sys := FirstSystemMessage(req.Messages); sys != "" {
-		payload.SystemInstruction = &map[string]any{
-			"role":  "system",
-			"parts": []map[string]any{{"text": sys}},
-		}
+
+	payload, url, headers, err := g.prepareRequest(req, true, l)
+	if err != nil {
+		return nil, err
 	}
 
 	// 2. Prepare and send the HTTP request
-	modelName := FirstNonEmpty(req.Model, g.Model)
-	url := g.BaseURL + "/v1beta/models/" + path.Join(modelName, ":streamGenerateContent")
-	headers := http.Header{
-		"Content-Type":   []string{"application/json"},
-		"x-goog-api-key": []string{g.APIKey},
-	}
-	bodyBytes, err := json.Marshal(payload)
+	bodyBytes, err := marshalRequestBody(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal gemini stream request: %w", err)
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(bodyBytes))
+	httpReq, err := newHTTPRequest(ctx, http.MethodPost, url, headers, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gemini stream request: %w", err)
 	}
-	httpReq.Header = headers
-	g.l.Debug("Gemini stream request sent to URL: %s", url)
+	l.Debug("Gemini stream request sent to URL: %s", url)
 	resp, err := g.Client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send gemini stream request: %w", err)
 	}
 	defer resp.Body.Close()
-	g.l.Debug("Gemini stream response status: %s", resp.Status)
+	l.Debug("Gemini stream response status: %s", resp.Status)
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("gemini stream returned non-200 status: %d %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("gemini stream failed: %w", newAPIError(resp.StatusCode, resp.Header, body, ProviderGemini, 1))
 	}
 
 	// 3.  Process the response as a streaming JSON array, not as SSE.
 	decoder := json.NewDecoder(resp.Body)
 	finalResponse := &LLMResponse{}
 	fullText := &strings.Builder{}
+	fullReasoning := &strings.Builder{}
 
 	// The entire response is a single JSON array. We first must read the opening token '['.
 	t, err := decoder.Token()
@@ -273,26 +617,43 @@ func (g *GeminiProvider) Stream(ctx context.Context, req *LLMRequest, onDelta fu
 	if t != json.Delim('[') {
 		return nil, fmt.Errorf("expected '[' at start of stream, but got %v", t)
 	}
-	g.l.Debug("Successfully found opening '[' of the JSON array.")
+	l.Debug("Successfully found opening '[' of the JSON array.")
 
 	// Now, we loop through the array, decoding one full JSON object at a time.
 	for decoder.More() {
 		var chunk geminiResponse
-		if err := decoder.Decode(&chunk); err != nil {
-			g.l.Warn("Failed to decode gemini object from stream: %v", err)
-			continue
+		raw, err := decodeStreamChunk(decoder, &chunk, req.IncludeRawChunks)
+		if err != nil {
+			// the decoder can't resync after a syntax error, continuing would loop forever
+			return nil, fmt.Errorf("failed to decode gemini object from stream: %w", err)
+		}
+		firstChunk()
+		l.Debug("Successfully decoded one object from the stream array.")
+		if err := chunk.blockedError(); err != nil {
+			return nil, err
+		}
+		if safety := chunk.safetyInfo(); safety != nil {
+			finalResponse.Safety = safety
 		}
-		g.l.Debug("Successfully decoded one object from the stream array.")
 
 		// The logic for processing the chunk is the same as before.
+		emit := withRawChunk(onDelta, raw)
 		if len(chunk.Candidates) > 0 {
 			candidate := chunk.Candidates[0]
-			if len(candidate.Content.Parts) > 0 {
-				textDelta := candidate.Content.Parts[0].Text
-				if textDelta != "" {
-					g.l.Debug("Extracted delta: '%s'", textDelta)
-					fullText.WriteString(textDelta)
-					onDelta(Delta{Text: textDelta})
+			for _, part := range candidate.Content.Parts {
+				if part.Thought {
+					fullReasoning.WriteString(part.Text)
+					emit(Delta{Reasoning: part.Text})
+					continue
+				}
+				if part.Text != "" {
+					l.Debug("Extracted delta: '%s'", part.Text)
+					fullText.WriteString(part.Text)
+					emit(Delta{Text: part.Text})
+				}
+				if tc, ok := part.toToolCall(); ok {
+					finalResponse.ToolCalls = append(finalResponse.ToolCalls, tc)
+					emit(Delta{ToolCalls: []ToolCall{tc}})
 				}
 			}
 			if candidate.FinishReason != "" {
@@ -308,8 +669,10 @@ func (g *GeminiProvider) Stream(ctx context.Context, req *LLMRequest, onDelta fu
 		}
 	}
 
-	g.l.Debug("Finished processing Gemini stream.")
+	l.Debug("Finished processing Gemini stream.")
+	completeStreamUsage(finalResponse, req, fullText.String(), TokenEstimatorForProvider(ProviderGemini, FirstNonEmpty(req.Model, g.Model)))
 	onDelta(Delta{Done: true, FinishReason: finalResponse.FinishReason})
 	finalResponse.Text = fullText.String()
+	finalResponse.Reasoning = fullReasoning.String()
 	return finalResponse, nil
 }
@@ -2,10 +2,13 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -118,3 +121,321 @@ func TestGeminiProvider_Stream(t *testing.T) {
 
 	fmt.Println("✅ Gemini stream test passed successfully.")
 }
+
+// TestToGeminiSchema verifies the conversion of OpenAI-style JSON schemas to Gemini's restricted dialect.
+func TestToGeminiSchema(t *testing.T) {
+	t.Run("StripsUnsupportedKeywords", func(t *testing.T) {
+		schema := map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"$schema":              "http://json-schema.org/draft-07/schema#",
+			"properties": map[string]any{
+				"location": map[string]any{"type": "string", "description": "City"},
+				"unit":     map[string]any{"type": []any{"string", "null"}, "enum": []string{"celsius", "fahrenheit"}},
+			},
+			"required": []string{"location"},
+		}
+		got, err := ToGeminiSchema(schema)
+		if err != nil {
+			t.Fatalf("ToGeminiSchema returned an unexpected error: %v", err)
+		}
+		if _, ok := got["additionalProperties"]; ok {
+			t.Error("Expected additionalProperties to be stripped")
+		}
+		if _, ok := got["$schema"]; ok {
+			t.Error("Expected $schema to be stripped")
+		}
+		if got["type"] != "OBJECT" {
+			t.Errorf("Expected type 'OBJECT', got %v", got["type"])
+		}
+		unit := got["properties"].(map[string]any)["unit"].(map[string]any)
+		if unit["type"] != "STRING" || unit["nullable"] != true {
+			t.Errorf("Expected nullable STRING for unit, got %#v", unit)
+		}
+	})
+
+	t.Run("RejectsUnrepresentableConstructs", func(t *testing.T) {
+		schema := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"value": map[string]any{"oneOf": []any{map[string]any{"type": "string"}, map[string]any{"type": "integer"}}},
+			},
+		}
+		_, err := ToGeminiSchema(schema)
+		if err == nil || !strings.Contains(err.Error(), "oneOf") {
+			t.Errorf("Expected an error mentioning oneOf, got %v", err)
+		}
+	})
+}
+
+// TestGeminiProvider_QueryToolCall verifies that tools are declared and functionCall parts are returned as ToolCalls.
+func TestGeminiProvider_QueryToolCall(t *testing.T) {
+	var sent map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"candidates": [{"content": {"parts": [{"functionCall": {"name": "get_weather", "args": {"location": "Lausanne"}}}]}, "finishReason": "STOP"}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+
+	req := &LLMRequest{
+		Messages:   []LLMMessage{{Role: RoleUser, Content: "What's the weather?"}},
+		Tools:      []Tool{{Type: "function", Function: ToolSpec{Name: "get_weather", Parameters: map[string]any{"type": "object"}}}},
+		ToolChoice: "auto",
+	}
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "get_weather" || resp.ToolCalls[0].ID == "" {
+		t.Fatalf("Expected one get_weather tool call with an ID, got %#v", resp.ToolCalls)
+	}
+	if _, ok := sent["tools"]; !ok {
+		t.Error("Expected the request to contain tools")
+	}
+	if _, ok := sent["toolConfig"]; !ok {
+		t.Error("Expected the request to contain a toolConfig")
+	}
+}
+
+func TestGeminiProvider_QueryParts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"candidates": [{"content": {"parts": [{"text": "Here is a cat: "}, {"inlineData": {"mimeType": "image/png", "data": "iVBORw=="}}, {"text": "enjoy!"}]}, "finishReason": "STOP"}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+	resp, err := provider.Query(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Draw a cat"}}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Text != "Here is a cat: enjoy!" {
+		t.Errorf("Expected the concatenated text, got %q", resp.Text)
+	}
+	if len(resp.Parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %#v", resp.Parts)
+	}
+	img := resp.Parts[1]
+	if img.Type != ContentPartImage || img.MIMEType != "image/png" || string(img.Data) != "\x89PNG" {
+		t.Errorf("Expected a decoded png image part, got %#v", img)
+	}
+}
+
+// TestGeminiProvider_StreamMalformedChunk verifies that a chunk the decoder can't parse ends the stream with an error.
+func TestGeminiProvider_StreamMalformedChunk(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"candidates": [{"content": {"parts": [{"text": "Hel"}]}}]}, {"candidates": oops}]`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+	done := make(chan error, 1)
+	go func() {
+		_, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}, func(Delta) {})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected an error for the malformed chunk, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to stop on the malformed chunk, it is still decoding")
+	}
+}
+
+// TestGeminiProvider_StreamUsageFallback verifies that the usage is estimated when usageMetadata is missing.
+func TestGeminiProvider_StreamUsageFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"candidates": [{"content": {"parts": [{"text": "Hello world"}]}, "finishReason": "STOP"}]}]`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+	resp, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}, func(Delta) {})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Usage == nil || !resp.Usage.Estimated || resp.Usage.TotalTokens == 0 {
+		t.Errorf("Expected an estimated usage, got %#v", resp.Usage)
+	}
+}
+
+func TestGeminiProvider_Safety(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantErr    string
+		wantSafety bool
+	}{
+		{
+			name:    "PromptBlocked",
+			body:    `{"promptFeedback": {"blockReason": "SAFETY", "safetyRatings": [{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "probability": "HIGH", "blocked": true}, {"category": "HARM_CATEGORY_HARASSMENT", "probability": "NEGLIGIBLE"}]}}`,
+			wantErr: "gemini blocked response: SAFETY (HARM_CATEGORY_DANGEROUS_CONTENT)",
+		},
+		{
+			name:       "RatedAnswer",
+			body:       `{"candidates": [{"content": {"parts": [{"text": "Sure."}]}, "finishReason": "STOP", "safetyRatings": [{"category": "HARM_CATEGORY_HARASSMENT", "probability": "LOW"}]}]}`,
+			wantSafety: true,
+		},
+		{
+			name: "NoSafetyFeedback",
+			body: `{"candidates": [{"content": {"parts": [{"text": "Sure."}]}, "finishReason": "STOP"}]}`,
+		},
+	}
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if strings.Contains(r.URL.Path, "streamGenerateContent") {
+					fmt.Fprintf(w, "[%s]", tt.body)
+					return
+				}
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+			provider := &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+			req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}
+
+			for mode, call := range map[string]func() (*LLMResponse, error){
+				"Query":  func() (*LLMResponse, error) { return provider.Query(context.Background(), req) },
+				"Stream": func() (*LLMResponse, error) { return provider.Stream(context.Background(), req, func(Delta) {}) },
+			} {
+				resp, err := call()
+				if tt.wantErr != "" {
+					var blocked *ContentBlockedError
+					if !errors.As(err, &blocked) || err.Error() != tt.wantErr {
+						t.Errorf("%s: Expected ContentBlockedError %q, got %v", mode, tt.wantErr, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s failed: %v", mode, err)
+				}
+				if (resp.Safety != nil) != tt.wantSafety {
+					t.Errorf("%s: Expected safety info %t, got %#v", mode, tt.wantSafety, resp.Safety)
+				}
+				if tt.wantSafety && (len(resp.Safety.Ratings) != 1 || resp.Safety.Ratings[0].Probability != "LOW") {
+					t.Errorf("%s: Unexpected safety ratings %#v", mode, resp.Safety.Ratings)
+				}
+			}
+		})
+	}
+}
+
+func TestGeminiProvider_SafetySettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		extras  map[string]any
+		want    []any
+		wantErr bool
+	}{
+		{name: "NoSettings"},
+		{
+			name:   "TypedSettings",
+			extras: map[string]any{ProviderExtraGeminiSafetySettings: []GeminiSafetySetting{{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Threshold: "BLOCK_ONLY_HIGH"}}},
+			want:   []any{map[string]any{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "threshold": "BLOCK_ONLY_HIGH"}},
+		},
+		{
+			name:   "MapSettings",
+			extras: map[string]any{ProviderExtraGeminiSafetySettings: []any{map[string]any{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_NONE"}}},
+			want:   []any{map[string]any{"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_NONE"}},
+		},
+		{
+			name:    "InvalidThreshold",
+			extras:  map[string]any{ProviderExtraGeminiSafetySettings: []GeminiSafetySetting{{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_SOME"}}},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidType",
+			extras:  map[string]any{ProviderExtraGeminiSafetySettings: "BLOCK_NONE"},
+			wantErr: true,
+		},
+	}
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&sent)
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintln(w, `{"candidates": [{"content": {"parts": [{"text": "Sure."}]}, "finishReason": "STOP"}]}`)
+			}))
+			defer server.Close()
+			provider := &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+			req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, ProviderExtras: tt.extras}
+
+			_, err := provider.Query(context.Background(), req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error for invalid safety settings, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			got, ok := sent["safetySettings"]
+			if tt.want == nil {
+				if ok {
+					t.Errorf("Expected no safetySettings in the request, got %v", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected safetySettings %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGeminiProvider_Reasoning(t *testing.T) {
+	const parts = `{"candidates": [{"content": {"parts": [{"text": "Thinking about sums.", "thought": true}, {"text": "4"}]}, "finishReason": "STOP"}]}`
+	var sent map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.Path, "streamGenerateContent") {
+			fmt.Fprintf(w, "[%s]", parts)
+			return
+		}
+		fmt.Fprint(w, parts)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "2+2?"}}, ProviderExtras: map[string]any{ProviderExtraIncludeReasoning: true}}
+
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Text != "4" || resp.Reasoning != "Thinking about sums." {
+		t.Errorf("Expected the thought apart from the text, got %#v", resp)
+	}
+	genConfig, _ := sent["generationConfig"].(map[string]any)
+	if thinking, _ := genConfig["thinkingConfig"].(map[string]any); thinking["includeThoughts"] != true {
+		t.Errorf("Expected thinkingConfig.includeThoughts to be sent, got %v", sent["generationConfig"])
+	}
+
+	var reasoning, text string
+	resp, err = provider.Stream(context.Background(), req, func(d Delta) {
+		reasoning += d.Reasoning
+		text += d.Text
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if reasoning != "Thinking about sums." || text != "4" || resp.Reasoning != reasoning {
+		t.Errorf("Expected separate reasoning and text deltas, got %q / %q", reasoning, text)
+	}
+}
@@ -0,0 +1,255 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// geminiTool groups the function declarations sent to Gemini's generateContent API.
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// geminiFunctionDeclaration is Gemini's equivalent of an OpenAI function tool.
+type geminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// geminiSchemaKeywords are the JSON schema keywords accepted by Gemini's OpenAPI-subset Schema object.
+var geminiSchemaKeywords = []string{
+	"type", "format", "title", "description", "nullable", "enum", "items", "properties", "required",
+	"minItems", "maxItems", "minLength", "maxLength", "pattern", "minimum", "maximum",
+	"minProperties", "maxProperties", "anyOf", "propertyOrdering", "default", "example",
+}
+
+// geminiUnsupportedSchemaKeywords change the meaning of a schema and cannot be represented by Gemini,
+// so we refuse them instead of silently sending a different contract to the model.
+// Any other keyword not listed in geminiSchemaKeywords (additionalProperties, $schema, strict, ...)
+// only adds validation or annotations and is simply stripped.
+var geminiUnsupportedSchemaKeywords = []string{
+	"$ref", "$defs", "definitions", "oneOf", "allOf", "not", "if", "then", "else",
+	"const", "patternProperties", "dependentSchemas", "prefixItems",
+}
+
+// toGeminiTools converts OpenAI-style function tools into Gemini function declarations.
+// It returns an error if a tool parameters schema uses constructs Gemini can't represent.
+func toGeminiTools(tools []Tool) ([]geminiTool, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	decls := make([]geminiFunctionDeclaration, 0, len(tools))
+	for _, t := range tools {
+		if t.Function.Name == "" {
+			return nil, fmt.Errorf("gemini: tool of type %q has no function name", t.Type)
+		}
+		decl := geminiFunctionDeclaration{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+		}
+		if len(t.Function.Parameters) > 0 {
+			params, err := ToGeminiSchema(t.Function.Parameters)
+			if err != nil {
+				return nil, fmt.Errorf("gemini: tool %q: %w", t.Function.Name, err)
+			}
+			decl.Parameters = params
+		}
+		decls = append(decls, decl)
+	}
+	return []geminiTool{{FunctionDeclarations: decls}}, nil
+}
+
+// ToGeminiSchema converts a JSON schema into the restricted OpenAPI subset accepted by Gemini.
+// Unsupported annotation keywords are stripped, types are upper-cased and a ["type","null"] union
+// is mapped to nullable. It returns an error on structural constructs Gemini can't represent.
+func ToGeminiSchema(schema map[string]any) (map[string]any, error) {
+	return toGeminiSchema(schema, "#")
+}
+
+func toGeminiSchema(schema map[string]any, at string) (map[string]any, error) {
+	out := make(map[string]any, len(schema))
+	for key, value := range schema {
+		if slices.Contains(geminiUnsupportedSchemaKeywords, key) {
+			return nil, fmt.Errorf("unsupported schema keyword %q at %s", key, at)
+		}
+		if !slices.Contains(geminiSchemaKeywords, key) {
+			continue
+		}
+		switch key {
+		case "type":
+			typ, nullable, err := toGeminiSchemaType(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w at %s", err, at)
+			}
+			out["type"] = typ
+			if nullable {
+				out["nullable"] = true
+			}
+		case "properties":
+			props, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("properties must be an object at %s", at)
+			}
+			converted := make(map[string]any, len(props))
+			for name, prop := range props {
+				propSchema, ok := prop.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("property %q must be an object at %s", name, at)
+				}
+				c, err := toGeminiSchema(propSchema, at+"/properties/"+name)
+				if err != nil {
+					return nil, err
+				}
+				converted[name] = c
+			}
+			out["properties"] = converted
+		case "items":
+			items, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("items must be a single schema object at %s", at)
+			}
+			c, err := toGeminiSchema(items, at+"/items")
+			if err != nil {
+				return nil, err
+			}
+			out["items"] = c
+		case "anyOf":
+			variants, err := toSchemaList(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w at %s", err, at)
+			}
+			converted := make([]map[string]any, 0, len(variants))
+			for i, v := range variants {
+				c, err := toGeminiSchema(v, fmt.Sprintf("%s/anyOf/%d", at, i))
+				if err != nil {
+					return nil, err
+				}
+				converted = append(converted, c)
+			}
+			out["anyOf"] = converted
+		default:
+			out[key] = value
+		}
+	}
+	return out, nil
+}
+
+// toGeminiSchemaType maps a JSON schema "type" (a string or a list with an optional "null") to a Gemini type.
+func toGeminiSchemaType(value any) (typ string, nullable bool, err error) {
+	var types []string
+	switch v := value.(type) {
+	case string:
+		types = []string{v}
+	case []string:
+		types = v
+	case []any:
+		for _, t := range v {
+			s, ok := t.(string)
+			if !ok {
+				return "", false, fmt.Errorf("invalid type %v", t)
+			}
+			types = append(types, s)
+		}
+	default:
+		return "", false, fmt.Errorf("invalid type %v", value)
+	}
+	for _, t := range types {
+		if t == "null" {
+			nullable = true
+			continue
+		}
+		if typ != "" {
+			return "", false, fmt.Errorf("union type %v is not supported", types)
+		}
+		typ = strings.ToUpper(t)
+	}
+	if typ == "" {
+		return "", false, fmt.Errorf("type %v has no non-null type", types)
+	}
+	return typ, nullable, nil
+}
+
+func toSchemaList(value any) ([]map[string]any, error) {
+	switch v := value.(type) {
+	case []map[string]any:
+		return v, nil
+	case []any:
+		out := make([]map[string]any, 0, len(v))
+		for _, item := range v {
+			m, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("schema list must only contain objects")
+			}
+			out = append(out, m)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("schema list must be an array")
+	}
+}
+
+// toGeminiToolConfig maps an OpenAI-style tool_choice ("auto", "none", "required" or a ToolChoice)
+// to Gemini's toolConfig. It returns nil when the choice is unset or unknown.
+func toGeminiToolConfig(choice any) map[string]any {
+	mode := ""
+	var allowed []string
+	switch c := choice.(type) {
+	case string:
+		mode = c
+	case ToolChoice:
+		mode = c.Type
+		if c.Function.Name != "" {
+			allowed = []string{c.Function.Name}
+		}
+	case *ToolChoice:
+		if c == nil {
+			return nil
+		}
+		mode = c.Type
+		if c.Function.Name != "" {
+			allowed = []string{c.Function.Name}
+		}
+	}
+	cfg := map[string]any{}
+	switch mode {
+	case "auto":
+		cfg["mode"] = "AUTO"
+	case "none":
+		cfg["mode"] = "NONE"
+	case "required", "function":
+		cfg["mode"] = "ANY"
+		if len(allowed) > 0 {
+			cfg["allowedFunctionNames"] = allowed
+		}
+	default:
+		return nil
+	}
+	return map[string]any{"functionCallingConfig": cfg}
+}
+
+// geminiFunctionArgs decodes tool call arguments into the object expected by Gemini.
+// OpenAI-compatible providers encode arguments as a JSON string, Gemini and Ollama as an object.
+func geminiFunctionArgs(raw json.RawMessage) map[string]any {
+	args := map[string]any{}
+	if len(raw) == 0 {
+		return args
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		raw = json.RawMessage(s)
+	}
+	_ = json.Unmarshal(raw, &args)
+	return args
+}
+
+// geminiFunctionResponse wraps a tool result into the object expected by Gemini's functionResponse.
+func geminiFunctionResponse(content string) map[string]any {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(content), &obj); err == nil && obj != nil {
+		return obj
+	}
+	return map[string]any{"result": content}
+}
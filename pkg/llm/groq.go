@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// NewGroqAdapter returns a provider for the OpenAI-compatible Groq API.
+// The inference timings reported by Groq are available with GroqTimingsFromResponse.
+func NewGroqAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("groq: missing API key")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("groq: missing model")
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("groq: missing baseURl")
+	}
+	return NewOpenAICompatAdapter(cfg, ProviderGroq, cfg.BaseURL, l)
+}
+
+// GroqTimings are the durations in seconds reported by Groq in the usage of a response.
+type GroqTimings struct {
+	QueueTime      float64 `json:"queue_time"`
+	PromptTime     float64 `json:"prompt_time"`
+	CompletionTime float64 `json:"completion_time"`
+	TotalTime      float64 `json:"total_time"`
+}
+
+// GroqTimingsFromResponse returns the timings found in the raw usage of a Groq response,
+// and false when there are none, e.g. for a streamed response or another provider.
+func GroqTimingsFromResponse(resp *LLMResponse) (GroqTimings, bool) {
+	if resp == nil || len(resp.Raw) == 0 {
+		return GroqTimings{}, false
+	}
+	var wire struct {
+		Usage *GroqTimings `json:"usage"`
+	}
+	if err := json.Unmarshal(resp.Raw, &wire); err != nil || wire.Usage == nil || wire.Usage.TotalTime == 0 {
+		return GroqTimings{}, false
+	}
+	return *wire.Usage, true
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestGroqProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") == "text/event-stream" {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Fast\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}],\"x_groq\":{\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":1,\"total_tokens\":13}}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "Fast"}}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 1, "total_tokens": 13, "queue_time": 0.01, "prompt_time": 0.002, "completion_time": 0.004, "total_time": 0.006}}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider, err := NewGroqAdapter(ProviderConfig{Model: "llama-3.3-70b-versatile", APIKey: "test-api-key", BaseURL: server.URL}, l)
+	if err != nil {
+		t.Fatalf("NewGroqAdapter failed: %v", err)
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "How fast are you?"}}}
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	timings, ok := GroqTimingsFromResponse(resp)
+	if !ok || timings.PromptTime != 0.002 || timings.CompletionTime != 0.004 || timings.TotalTime != 0.006 {
+		t.Errorf("Expected the Groq timings of the usage, got %+v (found: %t)", timings, ok)
+	}
+
+	resp, err = provider.Stream(context.Background(), req, func(Delta) {})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Text != "Fast" || resp.Usage == nil || resp.Usage.TotalTokens != 13 || resp.Usage.Estimated {
+		t.Errorf("Expected the streamed text with the x_groq usage, got %q and %+v", resp.Text, resp.Usage)
+	}
+	if _, ok := GroqTimingsFromResponse(resp); ok {
+		t.Error("Expected no timings for a streamed response")
+	}
+
+	if _, err := NewGroqAdapter(ProviderConfig{Model: "llama-3.3-70b-versatile", BaseURL: server.URL}, l); err == nil {
+		t.Error("Expected an error without API key, got nil")
+	}
+}
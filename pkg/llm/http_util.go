@@ -2,17 +2,30 @@ package llm
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
 )
 
+// withRequestTimeout derives a context bounded by timeout from ctx when timeout is > 0.
+// Otherwise, it returns ctx unchanged with a no-op cancel func, so callers can always defer cancel().
+func withRequestTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 // HttpRequest performs a generic HTTP POST request and unmarshals the response.
 // It's designed to be used by providers that don't follow the OpenAI API schema.
+// Transient failures are retried with DefaultRetryPolicy, see HttpRequestWithRetry.
 func HttpRequest[ReqT any, RespT any](
 	ctx context.Context,
 	client *http.Client,
@@ -21,40 +34,90 @@ func HttpRequest[ReqT any, RespT any](
 	requestBody ReqT,
 	l golog.MyLogger,
 ) (*RespT, []byte, error) {
+	return HttpRequestWithRetry[ReqT, RespT](ctx, client, url, headers, requestBody, DefaultRetryPolicy, l)
+}
 
-	// 1. Marshal the request body
-	bodyBytes, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal request payload: %w", err)
-	}
+// HttpRequestWithRetry is like HttpRequest, retrying on 429, 500, 502, 503 and 504 responses as set by policy.
+// On a non-2xx response, the error is an *APIError with the body of the last attempt, which is also returned.
+func HttpRequestWithRetry[ReqT any, RespT any](
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	headers http.Header,
+	requestBody ReqT,
+	policy RetryPolicy,
+	l golog.MyLogger,
+) (*RespT, []byte, error) {
+	return httpPostRequest[ReqT, RespT](ctx, client, url, headers, requestBody, policy, false, l)
+}
 
-	// 2. Create and configure the HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create new request: %w", err)
+// marshalRequestBody encodes the request body without escaping the HTML characters (<, > and &) like json.Marshal does,
+// so that prompts containing code or HTML reach servers that don't unescape them unchanged.
+func marshalRequestBody(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
 	}
-	httpReq.Header = headers
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
 
-	// 3. Execute the request
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		l.Warn("failed http request: %s %s", httpReq.Method, httpReq.URL)
-		return nil, nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
+// httpPostRequest is HttpRequestWithRetry with an optional gzip compression of the request body.
+// When gzipBody is true and the server answers 415 Unsupported Media Type, the request is sent again uncompressed.
+func httpPostRequest[ReqT any, RespT any](
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	headers http.Header,
+	requestBody ReqT,
+	policy RetryPolicy,
+	gzipBody bool,
+	l golog.MyLogger,
+) (*RespT, []byte, error) {
 
-	// 4. Read and check the response
-	respBody, err := io.ReadAll(resp.Body)
+	// 1. Marshal the request body
+	bodyBytes, err := marshalRequestBody(requestBody)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal request payload: %w", err)
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		l.Warn("non-2xx status code : %d, body:%q", resp.StatusCode, string(respBody))
-		return nil, respBody, fmt.Errorf("received non-2xx status code %d", resp.StatusCode)
+	// 2. Execute the request, the body is recreated for each attempt
+	send := func(body []byte, contentEncoding string) ([]byte, error) {
+		return doWithRetry(ctx, client, policy, l, func() (*http.Request, error) {
+			httpReq, err := newHTTPRequest(ctx, http.MethodPost, url, headers, bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create new request: %w", err)
+			}
+			if contentEncoding != "" {
+				httpReq.Header.Set("Content-Encoding", contentEncoding)
+			}
+			return httpReq, nil
+		})
+	}
+	var respBody []byte
+	if gzipBody {
+		compressed, err := gzipBytes(bodyBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		respBody, err = send(compressed, "gzip")
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnsupportedMediaType {
+			l.Warn("gzip compressed request refused by %s, sending it uncompressed", url)
+			respBody, err = send(bodyBytes, "")
+		}
+		if err != nil {
+			return nil, respBody, err
+		}
+	} else {
+		respBody, err = send(bodyBytes, "")
+		if err != nil {
+			return nil, respBody, err
+		}
 	}
 
-	// 5. Unmarshal the successful response
+	// 3. Unmarshal the successful response
 	var responsePayload RespT
 	if err := json.Unmarshal(respBody, &responsePayload); err != nil {
 		return nil, respBody, fmt.Errorf("failed to unmarshal response: %w", err)
@@ -63,41 +126,39 @@ func HttpRequest[ReqT any, RespT any](
 	return &responsePayload, respBody, nil
 }
 
-// httpGetRequest performs a generic HTTP GET request and unmarshal the response.
+// gzipBytes returns data compressed with gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to gzip request payload: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to gzip request payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// httpGetRequest performs a generic HTTP GET request and unmarshal the response, retrying as set by policy.
 func httpGetRequest[RespT any](
 	ctx context.Context,
 	client *http.Client,
 	url string,
 	headers http.Header,
+	policy RetryPolicy,
 	l golog.MyLogger,
 ) (*RespT, error) {
-	// 1. Create and configure the HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	respBody, err := doWithRetry(ctx, client, policy, l, func() (*http.Request, error) {
+		httpReq, err := newHTTPRequest(ctx, http.MethodGet, url, headers, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new GET request: %w", err)
+		}
+		return httpReq, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new GET request: %w", err)
+		return nil, err
 	}
-	httpReq.Header = headers
 
-	// 2. Execute the request
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		l.Warn("failed http GET request: %s %s", httpReq.Method, httpReq.URL)
-		return nil, fmt.Errorf("failed to send GET request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// 3. Read and check the response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read GET response body: %w", err)
-	}
-	l.Debug("GET: %s, body:\n%q\n", resp.StatusCode, httpReq.URL, string(respBody))
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		l.Warn("non-2xx status code [%d] doing GET: %s, body:%q", resp.StatusCode, httpReq.URL, string(respBody))
-		return nil, fmt.Errorf("received non-2xx status code %d", resp.StatusCode)
-	}
-
-	// 4. Unmarshal the successful response
 	var responsePayload RespT
 	if err := json.Unmarshal(respBody, &responsePayload); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal GET response: %w", err)
@@ -105,3 +166,43 @@ func httpGetRequest[RespT any](
 
 	return &responsePayload, nil
 }
+
+// doWithRetry sends the request built by newRequest and returns the body of a 2xx response.
+// Retryable statuses are retried with the policy backoff, the wait is interrupted when ctx is done.
+// For a non-2xx final response, the body is returned along with an *APIError containing it.
+func doWithRetry(ctx context.Context, client *http.Client, policy RetryPolicy, l golog.MyLogger, newRequest func() (*http.Request, error)) ([]byte, error) {
+	var wait time.Duration
+	for attempt := 0; ; attempt++ {
+		httpReq, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			l.Warn("failed http request: %s %s", httpReq.Method, httpReq.URL)
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		l.Debug("%s %s: status %d, body:\n%q\n", httpReq.Method, httpReq.URL, resp.StatusCode, string(respBody))
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return respBody, nil
+		}
+
+		if !isRetryableStatus(resp.StatusCode) || attempt >= policy.MaxRetries {
+			l.Warn("non-2xx status code [%d] doing %s: %s, body:%q", resp.StatusCode, httpReq.Method, httpReq.URL, string(respBody))
+			kind, _ := ProviderKindFromBaseURL(httpReq.URL.String())
+			return respBody, newAPIError(resp.StatusCode, resp.Header, respBody, kind, attempt+1)
+		}
+		wait = policy.delay(attempt, wait, resp.Header.Get("Retry-After"))
+		l.Warn("status code %d doing %s: %s, retrying in %s (%d/%d)", resp.StatusCode, httpReq.Method, httpReq.URL, wait, attempt+1, policy.MaxRetries)
+		if err := sleepContext(ctx, wait); err != nil {
+			kind, _ := ProviderKindFromBaseURL(httpReq.URL.String())
+			// keep the status of the last response inspectable with errors.As, along with the context error
+			return respBody, fmt.Errorf("retry interrupted: %w: %w", err, newAPIError(resp.StatusCode, resp.Header, respBody, kind, attempt+1))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestHttpPostRequestGzip(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	type echo struct {
+		Encoding string `json:"encoding"`
+		WireSize int    `json:"wire_size"`
+		Size     int    `json:"size"`
+	}
+	type payload struct {
+		Prompt string `json:"prompt"`
+	}
+	body := payload{Prompt: strings.Repeat("a large RAG context ", 1000)}
+	plainSize := len(mustMarshal(t, body))
+
+	// newServer decompresses gzip bodies and echoes their size, refusing them with a 415 if acceptGzip is false
+	newServer := func(acceptGzip bool) (*httptest.Server, *[]string) {
+		var encodings []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := r.Header.Get("Content-Encoding")
+			encodings = append(encodings, encoding)
+			wire, _ := io.ReadAll(r.Body)
+			data := wire
+			if encoding == "gzip" {
+				if !acceptGzip {
+					w.WriteHeader(http.StatusUnsupportedMediaType)
+					return
+				}
+				zr, err := gzip.NewReader(strings.NewReader(string(wire)))
+				if err != nil {
+					t.Errorf("Expected a valid gzip body, got error: %v", err)
+					return
+				}
+				data, _ = io.ReadAll(zr)
+			}
+			json.NewEncoder(w).Encode(echo{Encoding: encoding, WireSize: len(wire), Size: len(data)})
+		}))
+		return server, &encodings
+	}
+
+	t.Run("CompressesBody", func(t *testing.T) {
+		server, _ := newServer(true)
+		defer server.Close()
+		headers := http.Header{"Content-Type": []string{"application/json"}}
+		resp, _, err := httpPostRequest[payload, echo](context.Background(), server.Client(), server.URL, headers, body, DefaultRetryPolicy, true, l)
+		if err != nil {
+			t.Fatalf("httpPostRequest failed: %v", err)
+		}
+		if resp.Encoding != "gzip" || resp.Size != plainSize || resp.WireSize >= plainSize {
+			t.Errorf("Expected a gzip body of %d bytes once decompressed and smaller on the wire, got %+v", plainSize, resp)
+		}
+		if headers.Get("Content-Encoding") != "" {
+			t.Errorf("Expected the caller headers to be left unchanged, got %v", headers)
+		}
+	})
+
+	t.Run("FallbackOn415", func(t *testing.T) {
+		server, encodings := newServer(false)
+		defer server.Close()
+		resp, _, err := httpPostRequest[payload, echo](context.Background(), server.Client(), server.URL, http.Header{}, body, DefaultRetryPolicy, true, l)
+		if err != nil {
+			t.Fatalf("httpPostRequest failed: %v", err)
+		}
+		if resp.Encoding != "" || resp.Size != plainSize {
+			t.Errorf("Expected an uncompressed body of %d bytes, got %+v", plainSize, resp)
+		}
+		if len(*encodings) != 2 || (*encodings)[0] != "gzip" {
+			t.Errorf("Expected a gzip attempt then an uncompressed one, got %q", *encodings)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		server, _ := newServer(true)
+		defer server.Close()
+		resp, _, err := HttpRequestWithRetry[payload, echo](context.Background(), server.Client(), server.URL, http.Header{}, body, DefaultRetryPolicy, l)
+		if err != nil {
+			t.Fatalf("HttpRequestWithRetry failed: %v", err)
+		}
+		if resp.Encoding != "" || resp.WireSize != plainSize {
+			t.Errorf("Expected an uncompressed body, got %+v", resp)
+		}
+	})
+}
+
+func TestGzipRequestsFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ProviderConfig
+		want    bool
+		wantErr bool
+	}{
+		{"Default", ProviderConfig{}, false, false},
+		{"Field", ProviderConfig{GzipRequests: true}, true, false},
+		{"Extras", ProviderConfig{Extras: map[string]any{ProviderExtraGzipRequests: true}}, true, false},
+		{"InvalidExtras", ProviderConfig{Extras: map[string]any{ProviderExtraGzipRequests: "yes"}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gzipRequestsFromConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %t, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	return data
+}
+
+func TestRequestBodyNotHTMLEscaped(t *testing.T) {
+	prompt := `Fix this: <div class="a">Tom & Jerry</div>`
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		var payload struct {
+			Stream bool `json:"stream"`
+		}
+		json.Unmarshal(body, &payload)
+		if payload.Stream {
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Model: "gpt-4o-mini", Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: prompt}}}
+	if _, err := provider.Query(context.Background(), req); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if _, err := provider.Stream(context.Background(), req, func(Delta) {}); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(bodies))
+	}
+	for _, body := range bodies {
+		if !strings.Contains(body, `<div class=\"a\">Tom & Jerry</div>`) {
+			t.Errorf("Expected the prompt to be sent unescaped, got %s", body)
+		}
+	}
+}
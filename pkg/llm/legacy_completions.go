@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ProviderExtraLegacyCompletions is the ProviderConfig.Extras key switching an OpenAI-compatible provider
+// to the legacy prompt based "/completions" endpoint, for servers not implementing "/chat/completions".
+// The messages are then flattened into a single prompt and tools are not supported.
+const ProviderExtraLegacyCompletions = "legacy_completions"
+
+// defaultLegacyCompletionsEndpoint is the default endpoint of the legacy completions mode, cfg.Endpoint overrides it.
+const defaultLegacyCompletionsEndpoint = "/completions"
+
+// messagesToPrompt flattens msgs into a single prompt, one "Role: content" paragraph per message,
+// ending with "Assistant:" so that the model continues with the answer.
+func messagesToPrompt(msgs []LLMMessage) string {
+	var sb strings.Builder
+	for _, msg := range msgs {
+		role := string(msg.Role)
+		if role == "" {
+			role = string(RoleUser)
+		}
+		sb.WriteString(strings.ToUpper(role[:1]) + role[1:])
+		sb.WriteString(": ")
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("Assistant:")
+	return sb.String()
+}
+
+// buildLegacyPayload creates the request payload for the legacy completions endpoint.
+func buildLegacyPayload(req *LLMRequest, defaultModel string) (map[string]any, error) {
+	if len(req.Tools) > 0 {
+		return nil, errors.New("tools are not supported by the legacy completions endpoint")
+	}
+	payload := map[string]any{
+		"model":  FirstNonEmpty(req.Model, defaultModel),
+		"prompt": messagesToPrompt(preparedMessages(req)),
+		"stream": req.Stream,
+	}
+	if req.Temperature > 0 {
+		payload["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		payload["top_p"] = req.TopP
+	}
+	if req.MaxTokens > 0 {
+		payload["max_tokens"] = req.MaxTokens
+	}
+	if req.FrequencyPenalty != 0 {
+		payload["frequency_penalty"] = req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		payload["presence_penalty"] = req.PresencePenalty
+	}
+	return payload, nil
+}
+
+// unmarshalLegacyResponse parses a legacy completions response into LLMResponse.
+func unmarshalLegacyResponse(rawResp json.RawMessage) (*LLMResponse, error) {
+	var wire struct {
+		Choices []struct {
+			Text         string `json:"text"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *Usage `json:"usage,omitempty"`
+	}
+	if err := json.Unmarshal(rawResp, &wire); err != nil {
+		return nil, fmt.Errorf("unmarshal wire response: %w", err)
+	}
+	if len(wire.Choices) == 0 {
+		return nil, errors.New("no choices in response")
+	}
+	return &LLMResponse{
+		Text:         wire.Choices[0].Text,
+		FinishReason: wire.Choices[0].FinishReason,
+		Usage:        wire.Usage,
+		Raw:          rawResp,
+	}, nil
+}
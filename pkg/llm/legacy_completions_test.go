@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestMessagesToPrompt(t *testing.T) {
+	prompt := messagesToPrompt([]LLMMessage{
+		{Role: RoleSystem, Content: "You are terse."},
+		{Role: RoleUser, Content: "Hello"},
+		{Role: RoleAssistant, Content: "Hi."},
+		{Role: RoleUser, Content: "Bye"},
+	})
+	want := "System: You are terse.\n\nUser: Hello\n\nAssistant: Hi.\n\nUser: Bye\n\nAssistant:"
+	if prompt != want {
+		t.Errorf("Expected prompt %q, got %q", want, prompt)
+	}
+}
+
+func TestOpenAICompatProviderLegacyCompletions(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		var reqBody map[string]any
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if _, ok := reqBody["messages"]; ok {
+			t.Errorf("Expected no messages in a legacy completions request, got %v", reqBody["messages"])
+		}
+		if prompt, _ := reqBody["prompt"].(string); !strings.HasPrefix(prompt, "User: Say hello") {
+			t.Errorf("Expected a prompt built from the messages, got %q", reqBody["prompt"])
+		}
+		if reqBody["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"text\":\" Hello\"}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"text\":\" world\",\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"text":" Hello world","finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`)
+	}))
+	defer server.Close()
+
+	cfg := ProviderConfig{Model: "legacy-model", APIKey: "key", Extras: map[string]any{ProviderExtraLegacyCompletions: true}}
+	provider, err := NewOpenAICompatAdapter(cfg, ProviderOpenAI, server.URL, l)
+	if err != nil {
+		t.Fatalf("NewOpenAICompatAdapter failed: %v", err)
+	}
+	req := func() *LLMRequest {
+		return &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Say hello"}}}
+	}
+
+	t.Run("Query", func(t *testing.T) {
+		resp, err := provider.Query(context.Background(), req())
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if resp.Text != " Hello world" || resp.FinishReason != "stop" || resp.Usage == nil || resp.Usage.TotalTokens != 7 {
+			t.Errorf("Unexpected response: %#v", resp)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		var streamed strings.Builder
+		resp, err := provider.Stream(context.Background(), req(), func(d Delta) { streamed.WriteString(d.Text) })
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		if resp.Text != " Hello world" || streamed.String() != " Hello world" || resp.FinishReason != "stop" {
+			t.Errorf("Unexpected stream response: %#v (streamed %q)", resp, streamed.String())
+		}
+	})
+
+	t.Run("ToolsRejected", func(t *testing.T) {
+		r := req()
+		r.Tools = []Tool{{Type: "function", Function: ToolSpec{Name: "get_weather"}}}
+		if _, err := provider.Query(context.Background(), r); err == nil {
+			t.Error("Expected an error for tools with the legacy completions endpoint")
+		}
+	})
+
+	for _, path := range paths {
+		if path != "/completions" {
+			t.Errorf("Expected requests to /completions, got %s", path)
+		}
+	}
+}
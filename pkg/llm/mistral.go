@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// mistralMaxTemperature is the highest temperature accepted by the Mistral API, which rejects values above it.
+const mistralMaxTemperature = 1.0
+
+// mistralToolCallIDPattern matches the tool call IDs accepted by the Mistral API, 9 letters or digits.
+var mistralToolCallIDPattern = regexp.MustCompile(`^[a-zA-Z0-9]{9}$`)
+
+// MistralProvider is an OpenAI-compatible provider for the Mistral API,
+// adjusting the requests to its quirks before sending them.
+type MistralProvider struct {
+	*openAICompatibleProvider
+}
+
+// NewMistralAdapter returns a MistralProvider for the OpenAI-compatible API of Mistral at cfg.BaseURL,
+// cfg.APIKey, cfg.Model and cfg.BaseURL being required.
+func NewMistralAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("mistral: missing API key")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("mistral: missing model")
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("mistral: missing baseURl")
+	}
+	provider, err := NewOpenAICompatAdapter(cfg, ProviderMistral, cfg.BaseURL, l)
+	if err != nil {
+		return nil, err
+	}
+	return &MistralProvider{provider.(*openAICompatibleProvider)}, nil
+}
+
+// Query sends req to the Mistral API, adapted by mistralRequest.
+func (m *MistralProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return m.openAICompatibleProvider.Query(ctx, mistralRequest(req))
+}
+
+// Stream streams req from the Mistral API, adapted by mistralRequest.
+func (m *MistralProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	return m.openAICompatibleProvider.Stream(ctx, mistralRequest(req), onDelta)
+}
+
+// BuildRequestPayload returns the HTTP request that Query, or Stream when req.Stream is set, would send for req,
+// adapted to the Mistral API like they do.
+func (m *MistralProvider) BuildRequestPayload(req *LLMRequest) (*RequestPayload, error) {
+	return m.openAICompatibleProvider.BuildRequestPayload(mistralRequest(req))
+}
+
+// mistralRequest returns a copy of req adapted to the Mistral API, req itself is left unchanged:
+//   - the temperature is clamped to the range it accepts
+//   - the tool call IDs that are not 9 letters or digits, e.g. those of another provider, are replaced
+//     by such an ID, the same in the assistant tool calls and in the tool results referencing them
+//   - the tool results without name get the name of the tool call they answer, which Mistral requires
+func mistralRequest(req *LLMRequest) *LLMRequest {
+	if req == nil {
+		return nil
+	}
+	adapted := *req
+	adapted.Temperature = Clamp(adapted.Temperature, 0, mistralMaxTemperature)
+	adapted.Messages = mistralMessages(req.Messages)
+	return &adapted
+}
+
+// mistralMessages returns a copy of msgs with the tool call IDs and the tool result names expected by Mistral.
+func mistralMessages(msgs []LLMMessage) []LLMMessage {
+	if !slices.ContainsFunc(msgs, func(m LLMMessage) bool { return len(m.ToolCalls) > 0 || m.Role == RoleTool }) {
+		return msgs
+	}
+	out := slices.Clone(msgs)
+	toolNames := map[string]string{} // tool name by original tool call ID
+	for i, msg := range out {
+		if len(msg.ToolCalls) > 0 {
+			out[i].ToolCalls = slices.Clone(msg.ToolCalls)
+			for j, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Name
+				out[i].ToolCalls[j].ID = mistralToolCallID(tc.ID)
+			}
+		}
+		if msg.Role == RoleTool && msg.ToolCallID != "" {
+			if msg.Name == "" {
+				out[i].Name = toolNames[msg.ToolCallID]
+			}
+			out[i].ToolCallID = mistralToolCallID(msg.ToolCallID)
+		}
+	}
+	return out
+}
+
+// mistralToolCallID returns id when Mistral accepts it, and else 9 hexadecimal digits derived from it,
+// so that a tool call and its result get the same ID.
+func mistralToolCallID(id string) string {
+	if mistralToolCallIDPattern.MatchString(id) {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])[:9]
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestMistralProviderTemperature(t *testing.T) {
+	var sentTemperature any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]any
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		sentTemperature = reqBody["temperature"]
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "ok"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider, err := NewMistralAdapter(ProviderConfig{Model: "mistral-small-latest", APIKey: "test-api-key", BaseURL: server.URL}, l)
+	if err != nil {
+		t.Fatalf("NewMistralAdapter failed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		temperature float64
+		expected    float64
+	}{
+		{"InRange", 0.7, 0.7},
+		{"AboveMistralMax", 1.6, 1.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, Temperature: tt.temperature}
+			if _, err := provider.Query(context.Background(), req); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if sentTemperature != tt.expected {
+				t.Errorf("Expected temperature %v, got %v", tt.expected, sentTemperature)
+			}
+			if req.Temperature != tt.temperature {
+				t.Errorf("Expected the caller request to be left unchanged, got temperature %v", req.Temperature)
+			}
+		})
+	}
+}
+
+func TestMistralProviderToolCalls(t *testing.T) {
+	var sent struct {
+		Messages []struct {
+			Role       string `json:"role"`
+			Name       string `json:"name"`
+			ToolCallID string `json:"tool_call_id"`
+			ToolCalls  []struct {
+				ID string `json:"id"`
+			} `json:"tool_calls"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&sent)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "Sunny"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider, err := NewMistralAdapter(ProviderConfig{Model: "mistral-small-latest", APIKey: "test-api-key", BaseURL: server.URL}, l)
+	if err != nil {
+		t.Fatalf("NewMistralAdapter failed: %v", err)
+	}
+	// a conversation started with another provider, whose tool call IDs Mistral rejects
+	req := &LLMRequest{Messages: []LLMMessage{
+		{Role: RoleUser, Content: "Weather in Bern and Lausanne?"},
+		{Role: RoleAssistant, ToolCalls: []ToolCall{
+			{ID: "call_0bN5kqWmvXhLRy2a", Name: "get_weather", Arguments: json.RawMessage(`{"city": "Bern"}`)},
+			{ID: "D681PevKs", Name: "get_weather", Arguments: json.RawMessage(`{"city": "Lausanne"}`)},
+		}},
+		{Role: RoleTool, ToolCallID: "call_0bN5kqWmvXhLRy2a", Content: "Sunny"},
+		{Role: RoleTool, ToolCallID: "D681PevKs", Name: "get_weather", Content: "Cloudy"},
+	}}
+	if _, err := provider.Query(context.Background(), req); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(sent.Messages) != 4 || len(sent.Messages[1].ToolCalls) != 2 {
+		t.Fatalf("Expected the 4 messages with 2 tool calls, got %+v", sent.Messages)
+	}
+	converted, kept := sent.Messages[1].ToolCalls[0].ID, sent.Messages[1].ToolCalls[1].ID
+	if !mistralToolCallIDPattern.MatchString(converted) || sent.Messages[2].ToolCallID != converted {
+		t.Errorf("Expected a 9 characters ID shared by the tool call and its result, got %q and %q", converted, sent.Messages[2].ToolCallID)
+	}
+	if kept != "D681PevKs" || sent.Messages[3].ToolCallID != kept {
+		t.Errorf("Expected a valid Mistral ID to be kept, got %q and %q", kept, sent.Messages[3].ToolCallID)
+	}
+	if sent.Messages[2].Name != "get_weather" || sent.Messages[3].Name != "get_weather" {
+		t.Errorf("Expected the tool results to be named after their tool call, got %q and %q", sent.Messages[2].Name, sent.Messages[3].Name)
+	}
+	if req.Messages[1].ToolCalls[0].ID != "call_0bN5kqWmvXhLRy2a" || req.Messages[2].Name != "" {
+		t.Errorf("Expected the caller request to be left unchanged, got %+v", req.Messages)
+	}
+}
@@ -2,20 +2,38 @@ package llm
 
 import (
 	"encoding/json"
+	"fmt"
+	"math/rand/v2"
 	"os"
+	"slices"
+	"strings"
 )
 
 // ModelOverride defines optional fields to override the provider's defaults.
 // Using pointers allows us to distinguish between a field being explicitly set to `false`
 // and a field not being set at all.
 type ModelOverride struct {
-	ContextSize        *int  `json:"context_size,omitempty"`
-	SupportsTools      *bool `json:"supports_tools,omitempty"`
-	SupportsThinking   *bool `json:"supports_thinking,omitempty"`
-	SupportsInputImage *bool `json:"supports_input_image,omitempty"`
-	SupportsStreaming  *bool `json:"supports_streaming,omitempty"`
-	SupportsJSONMode   *bool `json:"supports_json_mode,omitempty"`
-	SupportsStructured *bool `json:"supports_structured,omitempty"`
+	ContextSize        *int     `json:"context_size,omitempty"`
+	Priority           *int     `json:"priority,omitempty"`
+	InputCostPer1M     *float64 `json:"input_cost_per_1m,omitempty"`
+	OutputCostPer1M    *float64 `json:"output_cost_per_1m,omitempty"`
+	SupportsTools      *bool    `json:"supports_tools,omitempty"`
+	SupportsThinking   *bool    `json:"supports_thinking,omitempty"`
+	SupportsInputImage *bool    `json:"supports_input_image,omitempty"`
+	SupportsStreaming  *bool    `json:"supports_streaming,omitempty"`
+	SupportsJSONMode   *bool    `json:"supports_json_mode,omitempty"`
+	SupportsStructured *bool    `json:"supports_structured,omitempty"`
+	// RequestOverrides replaces the ones of the defaults when set
+	RequestOverrides *RequestOverrides `json:"request_overrides,omitempty"`
+	// Family selects the FamilyDefaults of the model, when its name doesn't start with the family name
+	Family *string `json:"family,omitempty"`
+}
+
+// SamplingDefaults are the sweet-spot sampling parameters of a model family, used when a request leaves them unset.
+// Nil fields are left to the provider defaults.
+type SamplingDefaults struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
 }
 
 // ProviderModelsInfo holds the model catalog for a single provider.
@@ -24,6 +42,12 @@ type ProviderModelsInfo struct {
 	Models          map[string]ModelOverride `json:"models"`
 	Defaults        ModelInfo                `json:"defaults"`
 	ExcludePatterns []string                 `json:"exclude_patterns"`
+	// Headers are default extra headers sent with every request of the provider (e.g. X-Tenant-ID for a gateway),
+	// ProviderConfig.ExtraHeaders and LLMRequest.ExtraHeaders take precedence over them.
+	Headers map[string]string `json:"headers,omitempty"`
+	// FamilyDefaults holds the default sampling parameters by model family (e.g. "llama", "qwen3"),
+	// see SamplingDefaults. The values of the requests always take precedence over them.
+	FamilyDefaults map[string]SamplingDefaults `json:"family_defaults,omitempty"`
 }
 
 // ModelCatalog is the top-level structure for the entire models.json file.
@@ -32,7 +56,65 @@ type ModelCatalog struct {
 	Providers map[string]ProviderModelsInfo `json:"providers"`
 }
 
+// ModelInfo returns the information about the given model, merging the provider defaults
+// with the model specific overrides when they exist.
+func (p ProviderModelsInfo) ModelInfo(modelName string) ModelInfo {
+	info := p.Defaults
+	if overrides, exists := p.Models[modelName]; exists {
+		info = MergeModelInfo(p.Defaults, overrides)
+	}
+	info.Name = modelName
+	return info
+}
+
+// SamplingDefaults returns the FamilyDefaults of the family of modelName: its family in the catalog when it has
+// defaults, else the family with the longest name prefixing modelName. It returns zero defaults when none matches.
+func (p ProviderModelsInfo) SamplingDefaults(modelName string) SamplingDefaults {
+	if family := p.ModelInfo(modelName).Family; family != "" {
+		if defaults, ok := p.FamilyDefaults[family]; ok {
+			return defaults
+		}
+	}
+	var best SamplingDefaults
+	bestLen := 0
+	for family, defaults := range p.FamilyDefaults {
+		if len(family) > bestLen && strings.HasPrefix(modelName, family) {
+			best, bestLen = defaults, len(family)
+		}
+	}
+	return best
+}
+
+// withSamplingDefaults returns req with its unset (zero) temperature and top_p filled from defaults,
+// as a copy when anything changes so that the request of the caller is left as is.
+func withSamplingDefaults(req *LLMRequest, defaults SamplingDefaults) *LLMRequest {
+	fillTemperature := req.Temperature == 0 && defaults.Temperature != nil
+	fillTopP := req.TopP == 0 && defaults.TopP != nil
+	if !fillTemperature && !fillTopP {
+		return req
+	}
+	filled := *req
+	if fillTemperature {
+		filled.Temperature = *defaults.Temperature
+	}
+	if fillTopP {
+		filled.TopP = *defaults.TopP
+	}
+	return &filled
+}
+
+// ModelCatalogVersion is the newest models.json format version this package understands.
+const ModelCatalogVersion = 1
+
+// modelCatalogMigrations upgrades a catalog from the version used as key to the next one.
+var modelCatalogMigrations = map[int]func(*ModelCatalog) error{
+	// version 0 is a catalog without "version" field, written before versioning with the same format as 1
+	0: func(c *ModelCatalog) error { return nil },
+}
+
 // LoadModelCatalog reads and parses the models.json file from the given path.
+// Catalogs of an older version are migrated to ModelCatalogVersion, while a newer version is rejected
+// with an error instead of being silently misread.
 func LoadModelCatalog(filePath string) (*ModelCatalog, error) {
 	file, err := os.ReadFile(filePath)
 	if err != nil {
@@ -43,10 +125,34 @@ func LoadModelCatalog(filePath string) (*ModelCatalog, error) {
 	if err := json.Unmarshal(file, &catalog); err != nil {
 		return nil, err
 	}
+	if err := migrateModelCatalog(&catalog); err != nil {
+		return nil, fmt.Errorf("model catalog %s: %w", filePath, err)
+	}
 
 	return &catalog, nil
 }
 
+// migrateModelCatalog upgrades catalog step by step to ModelCatalogVersion.
+func migrateModelCatalog(catalog *ModelCatalog) error {
+	if catalog.Version > ModelCatalogVersion {
+		return fmt.Errorf("version %d is newer than the supported version %d, please upgrade this program", catalog.Version, ModelCatalogVersion)
+	}
+	if catalog.Version < 0 {
+		return fmt.Errorf("invalid version %d", catalog.Version)
+	}
+	for catalog.Version < ModelCatalogVersion {
+		migrate, ok := modelCatalogMigrations[catalog.Version]
+		if !ok {
+			return fmt.Errorf("no migration available from version %d", catalog.Version)
+		}
+		if err := migrate(catalog); err != nil {
+			return fmt.Errorf("migrating from version %d: %w", catalog.Version, err)
+		}
+		catalog.Version++
+	}
+	return nil
+}
+
 // MergeModelInfo combines a default ModelInfo with specific overrides.
 // It starts with the default values and replaces them with any non-zero or true values from the overrides.
 func MergeModelInfo(defaults ModelInfo, overrides ModelOverride) ModelInfo {
@@ -55,6 +161,15 @@ func MergeModelInfo(defaults ModelInfo, overrides ModelOverride) ModelInfo {
 	if overrides.ContextSize != nil {
 		merged.ContextSize = *overrides.ContextSize
 	}
+	if overrides.Priority != nil {
+		merged.Priority = *overrides.Priority
+	}
+	if overrides.InputCostPer1M != nil {
+		merged.InputCostPer1M = *overrides.InputCostPer1M
+	}
+	if overrides.OutputCostPer1M != nil {
+		merged.OutputCostPer1M = *overrides.OutputCostPer1M
+	}
 	if overrides.SupportsTools != nil {
 		merged.SupportsTools = *overrides.SupportsTools
 	}
@@ -73,6 +188,63 @@ func MergeModelInfo(defaults ModelInfo, overrides ModelOverride) ModelInfo {
 	if overrides.SupportsStructured != nil {
 		merged.SupportsStructured = *overrides.SupportsStructured
 	}
+	if overrides.RequestOverrides != nil {
+		merged.RequestOverrides = overrides.RequestOverrides
+	}
+	if overrides.Family != nil {
+		merged.Family = *overrides.Family
+	}
 
 	return merged
 }
+
+// EstimateCost returns the dollar cost of usage with the pricing of info.
+// The boolean is false, and the cost zero, when the model has no pricing defined in the catalog.
+func EstimateCost(info ModelInfo, usage Usage) (float64, bool) {
+	if info.InputCostPer1M == 0 && info.OutputCostPer1M == 0 {
+		return 0, false
+	}
+	cost := float64(usage.PromptTokens)*info.InputCostPer1M + float64(usage.CompletionTokens)*info.OutputCostPer1M
+	return cost / 1_000_000, true
+}
+
+// SampleModels returns n models picked at random from models, without replacement and keeping their original order.
+// When weighted is true, a model is picked with a probability proportional to its Priority
+// (models without a positive priority count as 1). If n <= 0 or n >= len(models) all the models are returned.
+// Pass a rng created with a fixed seed to get reproducible samples.
+func SampleModels(models []ModelInfo, n int, weighted bool, rng *rand.Rand) []ModelInfo {
+	if n <= 0 || n >= len(models) {
+		return slices.Clone(models)
+	}
+	weights := make([]int, len(models))
+	total := 0
+	for i, m := range models {
+		weights[i] = 1
+		if weighted && m.Priority > 0 {
+			weights[i] = m.Priority
+		}
+		total += weights[i]
+	}
+	picked := make([]bool, len(models))
+	for range n {
+		r := rng.IntN(total)
+		for i, w := range weights {
+			if picked[i] {
+				continue
+			}
+			if r < w {
+				picked[i] = true
+				total -= w
+				break
+			}
+			r -= w
+		}
+	}
+	sample := make([]ModelInfo, 0, n)
+	for i, m := range models {
+		if picked[i] {
+			sample = append(sample, m)
+		}
+	}
+	return sample
+}
@@ -0,0 +1,118 @@
+package llm
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadModelCatalogVersion(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		return path
+	}
+	providers := `"providers": {"Ollama": {"defaults": {"context_size": 8192}}}`
+
+	t.Run("Current", func(t *testing.T) {
+		catalog, err := LoadModelCatalog(write("current.json", `{"version": 1, `+providers+`}`))
+		if err != nil || catalog.Version != ModelCatalogVersion {
+			t.Fatalf("Expected the catalog to load, got %#v (err: %v)", catalog, err)
+		}
+	})
+
+	t.Run("UnversionedIsMigrated", func(t *testing.T) {
+		catalog, err := LoadModelCatalog(write("legacy.json", `{`+providers+`}`))
+		if err != nil {
+			t.Fatalf("Expected a legacy catalog to load, got %v", err)
+		}
+		if catalog.Version != ModelCatalogVersion || catalog.Providers["Ollama"].Defaults.ContextSize != 8192 {
+			t.Errorf("Unexpected migrated catalog: %#v", catalog)
+		}
+	})
+
+	t.Run("NewerIsRejected", func(t *testing.T) {
+		_, err := LoadModelCatalog(write("future.json", `{"version": 99, `+providers+`}`))
+		if err == nil || !strings.Contains(err.Error(), "newer than the supported version") {
+			t.Errorf("Expected a clear error for a newer catalog, got %v", err)
+		}
+	})
+}
+
+func TestEstimateCost(t *testing.T) {
+	usage := Usage{PromptTokens: 2_000, CompletionTokens: 500, TotalTokens: 2_500}
+	tests := []struct {
+		name       string
+		info       ModelInfo
+		wantCost   float64
+		wantPriced bool
+	}{
+		{"Priced", ModelInfo{InputCostPer1M: 2.5, OutputCostPer1M: 10}, 0.01, true},
+		{"OnlyOutputPriced", ModelInfo{OutputCostPer1M: 4}, 0.002, true},
+		{"Unpriced", ModelInfo{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, priced := EstimateCost(tt.info, usage)
+			if priced != tt.wantPriced {
+				t.Errorf("Expected priced %t, got %t", tt.wantPriced, priced)
+			}
+			if math.Abs(cost-tt.wantCost) > 1e-12 {
+				t.Errorf("Expected cost %f, got %f", tt.wantCost, cost)
+			}
+		})
+	}
+}
+
+func TestMergeModelInfoPricing(t *testing.T) {
+	inputCost := 0.15
+	merged := MergeModelInfo(ModelInfo{InputCostPer1M: 1, OutputCostPer1M: 2}, ModelOverride{InputCostPer1M: &inputCost})
+	if merged.InputCostPer1M != 0.15 || merged.OutputCostPer1M != 2 {
+		t.Errorf("Expected input cost 0.15 and output cost 2, got %f and %f", merged.InputCostPer1M, merged.OutputCostPer1M)
+	}
+}
+
+func TestSamplingDefaults(t *testing.T) {
+	temperature := func(v float64) *float64 { return &v }
+	family := "llama"
+	info := ProviderModelsInfo{
+		Models: map[string]ModelOverride{"my-finetune:7b": {Family: &family}},
+		FamilyDefaults: map[string]SamplingDefaults{
+			"llama":    {Temperature: temperature(0.7)},
+			"llama3.2": {Temperature: temperature(0.5), TopP: temperature(0.9)},
+			"qwen3":    {TopP: temperature(0.95)},
+		},
+	}
+	testCases := []struct {
+		name            string
+		model           string
+		req             LLMRequest
+		wantTemperature float64
+		wantTopP        float64
+	}{
+		{"FamilyPrefix", "llama3.1:8b", LLMRequest{}, 0.7, 0},
+		{"LongestFamilyPrefix", "llama3.2:3b", LLMRequest{}, 0.5, 0.9},
+		{"CatalogFamily", "my-finetune:7b", LLMRequest{}, 0.7, 0},
+		{"RequestWins", "llama3.2:3b", LLMRequest{Temperature: 0.1, TopP: 0.5}, 0.1, 0.5},
+		{"OnlyGapsFilled", "llama3.2:3b", LLMRequest{Temperature: 1.2}, 1.2, 0.9},
+		{"PartialDefaults", "qwen3:latest", LLMRequest{Temperature: 0.3}, 0.3, 0.95},
+		{"UnknownFamily", "mistral:7b", LLMRequest{Temperature: 0.2}, 0.2, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tc.req
+			got := withSamplingDefaults(&req, info.SamplingDefaults(tc.model))
+			if got.Temperature != tc.wantTemperature || got.TopP != tc.wantTopP {
+				t.Errorf("Expected temperature %v and top_p %v, got %v and %v", tc.wantTemperature, tc.wantTopP, got.Temperature, got.TopP)
+			}
+			if req.Temperature != tc.req.Temperature || req.TopP != tc.req.TopP {
+				t.Errorf("Expected the request of the caller to be left unchanged, got %#v", req)
+			}
+		})
+	}
+}
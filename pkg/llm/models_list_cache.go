@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// DefaultModelsListTTL is the time a models list stays valid in the package-level cache.
+const DefaultModelsListTTL = 5 * time.Minute
+
+// ModelsListCache caches the models returned by a provider's ListModels for a given TTL.
+// Entries are keyed by provider kind, base URL and credentials, so distinct instances of the same provider share them.
+// It is safe for concurrent use: concurrent callers asking for the same provider share a single fetch.
+type ModelsListCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*modelsListEntry
+}
+
+type modelsListEntry struct {
+	mu        sync.Mutex
+	models    []ModelInfo
+	fetchedAt time.Time
+}
+
+// NewModelsListCache creates a cache keeping models lists for ttl, a ttl <= 0 disables expiration.
+func NewModelsListCache(ttl time.Duration) *ModelsListCache {
+	return &ModelsListCache{
+		ttl:     ttl,
+		entries: make(map[string]*modelsListEntry),
+	}
+}
+
+// modelsListCacheKey identifies the models list of a provider by its kind, base URL and a hash of its API key,
+// as the models available can depend on the account. Unknown Provider implementations are identified by their instance.
+func modelsListCacheKey(provider Provider) string {
+	switch p := provider.(type) {
+	case *openAICompatibleProvider:
+		return string(p.Kind) + " " + p.BaseURL + " " + credentialsHash(p.APIKey)
+	case *MistralProvider:
+		return modelsListCacheKey(p.openAICompatibleProvider)
+	case *GeminiProvider:
+		return string(ProviderGemini) + " " + p.BaseURL + " " + credentialsHash(p.APIKey)
+	case *CohereProvider:
+		return string(ProviderCohere) + " " + p.BaseURL + " " + credentialsHash(p.APIKey)
+	case *OllamaProvider:
+		return string(ProviderOllama) + " " + p.BaseURL
+	case *CachedProvider:
+		return modelsListCacheKey(p.Provider)
+	default:
+		return fmt.Sprintf("%T %p", provider, provider)
+	}
+}
+
+// credentialsHash returns a short hash of apiKey, to tell accounts apart in a cache key without exposing the key.
+func credentialsHash(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ListModels returns the models of provider, fetching them with ctx only when the cached list
+// is missing, expired or when refresh is true. The returned slice is a copy.
+func (c *ModelsListCache) ListModels(ctx context.Context, l golog.MyLogger, provider Provider, refresh bool) ([]ModelInfo, error) {
+	key := modelsListCacheKey(provider)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &modelsListEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	// holding the entry lock while fetching makes concurrent callers wait for the result instead of refetching
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	fresh := !entry.fetchedAt.IsZero() && (c.ttl <= 0 || time.Since(entry.fetchedAt) < c.ttl)
+	if fresh && !refresh {
+		l.Debug("using cached models list of %s fetched at %s", key, entry.fetchedAt.Format(time.RFC3339))
+		return slices.Clone(entry.models), nil
+	}
+
+	l.Info("Fetching available models...")
+	if cached, ok := provider.(*CachedProvider); ok {
+		provider = cached.Provider // avoid going through the wrapper cache
+	}
+	models, err := provider.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching models from provider: %w", err)
+	}
+	entry.models = models
+	entry.fetchedAt = time.Now()
+	return slices.Clone(models), nil
+}
+
+// Get is like ListModels but returns only the models names.
+func (c *ModelsListCache) Get(ctx context.Context, l golog.MyLogger, provider Provider, refresh bool) ([]string, error) {
+	models, err := c.ListModels(ctx, l, provider, refresh)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// Invalidate removes the cached models list of provider.
+func (c *ModelsListCache) Invalidate(provider Provider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, modelsListCacheKey(provider))
+}
+
+var defaultModelsListCache = NewModelsListCache(DefaultModelsListTTL)
+
+// GetModelsListCached is like GetModelsList, but keeps the result in a process wide cache
+// for DefaultModelsListTTL, so validating a model and listing models in the same run hit the network once.
+// Use refresh to force a new fetch.
+func GetModelsListCached(l golog.MyLogger, provider Provider, defaultTimeout time.Duration, refresh bool) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return defaultModelsListCache.Get(ctx, l, provider, refresh)
+}
+
+// CachedProvider wraps a Provider so that its ListModels results are cached, Query and Stream are passed through.
+type CachedProvider struct {
+	Provider
+	cache *ModelsListCache
+	l     golog.MyLogger
+}
+
+// NewCachedProvider wraps provider with a models list cache of the given ttl,
+// a ttl of 0 uses the process wide cache with DefaultModelsListTTL.
+func NewCachedProvider(provider Provider, ttl time.Duration, l golog.MyLogger) *CachedProvider {
+	cache := defaultModelsListCache
+	if ttl != 0 {
+		cache = NewModelsListCache(ttl)
+	}
+	return &CachedProvider{Provider: provider, cache: cache, l: l}
+}
+
+// ListModels returns the cached models list, fetching it when missing or expired.
+func (p *CachedProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return p.cache.ListModels(ctx, p.l, p.Provider, false)
+}
+
+// DefaultModel returns the default model of the wrapped provider, "" when unknown.
+func (p *CachedProvider) DefaultModel() string {
+	return requestModel(p.Provider, &LLMRequest{})
+}
+
+// Embed passes through to the wrapped provider when it is an Embedder.
+func (p *CachedProvider) Embed(ctx context.Context, req *EmbedRequest) (*EmbedResponse, error) {
+	embedder, ok := p.Provider.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("embeddings: %w", ErrNotSupported)
+	}
+	return embedder.Embed(ctx, req)
+}
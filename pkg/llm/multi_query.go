@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ModelResult is the outcome of the query of one model by QueryAllModels.
+type ModelResult struct {
+	Model    string
+	Response *LLMResponse
+	Elapsed  time.Duration
+	Err      error
+}
+
+// QueryAllModels sends req to each of models with provider, using at most concurrency queries at a time
+// (a concurrency <= 0 queries the models one at a time). The results are returned in the order of models,
+// a failed query having its Err set instead of stopping the batch. Each query uses a copy of req with Model set,
+// so req.Timeout bounds every query. Cancelling ctx aborts the batch, the models not queried yet get ctx.Err().
+func QueryAllModels(ctx context.Context, provider Provider, models []string, req *LLMRequest, concurrency int) []ModelResult {
+	reqs := make([]*LLMRequest, len(models))
+	for i, model := range models {
+		reqs[i] = requestForModel(req, model)
+	}
+	return QueryRequests(ctx, provider, reqs, concurrency)
+}
+
+// QueryRequests is like QueryAllModels for a batch of different requests, e.g. a matrix of prompts and models,
+// each sent to its own req.Model. The results are returned in the order of reqs.
+func QueryRequests(ctx context.Context, provider Provider, reqs []*LLMRequest, concurrency int) []ModelResult {
+	results := make([]ModelResult, len(reqs))
+	QueryRequestsFunc(ctx, provider, reqs, concurrency, func(i int, result ModelResult) {
+		results[i] = result
+	})
+	return results
+}
+
+// QueryRequestsFunc is like QueryRequests but calls onResult with the index in reqs and the result of each query
+// as soon as it completes, e.g. to save the progress of a long batch. The calls of onResult are serialized,
+// so it doesn't need to lock, and they are all done when QueryRequestsFunc returns.
+func QueryRequestsFunc(ctx context.Context, provider Provider, reqs []*LLMRequest, concurrency int, onResult func(i int, result ModelResult)) {
+	if len(reqs) == 0 {
+		return
+	}
+	concurrency = min(max(concurrency, 1), len(reqs))
+
+	var mu sync.Mutex
+	report := func(i int, result ModelResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		onResult(i, result)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report(i, queryModel(ctx, provider, reqs[i]))
+			}
+		}()
+	}
+	for i, req := range reqs {
+		if ctx.Err() != nil {
+			report(i, ModelResult{Model: req.Model, Err: ctx.Err()})
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			report(i, ModelResult{Model: req.Model, Err: ctx.Err()})
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// requestForModel returns a copy of req for model, so that concurrent queries don't share it.
+func requestForModel(req *LLMRequest, model string) *LLMRequest {
+	modelReq := *req
+	modelReq.Model = model
+	modelReq.Messages = slices.Clone(req.Messages)
+	return &modelReq
+}
+
+// queryModel sends req and measures the elapsed time of the query.
+func queryModel(ctx context.Context, provider Provider, req *LLMRequest) ModelResult {
+	start := time.Now()
+	resp, err := provider.Query(ctx, req)
+	return ModelResult{Model: req.Model, Response: resp, Elapsed: time.Since(start), Err: err}
+}
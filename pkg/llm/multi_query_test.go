@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// modelEchoProvider answers the model name, fails for failModel and tracks the peak of concurrent queries.
+type modelEchoProvider struct {
+	failModel string
+	mu        sync.Mutex
+	running   int
+	peak      int
+}
+
+func (p *modelEchoProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	p.mu.Lock()
+	p.running++
+	p.peak = max(p.peak, p.running)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.running--
+		p.mu.Unlock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if req.Model == p.failModel {
+		return nil, errors.New("model unavailable")
+	}
+	return &LLMResponse{Text: req.Model}, nil
+}
+
+func (p *modelEchoProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	return p.Query(ctx, req)
+}
+
+func (p *modelEchoProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return nil, nil
+}
+
+func TestQueryAllModels(t *testing.T) {
+	models := []string{"m1", "m2", "m3", "m4", "m5", "m6"}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}
+
+	t.Run("PreservesOrderAndErrors", func(t *testing.T) {
+		provider := &modelEchoProvider{failModel: "m3"}
+		results := QueryAllModels(context.Background(), provider, models, req, 2)
+		if len(results) != len(models) {
+			t.Fatalf("Expected %d results, got %d", len(models), len(results))
+		}
+		for i, r := range results {
+			if r.Model != models[i] {
+				t.Errorf("Expected result %d for model %s, got %s", i, models[i], r.Model)
+			}
+			if r.Model == "m3" {
+				if r.Err == nil {
+					t.Errorf("Expected an error for m3, got %#v", r.Response)
+				}
+				continue
+			}
+			if r.Err != nil || r.Response == nil || r.Response.Text != r.Model || r.Elapsed <= 0 {
+				t.Errorf("Expected the answer of %s, got %#v", r.Model, r)
+			}
+		}
+		if provider.peak > 2 {
+			t.Errorf("Expected at most 2 concurrent queries, got %d", provider.peak)
+		}
+		if req.Model != "" {
+			t.Errorf("Expected the request to be left unchanged, got model %q", req.Model)
+		}
+	})
+
+	t.Run("CancelledContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		results := QueryAllModels(ctx, &modelEchoProvider{}, models, req, 3)
+		for _, r := range results {
+			if !errors.Is(r.Err, context.Canceled) && r.Err != nil {
+				t.Errorf("Expected no error or context.Canceled for %s, got %v", r.Model, r.Err)
+			}
+		}
+		if !errors.Is(results[len(results)-1].Err, context.Canceled) {
+			t.Errorf("Expected the last model to be skipped with context.Canceled, got %v", results[len(results)-1].Err)
+		}
+	})
+}
+
+func TestQueryRequestsFunc(t *testing.T) {
+	models := []string{"m1", "m2", "m3", "m4"}
+	reqs := make([]*LLMRequest, len(models))
+	for i, model := range models {
+		reqs[i] = &LLMRequest{Model: model, Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}
+	}
+	seen := map[int]string{}
+	QueryRequestsFunc(context.Background(), &modelEchoProvider{failModel: "m2"}, reqs, 3, func(i int, result ModelResult) {
+		// the calls are serialized, so the map is written without lock (the race detector would complain otherwise)
+		if result.Model == "m2" {
+			seen[i] = "error"
+			return
+		}
+		seen[i] = result.Response.Text
+	})
+	want := map[int]string{0: "m1", 1: "error", 2: "m3", 3: "m4"}
+	if len(seen) != len(want) {
+		t.Fatalf("Expected one call per request, got %v", seen)
+	}
+	for i, text := range want {
+		if seen[i] != text {
+			t.Errorf("Expected result %d to be %q, got %q", i, text, seen[i])
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package llm
 
 import (
+	"bytes"
 	"cmp"
 	"context"
 	"encoding/json"
@@ -24,7 +25,13 @@ type OllamaProvider struct {
 	Model      string
 	ModelsInfo ProviderModelsInfo
 	Client     *http.Client
-	l          golog.MyLogger
+	// ExtraHeaders are sent with every request, merged from the catalog and ProviderConfig.ExtraHeaders
+	ExtraHeaders map[string]string
+	RetryPolicy  RetryPolicy
+	GzipRequests bool
+	audit        AuditLogger
+	hooks        callHooks
+	l            golog.MyLogger
 }
 
 // ollamaRequest represents the request payload for Ollama's chat API.
@@ -33,7 +40,10 @@ type ollamaRequest struct {
 	Messages []map[string]any `json:"messages"`
 	Stream   bool             `json:"stream"`
 	Tools    []Tool           `json:"tools,omitempty"`
+	Format   any              `json:"format,omitempty"` // "json" or a JSON schema for structured outputs
 	Options  map[string]any   `json:"options,omitempty"`
+	// Think asks thinking models to return their reasoning in message.thinking
+	Think bool `json:"think,omitempty"`
 }
 
 // ollamaResponse represents the response payload from Ollama's chat API.
@@ -42,6 +52,7 @@ type ollamaResponse struct {
 	Message struct {
 		Role      string `json:"role"`
 		Content   string `json:"content"`
+		Thinking  string `json:"thinking,omitempty"`
 		ToolCalls []struct {
 			Function struct {
 				Name      string          `json:"name"`
@@ -49,8 +60,43 @@ type ollamaResponse struct {
 			} `json:"function"`
 		} `json:"tool_calls,omitempty"`
 	} `json:"message"`
-	Done  bool   `json:"done"`
-	Error string `json:"error,omitempty"`
+	Done bool `json:"done"`
+	// DoneReason is why the generation stopped ("stop", "length", "load", ...), only present in the final (done) message
+	DoneReason string `json:"done_reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Token counts, only present in the final (done) message
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+	// EvalDuration is the generation time of the eval_count tokens in nanoseconds, only present in the final message
+	EvalDuration int64 `json:"eval_duration,omitempty"`
+}
+
+// finishReason returns Ollama's done_reason, or "stop" when it is missing as with older Ollama versions.
+func (r *ollamaResponse) finishReason() string {
+	if r.DoneReason == "" {
+		return "stop"
+	}
+	return r.DoneReason
+}
+
+// usage converts Ollama's eval counts to a Usage, it returns nil if they are missing.
+func (r *ollamaResponse) usage() *Usage {
+	if r.PromptEvalCount == 0 && r.EvalCount == 0 {
+		return nil
+	}
+	return &Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// metrics returns the generation duration reported by Ollama, it returns nil if it is missing.
+func (r *ollamaResponse) metrics() *Metrics {
+	if r.EvalDuration <= 0 {
+		return nil
+	}
+	return &Metrics{GenerationDuration: time.Duration(r.EvalDuration)}
 }
 
 // OllamaModelDetails provides details about a model.
@@ -91,42 +137,72 @@ func NewOllamaAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
 	if !ok {
 		return nil, errors.New("ollama provider configuration not found in models.json")
 	}
+	retryPolicy, err := retryPolicyFromExtras(cfg.Extras)
+	if err != nil {
+		return nil, err
+	}
+	gzipRequests, err := gzipRequestsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return &OllamaProvider{
-		BaseURL:    cfg.BaseURL,
-		Model:      cfg.Model,
-		ModelsInfo: providerConfig, // cache this info for latter use
-		Client:     &http.Client{}, // let's use the outer context timeout
-		l:          l,
+		BaseURL:      config.NormalizeBaseURL(cfg.BaseURL),
+		Model:        cfg.Model,
+		ExtraHeaders: mergeHeaders(providerConfig.Headers, cfg.ExtraHeaders),
+		ModelsInfo:   providerConfig, // cache this info for latter use
+		Client:       client,
+		RetryPolicy:  retryPolicy,
+		audit:        auditLoggerOrNoop(cfg.AuditLogger),
+		hooks:        hooksFromConfig(cfg),
+		GzipRequests: gzipRequests,
+		l:            l,
 	}, nil
 }
 
+// Query sends req and returns the complete response, recording the call with the audit logger and the hooks.
 func (o *OllamaProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return auditCall(auditLoggerOrNoop(o.audit), o.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := o.query(ctx, req)
+		return finishResponse(req, start, resp, err, o.l)
+	})
+}
+
+// Stream sends req and emits the answer deltas to onDelta, recording the call with the audit logger and the hooks.
+func (o *OllamaProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	onDelta = withDeltaTimestamps(req, onDelta)
+	return auditCall(auditLoggerOrNoop(o.audit), o.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := runStream(ctx, req, onDelta, o.stream)
+		return finishResponse(req, start, resp, err, o.l)
+	})
+}
+
+func (o *OllamaProvider) query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	l := contextLogger(ctx, o.l)
 	if req == nil {
 		return nil, errors.New("request cannot be nil")
 	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
 	if len(req.Messages) == 0 {
 		return nil, errors.New("request must have messages")
 	}
 
-	// Build payload
-	payload := ollamaRequest{
-		Model:    FirstNonEmpty(req.Model, o.Model),
-		Messages: ToOpenAIChatMessages(req.Messages), // Exported version
-		Stream:   false,
-	}
-	if req.Temperature > 0 {
-		payload.Options = map[string]any{"temperature": req.Temperature}
-	}
-	if len(req.Tools) > 0 {
-		payload.Tools = req.Tools
+	payload, headers, err := o.prepareRequest(req, false, l)
+	if err != nil {
+		return nil, err
 	}
-
-	headers := http.Header{"Content-Type": []string{"application/json"}}
 	url := o.BaseURL + "/api/chat"
 
-	responseData, rawResp, err := HttpRequest[ollamaRequest, ollamaResponse](ctx, o.Client, url, headers, payload, o.l)
+	responseData, rawResp, err := httpPostRequest[ollamaRequest, ollamaResponse](ctx, o.Client, url, headers, payload, o.RetryPolicy, o.GzipRequests, l)
 	if err != nil {
+		setAPIErrorProvider(err, ProviderOllama)
 		return nil, fmt.Errorf("ollama request failed: %w (raw body: %s)", err, string(rawResp))
 	}
 	if responseData.Error != "" {
@@ -135,8 +211,12 @@ func (o *OllamaProvider) Query(ctx context.Context, req *LLMRequest) (*LLMRespon
 
 	// Map to LLMResponse
 	llmResp := &LLMResponse{
-		Text: responseData.Message.Content,
-		Raw:  json.RawMessage(rawResp),
+		Text:         responseData.Message.Content,
+		Reasoning:    responseData.Message.Thinking,
+		FinishReason: responseData.finishReason(),
+		Usage:        responseData.usage(),
+		Metrics:      responseData.metrics(),
+		Raw:          json.RawMessage(rawResp),
 	}
 	for _, tc := range responseData.Message.ToolCalls {
 		toolCall := ToolCall{
@@ -150,16 +230,101 @@ func (o *OllamaProvider) Query(ctx context.Context, req *LLMRequest) (*LLMRespon
 	return llmResp, nil
 }
 
+// prepareRequest builds the payload and the headers of an /api/chat request, shared by query, stream and BuildRequestPayload.
+func (o *OllamaProvider) prepareRequest(req *LLMRequest, stream bool, l golog.MyLogger) (ollamaRequest, http.Header, error) {
+	if err := applyMaxTokensCheck(req, o.ModelsInfo.ModelInfo(FirstNonEmpty(req.Model, o.Model)), l); err != nil {
+		return ollamaRequest{}, nil, err
+	}
+	payload, err := o.buildPayload(req, stream)
+	if err != nil {
+		return ollamaRequest{}, nil, err
+	}
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+	setExtraHeaders(headers, o.ExtraHeaders, req.ExtraHeaders)
+	return payload, headers, nil
+}
+
+// BuildRequestPayload returns the HTTP request that Query, or Stream when req.Stream is set, would send for req.
+func (o *OllamaProvider) BuildRequestPayload(req *LLMRequest) (*RequestPayload, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	payload, headers, err := o.prepareRequest(dryRunRequest(req, o.hooks), req.Stream, o.l)
+	if err != nil {
+		return nil, err
+	}
+	return newRequestPayload(o.BaseURL+"/api/chat", headers, payload)
+}
+
+// buildPayload creates the /api/chat payload shared by Query and Stream,
+// the unset sampling parameters are filled with the family defaults of the model in the catalog.
+func (o *OllamaProvider) buildPayload(req *LLMRequest, stream bool) (ollamaRequest, error) {
+	req = withSamplingDefaults(req, o.ModelsInfo.SamplingDefaults(FirstNonEmpty(req.Model, o.Model)))
+	payload := ollamaRequest{
+		Model:    FirstNonEmpty(req.Model, o.Model),
+		Messages: ToOpenAIChatMessagesFor(ProviderOllama, preparedMessages(req)), // Exported version
+		Stream:   stream,
+	}
+	options := map[string]any{}
+	if req.Temperature > 0 {
+		options["temperature"] = req.Temperature
+	}
+	if req.FrequencyPenalty != 0 {
+		options["frequency_penalty"] = req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		options["presence_penalty"] = req.PresencePenalty
+	}
+	if len(options) > 0 {
+		payload.Options = options
+	}
+	if len(req.Tools) > 0 {
+		payload.Tools = req.Tools
+	}
+	payload.Format = toOllamaFormat(req.ResponseFormat)
+	think, err := boolFromExtras(req.ProviderExtras, ProviderExtraIncludeReasoning, false)
+	if err != nil {
+		return ollamaRequest{}, err
+	}
+	payload.Think = think
+	return payload, nil
+}
+
+// toOllamaFormat maps a ResponseFormat to Ollama's format parameter:
+// "json" for JSON mode, or the JSON schema itself for structured outputs.
+func toOllamaFormat(rf *ResponseFormat) any {
+	if rf == nil {
+		return nil
+	}
+	switch rf.Type {
+	case "json_object":
+		return "json"
+	case "json_schema":
+		// OpenAI wraps the schema as {"name": ..., "schema": {...}, "strict": true}
+		if schema, ok := rf.JSONSchema["schema"]; ok {
+			return schema
+		}
+		if len(rf.JSONSchema) > 0 {
+			return rf.JSONSchema
+		}
+		return "json"
+	default:
+		return nil
+	}
+}
+
 func (o *OllamaProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	url := o.BaseURL + "/api/tags"
 	headers := http.Header{} // Ollama doesn't require auth headers
+	setExtraHeaders(headers, o.ExtraHeaders)
 
 	type ollamaTagsResponse struct {
 		Models []OllamaListModelResponse
 	}
 
-	resp, err := httpGetRequest[ollamaTagsResponse](ctx, o.Client, url, headers, o.l)
+	resp, err := httpGetRequest[ollamaTagsResponse](ctx, o.Client, url, headers, o.RetryPolicy, o.l)
 	if err != nil {
+		setAPIErrorProvider(err, ProviderOllama)
 		return nil, fmt.Errorf("failed to list ollama models: %w", err)
 	}
 
@@ -193,34 +358,37 @@ func (o *OllamaProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
 	return modelInfos, nil
 }
 
-func (o *OllamaProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+func (o *OllamaProvider) stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	l := contextLogger(ctx, o.l)
 	if req == nil {
 		return nil, errors.New("request cannot be nil")
 	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
+	firstChunk := firstChunkNotifier(req, time.Now())
 	if onDelta == nil {
 		return nil, errors.New("onDelta callback cannot be nil for streaming")
 	}
+	if modelName := FirstNonEmpty(req.Model, o.Model); req.FakeStreamIfUnsupported && !o.ModelsInfo.ModelInfo(modelName).SupportsStreaming {
+		l.Info("model %s doesn't support streaming, falling back to a regular query", modelName)
+		return QueryAsStream(ctx, queryFunc(o.query), req, onDelta)
+	}
 
 	req.Stream = true
-	payload := ollamaRequest{
-		Model:    FirstNonEmpty(req.Model, o.Model),
-		Messages: ToOpenAIChatMessages(req.Messages),
-		Stream:   true,
-	}
-	if req.Temperature > 0 {
-		payload.Options = map[string]any{"temperature": req.Temperature}
-	}
-	if len(req.Tools) > 0 {
-		payload.Tools = req.Tools
+	payload, headers, err := o.prepareRequest(req, true, l)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create and execute request
-	bodyBytes, _ := json.Marshal(payload)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/api/chat", strings.NewReader(string(bodyBytes)))
+	bodyBytes, err := marshalRequestBody(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ollama stream request: %w", err)
+	}
+	httpReq, err := newHTTPRequest(ctx, http.MethodPost, o.BaseURL+"/api/chat", headers, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ollama stream request: %w", err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := o.Client.Do(httpReq)
 	if err != nil {
@@ -230,39 +398,57 @@ func (o *OllamaProvider) Stream(ctx context.Context, req *LLMRequest, onDelta fu
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama stream returned non-200 status: %d %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("ollama stream failed: %w", newAPIError(resp.StatusCode, resp.Header, body, ProviderOllama, 1))
 	}
 
 	// Process the JSON stream
 	decoder := json.NewDecoder(resp.Body)
 	finalResponse := &LLMResponse{}
 	fullText := &strings.Builder{}
+	fullReasoning := &strings.Builder{}
 
 	for {
 		var chunk ollamaResponse
-		if err := decoder.Decode(&chunk); err == io.EOF {
+		raw, err := decodeStreamChunk(decoder, &chunk, req.IncludeRawChunks)
+		if err == io.EOF {
 			break
 		} else if err != nil {
 			return nil, fmt.Errorf("error decoding ollama stream: %w", err)
 		}
+		firstChunk()
 
 		if chunk.Error != "" {
 			return nil, fmt.Errorf("ollama API error in stream: %s", chunk.Error)
 		}
 
+		emit := withRawChunk(onDelta, raw)
+		if reasoningDelta := chunk.Message.Thinking; reasoningDelta != "" {
+			fullReasoning.WriteString(reasoningDelta)
+			emit(Delta{Reasoning: reasoningDelta})
+		}
+
 		textDelta := chunk.Message.Content
 		if textDelta != "" {
 			fullText.WriteString(textDelta)
-			onDelta(Delta{Text: textDelta})
+			emit(Delta{Text: textDelta})
 		}
 
 		if chunk.Done {
-			finalResponse.FinishReason = "stop" // Ollama doesn't provide a reason, so we assume "stop"
+			finalResponse.Usage = chunk.usage()
+			finalResponse.Metrics = chunk.metrics()
+			finalResponse.FinishReason = chunk.finishReason()
 			break
 		}
 	}
 
+	// with structured output the JSON arrives in fragments, it can only be validated once complete
+	if payload.Format != nil && !json.Valid([]byte(fullText.String())) {
+		return nil, fmt.Errorf("ollama stream returned invalid JSON for structured output: %q", fullText.String())
+	}
+
+	completeStreamUsage(finalResponse, req, fullText.String(), TokenEstimatorForProvider(ProviderOllama, FirstNonEmpty(req.Model, o.Model)))
 	onDelta(Delta{Done: true, FinishReason: finalResponse.FinishReason})
 	finalResponse.Text = fullText.String()
+	finalResponse.Reasoning = fullReasoning.String()
 	return finalResponse, nil
 }
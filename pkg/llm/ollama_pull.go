@@ -0,0 +1,75 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// PullProgress is a progress update of an Ollama model download, as streamed by /api/pull.
+// Completed and Total are the bytes of the layer being downloaded (Digest), zero for the other steps.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// PullModel downloads the model name to the Ollama server, e.g. to make sure it exists before querying it.
+// The progress updates are sent to onProgress (which can be nil) until the download is complete,
+// an error reported by Ollama in the stream is returned. Pulling a model already present only checks it is up to date.
+func (o *OllamaProvider) PullModel(ctx context.Context, name string, onProgress func(PullProgress)) error {
+	if name == "" {
+		return errors.New("model name cannot be empty")
+	}
+	bodyBytes, err := marshalRequestBody(map[string]any{"model": name, "stream": true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal ollama pull request: %w", err)
+	}
+	httpReq, err := newHTTPRequest(ctx, http.MethodPost, o.BaseURL+"/api/pull", nil, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create ollama pull request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	setExtraHeaders(httpReq.Header, o.ExtraHeaders)
+
+	resp, err := o.Client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send ollama pull request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ollama pull failed: %w", newAPIError(resp.StatusCode, resp.Header, body, ProviderOllama, 1))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	lastStatus := ""
+	for {
+		var chunk struct {
+			PullProgress
+			Error string `json:"error,omitempty"`
+		}
+		if err := decoder.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding ollama pull stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("ollama pull of model %s failed: %s", name, chunk.Error)
+		}
+		lastStatus = chunk.Status
+		if onProgress != nil {
+			onProgress(chunk.PullProgress)
+		}
+	}
+	if lastStatus != "success" {
+		return fmt.Errorf("ollama pull of model %s ended before completion, last status: %q", name, lastStatus)
+	}
+	o.l.Info("model %s pulled successfully", name)
+	return nil
+}
@@ -0,0 +1,300 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// ollamaStreamServer returns a mock Ollama server streaming the given content fragments as NDJSON.
+func ollamaStreamServer(t *testing.T, fragments []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["format"] != "json" {
+			t.Errorf("Expected format 'json' in request, got %#v", body["format"])
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, frag := range fragments {
+			chunk, _ := json.Marshal(map[string]any{"message": map[string]any{"role": "assistant", "content": frag}, "done": false})
+			fmt.Fprintf(w, "%s\n", chunk)
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": ""}, "done": true}`)
+	}))
+}
+
+// TestOllamaProvider_StreamStructuredOutput verifies that fragmented JSON is accumulated and validated on completion.
+func TestOllamaProvider_StreamStructuredOutput(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	req := func() *LLMRequest {
+		return &LLMRequest{
+			Messages:       []LLMMessage{{Role: RoleUser, Content: "Give me the weather as JSON"}},
+			ResponseFormat: &ResponseFormat{Type: "json_object"},
+		}
+	}
+
+	t.Run("ValidFragmentedJSON", func(t *testing.T) {
+		server := ollamaStreamServer(t, []string{`{"loc`, `ation": "Laus`, `anne", "temp`, `": 22.5}`})
+		defer server.Close()
+		provider := &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+
+		resp, err := provider.Stream(context.Background(), req(), func(Delta) {})
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		var weather struct {
+			Location string  `json:"location"`
+			Temp     float64 `json:"temp"`
+		}
+		if err := json.Unmarshal([]byte(resp.Text), &weather); err != nil || weather.Location != "Lausanne" {
+			t.Errorf("Expected the accumulated JSON to be parsable, got %q (err: %v)", resp.Text, err)
+		}
+	})
+
+	t.Run("InvalidJSON", func(t *testing.T) {
+		server := ollamaStreamServer(t, []string{`{"location": `, `"Laus`})
+		defer server.Close()
+		provider := &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+
+		_, err := provider.Stream(context.Background(), req(), func(Delta) {})
+		if err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+			t.Errorf("Expected an invalid JSON error, got %v", err)
+		}
+	})
+}
+
+// TestOllamaProvider_StreamUsage verifies that the usage is computed from Ollama's eval counts.
+func TestOllamaProvider_StreamUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "Hello"}, "done": false}`)
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": " world"}, "done": false}`)
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 12, "eval_count": 3}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+	resp, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}, func(Delta) {})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 3 || resp.Usage.TotalTokens != 15 || resp.Usage.Estimated {
+		t.Errorf("Expected usage from eval counts, got %#v", resp.Usage)
+	}
+}
+
+func TestOllamaProvider_TokensPerSecond(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "Hello world"}, "done": true, "prompt_eval_count": 12, "eval_count": 50, "eval_duration": 2000000000}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Metrics == nil || resp.Metrics.GenerationDuration != 2*time.Second || resp.Metrics.Duration <= 0 {
+		t.Fatalf("Expected the eval duration and the call duration in the metrics, got %#v", resp.Metrics)
+	}
+	if got := resp.TokensPerSecond(); got != 25 {
+		t.Errorf("Expected 25 tokens/s from eval_count and eval_duration, got %f", got)
+	}
+	resp, err = provider.Stream(context.Background(), req, func(Delta) {})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if got := resp.TokensPerSecond(); got != 25 {
+		t.Errorf("Expected 25 tokens/s for the stream, got %f", got)
+	}
+}
+
+func TestTokensPerSecond(t *testing.T) {
+	usage := &Usage{CompletionTokens: 30}
+	testCases := []struct {
+		name     string
+		resp     *LLMResponse
+		expected float64
+	}{
+		{"NilResponse", nil, 0},
+		{"NoUsage", &LLMResponse{Metrics: &Metrics{Duration: time.Second}}, 0},
+		{"NoMetrics", &LLMResponse{Usage: usage}, 0},
+		{"WallClock", &LLMResponse{Usage: usage, Metrics: &Metrics{Duration: 3 * time.Second}}, 10},
+		{"ServerGeneration", &LLMResponse{Usage: usage, Metrics: &Metrics{Duration: 3 * time.Second, GenerationDuration: time.Second}}, 30},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.resp.TokensPerSecond(); got != tc.expected {
+				t.Errorf("Expected %f tokens/s, got %f", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestOllamaProvider_StreamDoneReason(t *testing.T) {
+	tests := []struct {
+		name      string
+		finalLine string
+		want      string
+	}{
+		{name: "Length", finalLine: `{"message": {"role": "assistant", "content": ""}, "done": true, "done_reason": "length"}`, want: "length"},
+		{name: "Missing", finalLine: `{"message": {"role": "assistant", "content": ""}, "done": true}`, want: "stop"},
+	}
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "Once upon"}, "done": false}`)
+				fmt.Fprintln(w, tt.finalLine)
+			}))
+			defer server.Close()
+
+			provider := &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+			var doneReason string
+			resp, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Tell a story"}}}, func(d Delta) {
+				if d.Done {
+					doneReason = d.FinishReason
+				}
+			})
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+			if resp.FinishReason != tt.want || doneReason != tt.want {
+				t.Errorf("Expected finish reason %q, got %q (done delta %q)", tt.want, resp.FinishReason, doneReason)
+			}
+		})
+	}
+}
+
+func TestOllamaProvider_Reasoning(t *testing.T) {
+	var sentThink any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]any
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		sentThink = reqBody["think"]
+		if reqBody["stream"] == true {
+			fmt.Fprintln(w, `{"message": {"role": "assistant", "thinking": "Easy one."}, "done": false}`)
+			fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "4"}, "done": false}`)
+			fmt.Fprintln(w, `{"message": {"role": "assistant", "content": ""}, "done": true, "done_reason": "stop"}`)
+			return
+		}
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "thinking": "Easy one.", "content": "4"}, "done": true}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+	req := func() *LLMRequest {
+		return &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "2+2?"}}, ProviderExtras: map[string]any{ProviderExtraIncludeReasoning: true}}
+	}
+
+	resp, err := provider.Query(context.Background(), req())
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if sentThink != true || resp.Reasoning != "Easy one." || resp.Text != "4" {
+		t.Errorf("Expected think to be sent and the thinking in Reasoning, got think %v and %#v", sentThink, resp)
+	}
+
+	var reasoningDeltas []string
+	resp, err = provider.Stream(context.Background(), req(), func(d Delta) {
+		if d.Reasoning != "" {
+			reasoningDeltas = append(reasoningDeltas, d.Reasoning)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(reasoningDeltas) != 1 || resp.Reasoning != "Easy one." || resp.Text != "4" {
+		t.Errorf("Expected one reasoning delta apart from the text, got %q and %#v", reasoningDeltas, resp)
+	}
+}
+
+func TestOllamaProvider_CatalogHeaders(t *testing.T) {
+	catalogPath := filepath.Join(t.TempDir(), "models.json")
+	catalog := `{"version": 1, "providers": {"Ollama": {"defaults": {}, "headers": {"X-Tenant-ID": "tenant-a", "X-Env": "catalog"}}}}`
+	if err := os.WriteFile(catalogPath, []byte(catalog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROVIDER_INFO_FILEPATH", catalogPath)
+
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "ok"}, "done": true}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	cfg := ProviderConfig{BaseURL: server.URL, Model: "qwen3:latest", ExtraHeaders: map[string]string{"X-Env": "config"}}
+	provider, err := NewOllamaAdapter(cfg, l)
+	if err != nil {
+		t.Fatalf("NewOllamaAdapter failed: %v", err)
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}, ExtraHeaders: map[string]string{"X-Request": "req"}}
+	if _, err := provider.Query(context.Background(), req); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for key, want := range map[string]string{"X-Tenant-ID": "tenant-a", "X-Env": "config", "X-Request": "req"} {
+		if got.Get(key) != want {
+			t.Errorf("Expected header %s %q, got %q", key, want, got.Get(key))
+		}
+	}
+}
+
+func TestOllamaProvider_PullModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.URL.Path != "/api/pull" {
+			t.Errorf("Expected a pull request, got %s with error %v", r.URL.Path, err)
+		}
+		switch body.Model {
+		case "qwen3:latest":
+			fmt.Fprintln(w, `{"status": "pulling manifest"}`)
+			fmt.Fprintln(w, `{"status": "pulling 6a0746a1ec1a", "digest": "sha256:6a0746a1ec1a", "total": 100, "completed": 40}`)
+			fmt.Fprintln(w, `{"status": "pulling 6a0746a1ec1a", "digest": "sha256:6a0746a1ec1a", "total": 100, "completed": 100}`)
+			fmt.Fprintln(w, `{"status": "success"}`)
+		case "interrupted":
+			fmt.Fprintln(w, `{"status": "pulling manifest"}`)
+		default:
+			fmt.Fprintln(w, `{"status": "pulling manifest"}`)
+			fmt.Fprintln(w, `{"error": "pull model manifest: file does not exist"}`)
+		}
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+	var progress []PullProgress
+	if err := provider.PullModel(context.Background(), "qwen3:latest", func(p PullProgress) { progress = append(progress, p) }); err != nil {
+		t.Fatalf("PullModel failed: %v", err)
+	}
+	if len(progress) != 4 || progress[1].Completed != 40 || progress[1].Total != 100 || progress[3].Status != "success" {
+		t.Errorf("Unexpected progress updates: %+v", progress)
+	}
+
+	err := provider.PullModel(context.Background(), "unknown", nil)
+	if err == nil || !strings.Contains(err.Error(), "file does not exist") {
+		t.Errorf("Expected the error of the pull stream, got %v", err)
+	}
+	if err := provider.PullModel(context.Background(), "interrupted", nil); err == nil {
+		t.Error("Expected an error for a pull ending without success, got nil")
+	}
+}
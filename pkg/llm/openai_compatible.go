@@ -9,10 +9,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"maps"
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/lao-tseu-is-alive/go-ai-llm-query/pkg/config"
 	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
@@ -28,12 +28,51 @@ type openAICompatibleProvider struct {
 	Client                 *http.Client
 	ExtraHeaders           map[string]string
 	Endpoint               string
-	l                      golog.MyLogger
+	ModelsEndpoint         string
+	// EmbeddingsEndpoint is the path of the embeddings requests, "/embeddings" when empty
+	EmbeddingsEndpoint string
+	RetryPolicy        RetryPolicy
+	GzipRequests       bool
+	// LegacyCompletions uses the prompt based completions API instead of the chat one
+	LegacyCompletions bool
+	// StreamUsage asks for the token usage at the end of streams with stream_options.include_usage
+	StreamUsage bool
+	// AuthHeader is the header holding the raw API key (e.g. "api-key" for Azure), empty means "Authorization: Bearer"
+	AuthHeader string
+	audit      AuditLogger
+	hooks      callHooks
+	l          golog.MyLogger
+}
+
+// ProviderExtraStreamUsage is the ProviderConfig.Extras key controlling if the usage is requested at the end
+// of streams with stream_options.include_usage (default true). Servers answering 400 to stream_options
+// are detected and the stream is sent again without it, setting it to false avoids the extra request.
+const ProviderExtraStreamUsage = "stream_usage"
+
+// maxSSELineSize is the maximum size of a line of an OpenAI-compatible stream.
+const maxSSELineSize = 16 * 1024 * 1024
+
+const (
+	defaultChatEndpoint       = "/chat/completions"
+	defaultModelsEndpoint     = "/models"
+	defaultEmbeddingsEndpoint = "/embeddings"
+)
+
+// endpointPath returns path with a leading slash, or defaultPath when path is empty.
+func endpointPath(path, defaultPath string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return defaultPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
 }
 
 // NewOpenAICompatAdapter is a shared constructor for OpenAI-like providers.
 func NewOpenAICompatAdapter(cfg ProviderConfig, kind ProviderKind, defaultBaseURL string, l golog.MyLogger) (Provider, error) {
-	baseURL := FirstNonEmpty(cfg.BaseURL, defaultBaseURL)
+	baseURL := config.NormalizeBaseURL(FirstNonEmpty(cfg.BaseURL, defaultBaseURL))
 
 	filepath := config.GetProviderInfoFilePathFromEnv(defaultModelInfoFilePath)
 	// Load only once the external model configuration
@@ -41,6 +80,30 @@ func NewOpenAICompatAdapter(cfg ProviderConfig, kind ProviderKind, defaultBaseUR
 	if err != nil {
 		return nil, fmt.Errorf("failed to load model catalog: %w", err)
 	}
+	retryPolicy, err := retryPolicyFromExtras(cfg.Extras)
+	if err != nil {
+		return nil, err
+	}
+	gzipRequests, err := gzipRequestsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	legacyCompletions, err := boolFromExtras(cfg.Extras, ProviderExtraLegacyCompletions, false)
+	if err != nil {
+		return nil, err
+	}
+	streamUsage, err := boolFromExtras(cfg.Extras, ProviderExtraStreamUsage, true)
+	if err != nil {
+		return nil, err
+	}
+	chatEndpoint := defaultChatEndpoint
+	if legacyCompletions {
+		chatEndpoint = defaultLegacyCompletionsEndpoint
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return &openAICompatibleProvider{
 		BaseURL:                baseURL,
@@ -48,29 +111,102 @@ func NewOpenAICompatAdapter(cfg ProviderConfig, kind ProviderKind, defaultBaseUR
 		APIKey:                 cfg.APIKey,
 		Model:                  cfg.Model,
 		CatalogProvidersModels: catalog,
-		Client:                 &http.Client{},
-		ExtraHeaders:           maps.Clone(cfg.ExtraHeaders), // Go 1.21+
-		Endpoint:               "/chat/completions",
+		Client:                 client,
+		ExtraHeaders:           mergeHeaders(catalog.Providers[string(kind)].Headers, cfg.ExtraHeaders),
+		Endpoint:               endpointPath(cfg.Endpoint, chatEndpoint),
+		ModelsEndpoint:         endpointPath(cfg.ModelsEndpoint, defaultModelsEndpoint),
+		RetryPolicy:            retryPolicy,
+		audit:                  auditLoggerOrNoop(cfg.AuditLogger),
+		hooks:                  hooksFromConfig(cfg),
+		GzipRequests:           gzipRequests,
+		LegacyCompletions:      legacyCompletions,
+		StreamUsage:            streamUsage,
 		l:                      l,
 	}, nil
 }
 
-// Query sends a request to an OpenAI-compatible API.
-// It validates inputs and handles responses robustly.
+// Query sends req and returns the complete response, recording the call with the audit logger and the hooks.
 func (p *openAICompatibleProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return auditCall(auditLoggerOrNoop(p.audit), p.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := p.query(ctx, req)
+		return finishResponse(req, start, resp, err, p.l)
+	})
+}
+
+// Stream sends req and emits the answer deltas to onDelta, recording the call with the audit logger and the hooks.
+func (p *openAICompatibleProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	onDelta = withDeltaTimestamps(req, onDelta)
+	return auditCall(auditLoggerOrNoop(p.audit), p.hooks, req, func() (*LLMResponse, error) {
+		start := time.Now()
+		resp, err := runStream(ctx, req, onDelta, p.stream)
+		return finishResponse(req, start, resp, err, p.l)
+	})
+}
+
+// query sends a request to an OpenAI-compatible API.
+// It validates inputs and handles responses robustly.
+func (p *openAICompatibleProvider) query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	l := contextLogger(ctx, p.l)
 	if req == nil {
 		return nil, errors.New("request cannot be nil")
 	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
 	// Validate required fields
 	if len(req.Messages) == 0 {
 		return nil, errors.New("request must have at least one message")
 	}
 
-	payload := buildPayload(req, p.Model)
-	headers := http.Header{
-		"Content-Type":  []string{"application/json"},
-		"Authorization": []string{"Bearer " + p.APIKey},
+	payload, headers, err := p.prepareRequest(req, false, l)
+	if err != nil {
+		return nil, err
+	}
+	l.Debug("about to send request to %s", p.BaseURL+p.Endpoint)
+	_, rawBody, err := httpPostRequest[map[string]any, any](
+		ctx, p.Client, p.BaseURL+p.Endpoint, headers, payload, p.RetryPolicy, p.GzipRequests, l,
+	)
+	if err != nil {
+		l.Warn("got error during HttpRequest: %q", err)
+		setAPIErrorProvider(err, p.Kind)
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	l.Debug("successful HttpRequest, rawbody: %s", string(rawBody))
+	// Use dedicated unmarshal for better control
+	unmarshal := unmarshalResponse
+	if p.LegacyCompletions {
+		unmarshal = unmarshalLegacyResponse
+	}
+	resp, err := unmarshal(rawBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return resp, nil
+}
+
+// prepareRequest builds the payload and the headers of a chat request, shared by query, stream and BuildRequestPayload.
+func (p *openAICompatibleProvider) prepareRequest(req *LLMRequest, stream bool, l golog.MyLogger) (map[string]any, http.Header, error) {
+	info, hasInfo := p.modelInfo(FirstNonEmpty(req.Model, p.Model))
+	if hasInfo {
+		if err := applyMaxTokensCheck(req, info, l); err != nil {
+			return nil, nil, err
+		}
+	}
+	payload, err := p.buildPayload(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stream && p.StreamUsage {
+		// ask for the usage in a last chunk, otherwise OpenAI doesn't send it when streaming
+		payload["stream_options"] = map[string]any{"include_usage": true}
 	}
+	applyRequestOverrides(payload, info.RequestOverrides)
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+	if stream {
+		headers.Set("Accept", "text/event-stream") // Important for SSE
+		headers.Set("Connection", "keep-alive")
+	}
+	p.setAuthHeader(headers)
 	// Merge extra headers (p.ExtraHeaders and req.ExtraHeaders are map[string]string, so convert to []string)
 	for key, value := range p.ExtraHeaders {
 		headers[key] = []string{value}
@@ -78,21 +214,19 @@ func (p *openAICompatibleProvider) Query(ctx context.Context, req *LLMRequest) (
 	for key, value := range req.ExtraHeaders {
 		headers[key] = []string{value}
 	}
-	p.l.Debug("about to send request to %s", p.BaseURL+p.Endpoint)
-	_, rawBody, err := HttpRequest[map[string]any, any](
-		ctx, p.Client, p.BaseURL+p.Endpoint, headers, payload, p.l,
-	)
-	if err != nil {
-		p.l.Warn("got error during HttpRequest: %q", err)
-		return nil, fmt.Errorf("http request failed: %w", err)
+	return payload, headers, nil
+}
+
+// BuildRequestPayload returns the HTTP request that Query, or Stream when req.Stream is set, would send for req.
+func (p *openAICompatibleProvider) BuildRequestPayload(req *LLMRequest) (*RequestPayload, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
 	}
-	p.l.Debug("successful HttpRequest, rawbody: %s", string(rawBody))
-	// Use dedicated unmarshal for better control
-	resp, err := unmarshalResponse(rawBody)
+	payload, headers, err := p.prepareRequest(dryRunRequest(req, p.hooks), req.Stream, p.l)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, err
 	}
-	return resp, nil
+	return newRequestPayload(p.BaseURL+p.Endpoint, headers, payload)
 }
 
 // unmarshalResponse parses wire data into LLMResponse.
@@ -100,18 +234,26 @@ func (p *openAICompatibleProvider) Query(ctx context.Context, req *LLMRequest) (
 func unmarshalResponse(rawResp json.RawMessage) (*LLMResponse, error) {
 	var wire struct {
 		Choices []struct {
+			Index        int    `json:"index"`
 			FinishReason string `json:"finish_reason"`
-			Message      *struct {
-				Role      string `json:"role"`
-				Content   string `json:"content"`
-				ToolCalls []struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function json.RawMessage `json:"function"`
-				} `json:"tool_calls,omitempty"`
+			LogProbs     *struct {
+				Content []TokenLogProb `json:"content"`
+			} `json:"logprobs,omitempty"`
+			Message *struct {
+				Role string `json:"role"`
+				// Content is usually a string, but can be an array of typed parts
+				Content json.RawMessage `json:"content"`
+				// ReasoningContent is the reasoning of DeepSeek-R1 like models, Reasoning the one of OpenRouter
+				ReasoningContent string `json:"reasoning_content,omitempty"`
+				Reasoning        string `json:"reasoning,omitempty"`
+				// Images are generated images, as returned by OpenRouter
+				Images    []openAIContentPartWire `json:"images,omitempty"`
+				ToolCalls []openAIToolCallWire    `json:"tool_calls,omitempty"`
 			} `json:"message,omitempty"`
 		} `json:"choices,omitempty"`
-		Usage *Usage `json:"usage,omitempty"`
+		Usage       *Usage `json:"usage,omitempty"`
+		ServiceTier string `json:"service_tier,omitempty"`
+		openAIStatusWire
 	}
 
 	if err := json.Unmarshal(rawResp, &wire); err != nil {
@@ -126,14 +268,93 @@ func unmarshalResponse(rawResp json.RawMessage) (*LLMResponse, error) {
 		return nil, errors.New("first choice has nil message")
 	}
 
+	parts, err := parseOpenAIContent(firstMsg.Content)
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range firstMsg.Images {
+		if cp, ok := img.toContentPart(); ok {
+			parts = append(parts, cp)
+		}
+	}
+	text := &strings.Builder{}
+	for _, part := range parts {
+		text.WriteString(part.Text)
+	}
+
 	resp := &LLMResponse{
-		Text:         firstMsg.Content,
+		Text:         text.String(),
+		Parts:        structuredParts(parts),
+		Reasoning:    firstMsg.ReasoningContent + firstMsg.Reasoning,
 		FinishReason: wire.Choices[0].FinishReason,
 		Usage:        wire.Usage,
+		ServiceTier:  wire.ServiceTier,
 		Raw:          rawResp,
 	}
+	wire.openAIStatusWire.apply(resp)
 
-	for _, tc := range firstMsg.ToolCalls {
+	resp.ToolCalls, err = unmarshalToolCalls(firstMsg.ToolCalls)
+	if err != nil {
+		return nil, err
+	}
+	if wire.Choices[0].LogProbs != nil {
+		resp.LogProbs = wire.Choices[0].LogProbs.Content
+	}
+	if len(wire.Choices) == 1 {
+		return resp, nil
+	}
+	for _, choice := range wire.Choices {
+		c := Choice{Index: choice.Index, FinishReason: choice.FinishReason}
+		if choice.LogProbs != nil {
+			c.LogProbs = choice.LogProbs.Content
+		}
+		if choice.Message != nil {
+			choiceParts, err := parseOpenAIContent(choice.Message.Content)
+			if err != nil {
+				return nil, err
+			}
+			for _, part := range choiceParts {
+				c.Text += part.Text
+			}
+			if c.ToolCalls, err = unmarshalToolCalls(choice.Message.ToolCalls); err != nil {
+				return nil, err
+			}
+		}
+		resp.Choices = append(resp.Choices, c)
+	}
+	return resp, nil
+}
+
+// openAIStatusWire is the top-level status of an OpenAI response,
+// reported by the Responses API and some OpenAI-compatible servers apart from the finish reason.
+type openAIStatusWire struct {
+	Status            string `json:"status,omitempty"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
+}
+
+// apply sets the status and the incomplete reason of resp when reported.
+func (w openAIStatusWire) apply(resp *LLMResponse) {
+	if w.Status != "" {
+		resp.Status = w.Status
+	}
+	if w.IncompleteDetails != nil && w.IncompleteDetails.Reason != "" {
+		resp.IncompleteReason = w.IncompleteDetails.Reason
+	}
+}
+
+// openAIToolCallWire is a tool call of an OpenAI-compatible response message.
+type openAIToolCallWire struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Function json.RawMessage `json:"function"`
+}
+
+// unmarshalToolCalls converts the tool calls of a response message.
+func unmarshalToolCalls(wireCalls []openAIToolCallWire) ([]ToolCall, error) {
+	var calls []ToolCall
+	for _, tc := range wireCalls {
 		var fn struct {
 			Name      string          `json:"name"`
 			Arguments json.RawMessage `json:"arguments"`
@@ -141,20 +362,71 @@ func unmarshalResponse(rawResp json.RawMessage) (*LLMResponse, error) {
 		if err := json.Unmarshal(tc.Function, &fn); err != nil {
 			return nil, fmt.Errorf("unmarshal tool function: %w", err)
 		}
-		resp.ToolCalls = append(resp.ToolCalls, ToolCall{
+		calls = append(calls, ToolCall{
 			ID:        tc.ID,
 			Name:      fn.Name,
 			Arguments: fn.Arguments,
 		})
 	}
-	return resp, nil
+	return calls, nil
 }
 
-// buildPayload creates the request payload for an OpenAI-compatible API.
-func buildPayload(req *LLMRequest, defaultModel string) map[string]any {
+// openAIContentPartWire is a typed part of a message content array.
+type openAIContentPartWire struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// toContentPart converts a text or image_url part to a ContentPart, other part types are skipped.
+func (w openAIContentPartWire) toContentPart() (ContentPart, bool) {
+	switch {
+	case w.Type == "text":
+		return ContentPart{Type: ContentPartText, Text: w.Text}, true
+	case w.Type == "image_url" && w.ImageURL != nil:
+		return ContentPart{Type: ContentPartImage, URL: w.ImageURL.URL}, true
+	default:
+		return ContentPart{}, false
+	}
+}
+
+// parseOpenAIContent parses a message content, either a string (a single text part) or an array of parts.
+func parseOpenAIContent(raw json.RawMessage) ([]ContentPart, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] != '[' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, fmt.Errorf("unmarshal message content: %w", err)
+		}
+		if text == "" {
+			return nil, nil
+		}
+		return []ContentPart{{Type: ContentPartText, Text: text}}, nil
+	}
+	var wireParts []openAIContentPartWire
+	if err := json.Unmarshal(raw, &wireParts); err != nil {
+		return nil, fmt.Errorf("unmarshal message content parts: %w", err)
+	}
+	var parts []ContentPart
+	for _, w := range wireParts {
+		if cp, ok := w.toContentPart(); ok {
+			parts = append(parts, cp)
+		}
+	}
+	return parts, nil
+}
+
+// buildPayload creates the request payload for an OpenAI-compatible API of the given provider kind.
+// It returns an error when provider specific extras are invalid.
+func buildPayload(req *LLMRequest, kind ProviderKind, defaultModel string) (map[string]any, error) {
 	payload := map[string]any{
 		"model":    FirstNonEmpty(req.Model, defaultModel),
-		"messages": ToOpenAIChatMessages(req.Messages),
+		"messages": ToOpenAIChatMessagesFor(kind, preparedMessages(req)),
 		"stream":   req.Stream,
 	}
 	// Add optional parameters...
@@ -167,6 +439,21 @@ func buildPayload(req *LLMRequest, defaultModel string) map[string]any {
 	if req.MaxTokens > 0 {
 		payload["max_tokens"] = req.MaxTokens
 	}
+	if req.FrequencyPenalty != 0 {
+		payload["frequency_penalty"] = req.FrequencyPenalty
+	}
+	if req.PresencePenalty != 0 {
+		payload["presence_penalty"] = req.PresencePenalty
+	}
+	if req.N > 1 && !req.Stream {
+		payload["n"] = req.N
+	}
+	if req.LogProbs && !req.Stream {
+		payload["logprobs"] = true
+		if req.TopLogProbs > 0 {
+			payload["top_logprobs"] = req.TopLogProbs
+		}
+	}
 	if len(req.Tools) > 0 {
 		payload["tools"] = req.Tools
 	}
@@ -176,20 +463,85 @@ func buildPayload(req *LLMRequest, defaultModel string) map[string]any {
 	if req.ResponseFormat != nil {
 		payload["response_format"] = req.ResponseFormat
 	}
+	if req.ServiceTier != "" && kind == ProviderOpenAI {
+		payload["service_tier"] = req.ServiceTier
+	}
 	if req.ProviderExtras != nil {
 		if mos, ok := req.ProviderExtras["messages_override"].([]map[string]any); ok && len(mos) > 0 {
 			payload["messages"] = mos
 		}
+		if kind == ProviderOpenRouter {
+			options, err := openRouterOptions(req.ProviderExtras)
+			if err != nil {
+				return nil, err
+			}
+			if options != nil {
+				if options.Provider != nil {
+					payload["provider"] = options.Provider
+				}
+				if len(options.Transforms) > 0 {
+					payload["transforms"] = options.Transforms
+				}
+				if len(options.Models) > 0 {
+					payload["models"] = options.Models
+				}
+				if options.Route != "" {
+					payload["route"] = options.Route
+				}
+			}
+		}
 	}
-	return payload
+	return payload, nil
+}
+
+// buildPayload creates the request payload for the chat or the legacy completions API, as configured for p.
+// The unset sampling parameters are filled with the family defaults of the model in the catalog.
+func (p *openAICompatibleProvider) buildPayload(req *LLMRequest) (map[string]any, error) {
+	if p.CatalogProvidersModels != nil {
+		req = withSamplingDefaults(req, p.CatalogProvidersModels.Providers[string(p.Kind)].SamplingDefaults(FirstNonEmpty(req.Model, p.Model)))
+	}
+	if p.LegacyCompletions {
+		return buildLegacyPayload(req, p.Model)
+	}
+	return buildPayload(req, p.Kind, p.Model)
+}
+
+// applyRequestOverrides adjusts payload with the model specific overrides from the catalog, ro can be nil.
+func applyRequestOverrides(payload map[string]any, ro *RequestOverrides) {
+	if ro == nil {
+		return
+	}
+	for _, field := range ro.Omit {
+		delete(payload, field)
+	}
+	for from, to := range ro.Rename {
+		if value, ok := payload[from]; ok {
+			delete(payload, from)
+			payload[to] = value
+		}
+	}
+	for field, value := range ro.Set {
+		payload[field] = value
+	}
+}
+
+// setAuthHeader sets the API key header of the provider on headers.
+func (p *openAICompatibleProvider) setAuthHeader(headers http.Header) {
+	if p.AuthHeader != "" {
+		headers.Set(p.AuthHeader, p.APIKey)
+		return
+	}
+	headers.Set("Authorization", "Bearer "+p.APIKey)
 }
 
 // ListModels fetches the list of available models from an OpenAI-compatible API.
 func (p *openAICompatibleProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
-	url := p.BaseURL + "/models"
-	headers := http.Header{
-		"Authorization": []string{"Bearer " + p.APIKey},
+	if p.Kind == ProviderAzureOpenAI {
+		return p.azureDeployments(), nil
 	}
+	url := p.BaseURL + endpointPath(p.ModelsEndpoint, defaultModelsEndpoint)
+	headers := http.Header{}
+	p.setAuthHeader(headers)
 	for key, value := range p.ExtraHeaders {
 		headers.Set(key, value)
 	}
@@ -200,8 +552,9 @@ func (p *openAICompatibleProvider) ListModels(ctx context.Context) ([]ModelInfo,
 		} `json:"data"`
 	}
 
-	resp, err := httpGetRequest[modelsResponse](ctx, p.Client, url, headers, p.l)
+	resp, err := httpGetRequest[modelsResponse](ctx, p.Client, url, headers, p.RetryPolicy, p.l)
 	if err != nil {
+		setAPIErrorProvider(err, p.Kind)
 		return nil, fmt.Errorf("failed to list models from %s: %w", p.BaseURL, err)
 	}
 
@@ -241,12 +594,52 @@ func (p *openAICompatibleProvider) ListModels(ctx context.Context) ([]ModelInfo,
 	return modelInfos, nil
 }
 
-// Stream sends a streaming request to an OpenAI-compatible API.
+// modelInfo returns the catalog information of modelName, or false when the provider is not in the catalog.
+func (p *openAICompatibleProvider) modelInfo(modelName string) (ModelInfo, bool) {
+	if p.CatalogProvidersModels == nil {
+		return ModelInfo{}, false
+	}
+	providerConfig, ok := p.CatalogProvidersModels.Providers[string(p.Kind)]
+	if !ok {
+		return ModelInfo{}, false
+	}
+	return providerConfig.ModelInfo(modelName), true
+}
+
+// supportsStreaming tells if the model catalog allows streaming for modelName, unknown providers are assumed to support it.
+func (p *openAICompatibleProvider) supportsStreaming(modelName string) bool {
+	info, ok := p.modelInfo(modelName)
+	return !ok || info.SupportsStreaming
+}
+
+// sendStreamRequest posts the stream payload and returns the response, whatever its status code.
+func (p *openAICompatibleProvider) sendStreamRequest(ctx context.Context, payload map[string]any, headers http.Header) (*http.Response, error) {
+	bodyBytes, err := marshalRequestBody(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stream request payload: %w", err)
+	}
+	httpReq, err := newHTTPRequest(ctx, http.MethodPost, p.BaseURL+p.Endpoint, headers, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream request: %w", err)
+	}
+
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send stream request: %w", err)
+	}
+	return resp, nil
+}
+
+// stream sends a streaming request to an OpenAI-compatible API.
 // Deltas are sent to the onDelta callback as they arrive.
-func (p *openAICompatibleProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+func (p *openAICompatibleProvider) stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	l := contextLogger(ctx, p.l)
 	if req == nil {
 		return nil, errors.New("request cannot be nil")
 	}
+	ctx, cancel := withRequestTimeout(ctx, req.Timeout)
+	defer cancel()
+	firstChunk := firstChunkNotifier(req, time.Now())
 	if onDelta == nil {
 		return nil, errors.New("onDelta callback cannot be nil for streaming")
 	}
@@ -254,57 +647,71 @@ func (p *openAICompatibleProvider) Stream(ctx context.Context, req *LLMRequest,
 		return nil, errors.New("request must have at least one message")
 	}
 
-	req.Stream = true // Ensure stream is enabled
-	payload := buildPayload(req, p.Model)
-
-	headers := http.Header{
-		"Content-Type":  []string{"application/json"},
-		"Authorization": []string{"Bearer " + p.APIKey},
-		"Accept":        []string{"text/event-stream"}, // Important for SSE
-		"Connection":    []string{"keep-alive"},
-	}
-	for key, value := range p.ExtraHeaders {
-		headers[key] = []string{value}
+	if req.FakeStreamIfUnsupported && !p.supportsStreaming(FirstNonEmpty(req.Model, p.Model)) {
+		l.Info("model %s doesn't support streaming, falling back to a regular query", FirstNonEmpty(req.Model, p.Model))
+		return QueryAsStream(ctx, queryFunc(p.query), req, onDelta)
 	}
 
-	// Create request
-	bodyBytes, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal stream request payload: %w", err)
-	}
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+p.Endpoint, bytes.NewBuffer(bodyBytes))
+	req.Stream = true // Ensure stream is enabled
+	payload, headers, err := p.prepareRequest(req, true, l)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create stream request: %w", err)
+		return nil, err
 	}
-	httpReq.Header = headers
 
-	// Execute request
-	resp, err := p.Client.Do(httpReq)
+	resp, err := p.sendStreamRequest(ctx, payload, headers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send stream request: %w", err)
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusBadRequest && payload["stream_options"] != nil {
+		// some OpenAI-compatible servers reject the stream_options field, retry without it
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), "stream_options") {
+			return nil, fmt.Errorf("stream request failed: %w", newAPIError(resp.StatusCode, resp.Header, body, p.Kind, 1))
+		}
+		l.Warn("%s rejected stream_options, streaming again without usage: %s", p.BaseURL, string(body))
+		delete(payload, "stream_options")
+		resp, err = p.sendStreamRequest(ctx, payload, headers)
+		if err != nil {
+			return nil, err
+		}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("received non-2xx status code %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("stream request failed: %w", newAPIError(resp.StatusCode, resp.Header, body, p.Kind, 1))
 	}
 
-	// Process the SSE stream
+	// Process the SSE stream, a single data line can be much larger than the default 64KB scanner limit
+	// (e.g. big tool call arguments or base64 content)
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
 	finalResponse := &LLMResponse{}
 	fullText := &strings.Builder{}
+	fullReasoning := &strings.Builder{}
 
 	// SSE wire format for deltas
 	type streamChoice struct {
+		Text  string `json:"text"` // legacy completions
 		Delta struct {
-			Content string `json:"content"`
+			Content          string               `json:"content"`
+			ReasoningContent string               `json:"reasoning_content"`
+			Reasoning        string               `json:"reasoning"`
+			ToolCalls        []streamToolCallWire `json:"tool_calls"`
 		} `json:"delta"`
 		FinishReason string `json:"finish_reason"`
 	}
+	toolCalls := &streamToolCallAccumulator{}
 	type streamChunk struct {
-		Choices []streamChoice `json:"choices"`
-		Usage   *Usage         `json:"usage"` // Sometimes usage is in the last chunk
+		Choices     []streamChoice `json:"choices"`
+		Usage       *Usage         `json:"usage"` // Sometimes usage is in the last chunk
+		ServiceTier string         `json:"service_tier"`
+		openAIStatusWire
+		// XGroq holds the usage of the last chunk of a Groq stream
+		XGroq *struct {
+			Usage *Usage `json:"usage"`
+		} `json:"x_groq"`
 	}
 
 	for scanner.Scan() {
@@ -312,6 +719,7 @@ func (p *openAICompatibleProvider) Stream(ctx context.Context, req *LLMRequest,
 		if !strings.HasPrefix(line, "data: ") {
 			continue
 		}
+		firstChunk()
 
 		data := strings.TrimPrefix(line, "data: ")
 		if data == "[DONE]" {
@@ -320,16 +728,40 @@ func (p *openAICompatibleProvider) Stream(ctx context.Context, req *LLMRequest,
 
 		var chunk streamChunk
 		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-			p.l.Warn("failed to unmarshal stream chunk: %v. data: %s", err, data)
+			l.Warn("failed to unmarshal stream chunk: %v. data: %s", err, data)
 			continue
 		}
+		var raw json.RawMessage
+		if req.IncludeRawChunks {
+			raw = json.RawMessage(data)
+		}
+		emit := withRawChunk(onDelta, raw)
 
 		if len(chunk.Choices) > 0 {
+			// Send reasoning delta, apart from the answer text
+			if reasoningDelta := chunk.Choices[0].Delta.ReasoningContent + chunk.Choices[0].Delta.Reasoning; reasoningDelta != "" {
+				fullReasoning.WriteString(reasoningDelta)
+				emit(Delta{Reasoning: reasoningDelta})
+			}
+
 			// Send text delta
-			textDelta := chunk.Choices[0].Delta.Content
+			textDelta := chunk.Choices[0].Delta.Content + chunk.Choices[0].Text
 			if textDelta != "" {
 				fullText.WriteString(textDelta)
-				onDelta(Delta{Text: textDelta})
+				emit(Delta{Text: textDelta})
+			}
+
+			// Tool calls arrive as fragments (id and name first, then pieces of arguments) keyed by index
+			for _, tc := range chunk.Choices[0].Delta.ToolCalls {
+				call := toolCalls.add(tc)
+				if tc.Function.Arguments != "" {
+					emit(Delta{ToolCallArgsFragment: &ToolCallFragment{
+						Index:     call.Index,
+						ID:        call.ID,
+						Name:      call.Function.Name,
+						Arguments: tc.Function.Arguments,
+					}})
+				}
 			}
 
 			// Capture finish reason
@@ -338,9 +770,16 @@ func (p *openAICompatibleProvider) Stream(ctx context.Context, req *LLMRequest,
 			}
 		}
 
+		if chunk.ServiceTier != "" {
+			finalResponse.ServiceTier = chunk.ServiceTier
+		}
+		chunk.openAIStatusWire.apply(finalResponse)
+
 		// Capture usage stats if present in the final chunk
 		if chunk.Usage != nil {
 			finalResponse.Usage = chunk.Usage
+		} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			finalResponse.Usage = chunk.XGroq.Usage
 		}
 	}
 
@@ -348,7 +787,70 @@ func (p *openAICompatibleProvider) Stream(ctx context.Context, req *LLMRequest,
 		return nil, fmt.Errorf("error reading stream: %w", err)
 	}
 
+	if calls := toolCalls.toolCalls(); len(calls) > 0 {
+		finalResponse.ToolCalls = calls
+		onDelta(Delta{ToolCalls: calls})
+	}
+	completeStreamUsage(finalResponse, req, fullText.String(), TokenEstimatorForProvider(p.Kind, FirstNonEmpty(req.Model, p.Model)))
 	onDelta(Delta{Done: true, FinishReason: finalResponse.FinishReason})
 	finalResponse.Text = fullText.String()
+	finalResponse.Reasoning = fullReasoning.String()
 	return finalResponse, nil
 }
+
+// streamToolCallWire is the wire format of a tool call fragment in an OpenAI streaming delta.
+type streamToolCallWire struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// streamToolCallAccumulator reassembles streamed tool call fragments into complete ToolCalls.
+type streamToolCallAccumulator struct {
+	order []int
+	calls map[int]*streamToolCallWire
+}
+
+// add merges a fragment into the tool call with the same index and returns the merged tool call so far.
+func (a *streamToolCallAccumulator) add(frag streamToolCallWire) *streamToolCallWire {
+	if a.calls == nil {
+		a.calls = map[int]*streamToolCallWire{}
+	}
+	call, exists := a.calls[frag.Index]
+	if !exists {
+		call = &streamToolCallWire{Index: frag.Index}
+		a.calls[frag.Index] = call
+		a.order = append(a.order, frag.Index)
+	}
+	if frag.ID != "" {
+		call.ID = frag.ID
+	}
+	if frag.Function.Name != "" {
+		call.Function.Name = frag.Function.Name
+	}
+	call.Function.Arguments += frag.Function.Arguments
+	return call
+}
+
+// toolCalls returns the reassembled tool calls in arrival order.
+// Arguments are kept as a JSON string like in a non-streaming response.
+func (a *streamToolCallAccumulator) toolCalls() []ToolCall {
+	if len(a.order) == 0 {
+		return nil
+	}
+	out := make([]ToolCall, 0, len(a.order))
+	for _, idx := range a.order {
+		call := a.calls[idx]
+		args, _ := json.Marshal(call.Function.Arguments)
+		out = append(out, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: args,
+		})
+	}
+	return out
+}
@@ -3,10 +3,16 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
 )
@@ -140,3 +146,1028 @@ func TestOpenAICompatProviderQuery(t *testing.T) {
 		}
 	})
 }
+
+// TestOpenAICompatProviderQueryTimeout verifies that LLMRequest.Timeout bounds the request.
+func TestOpenAICompatProviderQueryTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(500 * time.Millisecond):
+		}
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{
+		BaseURL:  server.URL,
+		APIKey:   "test-api-key",
+		Model:    "test-model",
+		Client:   server.Client(),
+		Endpoint: "/chat/completions",
+		l:        l,
+	}
+
+	req := &LLMRequest{
+		Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}},
+		Timeout:  50 * time.Millisecond,
+	}
+	start := time.Now()
+	_, err := provider.Query(context.Background(), req)
+	if err == nil {
+		t.Fatal("Expected a timeout error, got nil")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Expected the request to be cancelled quickly, took %v", elapsed)
+	}
+}
+
+// TestOpenAICompatProviderStreamToolCallOnly verifies that a stream made only of tool call deltas
+// yields a final response with the reassembled tool calls, no text and the tool_calls finish reason.
+func TestOpenAICompatProviderStreamToolCallOnly(t *testing.T) {
+	sseChunks := []string{
+		`{"choices":[{"delta":{"role":"assistant","content":null,"tool_calls":[{"index":0,"id":"call_abc123","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}`,
+		`{"choices":[{"delta":{"content":null,"tool_calls":[{"index":0,"function":{"arguments":"{\"location\":"}}]},"finish_reason":null}]}`,
+		`{"choices":[{"delta":{"content":null,"tool_calls":[{"index":0,"function":{"arguments":" \"Lausanne\"}"}}]},"finish_reason":null}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		`[DONE]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range sseChunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{
+		BaseURL:  server.URL,
+		APIKey:   "test-api-key",
+		Model:    "test-model",
+		Client:   server.Client(),
+		Endpoint: "/chat/completions",
+		l:        l,
+	}
+
+	req := &LLMRequest{
+		Messages: []LLMMessage{{Role: RoleUser, Content: "What's the weather?"}},
+		Tools:    []Tool{{Type: "function", Function: ToolSpec{Name: "get_weather"}}},
+	}
+	var deltaToolCalls []ToolCall
+	var fragments []ToolCallFragment
+	resp, err := provider.Stream(context.Background(), req, func(d Delta) {
+		deltaToolCalls = append(deltaToolCalls, d.ToolCalls...)
+		if d.ToolCallArgsFragment != nil {
+			fragments = append(fragments, *d.ToolCallArgsFragment)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Text != "" {
+		t.Errorf("Expected empty text, got %q", resp.Text)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("Expected finish reason 'tool_calls', got %q", resp.FinishReason)
+	}
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("Expected 1 tool call, got %d", len(resp.ToolCalls))
+	}
+	tc := resp.ToolCalls[0]
+	if tc.ID != "call_abc123" || tc.Name != "get_weather" {
+		t.Errorf("Unexpected tool call: %#v", tc)
+	}
+	var args string
+	if err := json.Unmarshal(tc.Arguments, &args); err != nil || args != `{"location": "Lausanne"}` {
+		t.Errorf("Expected reassembled arguments, got %s (err: %v)", string(tc.Arguments), err)
+	}
+	if len(deltaToolCalls) != 1 {
+		t.Errorf("Expected the tool call to be emitted once through onDelta, got %d", len(deltaToolCalls))
+	}
+	if len(fragments) != 2 {
+		t.Fatalf("Expected 2 argument fragments, got %d", len(fragments))
+	}
+	if fragments[0].Arguments+fragments[1].Arguments != args {
+		t.Errorf("Expected fragments to concatenate to the arguments, got %#v", fragments)
+	}
+	if fragments[1].Index != 0 || fragments[1].ID != "call_abc123" || fragments[1].Name != "get_weather" {
+		t.Errorf("Expected fragments to carry the tool call index, id and name, got %#v", fragments[1])
+	}
+}
+
+// TestOpenAICompatProviderFakeStream verifies that Stream falls back to Query when the catalog
+// says the model doesn't support streaming and FakeStreamIfUnsupported is set.
+func TestOpenAICompatProviderFakeStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]any
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if reqBody["stream"] == true {
+			t.Error("Expected a non-streaming request")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "full answer"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	noStreaming := false
+	provider := &openAICompatibleProvider{
+		BaseURL: server.URL,
+		Kind:    ProviderOpenAI,
+		APIKey:  "test-api-key",
+		Model:   "no-stream-model",
+		CatalogProvidersModels: &ModelCatalog{Providers: map[string]ProviderModelsInfo{
+			string(ProviderOpenAI): {
+				Defaults: ModelInfo{SupportsStreaming: true},
+				Models:   map[string]ModelOverride{"no-stream-model": {SupportsStreaming: &noStreaming}},
+			},
+		}},
+		Client:   server.Client(),
+		Endpoint: "/chat/completions",
+		l:        l,
+	}
+
+	var deltas []Delta
+	resp, err := provider.Stream(context.Background(), &LLMRequest{
+		Messages:                []LLMMessage{{Role: RoleUser, Content: "Hello"}},
+		FakeStreamIfUnsupported: true,
+	}, func(d Delta) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Text != "full answer" {
+		t.Errorf("Expected 'full answer', got %q", resp.Text)
+	}
+	if len(deltas) != 2 || deltas[0].Text != "full answer" || !deltas[1].Done || deltas[1].FinishReason != "stop" {
+		t.Errorf("Expected a single text delta followed by done, got %#v", deltas)
+	}
+}
+
+func TestBuildPayloadOpenRouterRouting(t *testing.T) {
+	req := &LLMRequest{
+		Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}},
+		ProviderExtras: map[string]any{
+			ProviderExtraOpenRouterRouting: map[string]any{"order": []string{"groq", "together"}, "allow_fallbacks": false},
+		},
+	}
+	payload, err := buildPayload(req, ProviderOpenRouter, "test-model")
+	if err != nil {
+		t.Fatalf("buildPayload failed: %v", err)
+	}
+	routing, ok := payload["provider"].(*OpenRouterProviderRouting)
+	if !ok {
+		t.Fatalf("Expected a provider routing in payload, got %#v", payload["provider"])
+	}
+	if len(routing.Order) != 2 || routing.AllowFallbacks == nil || *routing.AllowFallbacks {
+		t.Errorf("Unexpected routing: %#v", routing)
+	}
+
+	// other providers ignore the OpenRouter routing extras
+	payload, err = buildPayload(req, ProviderOpenAI, "test-model")
+	if err != nil || payload["provider"] != nil {
+		t.Errorf("Expected routing to be ignored for OpenAI, got %#v (err: %v)", payload["provider"], err)
+	}
+
+	for name, invalid := range map[string]any{
+		"UnknownKey": map[string]any{"orderr": []string{"groq"}},
+		"WrongType":  map[string]any{"allow_fallbacks": "no"},
+		"BadSort":    OpenRouterProviderRouting{Sort: "cheapest"},
+		"NotAMap":    []string{"groq"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req.ProviderExtras = map[string]any{ProviderExtraOpenRouterRouting: invalid}
+			if _, err := buildPayload(req, ProviderOpenRouter, "test-model"); err == nil {
+				t.Error("Expected a validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestBuildPayloadOpenRouterOptions(t *testing.T) {
+	req := &LLMRequest{
+		Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}},
+		ProviderExtras: map[string]any{
+			ProviderExtraOpenRouter: map[string]any{
+				"provider":   map[string]any{"order": []string{"deepinfra"}, "require_parameters": true},
+				"transforms": []string{"middle-out"},
+				"models":     []string{"mistralai/mistral-small", "qwen/qwen3-8b"},
+				"route":      "fallback",
+			},
+			// ignored, the options have their own routing preferences
+			ProviderExtraOpenRouterRouting: OpenRouterProviderRouting{Order: []string{"groq"}},
+		},
+	}
+	payload, err := buildPayload(req, ProviderOpenRouter, "test-model")
+	if err != nil {
+		t.Fatalf("buildPayload failed: %v", err)
+	}
+	routing, ok := payload["provider"].(*OpenRouterProviderRouting)
+	if !ok || len(routing.Order) != 1 || routing.Order[0] != "deepinfra" || routing.RequireParameters == nil || !*routing.RequireParameters {
+		t.Errorf("Expected the routing of the options, got %#v", payload["provider"])
+	}
+	if transforms, _ := payload["transforms"].([]string); len(transforms) != 1 || transforms[0] != "middle-out" {
+		t.Errorf("Expected the transforms at the top level, got %#v", payload["transforms"])
+	}
+	if models, _ := payload["models"].([]string); len(models) != 2 || payload["route"] != "fallback" {
+		t.Errorf("Expected the fallback models and route, got %#v and %#v", payload["models"], payload["route"])
+	}
+
+	for name, invalid := range map[string]any{
+		"UnknownKey":     map[string]any{"transform": []string{"middle-out"}},
+		"BadRoute":       OpenRouterOptions{Route: "random"},
+		"BadProviderKey": map[string]any{"provider": map[string]any{"orderr": []string{"groq"}}},
+		"NotAMap":        "middle-out",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req.ProviderExtras = map[string]any{ProviderExtraOpenRouter: invalid}
+			if _, err := buildPayload(req, ProviderOpenRouter, "test-model"); err == nil {
+				t.Error("Expected a validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestOpenRouterAttributionHeaders(t *testing.T) {
+	var gotHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "Hi"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}
+	for name, tc := range map[string]struct {
+		extraHeaders map[string]string
+		wantTitle    string
+	}{
+		"Defaults":   {nil, OpenRouterAttributionHeaders["X-Title"]},
+		"Overridden": {map[string]string{"x-title": "my-app"}, "my-app"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			provider, err := NewOpenRouterAdapter(ProviderConfig{Model: "qwen/qwen3-4b:free", APIKey: "test-api-key", BaseURL: server.URL, ExtraHeaders: tc.extraHeaders}, l)
+			if err != nil {
+				t.Fatalf("NewOpenRouterAdapter failed: %v", err)
+			}
+			if _, err := provider.Query(context.Background(), req); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if got := gotHeaders.Values("X-Title"); len(got) != 1 || got[0] != tc.wantTitle {
+				t.Errorf("Expected X-Title %q, got %q", tc.wantTitle, got)
+			}
+			if got := gotHeaders.Get("HTTP-Referer"); got != OpenRouterAttributionHeaders["HTTP-Referer"] {
+				t.Errorf("Expected the default HTTP-Referer, got %q", got)
+			}
+		})
+	}
+}
+
+// TestOpenAICompatProviderStreamUsage verifies that include_usage is requested and the usage chunk is used,
+// falling back to an estimation when the provider doesn't send it.
+func TestOpenAICompatProviderStreamUsage(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	newServer := func(sendUsage bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reqBody map[string]any
+			json.NewDecoder(r.Body).Decode(&reqBody)
+			if opts, _ := reqBody["stream_options"].(map[string]any); opts["include_usage"] != true {
+				t.Errorf("Expected stream_options.include_usage to be true, got %#v", reqBody["stream_options"])
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello world\"},\"finish_reason\":\"stop\"}]}\n\n")
+			if sendUsage {
+				fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":2,\"total_tokens\":11}}\n\n")
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+	}
+	req := func() *LLMRequest {
+		return &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Say hello"}}}
+	}
+
+	t.Run("ReportedUsage", func(t *testing.T) {
+		server := newServer(true)
+		defer server.Close()
+		provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", StreamUsage: true, l: l}
+		resp, err := provider.Stream(context.Background(), req(), func(Delta) {})
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		if resp.Usage == nil || resp.Usage.TotalTokens != 11 || resp.Usage.Estimated {
+			t.Errorf("Expected the reported usage, got %#v", resp.Usage)
+		}
+	})
+
+	t.Run("EstimatedUsage", func(t *testing.T) {
+		server := newServer(false)
+		defer server.Close()
+		provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", StreamUsage: true, l: l}
+		resp, err := provider.Stream(context.Background(), req(), func(Delta) {})
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		if resp.Usage == nil || !resp.Usage.Estimated || resp.Usage.CompletionTokens != EstimateTokens("Hello world") {
+			t.Errorf("Expected an estimated usage, got %#v", resp.Usage)
+		}
+	})
+}
+
+func TestOpenAICompatProviderStreamUsageRejected(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	var withOptions []bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]any
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		_, hasOptions := reqBody["stream_options"]
+		withOptions = append(withOptions, hasOptions)
+		if hasOptions {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": {"message": "Unrecognized request argument supplied: stream_options"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	cfg := ProviderConfig{Model: "m", Extras: map[string]any{}}
+	for name, streamUsage := range map[string]any{"Default": nil, "Disabled": false} {
+		t.Run(name, func(t *testing.T) {
+			withOptions = nil
+			cfg.Extras[ProviderExtraStreamUsage] = streamUsage
+			provider, err := NewOpenAICompatAdapter(cfg, ProviderOpenAI, server.URL, l)
+			if err != nil {
+				t.Fatalf("NewOpenAICompatAdapter failed: %v", err)
+			}
+			resp, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}}, func(Delta) {})
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+			if resp.Text != "Hello" || resp.Usage == nil || !resp.Usage.Estimated {
+				t.Errorf("Expected the text with an estimated usage, got %#v", resp)
+			}
+			want := []bool{true, false}
+			if streamUsage == false {
+				want = []bool{false}
+			}
+			if !slices.Equal(withOptions, want) {
+				t.Errorf("Expected requests with stream_options %v, got %v", want, withOptions)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatProviderStreamLargeChunk(t *testing.T) {
+	big := strings.Repeat("0123456789abcdef", 8*1024) // 128KB, over the default bufio.Scanner limit
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"start \"}}]}\n\n")
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", big)
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\" end\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	var streamed strings.Builder
+	resp, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}, func(d Delta) {
+		streamed.WriteString(d.Text)
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	want := "start " + big + " end"
+	if resp.Text != want || streamed.String() != want {
+		t.Errorf("Expected the full text of %d bytes, got %d bytes (%d streamed)", len(want), len(resp.Text), streamed.Len())
+	}
+	if resp.FinishReason != "stop" {
+		t.Errorf("Expected finish reason stop, got %q", resp.FinishReason)
+	}
+}
+
+func TestServiceTierSerialization(t *testing.T) {
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, ServiceTier: "flex"}
+	for kind, want := range map[ProviderKind]any{ProviderOpenAI: "flex", ProviderOpenRouter: nil, ProviderXAI: nil} {
+		payload, err := buildPayload(req, kind, "test-model")
+		if err != nil {
+			t.Fatalf("buildPayload failed: %v", err)
+		}
+		if payload["service_tier"] != want {
+			t.Errorf("%s: expected service_tier %v, got %v", kind, want, payload["service_tier"])
+		}
+	}
+	req.ServiceTier = ""
+	payload, _ := buildPayload(req, ProviderOpenAI, "test-model")
+	body, _ := json.Marshal(payload)
+	if strings.Contains(string(body), "service_tier") {
+		t.Errorf("Expected service_tier to be omitted when empty, got %s", body)
+	}
+
+	resp, err := unmarshalResponse([]byte(`{"service_tier": "default", "choices": [{"message": {"role": "assistant", "content": "Hi"}}]}`))
+	if err != nil {
+		t.Fatalf("unmarshalResponse failed: %v", err)
+	}
+	if resp.ServiceTier != "default" {
+		t.Errorf("Expected service tier 'default', got %q", resp.ServiceTier)
+	}
+}
+
+func TestPenaltiesSerialization(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency float64
+		presence  float64
+	}{
+		{"Set", 0.5, -0.3},
+		{"Zero", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, FrequencyPenalty: tt.frequency, PresencePenalty: tt.presence}
+
+			payload, err := buildPayload(req, ProviderOpenAI, "test-model")
+			if err != nil {
+				t.Fatalf("buildPayload failed: %v", err)
+			}
+			ollamaPayload, err := (&OllamaProvider{Model: "qwen3:latest"}).buildPayload(req, false)
+			if err != nil {
+				t.Fatalf("ollama buildPayload failed: %v", err)
+			}
+			for name, params := range map[string]map[string]any{"OpenAI": payload, "Ollama": ollamaPayload.Options} {
+				if tt.frequency == 0 {
+					if _, ok := params["frequency_penalty"]; ok {
+						t.Errorf("%s: expected frequency_penalty to be omitted when zero, got %v", name, params)
+					}
+					if _, ok := params["presence_penalty"]; ok {
+						t.Errorf("%s: expected presence_penalty to be omitted when zero, got %v", name, params)
+					}
+					continue
+				}
+				if params["frequency_penalty"] != tt.frequency || params["presence_penalty"] != tt.presence {
+					t.Errorf("%s: expected penalties %v and %v, got %v", name, tt.frequency, tt.presence, params)
+				}
+			}
+			if tt.frequency == 0 && ollamaPayload.Options != nil {
+				t.Errorf("Expected no ollama options, got %v", ollamaPayload.Options)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatAdapterCustomEndpoints(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/v1/chat":
+			fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "Hi"}}]}`)
+		case "/v1/models/list":
+			fmt.Fprint(w, `{"data": [{"id": "custom-model"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	cfg := ProviderConfig{Model: "custom-model", BaseURL: server.URL, Endpoint: "v1/chat", ModelsEndpoint: "/v1/models/list"}
+	provider, err := NewOpenAICompatAdapter(cfg, ProviderOpenRouter, "", l)
+	if err != nil {
+		t.Fatalf("NewOpenAICompatAdapter failed: %v", err)
+	}
+	if _, err := provider.Query(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	models, err := provider.ListModels(context.Background())
+	if err != nil || len(models) != 1 {
+		t.Fatalf("Expected 1 model, got %v (err: %v)", models, err)
+	}
+	if strings.Join(paths, ",") != "/v1/chat,/v1/models/list" {
+		t.Errorf("Expected the custom endpoints to be used, got %v", paths)
+	}
+
+	defaults, _ := NewOpenAICompatAdapter(ProviderConfig{Model: "m"}, ProviderOpenAI, server.URL, l)
+	if p := defaults.(*openAICompatibleProvider); p.Endpoint != "/chat/completions" || p.ModelsEndpoint != "/models" {
+		t.Errorf("Expected default endpoints, got %q and %q", p.Endpoint, p.ModelsEndpoint)
+	}
+}
+
+func TestOpenAICompatProviderRequestOverrides(t *testing.T) {
+	var reqBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody = nil
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "ok"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{
+		BaseURL: server.URL,
+		Kind:    ProviderOpenAI,
+		APIKey:  "test-api-key",
+		Model:   "reasoning-model",
+		CatalogProvidersModels: &ModelCatalog{Providers: map[string]ProviderModelsInfo{
+			string(ProviderOpenAI): {
+				Defaults: ModelInfo{SupportsStreaming: true},
+				Models: map[string]ModelOverride{"reasoning-model": {RequestOverrides: &RequestOverrides{
+					Omit:   []string{"temperature"},
+					Rename: map[string]string{"max_tokens": "max_completion_tokens"},
+					Set:    map[string]any{"reasoning_effort": "low"},
+				}}},
+			},
+		}},
+		Client:   server.Client(),
+		Endpoint: "/chat/completions",
+		l:        l,
+	}
+
+	req := &LLMRequest{
+		Messages:    []LLMMessage{{Role: RoleUser, Content: "Hello"}},
+		Temperature: 0.5,
+		MaxTokens:   100,
+	}
+	if _, err := provider.Query(context.Background(), req); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if _, ok := reqBody["temperature"]; ok {
+		t.Errorf("Expected temperature to be omitted, got %v", reqBody["temperature"])
+	}
+	if _, ok := reqBody["max_tokens"]; ok {
+		t.Errorf("Expected max_tokens to be renamed, got %v", reqBody["max_tokens"])
+	}
+	if reqBody["max_completion_tokens"] != float64(100) {
+		t.Errorf("Expected max_completion_tokens 100, got %v", reqBody["max_completion_tokens"])
+	}
+	if reqBody["reasoning_effort"] != "low" {
+		t.Errorf("Expected reasoning_effort low, got %v", reqBody["reasoning_effort"])
+	}
+
+	// models without overrides keep the payload unchanged
+	req.Model = "other-model"
+	if _, err := provider.Query(context.Background(), req); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if reqBody["temperature"] != 0.5 || reqBody["max_tokens"] != float64(100) {
+		t.Errorf("Expected temperature and max_tokens to be kept, got %v", reqBody)
+	}
+}
+
+func TestUnmarshalResponseParts(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantText  string
+		wantParts []ContentPart
+	}{
+		{"StringContent", `{"choices": [{"message": {"content": "Hi"}}]}`, "Hi", nil},
+		{"NullContent", `{"choices": [{"message": {"content": null}}]}`, "", nil},
+		{"SingleTextPart", `{"choices": [{"message": {"content": [{"type": "text", "text": "Hi"}]}}]}`, "Hi", nil},
+		{
+			"MixedParts",
+			`{"choices": [{"message": {"content": [{"type": "text", "text": "Hi "}, {"type": "image_url", "image_url": {"url": "https://img/cat.png"}}, {"type": "text", "text": "there"}]}}]}`,
+			"Hi there",
+			[]ContentPart{{Type: ContentPartText, Text: "Hi "}, {Type: ContentPartImage, URL: "https://img/cat.png"}, {Type: ContentPartText, Text: "there"}},
+		},
+		{
+			"OpenRouterImages",
+			`{"choices": [{"message": {"content": "A cat", "images": [{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw=="}}]}}]}`,
+			"A cat",
+			[]ContentPart{{Type: ContentPartText, Text: "A cat"}, {Type: ContentPartImage, URL: "data:image/png;base64,iVBORw=="}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := unmarshalResponse([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("unmarshalResponse failed: %v", err)
+			}
+			if resp.Text != tt.wantText {
+				t.Errorf("Expected text %q, got %q", tt.wantText, resp.Text)
+			}
+			if !reflect.DeepEqual(resp.Parts, tt.wantParts) {
+				t.Errorf("Expected parts %#v, got %#v", tt.wantParts, resp.Parts)
+			}
+		})
+	}
+}
+
+func TestMultipleChoices(t *testing.T) {
+	payload, err := buildPayload(&LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Name a color"}}, N: 2}, ProviderOpenAI, "gpt-4o-mini")
+	if err != nil {
+		t.Fatalf("buildPayload failed: %v", err)
+	}
+	if payload["n"] != 2 {
+		t.Errorf("Expected n 2 in payload, got %v", payload["n"])
+	}
+	streamPayload, _ := buildPayload(&LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Name a color"}}, N: 2, Stream: true}, ProviderOpenAI, "gpt-4o-mini")
+	if _, ok := streamPayload["n"]; ok {
+		t.Errorf("Expected n to be omitted when streaming, got %v", streamPayload["n"])
+	}
+
+	raw := json.RawMessage(`{"choices": [
+		{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Blue"}},
+		{"index": 1, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": null,
+			"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "pick_color", "arguments": "{}"}}]}}
+	]}`)
+	resp, err := unmarshalResponse(raw)
+	if err != nil {
+		t.Fatalf("unmarshalResponse failed: %v", err)
+	}
+	if resp.Text != "Blue" || resp.FinishReason != "stop" || len(resp.ToolCalls) != 0 {
+		t.Errorf("Expected the first choice in Text and FinishReason, got %q and %q", resp.Text, resp.FinishReason)
+	}
+	if len(resp.Choices) != 2 {
+		t.Fatalf("Expected 2 choices, got %d", len(resp.Choices))
+	}
+	if resp.Choices[0].Text != "Blue" || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("Unexpected first choice %#v", resp.Choices[0])
+	}
+	second := resp.Choices[1]
+	if second.Index != 1 || second.FinishReason != "tool_calls" || len(second.ToolCalls) != 1 || second.ToolCalls[0].Name != "pick_color" {
+		t.Errorf("Unexpected second choice %#v", second)
+	}
+}
+
+func TestOpenAICompatProviderLogProbs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["logprobs"] != true || payload["top_logprobs"] != float64(2) {
+			t.Errorf("Expected logprobs true and top_logprobs 2 in payload, got %v and %v", payload["logprobs"], payload["top_logprobs"])
+		}
+		fmt.Fprint(w, `{"choices": [{"index": 0, "finish_reason": "stop",
+			"message": {"role": "assistant", "content": "Yes"},
+			"logprobs": {"content": [{"token": "Yes", "logprob": -0.01, "bytes": [89, 101, 115],
+				"top_logprobs": [{"token": "Yes", "logprob": -0.01}, {"token": "No", "logprob": -4.6}]}]}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Model: "gpt-4o-mini", Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Is Go fun?"}}, LogProbs: true, TopLogProbs: 2}
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(resp.LogProbs) != 1 {
+		t.Fatalf("Expected 1 token log probability, got %#v", resp.LogProbs)
+	}
+	token := resp.LogProbs[0]
+	if token.Token != "Yes" || token.LogProb != -0.01 || len(token.TopLogProbs) != 2 || token.TopLogProbs[1].Token != "No" {
+		t.Errorf("Unexpected token log probability %#v", token)
+	}
+	if p := token.Prob(); p < 0.98 || p > 1 {
+		t.Errorf("Expected a probability of about 0.99, got %f", p)
+	}
+
+	geminiPayload, err := buildGeminiPayload(req)
+	if err != nil {
+		t.Fatalf("Expected Gemini to ignore logprobs, got %v", err)
+	}
+	if data, _ := json.Marshal(geminiPayload); strings.Contains(string(data), "logprob") {
+		t.Errorf("Expected no logprobs in Gemini payload, got %s", data)
+	}
+}
+
+func TestOpenAICompatProviderStreamReasoning(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantReasoning string
+	}{
+		{
+			name: "ReasoningContent",
+			chunks: []string{
+				`{"choices":[{"delta":{"reasoning_content":"Compare "}}]}`,
+				`{"choices":[{"delta":{"reasoning_content":"decimals."}}]}`,
+				`{"choices":[{"delta":{"content":"9.8"},"finish_reason":"stop"}]}`,
+			},
+			wantReasoning: "Compare decimals.",
+		},
+		{
+			name: "OpenRouterReasoning",
+			chunks: []string{
+				`{"choices":[{"delta":{"reasoning":"Compare decimals."}}]}`,
+				`{"choices":[{"delta":{"content":"9.8"},"finish_reason":"stop"}]}`,
+			},
+			wantReasoning: "Compare decimals.",
+		},
+		{
+			name:   "NoReasoning",
+			chunks: []string{`{"choices":[{"delta":{"content":"9.8"},"finish_reason":"stop"}]}`},
+		},
+	}
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, chunk := range tt.chunks {
+					fmt.Fprintf(w, "data: %s\n\n", chunk)
+				}
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+			provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", StreamUsage: true, l: l}
+
+			var reasoning, text strings.Builder
+			resp, err := provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "9.11 or 9.8?"}}}, func(d Delta) {
+				if d.Reasoning != "" && d.Text != "" {
+					t.Errorf("Expected reasoning and text in separate deltas, got %#v", d)
+				}
+				reasoning.WriteString(d.Reasoning)
+				text.WriteString(d.Text)
+			})
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+			if reasoning.String() != tt.wantReasoning || resp.Reasoning != tt.wantReasoning {
+				t.Errorf("Expected reasoning %q, got deltas %q and response %q", tt.wantReasoning, reasoning.String(), resp.Reasoning)
+			}
+			if text.String() != "9.8" || resp.Text != "9.8" {
+				t.Errorf("Expected the text '9.8' without reasoning, got deltas %q and response %q", text.String(), resp.Text)
+			}
+		})
+	}
+}
+
+func TestStreamDeltaTimestamps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range []string{"one", " two", " three"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", word)
+			w.(http.Flusher).Flush()
+			time.Sleep(5 * time.Millisecond)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", StreamUsage: true, l: l}
+	for _, enabled := range []bool{true, false} {
+		var stamps []time.Duration
+		req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Count"}}, TimestampDeltas: enabled}
+		if _, err := provider.Stream(context.Background(), req, func(d Delta) { stamps = append(stamps, d.Elapsed) }); err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+		if len(stamps) != 4 {
+			t.Fatalf("Expected 3 text deltas and a done delta, got %d", len(stamps))
+		}
+		for i, elapsed := range stamps {
+			switch {
+			case !enabled && elapsed != 0:
+				t.Errorf("Expected no timestamp when disabled, got %v", elapsed)
+			case enabled && elapsed <= 0:
+				t.Errorf("Expected a positive elapsed time for delta %d, got %v", i, elapsed)
+			case enabled && i > 0 && elapsed < stamps[i-1]:
+				t.Errorf("Expected monotonic timestamps, got %v after %v", elapsed, stamps[i-1])
+			}
+		}
+		if enabled && stamps[2]-stamps[0] < 10*time.Millisecond {
+			t.Errorf("Expected the inter-token delays to show in the timestamps, got %v", stamps)
+		}
+	}
+}
+
+func TestStreamRawChunks(t *testing.T) {
+	openAIChunk := `{"choices":[{"delta":{"content":"Hi"}}]}`
+	geminiChunk := `{"candidates":[{"content":{"parts":[{"text":"Hi"}]}}]}`
+	ollamaChunk := `{"message":{"role":"assistant","content":"Hi"},"done":false}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+			fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", openAIChunk)
+		case strings.Contains(r.URL.Path, ":streamGenerateContent"):
+			fmt.Fprintf(w, "[%s]", geminiChunk)
+		default:
+			fmt.Fprintf(w, "%s\n{\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true}\n", ollamaChunk)
+		}
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	tests := []struct {
+		name     string
+		provider Provider
+		wantRaw  string
+	}{
+		{name: "OpenAICompatible", provider: &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}, wantRaw: openAIChunk},
+		{name: "Gemini", provider: &GeminiProvider{BaseURL: server.URL, Model: "gemini-2.5-flash", Client: server.Client(), l: l}, wantRaw: geminiChunk},
+		{name: "Ollama", provider: &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}, wantRaw: ollamaChunk},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, enabled := range []bool{true, false} {
+				var textDelta Delta
+				req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, IncludeRawChunks: enabled}
+				_, err := tt.provider.Stream(context.Background(), req, func(d Delta) {
+					if d.Text != "" {
+						textDelta = d
+					}
+				})
+				if err != nil {
+					t.Fatalf("Stream failed: %v", err)
+				}
+				want := ""
+				if enabled {
+					want = tt.wantRaw
+				}
+				if string(textDelta.RawChunk) != want {
+					t.Errorf("Expected raw chunk %q (enabled: %t), got %q", want, enabled, textDelta.RawChunk)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamOnFirstChunk(t *testing.T) {
+	const firstChunkDelay = 20 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(firstChunkDelay)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"!\"}}]}\n\ndata: [DONE]\n\n")
+		case strings.Contains(r.URL.Path, ":streamGenerateContent"):
+			fmt.Fprint(w, `[{"candidates":[{"content":{"parts":[{"text":"Hi"}]}}]}, {"candidates":[{"content":{"parts":[{"text":"!"}]}}]}]`)
+		case r.URL.Path == "/v2/chat":
+			fmt.Fprint(w, "data: {\"type\":\"content-delta\",\"delta\":{\"message\":{\"content\":{\"text\":\"Hi\"}}}}\n\ndata: {\"type\":\"content-delta\",\"delta\":{\"message\":{\"content\":{\"text\":\"!\"}}}}\n\n")
+		default:
+			fmt.Fprint(w, "{\"message\":{\"content\":\"Hi\"},\"done\":false}\n{\"message\":{\"content\":\"!\"},\"done\":true}\n")
+		}
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	tests := []struct {
+		name     string
+		provider Provider
+	}{
+		{name: "OpenAICompatible", provider: &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}},
+		{name: "Gemini", provider: &GeminiProvider{BaseURL: server.URL, Model: "gemini-2.5-flash", Client: server.Client(), l: l}},
+		{name: "Ollama", provider: &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}},
+		{name: "Cohere", provider: &CohereProvider{BaseURL: server.URL, Model: "command-r-plus", Client: server.Client(), l: l}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []time.Duration
+			req := &LLMRequest{
+				Messages:     []LLMMessage{{Role: RoleUser, Content: "Hello"}},
+				OnFirstChunk: func(elapsed time.Duration) { calls = append(calls, elapsed) },
+			}
+			var textDeltas int
+			_, err := tt.provider.Stream(context.Background(), req, func(d Delta) {
+				if d.Text != "" {
+					textDeltas++
+					if len(calls) != 1 {
+						t.Errorf("Expected OnFirstChunk to be called before the text deltas")
+					}
+				}
+			})
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+			if textDeltas != 2 || len(calls) != 1 {
+				t.Fatalf("Expected a single OnFirstChunk call for 2 text deltas, got %d calls for %d deltas", len(calls), textDeltas)
+			}
+			if calls[0] < firstChunkDelay {
+				t.Errorf("Expected the elapsed time to include the %v server delay, got %v", firstChunkDelay, calls[0])
+			}
+		})
+	}
+}
+
+func TestSentMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "Bonjour"}}]}`)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	for _, enabled := range []bool{true, false} {
+		req := &LLMRequest{
+			Messages:            []LLMMessage{{Role: RoleSystem, Content: "Be brief."}, {Role: RoleUser, Content: "Hello"}},
+			Language:            "French",
+			IncludeSentMessages: enabled,
+		}
+		resp, err := provider.Query(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if !enabled {
+			if resp.SentMessages != nil {
+				t.Errorf("Expected no sent messages when disabled, got %v", resp.SentMessages)
+			}
+			continue
+		}
+		if len(resp.SentMessages) != 2 || resp.SentMessages[0].Content != "Be brief.\nRespond in French." {
+			t.Errorf("Expected the system prompt with the language hint in the sent messages, got %v", resp.SentMessages)
+		}
+		if req.Messages[0].Content != "Be brief." {
+			t.Errorf("Expected the request messages unchanged, got %q", req.Messages[0].Content)
+		}
+	}
+
+	t.Run("AfterTheOnRequestHook", func(t *testing.T) {
+		hooked := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l,
+			hooks: callHooks{onRequest: func(req *LLMRequest) {
+				req.Messages = append(req.Messages, LLMMessage{Role: RoleUser, Content: "Added by the hook"})
+			}},
+		}
+		req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}, IncludeSentMessages: true}
+		resp, err := hooked.Query(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if len(resp.SentMessages) != 2 || resp.SentMessages[1].Content != "Added by the hook" {
+			t.Errorf("Expected the sent messages to include the one added by the hook, got %v", resp.SentMessages)
+		}
+	})
+}
+
+func TestIncompleteStatus(t *testing.T) {
+	resp, err := unmarshalResponse(json.RawMessage(`{"status": "incomplete", "incomplete_details": {"reason": "content_filter"},
+		"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "The answer is"}}]}`))
+	if err != nil {
+		t.Fatalf("unmarshalResponse failed: %v", err)
+	}
+	if resp.Status != StatusIncomplete || resp.IncompleteReason != IncompleteReasonContentFilter {
+		t.Errorf("Expected the incomplete status and reason, got %q and %q", resp.Status, resp.IncompleteReason)
+	}
+	if reason, ok := resp.Incomplete(); !ok || reason != IncompleteReasonContentFilter {
+		t.Errorf("Expected an output incomplete because of the content filter, got %q (%t)", reason, ok)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"The answer\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"length\"}],\"status\":\"incomplete\",\"incomplete_details\":{\"reason\":\"max_output_tokens\"}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	resp, err = provider.Stream(context.Background(), &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}, func(Delta) {})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Status != StatusIncomplete || resp.IncompleteReason != IncompleteReasonMaxOutputTokens {
+		t.Errorf("Expected the streamed incomplete status and reason, got %q and %q", resp.Status, resp.IncompleteReason)
+	}
+}
+
+func TestLLMResponseIncomplete(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       *LLMResponse
+		wantReason string
+		wantOK     bool
+	}{
+		{"Nil", nil, "", false},
+		{"Stop", &LLMResponse{FinishReason: "stop"}, "", false},
+		{"OpenAILength", &LLMResponse{FinishReason: "length"}, IncompleteReasonMaxOutputTokens, true},
+		{"GeminiMaxTokens", &LLMResponse{FinishReason: "MAX_TOKENS"}, IncompleteReasonMaxOutputTokens, true},
+		{"GeminiSafety", &LLMResponse{FinishReason: "SAFETY"}, IncompleteReasonContentFilter, true},
+		{"ReportedReason", &LLMResponse{FinishReason: "stop", Status: StatusIncomplete, IncompleteReason: IncompleteReasonContentFilter}, IncompleteReasonContentFilter, true},
+		{"StatusWithoutDetails", &LLMResponse{Status: StatusIncomplete}, "", true},
+		{"Completed", &LLMResponse{Status: "completed", FinishReason: "stop"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason, ok := tt.resp.Incomplete(); reason != tt.wantReason || ok != tt.wantOK {
+				t.Errorf("Expected (%q, %t), got (%q, %t)", tt.wantReason, tt.wantOK, reason, ok)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatProviderStreamExtraHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Provider"); got != "catalog" {
+			t.Errorf("Expected the provider header, got %q", got)
+		}
+		if got := r.Header.Get("X-Request-Id"); got != "req-42" {
+			t.Errorf("Expected the request header, got %q", got)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", ExtraHeaders: map[string]string{"X-Provider": "catalog"}, l: l}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hi"}}, ExtraHeaders: map[string]string{"X-Request-Id": "req-42"}}
+	if _, err := provider.Stream(context.Background(), req, func(Delta) {}); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+}
@@ -1,7 +1,10 @@
 package llm
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
 )
@@ -20,5 +23,177 @@ func NewOpenRouterAdapter(cfg ProviderConfig, l golog.MyLogger) (Provider, error
 	if cfg.BaseURL == "" {
 		return nil, fmt.Errorf("openrouter: missing baseURl")
 	}
-	return NewOpenAICompatAdapter(cfg, ProviderOpenRouter, cfg.BaseURL, l)
+	provider, err := NewOpenAICompatAdapter(cfg, ProviderOpenRouter, cfg.BaseURL, l)
+	if err != nil {
+		return nil, err
+	}
+	p := provider.(*openAICompatibleProvider)
+	p.ExtraHeaders = withDefaultHeaders(p.ExtraHeaders, OpenRouterAttributionHeaders)
+	return p, nil
+}
+
+// OpenRouterAttributionHeaders are the app attribution headers recommended by OpenRouter,
+// see https://openrouter.ai/docs/api-reference/overview#headers
+// They are sent by default, the same headers from the catalog or ProviderConfig.ExtraHeaders take precedence.
+var OpenRouterAttributionHeaders = map[string]string{
+	"HTTP-Referer": "https://github.com/lao-tseu-is-alive/go-ai-llm-query",
+	"X-Title":      "go-ai-llm-query",
+}
+
+// withDefaultHeaders returns headers completed with the defaults missing from it, whatever the case of the keys.
+func withDefaultHeaders(headers, defaults map[string]string) map[string]string {
+	canonical := make(map[string]bool, len(headers))
+	for key := range headers {
+		canonical[http.CanonicalHeaderKey(key)] = true
+	}
+	merged := mergeHeaders(headers)
+	for key, value := range defaults {
+		if !canonical[http.CanonicalHeaderKey(key)] {
+			merged = mergeHeaders(merged, map[string]string{key: value})
+		}
+	}
+	return merged
+}
+
+// ProviderExtraOpenRouter is the LLMRequest.ProviderExtras key holding the OpenRouter specific request fields,
+// merged into the top-level payload. The value can be an OpenRouterOptions (or a pointer to it)
+// or a map[string]any with the same JSON keys.
+const ProviderExtraOpenRouter = "openrouter"
+
+// OpenRouterOptions are the OpenRouter specific fields of a request, see https://openrouter.ai/docs/api-reference/parameters
+//   - provider: the upstream provider routing preferences, see OpenRouterProviderRouting
+//   - transforms: the prompt transforms to apply, e.g. ["middle-out"] to compress a prompt exceeding the context
+//   - models: fallback models tried in order when the request model is unavailable
+//   - route: "fallback" to use the models list
+type OpenRouterOptions struct {
+	Provider   *OpenRouterProviderRouting `json:"provider,omitempty"`
+	Transforms []string                   `json:"transforms,omitempty"`
+	Models     []string                   `json:"models,omitempty"`
+	Route      string                     `json:"route,omitempty"`
+}
+
+// Validate checks the routing preferences and the route of the options.
+func (o OpenRouterOptions) Validate() error {
+	if o.Provider != nil {
+		if err := o.Provider.Validate(); err != nil {
+			return err
+		}
+	}
+	switch o.Route {
+	case "", "fallback":
+	default:
+		return fmt.Errorf("openrouter: invalid route %q (accepted: fallback)", o.Route)
+	}
+	return nil
+}
+
+// openRouterOptions extracts and validates the OpenRouter options from the request extras.
+// The routing preferences of the ProviderExtraOpenRouterRouting key are used when the options have none.
+// It returns nil when no option was given.
+func openRouterOptions(extras map[string]any) (*OpenRouterOptions, error) {
+	routing, err := openRouterProviderRouting(extras)
+	if err != nil {
+		return nil, err
+	}
+	var options OpenRouterOptions
+	switch v := extras[ProviderExtraOpenRouter].(type) {
+	case nil:
+		if routing == nil {
+			return nil, nil
+		}
+	case OpenRouterOptions:
+		options = v
+	case *OpenRouterOptions:
+		options = *v
+	case map[string]any:
+		if err := decodeStrict(v, &options); err != nil {
+			return nil, fmt.Errorf("openrouter: invalid %s: %w", ProviderExtraOpenRouter, err)
+		}
+	default:
+		return nil, fmt.Errorf("openrouter: %s must be an OpenRouterOptions or a map, got %T", ProviderExtraOpenRouter, v)
+	}
+	if options.Provider == nil {
+		options.Provider = routing
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return &options, nil
+}
+
+// decodeStrict decodes the map m into target through JSON, rejecting the keys unknown to target.
+func decodeStrict(m map[string]any, target any) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+// ProviderExtraOpenRouterRouting is the LLMRequest.ProviderExtras key holding OpenRouter provider routing preferences.
+// The value can be an OpenRouterProviderRouting (or a pointer to it) or a map[string]any with the same JSON keys.
+const ProviderExtraOpenRouterRouting = "provider_routing"
+
+// OpenRouterProviderRouting controls which upstream providers OpenRouter may use to serve a model.
+// It is sent as the "provider" object of the request, see https://openrouter.ai/docs/features/provider-routing
+// Accepted keys are:
+//   - order: provider slugs to try in order (e.g. ["anthropic", "openai"])
+//   - allow_fallbacks: whether other providers may be used when the ordered ones are unavailable
+//   - require_parameters: only use providers supporting all the request parameters
+//   - data_collection: "allow" or "deny" providers that may store or train on the data
+//   - only / ignore: provider slugs to restrict to or to skip
+//   - quantizations: accepted quantization levels (e.g. ["fp8", "int4"])
+//   - sort: "price", "throughput" or "latency"
+type OpenRouterProviderRouting struct {
+	Order             []string `json:"order,omitempty"`
+	AllowFallbacks    *bool    `json:"allow_fallbacks,omitempty"`
+	RequireParameters *bool    `json:"require_parameters,omitempty"`
+	DataCollection    string   `json:"data_collection,omitempty"`
+	Only              []string `json:"only,omitempty"`
+	Ignore            []string `json:"ignore,omitempty"`
+	Quantizations     []string `json:"quantizations,omitempty"`
+	Sort              string   `json:"sort,omitempty"`
+}
+
+// Validate checks the enumerated values of the routing preferences.
+func (r OpenRouterProviderRouting) Validate() error {
+	switch r.DataCollection {
+	case "", "allow", "deny":
+	default:
+		return fmt.Errorf("openrouter: invalid data_collection %q (accepted: allow, deny)", r.DataCollection)
+	}
+	switch r.Sort {
+	case "", "price", "throughput", "latency":
+	default:
+		return fmt.Errorf("openrouter: invalid sort %q (accepted: price, throughput, latency)", r.Sort)
+	}
+	return nil
+}
+
+// openRouterProviderRouting extracts and validates the routing preferences from the request extras.
+// It returns nil when no routing preferences were given.
+func openRouterProviderRouting(extras map[string]any) (*OpenRouterProviderRouting, error) {
+	value, ok := extras[ProviderExtraOpenRouterRouting]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	var routing OpenRouterProviderRouting
+	switch v := value.(type) {
+	case OpenRouterProviderRouting:
+		routing = v
+	case *OpenRouterProviderRouting:
+		routing = *v
+	case map[string]any:
+		if err := decodeStrict(v, &routing); err != nil {
+			return nil, fmt.Errorf("openrouter: invalid %s: %w", ProviderExtraOpenRouterRouting, err)
+		}
+	default:
+		return nil, fmt.Errorf("openrouter: %s must be an OpenRouterProviderRouting or a map, got %T", ProviderExtraOpenRouterRouting, value)
+	}
+	if err := routing.Validate(); err != nil {
+		return nil, err
+	}
+	return &routing, nil
 }
@@ -4,6 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/lao-tseu-is-alive/go-ai-llm-query/pkg/config"
@@ -18,6 +23,12 @@ const (
 	ProviderGemini     ProviderKind = "Gemini"
 	ProviderXAI        ProviderKind = "XAI"
 	ProviderOllama     ProviderKind = "Ollama"
+	ProviderMistral    ProviderKind = "Mistral"
+	ProviderDeepSeek   ProviderKind = "DeepSeek"
+	ProviderGroq       ProviderKind = "Groq"
+	// ProviderAzureOpenAI is an OpenAI model deployed on an Azure OpenAI resource
+	ProviderAzureOpenAI ProviderKind = "AzureOpenAI"
+	ProviderCohere      ProviderKind = "Cohere"
 )
 
 const defaultModelInfoFilePath = "info/models.json"
@@ -33,33 +44,160 @@ type Provider interface {
 	ListModels(ctx context.Context) ([]ModelInfo, error)
 }
 
+// DefaultModelProvider is implemented by the providers giving the model they use when LLMRequest.Model is empty,
+// as all the providers of this package do.
+type DefaultModelProvider interface {
+	DefaultModel() string
+}
+
+// requestModel returns the model req is sent to: req.Model, or else the default model of provider when known.
+func requestModel(provider Provider, req *LLMRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	if p, ok := provider.(DefaultModelProvider); ok {
+		return p.DefaultModel()
+	}
+	return ""
+}
+
+// DefaultModel returns the model used when LLMRequest.Model is empty.
+func (p *openAICompatibleProvider) DefaultModel() string { return p.Model }
+
+// DefaultModel returns the model used when LLMRequest.Model is empty.
+func (g *GeminiProvider) DefaultModel() string { return g.Model }
+
+// DefaultModel returns the model used when LLMRequest.Model is empty.
+func (o *OllamaProvider) DefaultModel() string { return o.Model }
+
+// DefaultModel returns the model used when LLMRequest.Model is empty.
+func (c *CohereProvider) DefaultModel() string { return c.Model }
+
 type ProviderConfig struct {
 	Kind    ProviderKind
 	BaseURL string
 	APIKey  string
 	Model   string
-	// Optional headers (e.g., OpenRouter: HTTP-Referer, X-Title)
+	// Optional headers (e.g., OpenRouter: HTTP-Referer, X-Title), merged over the "headers" of the provider
+	// in the model catalog (see ProviderModelsInfo.Headers)
 	ExtraHeaders map[string]string
 	// ProviderExtras for feature flags, timeouts, etc.
 	Extras map[string]any
+	// Timeout of the provider http.Client, it takes precedence over Extras["timeout"].
+	// Zero means Extras["timeout"] or else DefaultHTTPTimeout.
+	Timeout time.Duration
+	// Endpoint and ModelsEndpoint override the chat completions ("/chat/completions") and models list ("/models")
+	// paths of OpenAI-compatible providers, for gateways using non-standard paths like "/v1/chat".
+	// Empty means the default path.
+	Endpoint       string
+	ModelsEndpoint string
+	// HTTPClient, when not nil, is used as is by the provider (e.g. for a custom transport, proxy or TLS config),
+	// Timeout and Extras["timeout"] are then ignored. Nil means a default client is created.
+	HTTPClient *http.Client
+	// GzipRequests compresses the body of the non-streaming requests with Content-Encoding: gzip, it is opt-in
+	// since not all servers accept compressed requests. It can also be enabled with Extras["gzip_requests"] = true.
+	GzipRequests bool
+	// AuditLogger, when not nil, records every request and response of the provider, see AuditLogger.
+	AuditLogger AuditLogger
+	// OnRequest, when not nil, is called with every request before it is audited and sent by Query and Stream,
+	// e.g. to start a tracing span or to strip PII. It may modify the request, the caller then sees the changes.
+	OnRequest func(req *LLMRequest)
+	// OnResponse, when not nil, is called with the outcome of every Query and Stream, including the failed ones.
+	OnResponse func(resp *LLMResponse, err error)
+}
+
+// DefaultHTTPTimeout is the http.Client timeout of the providers when none is configured.
+// Note that it bounds the whole request, including reading a streamed response.
+const DefaultHTTPTimeout = 120 * time.Second
+
+// ProviderExtraTimeout is the ProviderConfig.Extras key holding the http.Client timeout,
+// as a time.Duration or a duration string like "5m".
+const ProviderExtraTimeout = "timeout"
+
+// ProviderExtraGzipRequests is the ProviderConfig.Extras key enabling the gzip compression of requests, see ProviderConfig.GzipRequests.
+const ProviderExtraGzipRequests = "gzip_requests"
+
+// ProviderExtraIncludeReasoning is the LLMRequest.ProviderExtras key asking, with a true bool, the providers
+// that only return the reasoning on demand to include it: Gemini (thinkingConfig.includeThoughts) and Ollama (think).
+// The OpenAI-compatible providers return it in LLMResponse.Reasoning whenever the model emits it.
+const ProviderExtraIncludeReasoning = "include_reasoning"
+
+// gzipRequestsFromConfig tells if the requests of the provider must be gzipped, from cfg.GzipRequests or Extras["gzip_requests"].
+func gzipRequestsFromConfig(cfg ProviderConfig) (bool, error) {
+	if cfg.GzipRequests {
+		return true, nil
+	}
+	return boolFromExtras(cfg.Extras, ProviderExtraGzipRequests, false)
+}
+
+// boolFromExtras returns the boolean flag key of the provider extras, defaultValue when missing.
+func boolFromExtras(extras map[string]any, key string, defaultValue bool) (bool, error) {
+	value, ok := extras[key]
+	if !ok || value == nil {
+		return defaultValue, nil
+	}
+	enabled, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("invalid %s: expected a bool, got %T", key, value)
+	}
+	return enabled, nil
+}
+
+// mergeHeaders returns the union of the header maps, the later maps taking precedence, nil when all are empty.
+func mergeHeaders(headerMaps ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, headerMap := range headerMaps {
+		for key, value := range headerMap {
+			if merged == nil {
+				merged = make(map[string]string)
+			}
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// setExtraHeaders sets the extra headers of the header maps on headers, the later maps taking precedence.
+func setExtraHeaders(headers http.Header, headerMaps ...map[string]string) {
+	for key, value := range mergeHeaders(headerMaps...) {
+		headers.Set(key, value)
+	}
+}
+
+// newHTTPClient returns cfg.HTTPClient when set, or creates the http.Client of a provider with the timeout configured in cfg.
+func newHTTPClient(cfg ProviderConfig) (*http.Client, error) {
+	if cfg.HTTPClient != nil {
+		return cfg.HTTPClient, nil
+	}
+	timeout := cfg.Timeout
+	if value, ok := cfg.Extras[ProviderExtraTimeout]; ok && timeout == 0 {
+		d, err := durationValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", ProviderExtraTimeout, err)
+		}
+		timeout = d
+	}
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &http.Client{Timeout: timeout}, nil
 }
 
 // NewProvider creates a new provider based on a given ProviderKind
 // Validates config and applies defaults.
 func NewProvider(kind ProviderKind, model string, l golog.MyLogger) (Provider, error) {
-	if kind == "" {
+	return NewProviderWithConfig(ProviderConfig{Kind: kind, Model: model}, l)
+}
+
+// NewProviderWithConfig is like NewProvider for a ProviderConfig, e.g. to set the Timeout of the http.Client
+// to the one of the requests when it exceeds DefaultHTTPTimeout. The empty APIKey and BaseURL are read from
+// the environment like NewProvider does, the other fields are used as is.
+func NewProviderWithConfig(cfg ProviderConfig, l golog.MyLogger) (Provider, error) {
+	if cfg.Kind == "" {
 		return nil, errors.New("provider kind cannot be empty")
 	}
-	if model == "" {
-		return nil, fmt.Errorf("model required for provider %q", kind)
-	}
-	cfg := ProviderConfig{
-		Kind:         kind,
-		BaseURL:      "",
-		APIKey:       "",
-		Model:        model,
-		ExtraHeaders: nil,
-		Extras:       nil,
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("model required for provider %q", cfg.Kind)
 	}
 
 	switch cfg.Kind {
@@ -72,7 +210,7 @@ func NewProvider(kind ProviderKind, model string, l golog.MyLogger) (Provider, e
 			l.Info("success retrieving OpenAI ApiKey")
 			cfg.APIKey = key
 		}
-		cfg.BaseURL = config.GetApiBase("OPENAI_API_BASE", "https://api.openai.com/v1", l)
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "OPENAI_API_BASE", "https://api.openai.com/v1", l)
 		return NewOpenAIAdapter(cfg, l)
 	case ProviderOpenRouter:
 		if cfg.APIKey == "" {
@@ -83,7 +221,7 @@ func NewProvider(kind ProviderKind, model string, l golog.MyLogger) (Provider, e
 			l.Info("success retrieving OpenRouter ApiKey")
 			cfg.APIKey = key
 		}
-		cfg.BaseURL = config.GetApiBase("OPENROUTER_API_BASE", "https://openrouter.ai/api/v1", l)
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "OPENROUTER_API_BASE", "https://openrouter.ai/api/v1", l)
 		return NewOpenRouterAdapter(cfg, l)
 
 	case ProviderGemini:
@@ -95,7 +233,7 @@ func NewProvider(kind ProviderKind, model string, l golog.MyLogger) (Provider, e
 			l.Info("success retrieving Gemini ApiKey")
 			cfg.APIKey = key
 		}
-		cfg.BaseURL = config.GetApiBase("GEMINI_API_BASE", "https://generativelanguage.googleapis.com", l)
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "GEMINI_API_BASE", "https://generativelanguage.googleapis.com", l)
 		return NewGeminiAdapter(cfg, l)
 	case ProviderXAI:
 		if cfg.APIKey == "" {
@@ -106,10 +244,79 @@ func NewProvider(kind ProviderKind, model string, l golog.MyLogger) (Provider, e
 			l.Info("success retrieving XAI ApiKey")
 			cfg.APIKey = key
 		}
-		cfg.BaseURL = config.GetApiBase("XAI_API_BASE", "https://api.x.ai/v1", l)
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "XAI_API_BASE", "https://api.x.ai/v1", l)
 		return newXaiAdapter(cfg, l) // if using OpenAI-compatible chat/completions semantics
+	case ProviderMistral:
+		if cfg.APIKey == "" {
+			key, err := config.GetMistralApiKey()
+			if err != nil {
+				return nil, err
+			}
+			l.Info("success retrieving Mistral ApiKey")
+			cfg.APIKey = key
+		}
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "MISTRAL_API_BASE", "https://api.mistral.ai/v1", l)
+		return NewMistralAdapter(cfg, l)
+	case ProviderDeepSeek:
+		if cfg.APIKey == "" {
+			key, err := config.GetDeepSeekApiKey()
+			if err != nil {
+				return nil, err
+			}
+			l.Info("success retrieving DeepSeek ApiKey")
+			cfg.APIKey = key
+		}
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "DEEPSEEK_API_BASE", "https://api.deepseek.com", l)
+		return NewDeepSeekAdapter(cfg, l)
+	case ProviderGroq:
+		if cfg.APIKey == "" {
+			key, err := config.GetGroqApiKey()
+			if err != nil {
+				return nil, err
+			}
+			l.Info("success retrieving Groq ApiKey")
+			cfg.APIKey = key
+		}
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "GROQ_API_BASE", "https://api.groq.com/openai/v1", l)
+		return NewGroqAdapter(cfg, l)
+	case ProviderAzureOpenAI:
+		if cfg.APIKey == "" {
+			key, err := config.GetAzureOpenAIApiKey()
+			if err != nil {
+				return nil, err
+			}
+			l.Info("success retrieving Azure OpenAI ApiKey")
+			cfg.APIKey = key
+		}
+		// the endpoint is specific to each Azure resource, there is no default
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "AZURE_OPENAI_ENDPOINT", "", l)
+		if cfg.BaseURL == "" {
+			return nil, errors.New("AZURE_OPENAI_ENDPOINT must be set to the endpoint of the Azure OpenAI resource")
+		}
+		if apiVersion := os.Getenv("AZURE_OPENAI_API_VERSION"); apiVersion != "" {
+			if _, ok := cfg.Extras[ProviderExtraAzureAPIVersion]; !ok {
+				extras := maps.Clone(cfg.Extras)
+				if extras == nil {
+					extras = map[string]any{}
+				}
+				extras[ProviderExtraAzureAPIVersion] = apiVersion
+				cfg.Extras = extras
+			}
+		}
+		return NewAzureOpenAIAdapter(cfg, l)
+	case ProviderCohere:
+		if cfg.APIKey == "" {
+			key, err := config.GetCohereApiKey()
+			if err != nil {
+				return nil, err
+			}
+			l.Info("success retrieving Cohere ApiKey")
+			cfg.APIKey = key
+		}
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "COHERE_API_BASE", "https://api.cohere.com", l)
+		return NewCohereAdapter(cfg, l)
 	case ProviderOllama:
-		cfg.BaseURL = config.GetApiBase("OLLAMA_API_BASE", "http://localhost:11434", l)
+		cfg.BaseURL = baseURLFromEnv(cfg.BaseURL, "OLLAMA_API_BASE", "http://localhost:11434", l)
 		return NewOllamaAdapter(cfg, l)
 
 	default:
@@ -117,11 +324,57 @@ func NewProvider(kind ProviderKind, model string, l golog.MyLogger) (Provider, e
 	}
 }
 
+// baseURLFromEnv returns baseURL when set, or else the base URL of the env variable envVar (see config.GetApiBase).
+func baseURLFromEnv(baseURL, envVar, defaultURL string, l golog.MyLogger) string {
+	if baseURL != "" {
+		return config.NormalizeBaseURL(baseURL)
+	}
+	return config.GetApiBase(envVar, defaultURL, l)
+}
+
 // IsLocalProvider checks if a provider doesn't need an explicit API key.
 func IsLocalProvider(kind ProviderKind) bool {
 	return kind == ProviderOllama
 }
 
+// ProviderKindFromBaseURL infers the provider kind from a base URL like https://api.openai.com/v1
+// by matching the known provider hosts. It returns false for unrecognized hosts or invalid URLs.
+func ProviderKindFromBaseURL(baseURL string) (ProviderKind, bool) {
+	u, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	isDomain := func(domain string) bool {
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	}
+	switch {
+	case isDomain("openai.azure.com"):
+		return ProviderAzureOpenAI, true
+	case isDomain("openai.com"):
+		return ProviderOpenAI, true
+	case isDomain("openrouter.ai"):
+		return ProviderOpenRouter, true
+	case isDomain("x.ai"):
+		return ProviderXAI, true
+	case isDomain("mistral.ai"):
+		return ProviderMistral, true
+	case isDomain("deepseek.com"):
+		return ProviderDeepSeek, true
+	case isDomain("groq.com"):
+		return ProviderGroq, true
+	case isDomain("cohere.com"), isDomain("cohere.ai"):
+		return ProviderCohere, true
+	case isDomain("googleapis.com"):
+		return ProviderGemini, true
+	case u.Port() == "11434":
+		// default port of a local or remote Ollama server
+		return ProviderOllama, true
+	default:
+		return "", false
+	}
+}
+
 func GetProviderKindAndDefaultModel(kind string) (p ProviderKind, defaultModel string, err error) {
 	switch kind {
 	case "ollama":
@@ -136,6 +389,17 @@ func GetProviderKindAndDefaultModel(kind string) (p ProviderKind, defaultModel s
 		return ProviderOpenAI, "gpt-4o-mini", nil
 	case "openrouter":
 		return ProviderOpenRouter, "qwen/qwen3-4b:free", nil
+	case "mistral":
+		return ProviderMistral, "mistral-small-latest", nil
+	case "deepseek":
+		return ProviderDeepSeek, "deepseek-chat", nil
+	case "groq":
+		return ProviderGroq, "llama-3.3-70b-versatile", nil
+	case "azure", "azureopenai":
+		// the model is the name of the Azure deployment, usually named after its model
+		return ProviderAzureOpenAI, "gpt-4o-mini", nil
+	case "cohere":
+		return ProviderCohere, "command-r-plus", nil
 
 	default:
 		return "", "", fmt.Errorf("provider kind %s is not available", kind)
@@ -57,6 +57,8 @@ func TestAllProvidersIntegration(t *testing.T) {
 		{"openai", "gpt-test", "Mock response for OpenAI-compatible API"},
 		{"openrouter", "router-test", "Mock response for OpenAI-compatible API"},
 		{"xai", "grok-test", "Mock response for OpenAI-compatible API"},
+		{"mistral", "mistral-test", "Mock response for OpenAI-compatible API"},
+		{"deepseek", "deepseek-test", "Mock response for OpenAI-compatible API"},
 		{"ollama", "ollama-test", "Mock response for Ollama"},
 		{"gemini", "gemini-test", "Mock response for Gemini"},
 	}
@@ -86,6 +88,10 @@ func TestAllProvidersIntegration(t *testing.T) {
 				provider, err = NewOpenRouterAdapter(cfg, l)
 			case ProviderXAI:
 				provider, err = newXaiAdapter(cfg, l)
+			case ProviderMistral:
+				provider, err = NewMistralAdapter(cfg, l)
+			case ProviderDeepSeek:
+				provider, err = NewDeepSeekAdapter(cfg, l)
 			case ProviderOllama:
 				provider, err = NewOllamaAdapter(cfg, l)
 			case ProviderGemini:
@@ -1,12 +1,21 @@
 package llm
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
 )
@@ -26,6 +35,11 @@ func TestGetProviderKindAndDefaultModel(t *testing.T) {
 		{"XAI", "xai", ProviderXAI, "grok-3-mini", false},
 		{"OpenAI", "openai", ProviderOpenAI, "gpt-4o-mini", false},
 		{"OpenRouter", "openrouter", ProviderOpenRouter, "qwen/qwen3-4b:free", false},
+		{"Mistral", "mistral", ProviderMistral, "mistral-small-latest", false},
+		{"DeepSeek", "deepseek", ProviderDeepSeek, "deepseek-chat", false},
+		{"Groq", "groq", ProviderGroq, "llama-3.3-70b-versatile", false},
+		{"Cohere", "cohere", ProviderCohere, "command-r-plus", false},
+		{"AzureOpenAI", "azure", ProviderAzureOpenAI, "gpt-4o-mini", false},
 		{"Invalid", "invalid-provider", "", "", true},
 	}
 
@@ -200,3 +214,335 @@ func init() {
 		}
 	}
 }
+
+// countingProvider is a fake Provider counting the calls to ListModels.
+type countingProvider struct {
+	mu        sync.Mutex
+	listCalls int
+}
+
+func (p *countingProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return &LLMResponse{Text: "ok"}, nil
+}
+
+func (p *countingProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	return &LLMResponse{Text: "ok"}, nil
+}
+
+func (p *countingProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listCalls++
+	time.Sleep(10 * time.Millisecond)
+	return []ModelInfo{{Name: "model-a"}, {Name: "model-b"}}, nil
+}
+
+func TestModelsListCache(t *testing.T) {
+	nullLogger, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &countingProvider{}
+	cache := NewModelsListCache(time.Minute)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			names, err := cache.Get(context.Background(), nullLogger, provider, false)
+			if err != nil || len(names) != 2 {
+				t.Errorf("Unexpected result: %v, %v", names, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if provider.listCalls != 1 {
+		t.Errorf("Expected concurrent calls to share a single fetch, got %d ListModels calls", provider.listCalls)
+	}
+
+	if _, err := cache.Get(context.Background(), nullLogger, provider, true); err != nil {
+		t.Fatalf("Get with refresh failed: %v", err)
+	}
+	if provider.listCalls != 2 {
+		t.Errorf("Expected refresh to fetch again, got %d ListModels calls", provider.listCalls)
+	}
+
+	expiring := NewModelsListCache(time.Nanosecond)
+	expiring.Get(context.Background(), nullLogger, provider, false)
+	time.Sleep(time.Millisecond)
+	expiring.Get(context.Background(), nullLogger, provider, false)
+	if provider.listCalls != 4 {
+		t.Errorf("Expected an expired entry to be fetched again, got %d ListModels calls", provider.listCalls)
+	}
+}
+
+func TestModelsListCacheKey(t *testing.T) {
+	openAI := &openAICompatibleProvider{Kind: ProviderMistral, BaseURL: "https://api.mistral.ai/v1", APIKey: "key-a"}
+	tests := []struct {
+		name      string
+		a, b      Provider
+		wantEqual bool
+	}{
+		{"SameAccount", openAI, &openAICompatibleProvider{Kind: ProviderMistral, BaseURL: "https://api.mistral.ai/v1", APIKey: "key-a"}, true},
+		{"OtherAPIKey", openAI, &openAICompatibleProvider{Kind: ProviderMistral, BaseURL: "https://api.mistral.ai/v1", APIKey: "key-b"}, false},
+		{"MistralLikeItsOpenAIProvider", &MistralProvider{openAI}, &MistralProvider{&openAICompatibleProvider{Kind: ProviderMistral, BaseURL: "https://api.mistral.ai/v1", APIKey: "key-a"}}, true},
+		{"MistralOtherAPIKey", &MistralProvider{openAI}, &MistralProvider{&openAICompatibleProvider{Kind: ProviderMistral, BaseURL: "https://api.mistral.ai/v1", APIKey: "key-b"}}, false},
+		{"CohereInstances", &CohereProvider{BaseURL: "https://api.cohere.com", APIKey: "key-a"}, &CohereProvider{BaseURL: "https://api.cohere.com", APIKey: "key-a"}, true},
+		{"CohereOtherAPIKey", &CohereProvider{BaseURL: "https://api.cohere.com", APIKey: "key-a"}, &CohereProvider{BaseURL: "https://api.cohere.com", APIKey: "key-b"}, false},
+		{"GeminiOtherAPIKey", &GeminiProvider{BaseURL: "https://gemini", APIKey: "key-a"}, &GeminiProvider{BaseURL: "https://gemini", APIKey: "key-b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := modelsListCacheKey(tt.a), modelsListCacheKey(tt.b)
+			if (a == b) != tt.wantEqual {
+				t.Errorf("Expected equal keys to be %t, got %q and %q", tt.wantEqual, a, b)
+			}
+			if strings.Contains(a, "key-a") {
+				t.Errorf("Expected the API key not to appear in the cache key, got %q", a)
+			}
+		})
+	}
+}
+
+func TestCachedProvider(t *testing.T) {
+	nullLogger, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintln(w, `{"models":[{"name":"qwen3:latest"}]}`)
+	}))
+	defer server.Close()
+
+	// two instances pointing to the same base URL share the cache entry
+	first := NewCachedProvider(&OllamaProvider{BaseURL: server.URL, Client: server.Client(), l: nullLogger}, time.Minute, nullLogger)
+	second := &CachedProvider{Provider: &OllamaProvider{BaseURL: server.URL, Client: server.Client(), l: nullLogger}, cache: first.cache, l: nullLogger}
+	for _, p := range []Provider{first, second, first} {
+		models, err := p.ListModels(context.Background())
+		if err != nil || len(models) != 1 || models[0].Name != "qwen3:latest" {
+			t.Fatalf("Unexpected models: %v (err: %v)", models, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected a single fetch for the same kind and base URL, got %d", calls)
+	}
+
+	if _, ok := Provider(first).(Embedder); !ok {
+		t.Error("Expected CachedProvider to still be an Embedder")
+	}
+}
+
+func TestAdaptersNormalizeBaseURL(t *testing.T) {
+	nullLogger, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	cfg := ProviderConfig{Model: "test-model", APIKey: "dummy-key-for-testing-with-sufficient-length"}
+
+	cfg.BaseURL = "https://api.openai.com/v1/"
+	p, err := NewOpenAIAdapter(cfg, nullLogger)
+	if err != nil {
+		t.Fatalf("NewOpenAIAdapter failed: %v", err)
+	}
+	if got := p.(*openAICompatibleProvider).BaseURL; got != "https://api.openai.com/v1" {
+		t.Errorf("Expected trailing slash to be trimmed, got '%s'", got)
+	}
+
+	cfg.BaseURL = "http://localhost:11434/"
+	o, err := NewOllamaAdapter(cfg, nullLogger)
+	if err != nil {
+		t.Fatalf("NewOllamaAdapter failed: %v", err)
+	}
+	if got := o.(*OllamaProvider).BaseURL; got != "http://localhost:11434" {
+		t.Errorf("Expected trailing slash to be trimmed, got '%s'", got)
+	}
+}
+
+func TestAdaptersHTTPTimeout(t *testing.T) {
+	nullLogger, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	testCases := []struct {
+		name string
+		cfg  ProviderConfig
+		want time.Duration
+	}{
+		{"Default", ProviderConfig{}, DefaultHTTPTimeout},
+		{"Extras", ProviderConfig{Extras: map[string]any{ProviderExtraTimeout: "5m"}}, 5 * time.Minute},
+		{"FieldWins", ProviderConfig{Timeout: time.Minute, Extras: map[string]any{ProviderExtraTimeout: "5m"}}, time.Minute},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.Model, cfg.APIKey, cfg.BaseURL = "test-model", "dummy-key-for-testing-with-sufficient-length", "http://localhost:11434"
+			p, err := NewOpenAIAdapter(cfg, nullLogger)
+			if err != nil {
+				t.Fatalf("NewOpenAIAdapter failed: %v", err)
+			}
+			if got := p.(*openAICompatibleProvider).Client.Timeout; got != tc.want {
+				t.Errorf("Expected OpenAI client timeout %s, got %s", tc.want, got)
+			}
+			g, err := NewGeminiAdapter(cfg, nullLogger)
+			if err != nil {
+				t.Fatalf("NewGeminiAdapter failed: %v", err)
+			}
+			if got := g.(*GeminiProvider).Client.Timeout; got != tc.want {
+				t.Errorf("Expected Gemini client timeout %s, got %s", tc.want, got)
+			}
+			o, err := NewOllamaAdapter(cfg, nullLogger)
+			if err != nil {
+				t.Fatalf("NewOllamaAdapter failed: %v", err)
+			}
+			if got := o.(*OllamaProvider).Client.Timeout; got != tc.want {
+				t.Errorf("Expected Ollama client timeout %s, got %s", tc.want, got)
+			}
+		})
+	}
+
+	_, err := NewOllamaAdapter(ProviderConfig{Model: "m", BaseURL: "http://localhost:11434", Extras: map[string]any{ProviderExtraTimeout: 42}}, nullLogger)
+	if err == nil {
+		t.Error("Expected error for an invalid timeout, got nil")
+	}
+}
+
+func TestNewProviderWithConfig(t *testing.T) {
+	nullLogger, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	p, err := NewProviderWithConfig(ProviderConfig{Kind: ProviderOllama, Model: "qwen3:latest", BaseURL: "http://gpu-box:11434/", Timeout: 5 * time.Minute}, nullLogger)
+	if err != nil {
+		t.Fatalf("NewProviderWithConfig failed: %v", err)
+	}
+	o := p.(*OllamaProvider)
+	if o.Client.Timeout != 5*time.Minute {
+		t.Errorf("Expected client timeout 5m0s, got %s", o.Client.Timeout)
+	}
+	if o.BaseURL != "http://gpu-box:11434" {
+		t.Errorf("Expected the configured base URL, got '%s'", o.BaseURL)
+	}
+	if _, err := NewProviderWithConfig(ProviderConfig{Kind: ProviderOllama}, nullLogger); err == nil {
+		t.Error("Expected error for a missing model, got nil")
+	}
+}
+
+func TestAdaptersCustomHTTPClient(t *testing.T) {
+	nullLogger, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	client := &http.Client{}
+	cfg := ProviderConfig{
+		Model:      "test-model",
+		APIKey:     "dummy-key-for-testing-with-sufficient-length",
+		BaseURL:    "http://localhost:11434",
+		HTTPClient: client,
+		Timeout:    time.Minute,
+	}
+	p, err := NewOpenAICompatAdapter(cfg, ProviderOpenAI, "", nullLogger)
+	if err != nil || p.(*openAICompatibleProvider).Client != client {
+		t.Errorf("Expected NewOpenAICompatAdapter to use the given client (err: %v)", err)
+	}
+	g, err := NewGeminiAdapter(cfg, nullLogger)
+	if err != nil || g.(*GeminiProvider).Client != client {
+		t.Errorf("Expected NewGeminiAdapter to use the given client (err: %v)", err)
+	}
+	o, err := NewOllamaAdapter(cfg, nullLogger)
+	if err != nil || o.(*OllamaProvider).Client != client {
+		t.Errorf("Expected NewOllamaAdapter to use the given client (err: %v)", err)
+	}
+}
+
+func TestQueryWithCapabilities(t *testing.T) {
+	nullLogger, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	var queriedModel string
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"models":[{"name":"tinyllama:latest"},{"name":"qwen3:latest"}]}`)
+	})
+	handler.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		queriedModel, _ = body["model"].(string)
+		fmt.Fprintln(w, `{"message": {"role": "assistant", "content": "Mock response for Ollama"}, "done": true}`)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// only the local Ollama provider is configured
+	t.Setenv("OLLAMA_API_BASE", server.URL)
+	for _, env := range []string{"OPENAI_API_KEY", "GEMINI_API_KEY", "XAI_API_KEY", "OPENROUTER_API_KEY"} {
+		t.Setenv(env, "")
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Ping"}}}
+
+	resp, err := QueryWithCapabilities(context.Background(), req, Capabilities{Tools: true}, nullLogger)
+	if err != nil {
+		t.Fatalf("QueryWithCapabilities failed: %v", err)
+	}
+	if resp.Text != "Mock response for Ollama" || queriedModel != "qwen3:latest" {
+		t.Errorf("Expected the tools capable model to be queried, got model %q and text %q", queriedModel, resp.Text)
+	}
+
+	_, err = QueryWithCapabilities(context.Background(), req, Capabilities{Tools: true, InputImage: true}, nullLogger)
+	if err == nil || !strings.Contains(err.Error(), "input_image") || strings.Contains(err.Error(), "tools") {
+		t.Errorf("Expected an error listing only input_image as unsatisfied, got %v", err)
+	}
+}
+
+func TestProviderKindFromBaseURL(t *testing.T) {
+	testCases := []struct {
+		baseURL      string
+		expectedKind ProviderKind
+		expectedOk   bool
+	}{
+		{"https://api.openai.com/v1", ProviderOpenAI, true},
+		{"https://openrouter.ai/api/v1", ProviderOpenRouter, true},
+		{"https://api.x.ai/v1/", ProviderXAI, true},
+		{"https://api.mistral.ai/v1", ProviderMistral, true},
+		{"https://api.deepseek.com", ProviderDeepSeek, true},
+		{"https://api.groq.com/openai/v1", ProviderGroq, true},
+		{"https://api.cohere.com", ProviderCohere, true},
+		{"https://my-resource.openai.azure.com", ProviderAzureOpenAI, true},
+		{"https://generativelanguage.googleapis.com", ProviderGemini, true},
+		{"http://localhost:11434", ProviderOllama, true},
+		{"http://gpu-server.lan:11434/", ProviderOllama, true},
+		{"https://notopenai.com/v1", "", false},
+		{"https://example.com", "", false},
+		{"not a url", "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.baseURL, func(t *testing.T) {
+			kind, ok := ProviderKindFromBaseURL(tc.baseURL)
+			if kind != tc.expectedKind || ok != tc.expectedOk {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tc.expectedKind, tc.expectedOk, kind, ok)
+			}
+		})
+	}
+}
+
+func TestSampleModels(t *testing.T) {
+	models := []ModelInfo{{Name: "a"}, {Name: "b", Priority: 1000}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	t.Run("ReturnsAllWhenNotSampling", func(t *testing.T) {
+		for _, n := range []int{0, -1, 5, 10} {
+			if got := SampleModels(models, n, false, rand.New(rand.NewPCG(1, 1))); len(got) != len(models) {
+				t.Errorf("Expected %d models for n=%d, got %d", len(models), n, len(got))
+			}
+		}
+	})
+
+	t.Run("ReproducibleWithSeed", func(t *testing.T) {
+		first := SampleModels(models, 3, false, rand.New(rand.NewPCG(42, 42)))
+		second := SampleModels(models, 3, false, rand.New(rand.NewPCG(42, 42)))
+		if len(first) != 3 || !slices.Equal(first, second) {
+			t.Errorf("Expected the same 3 models with the same seed, got %v and %v", first, second)
+		}
+		seen := map[string]bool{}
+		for _, m := range first {
+			if seen[m.Name] {
+				t.Errorf("Model %s sampled twice", m.Name)
+			}
+			seen[m.Name] = true
+		}
+	})
+
+	t.Run("WeightedFavorsPriority", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(7, 7))
+		hits := 0
+		for range 100 {
+			if got := SampleModels(models, 1, true, rng); got[0].Name == "b" {
+				hits++
+			}
+		}
+		if hits < 90 {
+			t.Errorf("Expected the high priority model to be picked most of the time, got %d/100", hits)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxRAGDocuments is the maximum number of documents injected by BuildRAGMessages, extra ones are dropped.
+	MaxRAGDocuments = 20
+	// MaxRAGDocumentChars is the maximum size in characters of a single document, longer ones are truncated.
+	MaxRAGDocumentChars = 8000
+	// MaxRAGContextChars is the maximum total size in characters of the documents context block.
+	MaxRAGContextChars = 48000
+
+	ragTruncatedMarker = "\n[...truncated]"
+)
+
+// BuildRAGMessages builds the system and user messages for a simple retrieval augmented generation request.
+// The retrieved docs are placed in a delimited context block, each one prefixed by its source index [n]
+// so the model can cite them. Empty documents are skipped, and the number and size of the documents
+// are capped by MaxRAGDocuments, MaxRAGDocumentChars and MaxRAGContextChars to avoid blowing the context window.
+func BuildRAGMessages(systemPrompt, question string, docs []string) []LLMMessage {
+	var sb strings.Builder
+	if len(docs) > 0 {
+		sb.WriteString("Use the following documents to answer the question. ")
+		sb.WriteString("Cite the documents you use by their source index, e.g. [1]. ")
+		sb.WriteString("If the documents do not contain the answer, say so.\n\n")
+		sb.WriteString("<documents>\n")
+		total, index := 0, 0
+		for _, doc := range docs {
+			doc = strings.TrimSpace(doc)
+			if doc == "" {
+				continue
+			}
+			if index >= MaxRAGDocuments || total >= MaxRAGContextChars {
+				break
+			}
+			doc = truncateChars(doc, min(MaxRAGDocumentChars, MaxRAGContextChars-total))
+			total += utf8.RuneCountInString(doc)
+			index++
+			fmt.Fprintf(&sb, "<document source=\"[%d]\">\n%s\n</document>\n", index, doc)
+		}
+		sb.WriteString("</documents>\n\n")
+	}
+	sb.WriteString("Question: ")
+	sb.WriteString(question)
+
+	msgs := make([]LLMMessage, 0, 2)
+	if systemPrompt != "" {
+		msgs = append(msgs, LLMMessage{Role: RoleSystem, Content: systemPrompt})
+	}
+	return append(msgs, LLMMessage{Role: RoleUser, Content: sb.String()})
+}
+
+// truncateChars shortens s to at most maxChars characters, adding a marker when something was cut.
+func truncateChars(s string, maxChars int) string {
+	if utf8.RuneCountInString(s) <= maxChars {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxChars]) + ragTruncatedMarker
+}
@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuildRAGMessages(t *testing.T) {
+	t.Run("FormatsDocumentsWithSourceIndices", func(t *testing.T) {
+		msgs := BuildRAGMessages("You are a librarian.", "Who wrote it?", []string{"first doc", "", "second doc"})
+		if len(msgs) != 2 || msgs[0].Role != RoleSystem || msgs[1].Role != RoleUser {
+			t.Fatalf("Expected a system and a user message, got %#v", msgs)
+		}
+		user := msgs[1].Content
+		for _, want := range []string{"<documents>", `source="[1]"`, "first doc", `source="[2]"`, "second doc", "Question: Who wrote it?"} {
+			if !strings.Contains(user, want) {
+				t.Errorf("Expected user message to contain %q, got:\n%s", want, user)
+			}
+		}
+		if strings.Contains(user, `source="[3]"`) {
+			t.Error("Expected empty documents to be skipped")
+		}
+	})
+
+	t.Run("AppliesGuards", func(t *testing.T) {
+		docs := make([]string, MaxRAGDocuments+5)
+		for i := range docs {
+			docs[i] = fmt.Sprintf("doc %d", i)
+		}
+		docs[0] = strings.Repeat("x", MaxRAGDocumentChars+100)
+		user := BuildRAGMessages("", "q", docs)[0].Content
+		if strings.Contains(user, fmt.Sprintf(`source="[%d]"`, MaxRAGDocuments+1)) {
+			t.Errorf("Expected at most %d documents", MaxRAGDocuments)
+		}
+		if !strings.Contains(user, ragTruncatedMarker) {
+			t.Error("Expected the oversized document to be truncated")
+		}
+	})
+}
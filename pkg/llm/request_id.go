@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// contextKey is the type of the context keys of the package, to avoid collisions with other packages.
+type contextKey string
+
+// RequestIDKey is the context key of the correlation ID of a call, set it with WithRequestID.
+// The providers include it in their log lines and send it in the RequestIDHeader of their HTTP requests.
+const RequestIDKey contextKey = "request_id"
+
+// RequestIDHeader is the outbound header carrying the request ID found in the context.
+const RequestIDHeader = "X-Request-ID"
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "" when there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// newHTTPRequest creates a request bound to ctx with a copy of header (which can be nil),
+// and the RequestIDHeader set when ctx carries a request ID.
+func newHTTPRequest(ctx context.Context, method, url string, header http.Header, body io.Reader) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		httpReq.Header = header.Clone()
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		httpReq.Header.Set(RequestIDHeader, id)
+	}
+	return httpReq, nil
+}
+
+// contextLogger returns l prefixing its lines with the request ID carried by ctx, or l itself when there is none.
+func contextLogger(ctx context.Context, l golog.MyLogger) golog.MyLogger {
+	id := RequestIDFromContext(ctx)
+	if id == "" {
+		return l
+	}
+	// the prefix is part of the format string, so a % of the ID must be escaped
+	return &prefixLogger{MyLogger: l, prefix: "[request_id=" + strings.ReplaceAll(id, "%", "%%") + "] "}
+}
+
+// prefixLogger is a golog.MyLogger prefixing all its lines.
+type prefixLogger struct {
+	golog.MyLogger
+	prefix string
+}
+
+func (p *prefixLogger) Debug(msg string, v ...any) { p.MyLogger.Debug(p.prefix+msg, v...) }
+func (p *prefixLogger) Info(msg string, v ...any)  { p.MyLogger.Info(p.prefix+msg, v...) }
+func (p *prefixLogger) Warn(msg string, v ...any)  { p.MyLogger.Warn(p.prefix+msg, v...) }
+func (p *prefixLogger) Error(msg string, v ...any) { p.MyLogger.Error(p.prefix+msg, v...) }
+func (p *prefixLogger) Fatal(msg string, v ...any) { p.MyLogger.Fatal(p.prefix+msg, v...) }
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	var headers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get(RequestIDHeader))
+		if r.Header.Get("Accept") == "text/event-stream" {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"choices": [{"message": {"content": "Hi"}}]}`)
+	}))
+	defer server.Close()
+
+	logs := &bytes.Buffer{}
+	l, _ := golog.NewLogger("simple", logs, golog.DebugLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	ctx := WithRequestID(context.Background(), "req-42")
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}
+	if _, err := provider.Query(ctx, req); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if _, err := provider.Stream(ctx, req, func(Delta) {}); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if _, err := provider.Query(context.Background(), req); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(headers) != 3 || headers[0] != "req-42" || headers[1] != "req-42" || headers[2] != "" {
+		t.Errorf("Expected the %s header only for the calls with a request ID, got %q", RequestIDHeader, headers)
+	}
+	if !strings.Contains(logs.String(), "[request_id=req-42] ") {
+		t.Errorf("Expected the request ID in the log lines, got:\n%s", logs.String())
+	}
+	if RequestIDFromContext(context.Background()) != "" {
+		t.Error("Expected no request ID in an empty context")
+	}
+}
@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ProviderExtraRetryPolicy is the ProviderConfig.Extras key holding the RetryPolicy of a provider.
+// The value can be a RetryPolicy (or a pointer to it) or a map[string]any with the keys
+// max_retries (number), base_delay and max_delay (duration strings like "500ms") and jitter (a JitterStrategy).
+const ProviderExtraRetryPolicy = "retry_policy"
+
+// RetryPolicy controls how HTTP requests are retried on transient failures (429, 500, 502, 503, 504 and 529).
+// The delay before retry n (starting at 0) is BaseDelay * 2^n capped by MaxDelay, randomized as set by Jitter,
+// unless the server sends a Retry-After header which is then honored (still capped by MaxDelay).
+// A zero RetryPolicy disables retries.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	// Jitter randomizes the delays so that many clients failing together don't retry together, JitterFull when empty
+	Jitter JitterStrategy
+}
+
+// JitterStrategy is the randomization of the retry delays,
+// see https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+type JitterStrategy string
+
+const (
+	// JitterFull waits a random delay between 0 and the exponential delay, spreading the retries the most.
+	JitterFull JitterStrategy = "full"
+	// JitterEqual keeps half of the exponential delay and randomizes the other half.
+	JitterEqual JitterStrategy = "equal"
+	// JitterDecorrelated waits a random delay between BaseDelay and 3 times the previous delay, capped by MaxDelay.
+	JitterDecorrelated JitterStrategy = "decorrelated"
+	// JitterNone waits exactly the exponential delay.
+	JitterNone JitterStrategy = "none"
+)
+
+// Validate checks that s is a known jitter strategy, the empty one being JitterFull.
+func (s JitterStrategy) Validate() error {
+	switch s {
+	case "", JitterFull, JitterEqual, JitterDecorrelated, JitterNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid jitter strategy %q (accepted: full, equal, decorrelated, none)", s)
+	}
+}
+
+// DefaultRetryPolicy is used when no retry policy is configured.
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// isRetryableStatus tells if a response status is worth retrying, client errors like 400 or 401 are not.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, statusOverloaded:
+		return true
+	default:
+		return false
+	}
+}
+
+// delay returns the wait before the retry number attempt (starting at 0), honoring retryAfter when set.
+// previous is the wait before the previous retry, used by JitterDecorrelated.
+func (p RetryPolicy) delay(attempt int, previous time.Duration, retryAfter string) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if d, ok := parseRetryAfter(retryAfter); ok {
+		return min(d, maxDelay)
+	}
+	if p.Jitter == JitterDecorrelated && p.BaseDelay > 0 {
+		upper := min(max(previous, p.BaseDelay)*3, maxDelay)
+		if upper <= p.BaseDelay {
+			return upper
+		}
+		return p.BaseDelay + rand.N(upper-p.BaseDelay+1)
+	}
+	d := p.BaseDelay << attempt
+	if d <= 0 || d > maxDelay { // d <= 0 on overflow
+		d = maxDelay
+	}
+	switch p.Jitter {
+	case JitterNone:
+		return d
+	case JitterEqual:
+		half := d / 2
+		return half + rand.N(half+1)
+	default:
+		return rand.N(d + 1)
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// retryPolicyFromExtras returns the retry policy configured in the provider extras, or DefaultRetryPolicy.
+func retryPolicyFromExtras(extras map[string]any) (RetryPolicy, error) {
+	value, ok := extras[ProviderExtraRetryPolicy]
+	if !ok || value == nil {
+		return DefaultRetryPolicy, nil
+	}
+	switch v := value.(type) {
+	case RetryPolicy:
+		return v, v.Jitter.Validate()
+	case *RetryPolicy:
+		return *v, v.Jitter.Validate()
+	case map[string]any:
+		policy := DefaultRetryPolicy
+		for key, val := range v {
+			var err error
+			switch key {
+			case "max_retries":
+				switch n := val.(type) {
+				case int:
+					policy.MaxRetries = n
+				case float64:
+					policy.MaxRetries = int(n)
+				default:
+					err = fmt.Errorf("expected a number, got %T", val)
+				}
+			case "base_delay":
+				policy.BaseDelay, err = durationValue(val)
+			case "max_delay":
+				policy.MaxDelay, err = durationValue(val)
+			case "jitter":
+				s, ok := val.(string)
+				if !ok {
+					err = fmt.Errorf("expected a string, got %T", val)
+					break
+				}
+				policy.Jitter = JitterStrategy(s)
+				err = policy.Jitter.Validate()
+			default:
+				err = fmt.Errorf("unknown key")
+			}
+			if err != nil {
+				return RetryPolicy{}, fmt.Errorf("invalid %s %q: %w", ProviderExtraRetryPolicy, key, err)
+			}
+		}
+		return policy, nil
+	default:
+		return RetryPolicy{}, fmt.Errorf("invalid %s: unsupported type %T", ProviderExtraRetryPolicy, value)
+	}
+}
+
+// durationValue converts a time.Duration or a duration string like "500ms".
+func durationValue(val any) (time.Duration, error) {
+	switch d := val.(type) {
+	case time.Duration:
+		return d, nil
+	case string:
+		return time.ParseDuration(d)
+	default:
+		return 0, fmt.Errorf("expected a duration, got %T", val)
+	}
+}
+
+// sleepContext waits for d or until ctx is done, in which case it returns the context error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestHttpRequestWithRetry(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	type reply struct {
+		OK bool `json:"ok"`
+	}
+	// newServer answers with the given statuses in turn, then 200
+	newServer := func(statuses ...int) (*httptest.Server, *int) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls <= len(statuses) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(statuses[calls-1])
+				fmt.Fprintf(w, `{"error": "attempt %d"}`, calls)
+				return
+			}
+			fmt.Fprint(w, `{"ok": true}`)
+		}))
+		return server, &calls
+	}
+
+	t.Run("RetriesTransientErrors", func(t *testing.T) {
+		server, calls := newServer(http.StatusTooManyRequests, http.StatusServiceUnavailable, statusOverloaded)
+		defer server.Close()
+		resp, _, err := HttpRequestWithRetry[map[string]any, reply](context.Background(), server.Client(), server.URL, http.Header{}, map[string]any{}, policy, l)
+		if err != nil {
+			t.Fatalf("Expected success after retries, got %v", err)
+		}
+		if !resp.OK || *calls != 4 {
+			t.Errorf("Expected 4 calls and a successful reply, got %d calls and %#v", *calls, resp)
+		}
+	})
+
+	t.Run("DoesNotRetryClientErrors", func(t *testing.T) {
+		server, calls := newServer(http.StatusUnauthorized)
+		defer server.Close()
+		_, body, err := HttpRequestWithRetry[map[string]any, reply](context.Background(), server.Client(), server.URL, http.Header{}, map[string]any{}, policy, l)
+		if err == nil || *calls != 1 {
+			t.Fatalf("Expected a single failing call, got %d calls and err %v", *calls, err)
+		}
+		if !strings.Contains(err.Error(), "attempt 1") || !strings.Contains(string(body), "attempt 1") {
+			t.Errorf("Expected the response body in the error, got %v", err)
+		}
+	})
+
+	t.Run("GivesUpAfterMaxRetries", func(t *testing.T) {
+		server, calls := newServer(500, 502, 503, 504, 503)
+		defer server.Close()
+		_, err := httpGetRequest[reply](context.Background(), server.Client(), server.URL, http.Header{}, policy, l)
+		if err == nil || *calls != 4 {
+			t.Fatalf("Expected 4 failing calls, got %d calls and err %v", *calls, err)
+		}
+		if !strings.Contains(err.Error(), "attempt 4") {
+			t.Errorf("Expected the last attempt body in the error, got %v", err)
+		}
+	})
+
+	t.Run("StopsOnContextCancel", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		slowPolicy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+		start := time.Now()
+		_, _, err := HttpRequestWithRetry[map[string]any, reply](ctx, server.Client(), server.URL, http.Header{}, map[string]any{}, slowPolicy, l)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+		if !IsRateLimited(err) {
+			t.Errorf("Expected the status of the last response to be kept, got %v", err)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Errorf("Expected the retry wait to be interrupted by the context")
+		}
+	})
+}
+
+func TestRetryPolicyFromExtras(t *testing.T) {
+	policy, err := retryPolicyFromExtras(nil)
+	if err != nil || policy != DefaultRetryPolicy {
+		t.Errorf("Expected the default policy, got %#v (err: %v)", policy, err)
+	}
+	policy, err = retryPolicyFromExtras(map[string]any{ProviderExtraRetryPolicy: map[string]any{"max_retries": 5.0, "base_delay": "100ms"}})
+	if err != nil || policy.MaxRetries != 5 || policy.BaseDelay != 100*time.Millisecond || policy.MaxDelay != DefaultRetryPolicy.MaxDelay {
+		t.Errorf("Unexpected policy %#v (err: %v)", policy, err)
+	}
+	if _, err = retryPolicyFromExtras(map[string]any{ProviderExtraRetryPolicy: map[string]any{"retries": 5}}); err == nil {
+		t.Error("Expected error for an unknown key, got nil")
+	}
+	policy, err = retryPolicyFromExtras(map[string]any{ProviderExtraRetryPolicy: map[string]any{"jitter": "decorrelated"}})
+	if err != nil || policy.Jitter != JitterDecorrelated {
+		t.Errorf("Expected the decorrelated jitter, got %#v (err: %v)", policy, err)
+	}
+	for _, invalid := range []any{map[string]any{"jitter": "random"}, RetryPolicy{Jitter: "random"}} {
+		if _, err = retryPolicyFromExtras(map[string]any{ProviderExtraRetryPolicy: invalid}); err == nil {
+			t.Errorf("Expected error for an unknown jitter strategy in %#v, got nil", invalid)
+		}
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	const base, maxDelay = 100 * time.Millisecond, 2 * time.Second
+	tests := []struct {
+		jitter JitterStrategy
+		// bounds returns the accepted delay range of attempt, exp being the capped exponential delay
+		bounds func(exp, previous time.Duration) (time.Duration, time.Duration)
+	}{
+		{"", func(exp, _ time.Duration) (time.Duration, time.Duration) { return 0, exp }},
+		{JitterFull, func(exp, _ time.Duration) (time.Duration, time.Duration) { return 0, exp }},
+		{JitterEqual, func(exp, _ time.Duration) (time.Duration, time.Duration) { return exp / 2, exp }},
+		{JitterNone, func(exp, _ time.Duration) (time.Duration, time.Duration) { return exp, exp }},
+		{JitterDecorrelated, func(_, previous time.Duration) (time.Duration, time.Duration) {
+			return base, min(max(previous, base)*3, maxDelay)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(FirstNonEmpty(string(tt.jitter), "default"), func(t *testing.T) {
+			policy := RetryPolicy{MaxRetries: 8, BaseDelay: base, MaxDelay: maxDelay, Jitter: tt.jitter}
+			for range 100 {
+				var previous time.Duration
+				for attempt := 0; attempt < policy.MaxRetries; attempt++ {
+					exp := min(base<<attempt, maxDelay)
+					low, high := tt.bounds(exp, previous)
+					d := policy.delay(attempt, previous, "")
+					if d < low || d > high {
+						t.Fatalf("Expected the delay of attempt %d in [%v, %v], got %v", attempt, low, high, d)
+					}
+					previous = d
+				}
+			}
+			if d := policy.delay(0, 0, "1"); d != time.Second {
+				t.Errorf("Expected Retry-After to be honored without jitter, got %v", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SSEHandler returns an http.HandlerFunc streaming the provider answer as Server-Sent-Events.
+// The LLMRequest is read as JSON from the POST body, each Delta is sent as a `data: {json}` event
+// flushed immediately, and the stream ends with `data: [DONE]`.
+// An error happening after the stream started is sent as a `data: {"error": "..."}` event.
+func SSEHandler(provider Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported by the response writer", http.StatusInternalServerError)
+			return
+		}
+		var req LLMRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(req.Messages) == 0 {
+			http.Error(w, "request must have messages", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		writeEvent := func(v any) {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+		// the request context is canceled when the client disconnects, which stops the provider stream
+		_, err := provider.Stream(r.Context(), &req, func(d Delta) {
+			writeEvent(d)
+		})
+		if err != nil {
+			writeEvent(map[string]string{"error": err.Error()})
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	}
+}
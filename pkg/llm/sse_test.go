@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSSEHandler(t *testing.T) {
+	server := httptest.NewServer(SSEHandler(&scriptedStreamProvider{deltas: []string{"Hello", " world"}}))
+	defer server.Close()
+
+	t.Run("StreamsDeltas", func(t *testing.T) {
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+		}
+		var events []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				events = append(events, strings.TrimPrefix(line, "data: "))
+			}
+		}
+		want := []string{`{"text":"Hello"}`, `{"text":" world"}`, `{"done":true,"finish_reason":"stop"}`, "[DONE]"}
+		if strings.Join(events, "|") != strings.Join(want, "|") {
+			t.Errorf("Expected events %q, got %q", want, events)
+		}
+	})
+
+	t.Run("RejectsInvalidRequests", func(t *testing.T) {
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"messages":[]}`))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+		resp, err = http.Get(server.URL)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status 405, got %d", resp.StatusCode)
+		}
+	})
+}
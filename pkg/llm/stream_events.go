@@ -0,0 +1,109 @@
+package llm
+
+import "context"
+
+// StreamEvent is a typed event emitted by StreamEvents, one of EventStart, EventReasoningDelta, EventTextDelta,
+// EventToolCall, EventUsage or EventDone. A stream always follows the same sequence: EventStart,
+// then any number of EventReasoningDelta, EventTextDelta and EventToolCall, then an optional EventUsage, then EventDone.
+type StreamEvent interface {
+	isStreamEvent()
+}
+
+// EventStart is the first event of a stream.
+type EventStart struct {
+	// Model is the requested model, empty when the provider default model is used
+	Model string
+}
+
+// EventTextDelta carries a piece of the answer text.
+type EventTextDelta struct {
+	Text string
+}
+
+// EventReasoningDelta carries a piece of the reasoning of a thinking model.
+type EventReasoningDelta struct {
+	Reasoning string
+}
+
+// EventToolCall carries a complete tool call requested by the model.
+type EventToolCall struct {
+	ToolCall ToolCall
+}
+
+// EventUsage carries the token usage of the request, it is only sent when known.
+type EventUsage struct {
+	Usage Usage
+}
+
+// EventDone is the last event of a stream. Err is set when the stream failed,
+// otherwise Response holds the complete response as returned by Provider.Stream.
+type EventDone struct {
+	FinishReason string
+	Response     *LLMResponse
+	Err          error
+}
+
+func (EventStart) isStreamEvent()          {}
+func (EventReasoningDelta) isStreamEvent() {}
+func (EventTextDelta) isStreamEvent()      {}
+func (EventToolCall) isStreamEvent()       {}
+func (EventUsage) isStreamEvent()          {}
+func (EventDone) isStreamEvent()           {}
+
+// streamEventsBuffer lets the provider read ahead a few deltas while the consumer handles an event.
+const streamEventsBuffer = 16
+
+// StreamEvents is an alternative to Provider.Stream emitting typed events over a channel,
+// instead of having to infer the stream state from the Delta fields.
+// The channel is closed after EventDone. The consumer must read it until closed or cancel ctx,
+// once ctx is done the pending events are dropped and the channel is closed as soon as the provider returns.
+// Tool call argument fragments are not forwarded, use Provider.Stream to get them.
+func StreamEvents(ctx context.Context, provider Provider, req *LLMRequest) <-chan StreamEvent {
+	events := make(chan StreamEvent, streamEventsBuffer)
+	send := func(e StreamEvent) {
+		select {
+		case events <- e:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(events)
+		model := ""
+		if req != nil {
+			model = req.Model
+		}
+		send(EventStart{Model: model})
+		toolCallsSent := 0
+		resp, err := provider.Stream(ctx, req, func(d Delta) {
+			if d.Reasoning != "" {
+				send(EventReasoningDelta{Reasoning: d.Reasoning})
+			}
+			if d.Text != "" {
+				send(EventTextDelta{Text: d.Text})
+			}
+			for _, tc := range d.ToolCalls {
+				send(EventToolCall{ToolCall: tc})
+				toolCallsSent++
+			}
+		})
+		if err != nil {
+			send(EventDone{Err: err})
+			return
+		}
+		// some providers only return the tool calls in the response, without a delta
+		if resp != nil && toolCallsSent == 0 {
+			for _, tc := range resp.ToolCalls {
+				send(EventToolCall{ToolCall: tc})
+			}
+		}
+		done := EventDone{Response: resp}
+		if resp != nil {
+			if resp.Usage != nil {
+				send(EventUsage{Usage: *resp.Usage})
+			}
+			done.FinishReason = resp.FinishReason
+		}
+		send(done)
+	}()
+	return events
+}
@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func collectStreamEvents(events <-chan StreamEvent) []StreamEvent {
+	var all []StreamEvent
+	for e := range events {
+		all = append(all, e)
+	}
+	return all
+}
+
+func TestStreamEvents(t *testing.T) {
+	t.Run("TextStream", func(t *testing.T) {
+		provider := &scriptedStreamProvider{deltas: []string{"Hel", "lo"}}
+		events := collectStreamEvents(StreamEvents(context.Background(), provider, &LLMRequest{Model: "test-model"}))
+		if len(events) != 4 {
+			t.Fatalf("Expected 4 events, got %d: %#v", len(events), events)
+		}
+		if start, ok := events[0].(EventStart); !ok || start.Model != "test-model" {
+			t.Errorf("Expected EventStart for test-model, got %#v", events[0])
+		}
+		if d, ok := events[1].(EventTextDelta); !ok || d.Text != "Hel" {
+			t.Errorf("Expected EventTextDelta 'Hel', got %#v", events[1])
+		}
+		if d, ok := events[2].(EventTextDelta); !ok || d.Text != "lo" {
+			t.Errorf("Expected EventTextDelta 'lo', got %#v", events[2])
+		}
+		done, ok := events[3].(EventDone)
+		if !ok || done.Err != nil || done.FinishReason != "stop" || done.Response.Text != "Hello" {
+			t.Errorf("Expected a successful EventDone, got %#v", events[3])
+		}
+	})
+
+	t.Run("ToolCallsAndUsage", func(t *testing.T) {
+		provider := &sequenceProvider{responses: []*LLMResponse{{
+			ToolCalls:    []ToolCall{{ID: "call-1", Name: "get_weather", Arguments: []byte(`{}`)}},
+			FinishReason: "tool_calls",
+			Usage:        &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		}}}
+		events := collectStreamEvents(StreamEvents(context.Background(), provider, &LLMRequest{}))
+		if len(events) != 4 {
+			t.Fatalf("Expected 4 events, got %d: %#v", len(events), events)
+		}
+		if tc, ok := events[1].(EventToolCall); !ok || tc.ToolCall.ID != "call-1" {
+			t.Errorf("Expected EventToolCall call-1, got %#v", events[1])
+		}
+		if u, ok := events[2].(EventUsage); !ok || u.Usage.TotalTokens != 15 {
+			t.Errorf("Expected EventUsage with 15 tokens, got %#v", events[2])
+		}
+		if done, ok := events[3].(EventDone); !ok || done.FinishReason != "tool_calls" {
+			t.Errorf("Expected EventDone with tool_calls, got %#v", events[3])
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		provider := &sequenceProvider{responses: []*LLMResponse{{Text: "unused"}}}
+		events := collectStreamEvents(StreamEvents(context.Background(), provider, nil))
+		if len(events) != 2 {
+			t.Fatalf("Expected 2 events, got %d: %#v", len(events), events)
+		}
+		if done, ok := events[1].(EventDone); !ok || done.Err == nil || done.Response != nil {
+			t.Errorf("Expected EventDone with an error, got %#v", events[1])
+		}
+	})
+
+	t.Run("CanceledConsumer", func(t *testing.T) {
+		deltas := make([]string, 4*streamEventsBuffer)
+		for i := range deltas {
+			deltas[i] = "x"
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		events := StreamEvents(ctx, &scriptedStreamProvider{deltas: deltas}, &LLMRequest{})
+		<-events
+		cancel()
+		// the channel must still be closed even if nobody reads the remaining events
+		for range events {
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// streamHarnessCase describes raw chunks, written and flushed one by one by the mock server exactly as given
+// (so a chunk can stop in the middle of a JSON object), and the expected outcome of Stream.
+type streamHarnessCase struct {
+	name   string
+	chunks []string
+	// expectations, wantUsage is only checked when not nil
+	wantText         string
+	wantToolCalls    []string // names of the tool calls
+	wantFinishReason string
+	wantUsage        *Usage
+	wantErr          bool
+}
+
+// runStreamHarness runs each case against the provider created by newProvider for the mock server,
+// checking that the deltas add up to the final response and that the response matches the expectations.
+func runStreamHarness(t *testing.T, newProvider func(server *httptest.Server, l golog.MyLogger) Provider, cases []streamHarnessCase) {
+	t.Helper()
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for _, chunk := range tc.chunks {
+					fmt.Fprint(w, chunk)
+					if f, ok := w.(http.Flusher); ok {
+						f.Flush()
+					}
+				}
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "test prompt"}}}
+			deltaText := &strings.Builder{}
+			var deltaToolCalls []string
+			dones := 0
+			resp, err := newProvider(server, l).Stream(ctx, req, func(d Delta) {
+				deltaText.WriteString(d.Text)
+				for _, call := range d.ToolCalls {
+					deltaToolCalls = append(deltaToolCalls, call.Name)
+				}
+				if d.Done {
+					dones++
+				}
+			})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got response %#v", resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+			if resp.Text != tc.wantText || deltaText.String() != tc.wantText {
+				t.Errorf("Expected text %q, got %q (deltas: %q)", tc.wantText, resp.Text, deltaText.String())
+			}
+			var respToolCalls []string
+			for _, call := range resp.ToolCalls {
+				respToolCalls = append(respToolCalls, call.Name)
+			}
+			if !reflect.DeepEqual(respToolCalls, tc.wantToolCalls) || !reflect.DeepEqual(deltaToolCalls, tc.wantToolCalls) {
+				t.Errorf("Expected tool calls %v, got %v (deltas: %v)", tc.wantToolCalls, respToolCalls, deltaToolCalls)
+			}
+			if resp.FinishReason != tc.wantFinishReason {
+				t.Errorf("Expected finish reason %q, got %q", tc.wantFinishReason, resp.FinishReason)
+			}
+			if tc.wantUsage != nil && !reflect.DeepEqual(resp.Usage, tc.wantUsage) {
+				t.Errorf("Expected usage %#v, got %#v", tc.wantUsage, resp.Usage)
+			}
+			if dones != 1 {
+				t.Errorf("Expected exactly one done delta, got %d", dones)
+			}
+		})
+	}
+}
+
+// sse frames each JSON payload as a Server-Sent-Event.
+func sse(payloads ...string) string {
+	var b strings.Builder
+	for _, p := range payloads {
+		b.WriteString("data: " + p + "\n\n")
+	}
+	return b.String()
+}
+
+func TestStreamHarnessOpenAI(t *testing.T) {
+	textChunk := func(s string) string {
+		data, _ := json.Marshal(map[string]any{"choices": []any{map[string]any{"delta": map[string]any{"content": s}}}})
+		return string(data)
+	}
+	stop := `{"choices":[{"delta":{},"finish_reason":"stop"}]}`
+	usage := `{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`
+	runStreamHarness(t, func(server *httptest.Server, l golog.MyLogger) Provider {
+		return &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	}, []streamHarnessCase{
+		{
+			name:             "TextAndUsage",
+			chunks:           []string{sse(textChunk("Hello")), sse(textChunk(" world")), sse(stop, usage, "[DONE]")},
+			wantText:         "Hello world",
+			wantFinishReason: "stop",
+			wantUsage:        &Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+		},
+		{
+			name:             "EventSplitAcrossWrites",
+			chunks:           []string{"data: " + textChunk("Hel")[:20], textChunk("Hel")[20:] + "\n\n", sse(stop, "[DONE]")},
+			wantText:         "Hel",
+			wantFinishReason: "stop",
+		},
+		{
+			name:             "MalformedAndKeepAliveSkipped",
+			chunks:           []string{": keep-alive\n\n", sse(textChunk("a"), `{"choices":[{"delta":`, textChunk("b"), stop, "[DONE]")},
+			wantText:         "ab",
+			wantFinishReason: "stop",
+		},
+		{
+			name: "ToolCallFragments",
+			chunks: []string{sse(
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Bern\"}"}}]}}]}`,
+				`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`, "[DONE]")},
+			wantToolCalls:    []string{"get_weather", "get_time"},
+			wantFinishReason: "tool_calls",
+		},
+		{
+			name:             "MissingDoneAndUsage",
+			chunks:           []string{sse(textChunk("abcdefgh"))},
+			wantText:         "abcdefgh",
+			wantFinishReason: FinishReasonStop,
+			wantUsage:        &Usage{PromptTokens: EstimateMessagesTokens([]LLMMessage{{Role: RoleUser, Content: "test prompt"}}), CompletionTokens: 2, TotalTokens: EstimateMessagesTokens([]LLMMessage{{Role: RoleUser, Content: "test prompt"}}) + 2, Estimated: true},
+		},
+	})
+}
+
+func TestStreamHarnessGemini(t *testing.T) {
+	runStreamHarness(t, func(server *httptest.Server, l golog.MyLogger) Provider {
+		return &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+	}, []streamHarnessCase{
+		{
+			name: "TextAndUsage",
+			chunks: []string{
+				`[{"candidates": [{"content": {"parts": [{"text": "Hello"}]}}]}`,
+				`,{"candidates": [{"content": {"parts": [{"text": " world"}]}, "finishReason": "STOP"}],
+				  "usageMetadata": {"promptTokenCount": 4, "candidatesTokenCount": 2, "totalTokenCount": 6}}]`,
+			},
+			wantText:         "Hello world",
+			wantFinishReason: "STOP",
+			wantUsage:        &Usage{PromptTokens: 4, CompletionTokens: 2, TotalTokens: 6},
+		},
+		{
+			name:             "ObjectSplitAcrossWrites",
+			chunks:           []string{`[{"candidates": [{"content": {"par`, `ts": [{"text": "Hi"}]}, "finishRea`, `son": "STOP"}]}]`},
+			wantText:         "Hi",
+			wantFinishReason: "STOP",
+		},
+		{
+			name:             "FunctionCall",
+			chunks:           []string{`[{"candidates": [{"content": {"parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Bern"}}}]}, "finishReason": "STOP"}]}]`},
+			wantToolCalls:    []string{"get_weather"},
+			wantFinishReason: "STOP",
+		},
+		{
+			name:    "MalformedObject",
+			chunks:  []string{`[{"candidates": [{"content": {"parts": [{"text": "Hi"}]}}]}, {"candidates": oops}]`},
+			wantErr: true,
+		},
+		{
+			name:    "NotAnArray",
+			chunks:  []string{`{"error": {"message": "quota exceeded"}}`},
+			wantErr: true,
+		},
+	})
+}
+
+func TestStreamHarnessOllama(t *testing.T) {
+	runStreamHarness(t, func(server *httptest.Server, l golog.MyLogger) Provider {
+		return &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+	}, []streamHarnessCase{
+		{
+			name: "TextAndUsage",
+			chunks: []string{
+				`{"message": {"role": "assistant", "content": "Hello"}, "done": false}` + "\n",
+				`{"message": {"role": "assistant", "content": " world"}, "done": false}` + "\n",
+				`{"message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 8, "eval_count": 2}` + "\n",
+			},
+			wantText:         "Hello world",
+			wantFinishReason: "stop",
+			wantUsage:        &Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10},
+		},
+		{
+			name: "LineSplitAcrossWrites",
+			chunks: []string{
+				`{"message": {"role": "assistant", "content": "Hel`,
+				`lo"}, "done": false}` + "\n" + `{"message": {"role": "assistant", "content": ""}, "done": true}` + "\n",
+			},
+			wantText:         "Hello",
+			wantFinishReason: "stop",
+		},
+		{
+			name:    "MalformedLine",
+			chunks:  []string{`{"message": {"role": "assistant", "content": "Hi"}, "done": false}` + "\n" + `{"message": oops}` + "\n"},
+			wantErr: true,
+		},
+		{
+			name:    "ErrorChunk",
+			chunks:  []string{`{"error": "model not found"}` + "\n"},
+			wantErr: true,
+		},
+	})
+}
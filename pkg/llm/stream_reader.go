@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"context"
+	"io"
+)
+
+// streamReader exposes the text deltas of a provider stream as an io.ReadCloser.
+type streamReader struct {
+	pr     *io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewStreamReader streams req with provider and returns a reader of the answer text, e.g. to io.Copy it to os.Stdout.
+// Read blocks until the next text delta arrives and returns io.EOF once the stream is done,
+// or the stream error if it failed. Close cancels the stream when it is still running.
+func NewStreamReader(ctx context.Context, provider Provider, req *LLMRequest) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	r := &streamReader{pr: pr, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		_, err := provider.Stream(ctx, req, func(d Delta) {
+			if d.Text != "" {
+				// a write error means the reader was closed, the cancelled context ends the stream
+				_, _ = pw.Write([]byte(d.Text))
+			}
+		})
+		// a nil error makes Read return io.EOF
+		pw.CloseWithError(err)
+	}()
+	return r
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	return r.pr.Read(p)
+}
+
+// Close cancels the stream and waits for it to end.
+func (r *streamReader) Close() error {
+	r.cancel()
+	err := r.pr.Close()
+	<-r.done
+	return err
+}
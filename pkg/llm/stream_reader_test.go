@@ -0,0 +1,72 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// blockingStreamProvider is a fake Provider whose Stream emits a delta then waits for the context to be done.
+type blockingStreamProvider struct {
+	cancelled chan struct{}
+}
+
+func (p *blockingStreamProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *blockingStreamProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	onDelta(Delta{Text: "never ending"})
+	<-ctx.Done()
+	close(p.cancelled)
+	return nil, ctx.Err()
+}
+
+func (p *blockingStreamProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return nil, nil
+}
+
+func TestStreamReader(t *testing.T) {
+	t.Run("ReadsAllDeltas", func(t *testing.T) {
+		reader := NewStreamReader(context.Background(), &scriptedStreamProvider{deltas: []string{"Hello", ", ", "world"}}, &LLMRequest{})
+		defer reader.Close()
+		text, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		if string(text) != "Hello, world" {
+			t.Errorf("Expected %q, got %q", "Hello, world", text)
+		}
+	})
+
+	t.Run("ReturnsStreamError", func(t *testing.T) {
+		streamErr := errors.New("connection reset")
+		reader := NewStreamReader(context.Background(), &scriptedStreamProvider{deltas: []string{"partial"}, err: streamErr}, &LLMRequest{})
+		defer reader.Close()
+		text, err := io.ReadAll(reader)
+		if !errors.Is(err, streamErr) || string(text) != "partial" {
+			t.Errorf("Expected the partial text and the stream error, got %q and %v", text, err)
+		}
+	})
+
+	t.Run("CloseCancelsStream", func(t *testing.T) {
+		provider := &blockingStreamProvider{cancelled: make(chan struct{})}
+		reader := NewStreamReader(context.Background(), provider, &LLMRequest{})
+		buf := make([]byte, 5)
+		if n, err := reader.Read(buf); err != nil || string(buf[:n]) != "never" {
+			t.Fatalf("Expected to read the first bytes, got %q (err: %v)", buf[:n], err)
+		}
+		if err := reader.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+		select {
+		case <-provider.cancelled:
+		default:
+			t.Error("Expected Close to cancel the stream")
+		}
+		if _, err := reader.Read(buf); !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("Expected io.ErrClosedPipe after Close, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// FinishReasonStoppedByCaller is the FinishReason of a response stopped by the callback of StreamWithStop.
+const FinishReasonStoppedByCaller = "stopped_by_caller"
+
+// Finish reasons telling how a stream ended, set on the done Delta and the response by the providers:
+//   - FinishReasonStop: the stream completed, when the provider didn't report its own reason (like "length")
+//   - FinishReasonCancelled: the context was cancelled, e.g. by the user, or its deadline passed,
+//     the error is context.Canceled or context.DeadlineExceeded
+//   - FinishReasonError: the stream failed after it started, the error is attached to the done Delta as Err
+const (
+	FinishReasonStop      = "stop"
+	FinishReasonCancelled = "cancelled"
+	FinishReasonError     = "error"
+)
+
+// runStream calls the stream function of a provider and makes it end with a done delta telling how it ended.
+// A completed stream without finish reason gets FinishReasonStop. A cancelled stream, or one failing after its first
+// delta, ends with a done delta holding the error and FinishReasonCancelled or FinishReasonError, and the partial
+// response is returned along with the error. A stream failing before its first delta only returns the error,
+// so that a FallbackProvider can try the next provider. A stream stopped by StreamWithStop returns its partial
+// response without error, so that the audit logger and the hooks record the same outcome as the caller gets.
+func runStream(ctx context.Context, req *LLMRequest, onDelta func(Delta), stream func(context.Context, *LLMRequest, func(Delta)) (*LLMResponse, error)) (*LLMResponse, error) {
+	if onDelta == nil {
+		return stream(ctx, req, onDelta)
+	}
+	text := &strings.Builder{}
+	reasoning := &strings.Builder{}
+	started := false
+	resp, err := stream(ctx, req, func(d Delta) {
+		started = true
+		text.WriteString(d.Text)
+		reasoning.WriteString(d.Reasoning)
+		if d.Done && d.FinishReason == "" {
+			d.FinishReason = FinishReasonStop
+		}
+		onDelta(d)
+	})
+	var stop *streamStoppedError
+	if errors.As(context.Cause(ctx), &stop) {
+		return stop.resp, nil
+	}
+	if err == nil {
+		if resp != nil && resp.FinishReason == "" {
+			resp.FinishReason = FinishReasonStop
+		}
+		return resp, nil
+	}
+	reason := FinishReasonError
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+		reason = FinishReasonCancelled
+	} else if !started {
+		return nil, err
+	}
+	onDelta(Delta{Done: true, FinishReason: reason, Err: err})
+	return &LLMResponse{Text: text.String(), Reasoning: reasoning.String(), FinishReason: reason}, err
+}
+
+// StreamWithStop streams req like provider.Stream, but onDelta returns false to stop the stream right away,
+// e.g. when a stop phrase is detected client side. The stream is then cancelled and closed, the next deltas are
+// not forwarded and the partial response is returned without error, with FinishReason set to
+// FinishReasonStoppedByCaller and an estimated usage, after a last done delta is sent to onDelta. The providers of
+// this package record that same response, without error, with their audit logger and OnResponse hook.
+// Returning false for the done delta of the provider doesn't stop anything, its response is returned unchanged.
+// Use NeverStop to pass a regular func(Delta) callback.
+func StreamWithStop(ctx context.Context, provider Provider, req *LLMRequest, onDelta func(Delta) bool) (*LLMResponse, error) {
+	return streamWithStop(ctx, provider, req, FinishReasonStoppedByCaller, onDelta)
+}
+
+// NeverStop adapts a regular streaming callback to StreamWithStop, the stream is never stopped by it.
+func NeverStop(onDelta func(Delta)) func(Delta) bool {
+	return func(d Delta) bool {
+		onDelta(d)
+		return true
+	}
+}
+
+// streamStoppedError is the cause of the context cancelled by streamWithStop, holding the partial response
+// that the stopped stream returns.
+type streamStoppedError struct {
+	resp *LLMResponse
+}
+
+func (e *streamStoppedError) Error() string {
+	return "stream stopped: " + e.resp.FinishReason
+}
+
+// streamWithStop implements StreamWithStop, the partial response and its done delta get finishReason.
+// Once the done delta of the provider was delivered, the response of the provider is returned unchanged.
+func streamWithStop(ctx context.Context, provider Provider, req *LLMRequest, finishReason string, onDelta func(Delta) bool) (*LLMResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if onDelta == nil {
+		return nil, errors.New("onDelta callback cannot be nil for streaming")
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	text := &strings.Builder{}
+	reasoning := &strings.Builder{}
+	generatedChars := 0
+	var stopped *streamStoppedError
+	resp, err := provider.Stream(ctx, req, func(d Delta) {
+		if stopped != nil {
+			return
+		}
+		text.WriteString(d.Text)
+		reasoning.WriteString(d.Reasoning)
+		// reasoning tokens are generated (and billed) too
+		generatedChars += utf8.RuneCountInString(d.Text) + utf8.RuneCountInString(d.Reasoning)
+		if d.ToolCallArgsFragment != nil {
+			generatedChars += utf8.RuneCountInString(d.ToolCallArgsFragment.Arguments)
+		}
+		if !onDelta(d) && !d.Done {
+			partial := &LLMResponse{Text: text.String(), Reasoning: reasoning.String(), FinishReason: finishReason}
+			partial.Usage = &Usage{CompletionTokens: (generatedChars + charsPerToken - 1) / charsPerToken, Estimated: true}
+			completeStreamUsage(partial, req, partial.Text, ProviderTokenEstimator(provider))
+			stopped = &streamStoppedError{resp: partial}
+			cancel(stopped)
+		}
+	})
+	if stopped == nil {
+		return resp, err
+	}
+	onDelta(Delta{Done: true, FinishReason: finishReason})
+	// the providers return it from Stream too, completed in place like their other responses
+	return stopped.resp, nil
+}
@@ -0,0 +1,213 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestStreamWithStop(t *testing.T) {
+	provider := &scriptedStreamProvider{deltas: []string{"Once upon", " a time.", " THE END", " of the story", " really"}}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Tell a story"}}}
+
+	t.Run("StoppedByTheCallback", func(t *testing.T) {
+		var received []Delta
+		text := &strings.Builder{}
+		resp, err := StreamWithStop(context.Background(), provider, req, func(d Delta) bool {
+			received = append(received, d)
+			text.WriteString(d.Text)
+			return !strings.Contains(text.String(), "THE END")
+		})
+		if err != nil {
+			t.Fatalf("StreamWithStop failed: %v", err)
+		}
+		if resp.Text != "Once upon a time. THE END" || resp.FinishReason != FinishReasonStoppedByCaller {
+			t.Errorf("Expected the partial text up to the stop phrase, got %q (%s)", resp.Text, resp.FinishReason)
+		}
+		if resp.Usage == nil || !resp.Usage.Estimated || resp.Usage.CompletionTokens == 0 {
+			t.Errorf("Expected an estimated usage, got %#v", resp.Usage)
+		}
+		if len(received) != 4 || !received[3].Done || received[3].FinishReason != FinishReasonStoppedByCaller {
+			t.Errorf("Expected 3 text deltas followed by done, got %#v", received)
+		}
+	})
+
+	t.Run("StopOnTheDoneDelta", func(t *testing.T) {
+		resp, err := StreamWithStop(context.Background(), provider, req, func(d Delta) bool { return !d.Done })
+		if err != nil {
+			t.Fatalf("StreamWithStop failed: %v", err)
+		}
+		if resp.Text != "Once upon a time. THE END of the story really" || resp.FinishReason != "stop" || resp.Usage != nil {
+			t.Errorf("Expected the response of the provider unchanged, got %#v", resp)
+		}
+	})
+
+	t.Run("RecordedLikeReturned", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, sse(`{"choices":[{"delta":{"content":"Hi THE END"}}]}`))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+
+		l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+		audit := &strings.Builder{}
+		var hookResp *LLMResponse
+		var hookErr error
+		provider := &openAICompatibleProvider{
+			BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l,
+			audit: NewJSONLAuditLogger(audit, AuditRedaction{}),
+			hooks: callHooks{onResponse: func(resp *LLMResponse, err error) { hookResp, hookErr = resp, err }},
+		}
+		resp, err := StreamWithStop(context.Background(), provider, req, func(d Delta) bool {
+			return !strings.Contains(d.Text, "THE END")
+		})
+		if err != nil || resp.FinishReason != FinishReasonStoppedByCaller {
+			t.Fatalf("Expected a response stopped by the caller, got %#v and %v", resp, err)
+		}
+		if hookResp != resp || hookErr != nil {
+			t.Errorf("Expected OnResponse to get the returned response without error, got %#v and %v", hookResp, hookErr)
+		}
+		if log := audit.String(); strings.Contains(log, `"error"`) || !strings.Contains(log, FinishReasonStoppedByCaller) {
+			t.Errorf("Expected the audit log to record the stopped response without error, got %s", log)
+		}
+	})
+
+	t.Run("NeverStop", func(t *testing.T) {
+		deltas := 0
+		resp, err := StreamWithStop(context.Background(), provider, req, NeverStop(func(Delta) { deltas++ }))
+		if err != nil {
+			t.Fatalf("StreamWithStop failed: %v", err)
+		}
+		if resp.FinishReason != "stop" || deltas != 6 {
+			t.Errorf("Expected the full stream, got %d deltas and %#v", deltas, resp)
+		}
+	})
+}
+
+func TestStreamTermination(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	// for each provider, a first chunk with the text "Hi" and the end of a stream without finish reason
+	providers := []struct {
+		name        string
+		first, end  string
+		newProvider func(server *httptest.Server) Provider
+	}{
+		{
+			name:  "OpenAI",
+			first: sse(`{"choices":[{"delta":{"content":"Hi"}}]}`),
+			end:   sse("[DONE]"),
+			newProvider: func(server *httptest.Server) Provider {
+				return &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+			},
+		},
+		{
+			name:  "Gemini",
+			first: `[{"candidates": [{"content": {"parts": [{"text": "Hi"}]}}]}`,
+			end:   `]`,
+			newProvider: func(server *httptest.Server) Provider {
+				return &GeminiProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "gemini-test", Client: server.Client(), l: l}
+			},
+		},
+		{
+			name:  "Ollama",
+			first: `{"message": {"role": "assistant", "content": "Hi"}, "done": false}` + "\n",
+			end:   `{"message": {"role": "assistant", "content": ""}, "done": true}` + "\n",
+			newProvider: func(server *httptest.Server) Provider {
+				return &OllamaProvider{BaseURL: server.URL, Model: "qwen3:latest", Client: server.Client(), l: l}
+			},
+		},
+		{
+			name:  "Cohere",
+			first: sse(`{"type":"content-delta","index":0,"delta":{"message":{"content":{"text":"Hi"}}}}`),
+			end:   sse(`{"type":"message-end","delta":{}}`),
+			newProvider: func(server *httptest.Server) Provider {
+				return &CohereProvider{BaseURL: server.URL, APIKey: "test-api-key", Model: "command-r-plus", Client: server.Client(), l: l}
+			},
+		},
+	}
+	// ending is how the mock server ends the stream after the first chunk
+	cases := []struct {
+		name       string
+		ending     string
+		wantReason string
+		wantErr    error
+	}{
+		{name: "Completed", ending: "end", wantReason: FinishReasonStop},
+		{name: "CancelledByTheCaller", ending: "block", wantReason: FinishReasonCancelled, wantErr: context.Canceled},
+		{name: "DeadlineExceeded", ending: "deadline", wantReason: FinishReasonCancelled, wantErr: context.DeadlineExceeded},
+		{name: "FailedMidStream", ending: "truncate", wantReason: FinishReasonError},
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "test prompt"}}}
+	for _, p := range providers {
+		for _, tc := range cases {
+			t.Run(p.name+"/"+tc.name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if tc.ending == "truncate" {
+						// announcing more bytes than sent makes the client fail with an unexpected EOF
+						w.Header().Set("Content-Length", "10000")
+					}
+					fmt.Fprint(w, p.first)
+					w.(http.Flusher).Flush()
+					switch tc.ending {
+					case "end":
+						fmt.Fprint(w, p.end)
+					case "block", "deadline":
+						<-r.Context().Done()
+					}
+				}))
+				defer server.Close()
+
+				ctx, cancel := context.WithCancel(context.Background())
+				if tc.ending == "deadline" {
+					ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+				}
+				defer cancel()
+				var done []Delta
+				resp, err := p.newProvider(server).Stream(ctx, req, func(d Delta) {
+					if d.Done {
+						done = append(done, d)
+					}
+					if d.Text != "" && tc.ending == "block" {
+						cancel()
+					}
+				})
+				if tc.ending == "end" && err != nil {
+					t.Fatalf("Stream failed: %v", err)
+				}
+				if tc.ending != "end" && (err == nil || (tc.wantErr != nil && !errors.Is(err, tc.wantErr))) {
+					t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+				}
+				if len(done) != 1 || done[0].FinishReason != tc.wantReason {
+					t.Fatalf("Expected exactly one done delta with finish reason %q, got %#v", tc.wantReason, done)
+				}
+				if (done[0].Err != nil) != (err != nil) {
+					t.Errorf("Expected the done delta to carry the error %v, got %v", err, done[0].Err)
+				}
+				if resp == nil || resp.Text != "Hi" || resp.FinishReason != tc.wantReason {
+					t.Errorf("Expected the (partial) text with finish reason %q, got %#v", tc.wantReason, resp)
+				}
+			})
+		}
+	}
+
+	t.Run("FailedBeforeStarting", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error": "invalid model"}`, http.StatusBadRequest)
+		}))
+		defer server.Close()
+		deltas := 0
+		resp, err := providers[0].newProvider(server).Stream(context.Background(), req, func(Delta) { deltas++ })
+		if err == nil || resp != nil || deltas != 0 {
+			t.Errorf("Expected only the error so a fallback can try another provider, got %d deltas, %#v and %v", deltas, resp, err)
+		}
+	})
+}
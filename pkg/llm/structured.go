@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+// ParseJSONResponse unmarshals the text of resp into a T, typically for a request made with a ResponseFormat.
+// Markdown code fences (```json ... ```) that models often wrap around their output are stripped first.
+// When the text is not valid JSON for T, the error contains the offending text.
+func ParseJSONResponse[T any](resp *LLMResponse) (T, error) {
+	var result T
+	if resp == nil {
+		return result, errors.New("cannot parse JSON from a nil response")
+	}
+	text := stripCodeFences(resp.Text)
+	if text == "" {
+		return result, errors.New("cannot parse JSON from an empty response")
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return result, fmt.Errorf("failed to parse JSON response into %T: %w, response text: %q", result, err, text)
+	}
+	return result, nil
+}
+
+// ExtractJSON returns the JSON object or array found in text, e.g. wrapped in a code fence or in explanations,
+// and false when text holds no valid JSON value. A text that is valid JSON is returned trimmed.
+// Otherwise a fenced json code block is preferred, then the longest object found in the text, then the longest array,
+// so that "see [1], here is {...}" gives the object.
+func ExtractJSON(text string) (string, bool) {
+	stripped := stripCodeFences(text)
+	if json.Valid([]byte(stripped)) {
+		return stripped, true
+	}
+	if fenced, ok := fencedJSON(text); ok {
+		return fenced, true
+	}
+	best := ""
+	for start := 0; start < len(text); start++ {
+		if text[start] != '{' && text[start] != '[' {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(text[start:]))
+		var value json.RawMessage
+		if dec.Decode(&value) != nil {
+			continue
+		}
+		end := start + int(dec.InputOffset())
+		if candidate := text[start:end]; betterJSONCandidate(candidate, best) {
+			best = candidate
+		}
+		// the values nested in this one are never better, resume after it
+		start = end - 1
+	}
+	return best, best != ""
+}
+
+// fencedJSON returns the body of the first code block of text tagged json, or untagged, that holds valid JSON.
+func fencedJSON(text string) (string, bool) {
+	blocks := strings.Split(text, "```")
+	// the odd parts are inside a fence, the last one only when the fence is closed
+	for i := 1; i < len(blocks)-1; i += 2 {
+		tag, body, found := strings.Cut(blocks[i], "\n")
+		if !found {
+			tag, body = "", strings.TrimPrefix(blocks[i], "json")
+		}
+		if tag = strings.TrimSpace(tag); tag != "" && !strings.EqualFold(tag, "json") {
+			continue
+		}
+		if body = strings.TrimSpace(body); json.Valid([]byte(body)) {
+			return body, true
+		}
+	}
+	return "", false
+}
+
+// betterJSONCandidate reports whether candidate is preferred to best: an object to an array, else the longest.
+func betterJSONCandidate(candidate, best string) bool {
+	if best == "" {
+		return true
+	}
+	if isObject, bestIsObject := candidate[0] == '{', best[0] == '{'; isObject != bestIsObject {
+		return isObject
+	}
+	return len(candidate) > len(best)
+}
+
+// extractJSONIfRequested applies the ExtractJSONResponse post-processing of req to the response of a query or stream.
+func extractJSONIfRequested(req *LLMRequest, resp *LLMResponse, err error, l golog.MyLogger) (*LLMResponse, error) {
+	if err != nil || resp == nil || req == nil || !req.ExtractJSONResponse || req.ResponseFormat == nil {
+		return resp, err
+	}
+	if req.ResponseFormat.Type != "json_object" && req.ResponseFormat.Type != "json_schema" {
+		return resp, err
+	}
+	if json.Valid([]byte(resp.Text)) {
+		return resp, nil
+	}
+	extracted, ok := ExtractJSON(resp.Text)
+	if !ok {
+		l.Warn("JSON mode requested but no JSON found in the response text")
+		return resp, nil
+	}
+	l.Info("JSON mode requested but the response text was not plain JSON, extracted %d of %d bytes", len(extracted), len(resp.Text))
+	resp.OriginalText = resp.Text
+	resp.Text = extracted
+	return resp, nil
+}
+
+// stripCodeFences returns text without the surrounding whitespace and markdown code fence, if any.
+// The language tag following the opening fence (e.g. json) is dropped too.
+func stripCodeFences(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	body, ok := strings.CutSuffix(strings.TrimPrefix(text, "```"), "```")
+	if !ok {
+		return text
+	}
+	// the first line holds the optional language tag
+	if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+		body = body[nl+1:]
+	} else {
+		body = strings.TrimPrefix(body, "json")
+	}
+	return strings.TrimSpace(body)
+}
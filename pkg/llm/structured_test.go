@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestParseJSONResponse(t *testing.T) {
+	type weather struct {
+		City string  `json:"city"`
+		Temp float64 `json:"temp"`
+	}
+	tests := []struct {
+		name    string
+		text    string
+		want    weather
+		wantErr string
+	}{
+		{name: "PlainJSON", text: `{"city": "Lausanne", "temp": 21.5}`, want: weather{City: "Lausanne", Temp: 21.5}},
+		{name: "JSONFence", text: "```json\n{\"city\": \"Lausanne\", \"temp\": 21.5}\n```", want: weather{City: "Lausanne", Temp: 21.5}},
+		{name: "BareFence", text: "  ```\n{\"city\": \"Bern\"}\n```\n", want: weather{City: "Bern"}},
+		{name: "SingleLineFence", text: "```json {\"city\": \"Bern\"}```", want: weather{City: "Bern"}},
+		{name: "InvalidJSON", text: "Sure! Here is the weather: sunny", wantErr: "Sure! Here is the weather: sunny"},
+		{name: "WrongType", text: `{"city": 42}`, wantErr: `{\"city\": 42}`},
+		{name: "Empty", text: "```json\n```", wantErr: "empty response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJSONResponse[weather](&LLMResponse{Text: tt.text})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJSONResponse failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := ParseJSONResponse[weather](nil); err == nil {
+		t.Error("Expected an error for a nil response, got nil")
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{"PlainJSON", ` {"a": 1} `, `{"a": 1}`, true},
+		{"Fenced", "```json\n[1, 2]\n```", `[1, 2]`, true},
+		{"Embedded", `Sure! Here it is: {"city": "Bern", "note": "a } in a string"} Hope it helps.`, `{"city": "Bern", "note": "a } in a string"}`, true},
+		{"EscapedQuote", `Result: {"quote": "say \"hi\" {"} done`, `{"quote": "say \"hi\" {"}`, true},
+		{"SkipsInvalidCandidate", `Use {braces} like this: {"ok": true}`, `{"ok": true}`, true},
+		{"ObjectAfterArray", `See [1], here is {"city": "Bern"}.`, `{"city": "Bern"}`, true},
+		{"LongestObject", `Not {"a": 1} but {"city": "Bern", "canton": "BE"}`, `{"city": "Bern", "canton": "BE"}`, true},
+		{"OutermostObject", `Result: {"city": {"name": "Bern"}, "list": [1, 2]} ok`, `{"city": {"name": "Bern"}, "list": [1, 2]}`, true},
+		{"FencedInExplanations", "Sources [1] and [2].\n```json\n{\"a\": 1}\n```\nAlso {\"longer\": \"object here\"}", `{"a": 1}`, true},
+		{"SkipsOtherLanguageFence", "```go\nx := []int{1}\n```\nGives [1, 2]", `[1, 2]`, true},
+		{"NoJSON", `No JSON here, sorry.`, "", false},
+		{"Unclosed", `{"a": 1`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ExtractJSON(tt.text)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Expected (%q, %t), got (%q, %t)", tt.want, tt.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+func TestExtractJSONResponse(t *testing.T) {
+	const answer = "Here is the JSON you asked for:\n{\"city\": \"Lausanne\"}"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": %q}}]}`, answer)
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), Endpoint: "/chat/completions", l: l}
+	tests := []struct {
+		name     string
+		format   *ResponseFormat
+		optIn    bool
+		wantText string
+	}{
+		{"Extracted", &ResponseFormat{Type: "json_object"}, true, `{"city": "Lausanne"}`},
+		{"NotOptedIn", &ResponseFormat{Type: "json_object"}, false, answer},
+		{"NoJSONMode", nil, true, answer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "City?"}}, ResponseFormat: tt.format, ExtractJSONResponse: tt.optIn}
+			resp, err := provider.Query(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if resp.Text != tt.wantText {
+				t.Errorf("Expected text %q, got %q", tt.wantText, resp.Text)
+			}
+			if extracted := resp.Text != answer; extracted != (resp.OriginalText == answer) {
+				t.Errorf("Expected the original text to be kept only when extracted, got %q", resp.OriginalText)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// summaryNotePrefix starts the summary of the older turns, appended to the system prompt after summaryNoteSeparator.
+	summaryNotePrefix    = "Summary of the earlier conversation:\n"
+	summaryNoteSeparator = "\n\n"
+	// summarizerSystemPrompt instructs the model used to summarize the oldest turns.
+	summarizerSystemPrompt = "You summarize conversations between a user and an assistant. " +
+		"Write a compact note keeping the facts, decisions, names, numbers and open questions needed to continue the conversation. " +
+		"Answer with the note only."
+	defaultSummaryKeepRecentTurns = 2
+	defaultSummaryTimeout         = 2 * time.Minute
+)
+
+// SummarizationConfig sets when and how a SummarizingConversation summarizes its oldest turns.
+// At least one of EveryTurns or MaxTokens must be set.
+type SummarizationConfig struct {
+	// Provider is used to write the summaries, Model optionally selects its model.
+	Provider Provider
+	Model    string
+	// EveryTurns triggers a summarization every K completed assistant turns, 0 disables it.
+	EveryTurns int
+	// MaxTokens triggers a summarization when the estimated history tokens exceed it, 0 disables it.
+	MaxTokens int
+	// Estimator counts the history tokens for MaxTokens, the estimator of Provider when nil (see ProviderTokenEstimator).
+	Estimator TokenEstimator
+	// KeepRecentTurns is the number of most recent user turns (with their answers and tool results) kept verbatim,
+	// it defaults to 2.
+	KeepRecentTurns int
+	// SummaryMaxTokens bounds the length of a summary, 0 leaves it to the provider.
+	SummaryMaxTokens int
+	// Timeout bounds the automatic summarization requests, it defaults to 2 minutes.
+	Timeout time.Duration
+}
+
+// SummarizingConversation is a Conversation that automatically replaces its oldest turns
+// by a compact summary note, keeping the history under budget for very long sessions.
+// Callers keep using the usual Add*/MessagesCopy methods: the summarization is triggered when an assistant turn
+// without tool calls is added. The note is appended to the system prompt, since some providers like Gemini
+// keep only the first system message, and previous notes are folded into the next summary.
+// As for Conversation, all methods are safe for concurrent use; the summary request is sent without holding the lock.
+type SummarizingConversation struct {
+	*Conversation
+	cfg SummarizationConfig
+	// turnsSinceSummary counts the completed assistant turns since the last summary, guarded by Conversation.mu
+	turnsSinceSummary int
+}
+
+// NewSummarizingConversation creates a conversation with the given system prompt summarized as set by cfg.
+func NewSummarizingConversation(systemPrompt string, cfg SummarizationConfig) (*SummarizingConversation, error) {
+	if cfg.Provider == nil {
+		return nil, errors.New("summarization provider cannot be nil")
+	}
+	if cfg.EveryTurns <= 0 && cfg.MaxTokens <= 0 {
+		return nil, errors.New("summarization needs EveryTurns or MaxTokens to be set")
+	}
+	if cfg.KeepRecentTurns <= 0 {
+		cfg.KeepRecentTurns = defaultSummaryKeepRecentTurns
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultSummaryTimeout
+	}
+	if cfg.Estimator == nil {
+		cfg.Estimator = ProviderTokenEstimator(cfg.Provider)
+	}
+	conv, err := NewConversation(systemPrompt)
+	if err != nil {
+		return nil, err
+	}
+	return &SummarizingConversation{Conversation: conv, cfg: cfg}, nil
+}
+
+// AddAssistantResponse appends an assistant response and, when the turn is complete (no tool calls pending)
+// and a threshold is reached, summarizes the oldest turns. A failed summarization is logged and the history kept as is.
+func (s *SummarizingConversation) AddAssistantResponse(resp *LLMResponse) {
+	s.Conversation.AddAssistantResponse(resp)
+	if resp == nil || len(resp.ToolCalls) > 0 {
+		return
+	}
+	s.mu.Lock()
+	s.turnsSinceSummary++
+	due := s.summaryDue()
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+	defer cancel()
+	if err := s.Summarize(ctx); err != nil {
+		slog.Warn("Conversation summarization failed, keeping the full history", "error", err)
+	}
+}
+
+// summaryDue tells if a threshold is reached. The caller must hold mu.
+func (s *SummarizingConversation) summaryDue() bool {
+	if s.cfg.EveryTurns > 0 && s.turnsSinceSummary >= s.cfg.EveryTurns {
+		return true
+	}
+	return s.cfg.MaxTokens > 0 && s.cfg.Estimator.EstimateMessages(s.Messages) > s.cfg.MaxTokens
+}
+
+// Summarize replaces the turns older than the KeepRecentTurns last user turns by a summary note now.
+// It does nothing when there are not enough turns to summarize.
+func (s *SummarizingConversation) Summarize(ctx context.Context) error {
+	msgs := s.MessagesCopy()
+	cut := summaryCut(msgs, s.cfg.KeepRecentTurns)
+	window := msgs[1:cut]
+	if len(window) == 0 {
+		return nil
+	}
+	systemPrompt, previousSummary := splitSummaryNote(msgs[0].Content)
+	text := transcript(window)
+	if previousSummary != "" {
+		text = "[previous summary]\n" + previousSummary + "\n" + text
+	}
+	req := &LLMRequest{
+		Model: s.cfg.Model,
+		Messages: []LLMMessage{
+			{Role: RoleSystem, Content: summarizerSystemPrompt},
+			{Role: RoleUser, Content: text},
+		},
+		MaxTokens: s.cfg.SummaryMaxTokens,
+	}
+	resp, err := s.cfg.Provider.Query(ctx, req)
+	if err != nil {
+		return fmt.Errorf("summarization request failed: %w", err)
+	}
+	summary := strings.TrimSpace(resp.Text)
+	if summary == "" {
+		return errors.New("summarization returned an empty summary")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// turns can only have been appended meanwhile, unless the history was rewritten (e.g. by RegeneratePrep)
+	if len(s.Messages) < cut || s.Messages[0].Content != msgs[0].Content || s.Messages[cut-1].Content != msgs[cut-1].Content {
+		return errors.New("conversation changed during summarization")
+	}
+	system := s.Messages[0]
+	system.Content = systemPrompt + summaryNoteSeparator + summaryNotePrefix + summary
+	s.Messages[0] = system
+	s.removeMessages(1, cut)
+	s.turnsSinceSummary = 0
+	return nil
+}
+
+// summaryCut returns the index of the first message kept verbatim: the keepTurns-th user message from the end,
+// so that tool calls and their results are never split. It returns 1 (nothing to summarize) when there are too few turns.
+func summaryCut(msgs []LLMMessage, keepTurns int) int {
+	seen := 0
+	for i := len(msgs) - 1; i > 0; i-- {
+		if msgs[i].Role != RoleUser {
+			continue
+		}
+		seen++
+		if seen == keepTurns {
+			return i
+		}
+	}
+	return 1
+}
+
+// splitSummaryNote splits the content of the system message into the system prompt and the summary
+// appended by a SummarizingConversation, "" when there is none yet.
+func splitSummaryNote(content string) (systemPrompt, summary string) {
+	systemPrompt, summary, _ = strings.Cut(content, summaryNoteSeparator+summaryNotePrefix)
+	return systemPrompt, summary
+}
+
+// transcript renders messages as plain text for the summarizer.
+func transcript(msgs []LLMMessage) string {
+	var b strings.Builder
+	for _, msg := range msgs {
+		switch {
+		case msg.Role == RoleTool:
+			fmt.Fprintf(&b, "tool result (%s): %s\n", msg.ToolCallID, msg.Content)
+		default:
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "%s: %s\n", msg.Role, msg.Content)
+			}
+			for _, tc := range msg.ToolCalls {
+				fmt.Fprintf(&b, "%s called tool %s with %s\n", msg.Role, tc.Name, string(tc.Arguments))
+			}
+		}
+	}
+	return b.String()
+}
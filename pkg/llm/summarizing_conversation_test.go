@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSummarizingConversation(t *testing.T) {
+	systemPrompt := "You are a test assistant."
+
+	t.Run("Config", func(t *testing.T) {
+		if _, err := NewSummarizingConversation(systemPrompt, SummarizationConfig{EveryTurns: 2}); err == nil {
+			t.Error("Expected an error without provider, got nil")
+		}
+		if _, err := NewSummarizingConversation(systemPrompt, SummarizationConfig{Provider: &sequenceProvider{}}); err == nil {
+			t.Error("Expected an error without threshold, got nil")
+		}
+	})
+
+	t.Run("EveryTurns", func(t *testing.T) {
+		summarizer := &sequenceProvider{responses: []*LLMResponse{{Text: "User is Bob, likes tea."}, {Text: "Bob likes tea and lives in Bern."}}}
+		convo, err := NewSummarizingConversation(systemPrompt, SummarizationConfig{Provider: summarizer, EveryTurns: 3, KeepRecentTurns: 1})
+		if err != nil {
+			t.Fatalf("NewSummarizingConversation failed: %v", err)
+		}
+		turn := func(user, answer string) {
+			convo.AddUserMessage(user)
+			convo.AddAssistantResponse(&LLMResponse{Text: answer})
+		}
+		turn("I'm Bob", "Hi Bob")
+		turn("I like tea", "Noted")
+		if len(summarizer.requests) != 0 {
+			t.Fatalf("Expected no summarization before 3 turns, got %d", len(summarizer.requests))
+		}
+		turn("What do I like?", "Tea")
+
+		if len(summarizer.requests) != 1 {
+			t.Fatalf("Expected 1 summarization after 3 turns, got %d", len(summarizer.requests))
+		}
+		sent := summarizer.requests[0].Messages[1].Content
+		if !strings.Contains(sent, "user: I'm Bob") || strings.Contains(sent, "What do I like?") {
+			t.Errorf("Expected the oldest turns only in the summarized transcript, got %q", sent)
+		}
+		msgs := convo.MessagesCopy()
+		if len(msgs) != 3 || msgs[0].Content != systemPrompt+"\n\n"+summaryNotePrefix+"User is Bob, likes tea." || msgs[1].Content != "What do I like?" {
+			t.Fatalf("Expected the system prompt with the summary note and the last turn, got %#v", msgs)
+		}
+		payload, err := buildGeminiPayload(&LLMRequest{Messages: msgs})
+		if err != nil {
+			t.Fatalf("buildGeminiPayload failed: %v", err)
+		}
+		parts := (*payload.SystemInstruction)["parts"].([]map[string]any)
+		if sys := parts[0]["text"].(string); !strings.Contains(sys, systemPrompt) || !strings.Contains(sys, "User is Bob, likes tea.") {
+			t.Errorf("Expected the Gemini system instruction to hold the summary, got %q", sys)
+		}
+
+		turn("I live in Bern", "Nice")
+		turn("Where do I live?", "Bern")
+		turn("Thanks", "You're welcome")
+		if len(summarizer.requests) != 2 {
+			t.Fatalf("Expected a second summarization, got %d", len(summarizer.requests))
+		}
+		if sent := summarizer.requests[1].Messages[1].Content; !strings.Contains(sent, "[previous summary]\nUser is Bob, likes tea.") {
+			t.Errorf("Expected the previous summary to be folded into the next one, got %q", sent)
+		}
+		msgs = convo.MessagesCopy()
+		if len(msgs) != 3 || msgs[0].Content != systemPrompt+"\n\n"+summaryNotePrefix+"Bob likes tea and lives in Bern." {
+			t.Errorf("Expected a single updated summary note, got %#v", msgs)
+		}
+	})
+
+	t.Run("MaxTokensKeepsToolTurns", func(t *testing.T) {
+		summarizer := &sequenceProvider{responses: []*LLMResponse{{Text: "Long story was told."}}}
+		convo, _ := NewSummarizingConversation(systemPrompt, SummarizationConfig{Provider: summarizer, MaxTokens: 200, KeepRecentTurns: 1})
+		convo.AddUserMessage("Tell me a long story")
+		convo.AddAssistantResponse(&LLMResponse{Text: strings.Repeat("once upon a time ", 100)})
+		convo.AddUserMessage("What's the weather?")
+		convo.AddAssistantResponse(&LLMResponse{ToolCalls: []ToolCall{{ID: "call-1", Name: "get_weather"}}})
+		if len(summarizer.requests) != 0 {
+			t.Fatalf("Expected no summarization while tool calls are pending, got %d", len(summarizer.requests))
+		}
+		convo.AddToolResultMessage("call-1", `{"temp": 21}`)
+		convo.AddAssistantResponse(&LLMResponse{Text: "It's 21 degrees."})
+
+		msgs := convo.MessagesCopy()
+		if len(summarizer.requests) != 1 || len(msgs) != 5 {
+			t.Fatalf("Expected one summarization keeping the tool turn, got %d requests and %#v", len(summarizer.requests), msgs)
+		}
+		if msgs[1].Role != RoleUser || msgs[2].ToolCalls[0].ID != "call-1" || msgs[3].ToolCallID != "call-1" {
+			t.Errorf("Expected the last turn with its tool call and result to be kept, got %#v", msgs[1:])
+		}
+	})
+
+	t.Run("NothingToSummarize", func(t *testing.T) {
+		summarizer := &sequenceProvider{responses: []*LLMResponse{{Text: "unused"}}}
+		convo, _ := NewSummarizingConversation(systemPrompt, SummarizationConfig{Provider: summarizer, EveryTurns: 1})
+		convo.AddUserMessage("Hello")
+		convo.AddAssistantResponse(&LLMResponse{Text: "Hi"})
+		if err := convo.Summarize(context.Background()); err != nil {
+			t.Fatalf("Summarize failed: %v", err)
+		}
+		if len(summarizer.requests) != 0 || len(convo.MessagesCopy()) != 3 {
+			t.Errorf("Expected the recent turns to be kept without summarization, got %d requests", len(summarizer.requests))
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"strings"
+	"sync"
+)
+
+// TokenEstimator counts, or estimates, the tokens of a text and of chat messages for a model tokenizer.
+// The trimming, cost and context checks of the package count tokens with the estimator registered for the model,
+// see RegisterTokenEstimator and RegisterTokenCounter.
+type TokenEstimator interface {
+	EstimateText(s string) int
+	EstimateMessages(msgs []LLMMessage) int
+}
+
+// HeuristicTokenEstimator is the default TokenEstimator, using the EstimateTokens and EstimateMessagesTokens heuristics.
+type HeuristicTokenEstimator struct{}
+
+// EstimateText returns EstimateTokens(s).
+func (HeuristicTokenEstimator) EstimateText(s string) int {
+	return EstimateTokens(s)
+}
+
+// EstimateMessages returns EstimateMessagesTokens(msgs).
+func (HeuristicTokenEstimator) EstimateMessages(msgs []LLMMessage) int {
+	return EstimateMessagesTokens(msgs)
+}
+
+// TokenCounter counts the tokens of a text with an actual tokenizer, e.g. a tiktoken binding.
+// It is turned into a TokenEstimator by RegisterTokenCounter, which adds the overhead of the chat messages.
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// TokenCounterFunc adapts a function to the TokenCounter interface.
+type TokenCounterFunc func(text string) int
+
+// CountTokens returns f(text).
+func (f TokenCounterFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// counterEstimator is the TokenEstimator of a registered TokenCounter.
+type counterEstimator struct {
+	counter TokenCounter
+}
+
+// EstimateText returns the tokens of s counted by the counter.
+func (c counterEstimator) EstimateText(s string) int {
+	return c.counter.CountTokens(s)
+}
+
+// EstimateMessages returns the tokens of msgs counted by the counter, plus the chat template overhead of each message.
+func (c counterEstimator) EstimateMessages(msgs []LLMMessage) int {
+	return estimateMessages(msgs, c.counter.CountTokens)
+}
+
+// TokenEstimatorProvider is implemented by the providers recommending a TokenEstimator for their model.
+type TokenEstimatorProvider interface {
+	TokenEstimator() TokenEstimator
+}
+
+// tokenEstimators holds the registered estimators by model name prefix, "" being the default for all models,
+// and the registered token counters by provider kind.
+var tokenEstimators = struct {
+	sync.RWMutex
+	byPrefix map[string]TokenEstimator
+	byKind   map[ProviderKind]TokenCounter
+}{byPrefix: map[string]TokenEstimator{}, byKind: map[ProviderKind]TokenCounter{}}
+
+// RegisterTokenEstimator plugs estimator, e.g. a real BPE tokenizer, for the models whose name starts with modelPrefix
+// (e.g. "gpt-4o", "openai/"). An empty modelPrefix replaces the default estimator of all the models.
+// A nil estimator removes the registration. It is safe for concurrent use.
+func RegisterTokenEstimator(modelPrefix string, estimator TokenEstimator) {
+	tokenEstimators.Lock()
+	defer tokenEstimators.Unlock()
+	if estimator == nil {
+		delete(tokenEstimators.byPrefix, modelPrefix)
+		return
+	}
+	tokenEstimators.byPrefix[modelPrefix] = estimator
+}
+
+// RegisterTokenCounter plugs counter, e.g. a tiktoken binding, for all the models of the provider kind,
+// so that the default heuristic is only used when no better counter is available.
+// The estimators registered with RegisterTokenEstimator for a model prefix take precedence over it.
+// A nil counter removes the registration. It is safe for concurrent use.
+func RegisterTokenCounter(kind ProviderKind, counter TokenCounter) {
+	tokenEstimators.Lock()
+	defer tokenEstimators.Unlock()
+	if counter == nil {
+		delete(tokenEstimators.byKind, kind)
+		return
+	}
+	tokenEstimators.byKind[kind] = counter
+}
+
+// TokenEstimatorFor returns the estimator registered with the longest prefix of model,
+// and HeuristicTokenEstimator when none matches.
+func TokenEstimatorFor(model string) TokenEstimator {
+	return TokenEstimatorForProvider("", model)
+}
+
+// TokenEstimatorForProvider returns the estimator of model served by a provider of the given kind:
+// the estimator registered with the longest non-empty prefix of model, else the counter registered for kind,
+// else the default estimator registered with an empty prefix, and HeuristicTokenEstimator when there is none.
+func TokenEstimatorForProvider(kind ProviderKind, model string) TokenEstimator {
+	tokenEstimators.RLock()
+	defer tokenEstimators.RUnlock()
+	var best TokenEstimator
+	bestLen := 0
+	for prefix, estimator := range tokenEstimators.byPrefix {
+		if len(prefix) > bestLen && strings.HasPrefix(model, prefix) {
+			best, bestLen = estimator, len(prefix)
+		}
+	}
+	if best != nil {
+		return best
+	}
+	if counter, ok := tokenEstimators.byKind[kind]; ok && kind != "" {
+		return counterEstimator{counter}
+	}
+	if estimator, ok := tokenEstimators.byPrefix[""]; ok {
+		return estimator
+	}
+	return HeuristicTokenEstimator{}
+}
+
+// MessageTokens adapts estimator to the per message function of Conversation.TrimToTokenBudget, e.g. to trim
+// with the counter registered for a provider: convo.TrimToTokenBudget(limit, MessageTokens(ProviderTokenEstimator(provider))).
+func MessageTokens(estimator TokenEstimator) func(LLMMessage) int {
+	return func(msg LLMMessage) int { return estimator.EstimateMessages([]LLMMessage{msg}) }
+}
+
+// ProviderTokenEstimator returns the estimator recommended by provider when it implements TokenEstimatorProvider,
+// and the default estimator otherwise.
+func ProviderTokenEstimator(provider Provider) TokenEstimator {
+	if p, ok := provider.(TokenEstimatorProvider); ok {
+		return p.TokenEstimator()
+	}
+	return TokenEstimatorFor("")
+}
+
+// TokenEstimator returns the estimator registered for the model of the provider.
+func (p *openAICompatibleProvider) TokenEstimator() TokenEstimator {
+	return TokenEstimatorForProvider(p.Kind, p.Model)
+}
+
+// TokenEstimator returns the estimator registered for the model of the provider.
+func (g *GeminiProvider) TokenEstimator() TokenEstimator {
+	return TokenEstimatorForProvider(ProviderGemini, g.Model)
+}
+
+// TokenEstimator returns the estimator registered for the model of the provider.
+func (o *OllamaProvider) TokenEstimator() TokenEstimator {
+	return TokenEstimatorForProvider(ProviderOllama, o.Model)
+}
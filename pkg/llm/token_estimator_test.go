@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenEstimatorRegistry(t *testing.T) {
+	gpt := wordTokenEstimator{}
+	RegisterTokenEstimator("gpt-", gpt)
+	t.Cleanup(func() { RegisterTokenEstimator("gpt-", nil) })
+
+	if _, ok := TokenEstimatorFor("gpt-4o-mini").(wordTokenEstimator); !ok {
+		t.Errorf("Expected the registered estimator for gpt-4o-mini, got %T", TokenEstimatorFor("gpt-4o-mini"))
+	}
+	if _, ok := TokenEstimatorFor("gemini-2.5-flash").(HeuristicTokenEstimator); !ok {
+		t.Errorf("Expected HeuristicTokenEstimator for gemini-2.5-flash, got %T", TokenEstimatorFor("gemini-2.5-flash"))
+	}
+
+	// the longest prefix wins over the default estimator
+	RegisterTokenEstimator("", HeuristicTokenEstimator{})
+	t.Cleanup(func() { RegisterTokenEstimator("", nil) })
+	if _, ok := TokenEstimatorFor("gpt-4o").(wordTokenEstimator); !ok {
+		t.Errorf("Expected the longest prefix estimator for gpt-4o, got %T", TokenEstimatorFor("gpt-4o"))
+	}
+
+	p := &openAICompatibleProvider{Model: "gpt-4o"}
+	if _, ok := ProviderTokenEstimator(p).(wordTokenEstimator); !ok {
+		t.Errorf("Expected the provider to recommend the registered estimator, got %T", ProviderTokenEstimator(p))
+	}
+}
+
+func TestTokenCounterRegistry(t *testing.T) {
+	words := TokenCounterFunc(func(text string) int { return len(strings.Fields(text)) })
+	RegisterTokenCounter(ProviderOpenAI, words)
+	t.Cleanup(func() { RegisterTokenCounter(ProviderOpenAI, nil) })
+
+	estimator := TokenEstimatorForProvider(ProviderOpenAI, "o3-mini")
+	if got := estimator.EstimateText("one two three"); got != 3 {
+		t.Errorf("Expected the registered counter to count 3 tokens, got %d", got)
+	}
+	msgs := []LLMMessage{{Role: RoleUser, Content: "one two three"}}
+	if got := estimator.EstimateMessages(msgs); got != 3+perMessageTokens {
+		t.Errorf("Expected %d tokens with the message overhead, got %d", 3+perMessageTokens, got)
+	}
+	if _, ok := TokenEstimatorForProvider(ProviderGemini, "o3-mini").(HeuristicTokenEstimator); !ok {
+		t.Errorf("Expected the heuristic for another provider kind, got %T", TokenEstimatorForProvider(ProviderGemini, "o3-mini"))
+	}
+	p := &openAICompatibleProvider{Kind: ProviderOpenAI, Model: "o3-mini"}
+	if got := ProviderTokenEstimator(p).EstimateText("one two"); got != 2 {
+		t.Errorf("Expected the provider to use the registered counter, got %d tokens", got)
+	}
+	newConvo := func() *Conversation {
+		convo, _ := NewConversation("one")
+		convo.AddUserMessage("a b c d e f g h i j")
+		convo.AddAssistantResponse(&LLMResponse{Text: "one"})
+		return convo
+	}
+	// the counter gives 5 + 14 + 5 tokens, more than the heuristic for the short words of the user message
+	if removed := newConvo().TrimToTokenBudget(20, nil); removed != 0 {
+		t.Errorf("Expected the heuristic to keep the messages, removed %d", removed)
+	}
+	if removed := newConvo().TrimToTokenBudget(20, MessageTokens(ProviderTokenEstimator(p))); removed != 1 {
+		t.Errorf("Expected the trimming to use the registered counter and remove 1 message, removed %d", removed)
+	}
+
+	// an estimator registered for a model prefix takes precedence over the counter of the provider kind
+	RegisterTokenEstimator("o3", wordTokenEstimator{})
+	t.Cleanup(func() { RegisterTokenEstimator("o3", nil) })
+	if _, ok := TokenEstimatorForProvider(ProviderOpenAI, "o3-mini").(wordTokenEstimator); !ok {
+		t.Errorf("Expected the model prefix estimator, got %T", TokenEstimatorForProvider(ProviderOpenAI, "o3-mini"))
+	}
+}
@@ -0,0 +1,189 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultMaxToolRounds is the number of tool rounds allowed when a tool loop is given a maxRounds <= 0.
+const DefaultMaxToolRounds = 10
+
+// DefaultToolCancelGracePeriod is how long a tool loop waits, once its context is cancelled,
+// for the running tool to return before giving up on it.
+const DefaultToolCancelGracePeriod = time.Second
+
+// ErrMaxToolRounds is returned when the model still asks for tools after the allowed number of rounds.
+var ErrMaxToolRounds = errors.New("maximum number of tool rounds reached")
+
+// ToolRegistry executes a tool call by the tool name, ExampleToolRegistry implements it.
+type ToolRegistry interface {
+	Execute(name string, args json.RawMessage) (string, error)
+}
+
+// ToolRegistryFunc adapts a function to the ToolRegistry interface.
+type ToolRegistryFunc func(name string, args json.RawMessage) (string, error)
+
+// Execute calls f(name, args).
+func (f ToolRegistryFunc) Execute(name string, args json.RawMessage) (string, error) {
+	return f(name, args)
+}
+
+// ContextToolRegistry is a ToolRegistry whose executions can be cancelled,
+// the tool loops call ExecuteContext with their context when the registry implements it.
+type ContextToolRegistry interface {
+	ToolRegistry
+	ExecuteContext(ctx context.Context, name string, args json.RawMessage) (string, error)
+}
+
+// ContextToolRegistryFunc adapts a context-aware function to the ContextToolRegistry interface.
+type ContextToolRegistryFunc func(ctx context.Context, name string, args json.RawMessage) (string, error)
+
+// Execute calls f with a background context.
+func (f ContextToolRegistryFunc) Execute(name string, args json.RawMessage) (string, error) {
+	return f(context.Background(), name, args)
+}
+
+// ExecuteContext calls f(ctx, name, args).
+func (f ContextToolRegistryFunc) ExecuteContext(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	return f(ctx, name, args)
+}
+
+// ToolLoopOptions configures RunToolLoopWithOptions.
+type ToolLoopOptions struct {
+	// MaxRounds bounds the number of tool rounds, DefaultMaxToolRounds when <= 0
+	MaxRounds int
+	// CancelGracePeriod is how long to wait for a running tool to return once the context is cancelled,
+	// DefaultToolCancelGracePeriod when <= 0. Tools ignoring the cancellation are left running in the background.
+	CancelGracePeriod time.Duration
+}
+
+// ToolLoopStep records one tool execution of a tool loop.
+type ToolLoopStep struct {
+	Round    int // 1 for the tools requested by the first response
+	ToolCall ToolCall
+	Result   string // the result sent back to the model, the JSON error message when Err is not nil
+	Err      error
+}
+
+// ToolLoopResult is the outcome of a tool loop: the last model response, the number of tool rounds executed
+// and the trace of every tool call with its result, in execution order.
+type ToolLoopResult struct {
+	Response *LLMResponse
+	Rounds   int
+	Trace    []ToolLoopStep
+}
+
+// RunToolLoopWithTrace queries provider with the conversation and tools, executes the requested tool calls
+// with registry, appends the results to the conversation and queries again, until the model answers without
+// asking for tools. A tool error is sent back to the model as a {"error": "..."} result so it can recover.
+// After maxRounds tool rounds (DefaultMaxToolRounds when <= 0), it stops and returns ErrMaxToolRounds
+// along with the result so far, the calls not executed getting an error result so the conversation stays valid. The result is also returned with a query error, to keep the trace.
+func RunToolLoopWithTrace(ctx context.Context, provider Provider, convo *Conversation, tools []Tool, registry ToolRegistry, maxRounds int) (*ToolLoopResult, error) {
+	return RunToolLoopWithOptions(ctx, provider, convo, tools, registry, ToolLoopOptions{MaxRounds: maxRounds})
+}
+
+// RunToolLoopWithOptions is RunToolLoopWithTrace configured by opts.
+// When ctx is cancelled while a tool is running, the tool is cancelled through its context
+// if registry is a ContextToolRegistry, and the loop returns ctx.Err() once the tool returned
+// or after opts.CancelGracePeriod, whichever comes first. The calls not executed then get a {"error": "cancelled"}
+// result, so that the conversation can be continued.
+func RunToolLoopWithOptions(ctx context.Context, provider Provider, convo *Conversation, tools []Tool, registry ToolRegistry, opts ToolLoopOptions) (*ToolLoopResult, error) {
+	if provider == nil || convo == nil || registry == nil {
+		return nil, errors.New("provider, conversation and tool registry cannot be nil")
+	}
+	maxRounds := opts.MaxRounds
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxToolRounds
+	}
+	gracePeriod := opts.CancelGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultToolCancelGracePeriod
+	}
+	result := &ToolLoopResult{}
+	for {
+		resp, err := provider.Query(ctx, &LLMRequest{Messages: convo.MessagesCopy(), Tools: tools})
+		if err != nil {
+			return result, fmt.Errorf("tool loop query after %d round(s) failed: %w", result.Rounds, err)
+		}
+		result.Response = resp
+		convo.AddAssistantResponse(resp)
+		if len(resp.ToolCalls) == 0 {
+			return result, nil
+		}
+		if result.Rounds >= maxRounds {
+			addSkippedToolResults(convo, resp.ToolCalls, ErrMaxToolRounds.Error())
+			return result, fmt.Errorf("%w (%d), the model still asks for %d tool call(s)", ErrMaxToolRounds, maxRounds, len(resp.ToolCalls))
+		}
+		result.Rounds++
+		for i, call := range resp.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				addSkippedToolResults(convo, resp.ToolCalls[i:], "cancelled")
+				return result, err
+			}
+			out, err := executeTool(ctx, registry, call, gracePeriod)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				addSkippedToolResults(convo, resp.ToolCalls[i:], "cancelled")
+				return result, ctxErr
+			}
+			if err != nil {
+				errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+				out = string(errJSON)
+			}
+			result.Trace = append(result.Trace, ToolLoopStep{Round: result.Rounds, ToolCall: call, Result: out, Err: err})
+			convo.AddToolResultMessage(call.ID, out)
+		}
+	}
+}
+
+// addSkippedToolResults appends a {"error": reason} result for each of calls, since the providers reject
+// a conversation whose assistant tool calls have no result, so that it can be continued after the loop stopped.
+func addSkippedToolResults(convo *Conversation, calls []ToolCall, reason string) {
+	errJSON, _ := json.Marshal(map[string]string{"error": reason})
+	for _, call := range calls {
+		convo.AddToolResultMessage(call.ID, string(errJSON))
+	}
+}
+
+// executeTool runs call with registry in its own goroutine, so that it can be abandoned when ctx is cancelled:
+// the tool is then given gracePeriod to return before ctx.Err() is returned.
+func executeTool(ctx context.Context, registry ToolRegistry, call ToolCall, gracePeriod time.Duration) (string, error) {
+	type outcome struct {
+		out string
+		err error
+	}
+	done := make(chan outcome, 1) // buffered so an abandoned tool doesn't leak its goroutine forever
+	go func() {
+		var o outcome
+		if ctxRegistry, ok := registry.(ContextToolRegistry); ok {
+			o.out, o.err = ctxRegistry.ExecuteContext(ctx, call.Name, call.Arguments)
+		} else {
+			o.out, o.err = registry.Execute(call.Name, call.Arguments)
+		}
+		done <- o
+	}()
+	select {
+	case o := <-done:
+		return o.out, o.err
+	case <-ctx.Done():
+	}
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+	return "", ctx.Err()
+}
+
+// RunToolLoop automates the tool calling cycle like RunToolLoopWithTrace, and returns only the final assistant response.
+// maxIterations bounds the number of tool rounds, guarding against a model asking for tools forever.
+func RunToolLoop(ctx context.Context, provider Provider, convo *Conversation, tools []Tool, registry ToolRegistry, maxIterations int) (*LLMResponse, error) {
+	result, err := RunToolLoopWithTrace(ctx, provider, convo, tools, registry, maxIterations)
+	if err != nil {
+		return nil, err
+	}
+	return result.Response, nil
+}
@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequenceProvider is a fake Provider whose Query returns the given responses in turn, repeating the last one.
+type sequenceProvider struct {
+	mu        sync.Mutex
+	responses []*LLMResponse
+	requests  []*LLMRequest
+}
+
+func (p *sequenceProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	resp := p.responses[min(len(p.requests), len(p.responses))-1]
+	return resp, nil
+}
+
+func (p *sequenceProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	return QueryAsStream(ctx, p, req, onDelta)
+}
+
+func (p *sequenceProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return nil, nil
+}
+
+func TestRunToolLoopWithTrace(t *testing.T) {
+	weatherCall := func(id string) ToolCall {
+		return ToolCall{ID: id, Name: "get_weather", Arguments: []byte(`{"location": "Lausanne"}`)}
+	}
+	registry := ToolRegistryFunc(func(name string, args json.RawMessage) (string, error) {
+		if name != "get_weather" {
+			return "", fmt.Errorf("unknown tool %s", name)
+		}
+		return `{"temp": 21}`, nil
+	})
+
+	t.Run("RunsUntilFinalAnswer", func(t *testing.T) {
+		provider := &sequenceProvider{responses: []*LLMResponse{
+			{ToolCalls: []ToolCall{weatherCall("call-1"), {ID: "call-2", Name: "get_time"}}},
+			{ToolCalls: []ToolCall{weatherCall("call-3")}},
+			{Text: "It's 21 degrees."},
+		}}
+		convo, _ := NewConversation("You are a weather assistant.")
+		convo.AddUserMessage("Weather in Lausanne?")
+
+		result, err := RunToolLoopWithTrace(context.Background(), provider, convo, nil, registry, 5)
+		if err != nil {
+			t.Fatalf("RunToolLoopWithTrace failed: %v", err)
+		}
+		if result.Response.Text != "It's 21 degrees." || result.Rounds != 2 {
+			t.Errorf("Expected the final answer after 2 rounds, got %q after %d", result.Response.Text, result.Rounds)
+		}
+		if len(result.Trace) != 3 || result.Trace[1].Err == nil || result.Trace[2].Round != 2 {
+			t.Fatalf("Unexpected trace: %#v", result.Trace)
+		}
+		if result.Trace[1].Result != `{"error":"unknown tool get_time"}` {
+			t.Errorf("Expected the tool error to be sent as result, got %s", result.Trace[1].Result)
+		}
+		// system, user, assistant, 2 tools, assistant, 1 tool, assistant
+		if len(convo.Messages) != 8 || len(provider.requests[2].Messages) != 7 {
+			t.Errorf("Expected the conversation to hold every turn, got %d messages", len(convo.Messages))
+		}
+	})
+
+	t.Run("StopsAfterMaxRounds", func(t *testing.T) {
+		provider := &sequenceProvider{responses: []*LLMResponse{{ToolCalls: []ToolCall{weatherCall("call-x")}}}}
+		convo, _ := NewConversation("You are a weather assistant.")
+		convo.AddUserMessage("Weather in Lausanne?")
+
+		result, err := RunToolLoopWithTrace(context.Background(), provider, convo, nil, registry, 3)
+		if !errors.Is(err, ErrMaxToolRounds) {
+			t.Fatalf("Expected ErrMaxToolRounds, got %v", err)
+		}
+		if result.Rounds != 3 || len(result.Trace) != 3 || len(provider.requests) != 4 {
+			t.Errorf("Expected 3 rounds and 4 queries, got %d rounds, %d steps and %d queries", result.Rounds, len(result.Trace), len(provider.requests))
+		}
+		msgs := convo.MessagesCopy()
+		if last := msgs[len(msgs)-1]; last.Role != RoleTool || last.ToolCallID != "call-x" || last.Content != `{"error":"maximum number of tool rounds reached"}` {
+			t.Errorf("Expected an error result for the call not executed, got %#v", last)
+		}
+
+		// the conversation can be continued, every tool call having its result
+		provider.responses = []*LLMResponse{{Text: "Sorry, I couldn't get the weather."}}
+		provider.requests = nil
+		convo.AddUserMessage("Never mind")
+		if _, err := RunToolLoop(context.Background(), provider, convo, nil, registry, 3); err != nil {
+			t.Fatalf("RunToolLoop on the same conversation failed: %v", err)
+		}
+		if err := checkToolResults(provider.requests[0].Messages); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestRunToolLoop(t *testing.T) {
+	provider := &sequenceProvider{responses: []*LLMResponse{
+		{ToolCalls: []ToolCall{{ID: "call-1", Name: "get_weather", Arguments: []byte(`{}`)}}},
+		{Text: "Sunny."},
+	}}
+	convo, _ := NewConversation("You are a weather assistant.")
+	convo.AddUserMessage("Weather?")
+	registry := ExampleToolRegistry{"get_weather": weatherExecutor{}}
+
+	resp, err := RunToolLoop(context.Background(), provider, convo, nil, registry, 2)
+	if err != nil {
+		t.Fatalf("RunToolLoop failed: %v", err)
+	}
+	if resp.Text != "Sunny." {
+		t.Errorf("Expected the final response 'Sunny.', got %q", resp.Text)
+	}
+	if msgs := convo.MessagesCopy(); msgs[3].Role != RoleTool || msgs[3].Content != "sunny" {
+		t.Errorf("Expected the tool result in the conversation, got %#v", msgs[3])
+	}
+}
+
+// checkToolResults returns an error when a tool call of msgs has no result, like the providers do.
+func checkToolResults(msgs []LLMMessage) error {
+	pending := map[string]bool{}
+	for _, msg := range msgs {
+		if msg.Role == RoleTool {
+			delete(pending, msg.ToolCallID)
+			continue
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("tool calls without result before a %s message: %v", msg.Role, pending)
+		}
+		for _, tc := range msg.ToolCalls {
+			pending[tc.ID] = true
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("tool calls without result: %v", pending)
+	}
+	return nil
+}
+
+// weatherExecutor is a ToolExecutor always answering "sunny".
+type weatherExecutor struct{}
+
+func (weatherExecutor) Execute(args json.RawMessage) (string, error) {
+	return "sunny", nil
+}
+
+func TestRunToolLoopCancelledDuringTool(t *testing.T) {
+	newProvider := func() *sequenceProvider {
+		return &sequenceProvider{responses: []*LLMResponse{
+			{ToolCalls: []ToolCall{{ID: "call-1", Name: "slow_scan", Arguments: []byte(`{}`)}, {ID: "call-2", Name: "slow_scan", Arguments: []byte(`{}`)}}},
+			{Text: "Done."},
+		}}
+	}
+	tests := []struct {
+		name       string
+		registry   func(cancelled chan<- struct{}) ToolRegistry
+		wantCancel bool
+	}{
+		{
+			name: "ContextAwareTool",
+			registry: func(cancelled chan<- struct{}) ToolRegistry {
+				return ContextToolRegistryFunc(func(ctx context.Context, name string, args json.RawMessage) (string, error) {
+					<-ctx.Done()
+					close(cancelled)
+					return "", ctx.Err()
+				})
+			},
+			wantCancel: true,
+		},
+		{
+			name: "ToolIgnoringCancellation",
+			registry: func(chan<- struct{}) ToolRegistry {
+				return ToolRegistryFunc(func(name string, args json.RawMessage) (string, error) {
+					time.Sleep(2 * time.Second)
+					return "too late", nil
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			convo, _ := NewConversation("You are a security assistant.")
+			convo.AddUserMessage("Scan the network")
+			cancelled := make(chan struct{})
+
+			start := time.Now()
+			provider := newProvider()
+			result, err := RunToolLoopWithOptions(ctx, provider, convo, nil, tt.registry(cancelled), ToolLoopOptions{CancelGracePeriod: 100 * time.Millisecond})
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the loop to return promptly after cancellation, took %v", elapsed)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+			}
+			if result == nil || result.Rounds != 1 || len(result.Trace) != 0 {
+				t.Errorf("Expected the partial result without the cancelled tool step, got %#v", result)
+			}
+			if tt.wantCancel {
+				select {
+				case <-cancelled:
+				default:
+					t.Error("Expected the tool context to be cancelled")
+				}
+			}
+
+			msgs := convo.MessagesCopy()
+			if len(msgs) != 5 || msgs[3].ToolCallID != "call-1" || msgs[4].ToolCallID != "call-2" || msgs[4].Content != `{"error":"cancelled"}` {
+				t.Fatalf("Expected a cancelled result for each call not executed, got %#v", msgs)
+			}
+			// the conversation can be continued after the cancellation
+			convo.AddUserMessage("Forget the scan")
+			resp, err := RunToolLoop(context.Background(), provider, convo, nil, tt.registry(make(chan struct{})), 1)
+			if err != nil || resp.Text != "Done." {
+				t.Fatalf("Expected the conversation to be reusable, got %v and %#v", err, resp)
+			}
+			if err := checkToolResults(provider.requests[1].Messages); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -3,15 +3,47 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"slices"
 	"strings"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
 )
 
 // ToOpenAIChatMessages converts internal messages to OpenAI API format.
 // It handles optional fields like tool_calls and ensures compatibility.
+// Assistant reasoning is omitted, use ToOpenAIChatMessagesFor to follow a provider's replay rules.
 func ToOpenAIChatMessages(msgs []LLMMessage) []map[string]any {
+	return toOpenAIChatMessages(msgs, "")
+}
+
+// ToOpenAIChatMessagesFor converts internal messages to the OpenAI API format used by the given provider.
+// Assistant reasoning is echoed in the field expected by the provider (see ReasoningInputField),
+// or omitted for providers that reject it on input.
+func ToOpenAIChatMessagesFor(kind ProviderKind, msgs []LLMMessage) []map[string]any {
+	return toOpenAIChatMessages(msgs, ReasoningInputField(kind))
+}
+
+// ReasoningInputField returns the assistant message field used to replay previous reasoning to a provider,
+// or an empty string when the reasoning must be omitted.
+//   - OpenRouter normalizes reasoning in a "reasoning" field and accepts it back.
+//   - Ollama uses a "thinking" field on assistant messages.
+//   - OpenAI, XAI and Gemini don't accept reasoning on input (DeepSeek-like APIs even reject a replayed reasoning_content).
+func ReasoningInputField(kind ProviderKind) string {
+	switch kind {
+	case ProviderOpenRouter:
+		return "reasoning"
+	case ProviderOllama:
+		return "thinking"
+	default:
+		return ""
+	}
+}
+
+func toOpenAIChatMessages(msgs []LLMMessage, reasoningField string) []map[string]any {
 	out := make([]map[string]any, 0, len(msgs))
 	for _, msg := range msgs {
 		item := map[string]any{
@@ -24,6 +56,9 @@ func ToOpenAIChatMessages(msgs []LLMMessage) []map[string]any {
 		if msg.ToolCallID != "" {
 			item["tool_call_id"] = msg.ToolCallID
 		}
+		if reasoningField != "" && msg.Role == RoleAssistant && msg.Reasoning != "" {
+			item[reasoningField] = msg.Reasoning
+		}
 		if len(msg.ToolCalls) > 0 {
 			apiToolCalls := make([]map[string]any, len(msg.ToolCalls))
 			for i, tc := range msg.ToolCalls {
@@ -44,6 +79,53 @@ func ToOpenAIChatMessages(msgs []LLMMessage) []map[string]any {
 	return out
 }
 
+// WithLanguageHint returns a copy of msgs where a "Respond in {language}" instruction
+// is appended to the first system message, or prepended as a new system message if there is none.
+// It returns msgs unchanged when language is empty.
+func WithLanguageHint(msgs []LLMMessage, language string) []LLMMessage {
+	language = strings.TrimSpace(language)
+	if language == "" {
+		return msgs
+	}
+	hint := fmt.Sprintf("Respond in %s.", language)
+	out := slices.Clone(msgs)
+	for i, msg := range out {
+		if msg.Role == RoleSystem && msg.Content != "" {
+			out[i].Content = msg.Content + "\n" + hint
+			return out
+		}
+	}
+	return append([]LLMMessage{{Role: RoleSystem, Content: hint}}, out...)
+}
+
+// preparedMessages returns the messages of req as they are sent to the provider, once the normalization steps
+// (like the language hint) are applied, before their conversion to the wire format of the provider.
+func preparedMessages(req *LLMRequest) []LLMMessage {
+	return WithLanguageHint(req.Messages, req.Language)
+}
+
+// withSentMessages sets resp.SentMessages to the messages sent for req when req.IncludeSentMessages is set.
+func withSentMessages(req *LLMRequest, resp *LLMResponse, err error) (*LLMResponse, error) {
+	if err != nil || resp == nil || req == nil || !req.IncludeSentMessages {
+		return resp, err
+	}
+	resp.SentMessages = slices.Clone(preparedMessages(req))
+	return resp, nil
+}
+
+// finishResponse applies the post-processing common to the providers to the response of a query or stream
+// started at start: the metrics, the sent messages and the JSON extraction requested by req.
+func finishResponse(req *LLMRequest, start time.Time, resp *LLMResponse, err error, l golog.MyLogger) (*LLMResponse, error) {
+	if err == nil && resp != nil {
+		if resp.Metrics == nil {
+			resp.Metrics = &Metrics{}
+		}
+		resp.Metrics.Duration = time.Since(start)
+	}
+	resp, err = withSentMessages(req, resp, err)
+	return extractJSONIfRequested(req, resp, err, l)
+}
+
 // FirstNonEmpty returns the first non-empty string, falling back to the second.
 func FirstNonEmpty(a, b string) string {
 	if a != "" {
@@ -80,23 +162,152 @@ func IsModelExcluded(modelName string, excludePatterns []string) bool {
 	})
 }
 
-func StreamQuery(ctx context.Context, provider Provider, req *LLMRequest) (<-chan Delta, error) {
+// QueryAsStream performs a regular Query and emits the full text as a single delta followed by a done delta.
+// It gives a uniform streaming API for models or providers that don't support streaming.
+func QueryAsStream(ctx context.Context, provider Provider, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	if onDelta == nil {
+		return nil, errors.New("onDelta callback cannot be nil for streaming")
+	}
+	queryReq := *req
+	queryReq.Stream = false
+	queryReq.FakeStreamIfUnsupported = false
+	firstChunk := firstChunkNotifier(req, time.Now())
+	resp, err := provider.Query(ctx, &queryReq)
+	if err != nil {
+		return nil, err
+	}
+	firstChunk()
+	if resp.Reasoning != "" {
+		onDelta(Delta{Reasoning: resp.Reasoning})
+	}
+	if resp.Text != "" || len(resp.ToolCalls) > 0 {
+		onDelta(Delta{Text: resp.Text, ToolCalls: resp.ToolCalls})
+	}
+	onDelta(Delta{Done: true, FinishReason: resp.FinishReason})
+	return resp, nil
+}
 
-	deltaChan := make(chan Delta)
+// withDeltaTimestamps returns onDelta stamping each delta with its Elapsed time since now
+// when req.TimestampDeltas is set, and onDelta unchanged otherwise.
+func withDeltaTimestamps(req *LLMRequest, onDelta func(Delta)) func(Delta) {
+	if req == nil || !req.TimestampDeltas || onDelta == nil {
+		return onDelta
+	}
+	start := time.Now()
+	return func(d Delta) {
+		d.Elapsed = time.Since(start)
+		onDelta(d)
+	}
+}
+
+// firstChunkNotifier returns a func calling req.OnFirstChunk with the time elapsed since start on its first call only,
+// to be called by the streaming providers on each received chunk. It does nothing when req has no OnFirstChunk hook.
+func firstChunkNotifier(req *LLMRequest, start time.Time) func() {
+	if req == nil || req.OnFirstChunk == nil {
+		return func() {}
+	}
+	notified := false
+	return func() {
+		if !notified {
+			notified = true
+			req.OnFirstChunk(time.Since(start))
+		}
+	}
+}
 
-	// The onDelta callback now sends to the channel
-	onDelta := func(delta Delta) {
+// withRawChunk returns onDelta attaching raw to each delta as Delta.RawChunk, and onDelta unchanged when raw is nil.
+func withRawChunk(onDelta func(Delta), raw json.RawMessage) func(Delta) {
+	if raw == nil {
+		return onDelta
+	}
+	return func(d Delta) {
+		d.RawChunk = raw
+		onDelta(d)
+	}
+}
+
+// decodeStreamChunk decodes the next JSON value of decoder into chunk,
+// and returns its raw bytes when keepRaw is set (see LLMRequest.IncludeRawChunks).
+func decodeStreamChunk(decoder *json.Decoder, chunk any, keepRaw bool) (json.RawMessage, error) {
+	if !keepRaw {
+		return nil, decoder.Decode(chunk)
+	}
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, json.Unmarshal(raw, chunk)
+}
+
+// StreamLines streams req with provider and calls onLine once per complete newline-delimited line
+// (without the trailing newline) instead of once per token fragment, the last partial line is flushed at the end.
+// It is handy to write streamed output to a logger.
+func StreamLines(ctx context.Context, provider Provider, req *LLMRequest, onLine func(string)) (*LLMResponse, error) {
+	if onLine == nil {
+		return nil, errors.New("onLine callback cannot be nil for streaming")
+	}
+	var pending strings.Builder
+	resp, err := provider.Stream(ctx, req, func(delta Delta) {
+		if delta.Text == "" {
+			return
+		}
+		pending.WriteString(delta.Text)
+		buffered := pending.String()
+		lastNewline := strings.LastIndexByte(buffered, '\n')
+		if lastNewline < 0 {
+			return
+		}
+		for _, line := range strings.Split(buffered[:lastNewline], "\n") {
+			onLine(strings.TrimSuffix(line, "\r"))
+		}
+		pending.Reset()
+		pending.WriteString(buffered[lastNewline+1:])
+	})
+	if pending.Len() > 0 {
+		onLine(strings.TrimSuffix(pending.String(), "\r"))
+	}
+	return resp, err
+}
+
+// StreamQuery runs provider.Stream in a goroutine and sends the deltas over the returned channel,
+// which is closed when the stream ends. When the stream fails, a last Delta with Done set and Err holding
+// the error is sent (by the provider, or by StreamQuery when it failed before starting),
+// so the consumer ranging over the channel learns why the stream stopped.
+// The consumer must read the channel until closed or cancel ctx, once ctx is done the pending deltas are dropped,
+// except the last Done one which is always delivered.
+func StreamQuery(ctx context.Context, provider Provider, req *LLMRequest) (<-chan Delta, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	// the buffer guarantees room for the done delta once ctx is done, without blocking on a consumer gone away
+	deltaChan := make(chan Delta, 1)
+	doneSent := false
+	send := func(delta Delta) {
+		doneSent = doneSent || delta.Done
+		select {
+		case deltaChan <- delta:
+			return
+		case <-ctx.Done():
+		}
+		if !delta.Done {
+			return
+		}
+		// StreamQuery is the only sender, so once the delta not read yet is dropped the buffer has room
+		select {
+		case <-deltaChan:
+		default:
+		}
 		deltaChan <- delta
 	}
 
-	// Run the provider's stream method in a goroutine
 	go func() {
-		defer close(deltaChan) // Close the channel when the stream is done
-		_, err := provider.Stream(ctx, req, onDelta)
-		if err != nil {
-			// How to handle errors is a key design decision here.
-			// You could send an error type over the channel, for example.
-			fmt.Printf("Error during stream: %v\n", err)
+		defer close(deltaChan)
+		// the providers end a failed stream with a done delta holding the error, except when it failed before starting
+		if _, err := provider.Stream(ctx, req, send); err != nil && !doneSent {
+			send(Delta{Done: true, FinishReason: FinishReasonError, Err: err})
 		}
 	}()
 
@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLanguageHint(t *testing.T) {
+	t.Run("EmptyLanguageIsNoOp", func(t *testing.T) {
+		msgs := []LLMMessage{{Role: RoleSystem, Content: "sys"}, {Role: RoleUser, Content: "hi"}}
+		got := WithLanguageHint(msgs, "")
+		if len(got) != 2 || got[0].Content != "sys" {
+			t.Errorf("Expected messages to be unchanged, got %#v", got)
+		}
+	})
+
+	t.Run("AppendsToExistingSystemMessage", func(t *testing.T) {
+		msgs := []LLMMessage{{Role: RoleSystem, Content: "sys"}, {Role: RoleUser, Content: "hi"}}
+		got := WithLanguageHint(msgs, "French")
+		if len(got) != 2 {
+			t.Fatalf("Expected 2 messages, got %d", len(got))
+		}
+		if got[0].Content != "sys\nRespond in French." {
+			t.Errorf("Unexpected system content: %q", got[0].Content)
+		}
+		if msgs[0].Content != "sys" {
+			t.Error("Original messages were modified, WithLanguageHint must work on a copy")
+		}
+	})
+
+	t.Run("PrependsSystemMessageWhenMissing", func(t *testing.T) {
+		msgs := []LLMMessage{{Role: RoleUser, Content: "hi"}}
+		got := WithLanguageHint(msgs, "fr-CH")
+		if len(got) != 2 || got[0].Role != RoleSystem || got[0].Content != "Respond in fr-CH." {
+			t.Errorf("Expected a new leading system message, got %#v", got)
+		}
+	})
+}
+
+func TestToOpenAIChatMessagesForReasoning(t *testing.T) {
+	msgs := []LLMMessage{
+		{Role: RoleUser, Content: "2+2?"},
+		{Role: RoleAssistant, Content: "4", Reasoning: "adding two and two"},
+	}
+	testCases := []struct {
+		kind      ProviderKind
+		wantField string
+	}{
+		{ProviderOpenRouter, "reasoning"},
+		{ProviderOllama, "thinking"},
+		{ProviderOpenAI, ""},
+		{ProviderXAI, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.kind), func(t *testing.T) {
+			out := ToOpenAIChatMessagesFor(tc.kind, msgs)
+			assistant := out[1]
+			for _, field := range []string{"reasoning", "thinking", "reasoning_content"} {
+				_, present := assistant[field]
+				if field == tc.wantField && !present {
+					t.Errorf("Expected field %q to be echoed", field)
+				}
+				if field != tc.wantField && present {
+					t.Errorf("Expected field %q to be omitted", field)
+				}
+			}
+		})
+	}
+	if _, present := ToOpenAIChatMessages(msgs)[1]["reasoning"]; present {
+		t.Error("Expected ToOpenAIChatMessages to omit reasoning")
+	}
+}
+
+// scriptedStreamProvider is a fake Provider whose Stream emits the given text deltas.
+type scriptedStreamProvider struct {
+	deltas []string
+	err    error // returned by Stream after the deltas when set
+}
+
+func (p *scriptedStreamProvider) Query(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return &LLMResponse{Text: strings.Join(p.deltas, "")}, nil
+}
+
+func (p *scriptedStreamProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	for _, d := range p.deltas {
+		onDelta(Delta{Text: d})
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	onDelta(Delta{Done: true, FinishReason: "stop"})
+	return &LLMResponse{Text: strings.Join(p.deltas, ""), FinishReason: "stop"}, nil
+}
+
+func (p *scriptedStreamProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return nil, nil
+}
+
+func TestStreamLines(t *testing.T) {
+	provider := &scriptedStreamProvider{deltas: []string{"fir", "st line\nsec", "ond", " line\r\n", "\nlast"}}
+	var lines []string
+	resp, err := StreamLines(context.Background(), provider, &LLMRequest{}, func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatalf("StreamLines failed: %v", err)
+	}
+	want := []string{"first line", "second line", "", "last"}
+	if !slices.Equal(lines, want) {
+		t.Errorf("Expected lines %q, got %q", want, lines)
+	}
+	if resp.FinishReason != "stop" {
+		t.Errorf("Expected the provider response to be returned, got %#v", resp)
+	}
+}
+
+// deadlineStreamProvider streams a delta then waits for the end of the context, like a slow model.
+type deadlineStreamProvider struct {
+	scriptedStreamProvider
+	doneDelta bool // ends the stream with its own done delta holding the error, like the providers do
+}
+
+func (p *deadlineStreamProvider) Stream(ctx context.Context, req *LLMRequest, onDelta func(Delta)) (*LLMResponse, error) {
+	onDelta(Delta{Text: "Hello"})
+	<-ctx.Done()
+	if p.doneDelta {
+		onDelta(Delta{Done: true, FinishReason: FinishReasonCancelled, Err: ctx.Err()})
+	}
+	return nil, ctx.Err()
+}
+
+func TestStreamQueryDeadline(t *testing.T) {
+	for _, doneDelta := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ProviderDoneDelta=%t", doneDelta), func(t *testing.T) {
+			// the done delta used to be dropped at random when racing with the deadline
+			for range 50 {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+				deltas, err := StreamQuery(ctx, &deadlineStreamProvider{doneDelta: doneDelta}, &LLMRequest{})
+				if err != nil {
+					cancel()
+					t.Fatalf("StreamQuery failed: %v", err)
+				}
+				var last Delta
+				for d := range deltas {
+					last = d
+				}
+				cancel()
+				if !last.Done || !errors.Is(last.Err, context.DeadlineExceeded) {
+					t.Fatalf("Expected a terminal delta with context.DeadlineExceeded, got %#v", last)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamQueryError(t *testing.T) {
+	streamErr := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "Success"},
+		{name: "StreamFailure", err: streamErr, wantErr: streamErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &scriptedStreamProvider{deltas: []string{"Hello", " world"}, err: tt.err}
+			deltas, err := StreamQuery(context.Background(), provider, &LLMRequest{})
+			if err != nil {
+				t.Fatalf("StreamQuery failed: %v", err)
+			}
+			var text strings.Builder
+			var last Delta
+			for d := range deltas {
+				text.WriteString(d.Text)
+				last = d
+			}
+			if text.String() != "Hello world" {
+				t.Errorf("Expected text 'Hello world', got %q", text.String())
+			}
+			if !last.Done || !errors.Is(last.Err, tt.wantErr) {
+				t.Errorf("Expected a terminal delta with error %v, got %#v", tt.wantErr, last)
+			}
+		})
+	}
+}
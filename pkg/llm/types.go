@@ -1,6 +1,10 @@
 package llm
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
 
 type Role string
 
@@ -18,6 +22,9 @@ type LLMMessage struct {
 	Name       string     `json:"name,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	// Reasoning holds the reasoning of a previous assistant turn (a.k.a. reasoning_content or thinking).
+	// It is replayed or omitted when building the request, depending on the provider rules.
+	Reasoning string `json:"reasoning,omitempty"`
 }
 
 type ToolSpec struct {
@@ -58,6 +65,63 @@ type LLMRequest struct {
 	MaxTokens   int     `json:"max_tokens,omitempty"`
 	Stream      bool    `json:"stream,omitempty"`
 
+	// FrequencyPenalty and PresencePenalty (-2.0 to 2.0) penalize the tokens already generated, by frequency
+	// or presence, to reduce repetition in long generations. Zero means the provider default and is not sent.
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64 `json:"presence_penalty,omitempty"`
+
+	// N asks the OpenAI-compatible providers for N candidate completions, returned in LLMResponse.Choices.
+	// Values <= 1 mean a single completion. It is ignored when streaming and by Gemini and Ollama.
+	N int `json:"n,omitempty"`
+
+	// LogProbs asks the OpenAI-compatible providers for the log probability of each generated token,
+	// returned in LLMResponse.LogProbs, with the TopLogProbs (0 to 20) most likely alternatives at each position.
+	// They are ignored when streaming and by Gemini and Ollama.
+	LogProbs    bool `json:"logprobs,omitempty"`
+	TopLogProbs int  `json:"top_logprobs,omitempty"`
+
+	// ServiceTier is the OpenAI processing tier ("auto", "default", "flex" or "priority") trading latency for cost.
+	// It is only sent to OpenAI and ignored by the other providers. Empty means the account default.
+	ServiceTier string `json:"service_tier,omitempty"`
+
+	// Language is an advisory hint (e.g. "French", "fr-CH") asking the model to answer in that language.
+	// None of the supported providers has a native locale parameter, so it is sent as a system instruction.
+	// Models usually follow it, but it is not guaranteed. Empty means no hint.
+	Language string `json:"-"`
+
+	// Timeout, when > 0, bounds this request with a context.WithTimeout derived from the passed context.
+	// Zero means the passed context is used as-is.
+	Timeout time.Duration `json:"-"`
+
+	// FakeStreamIfUnsupported makes Stream fall back to a regular Query when the model catalog says
+	// the model doesn't support streaming, the full text is then emitted as a single delta followed by done.
+	FakeStreamIfUnsupported bool `json:"-"`
+
+	// ExtractJSONResponse, when a JSON ResponseFormat is requested, replaces a response text that is not valid JSON
+	// by the JSON found in it with ExtractJSON, to salvage answers of models not strictly honoring JSON mode.
+	// The original text is kept in LLMResponse.OriginalText. Streamed deltas are left unchanged.
+	ExtractJSONResponse bool `json:"-"`
+
+	// TimestampDeltas makes the streaming providers stamp each Delta with its Elapsed time since the request start,
+	// e.g. to plot inter-token latencies. It is off by default as it costs a time.Now per chunk.
+	TimestampDeltas bool `json:"-"`
+
+	// OnFirstChunk, when not nil, is called once by the streaming providers with the time elapsed since the request
+	// start when the first chunk of the answer is received, giving the time to first token for latency monitoring.
+	OnFirstChunk func(elapsed time.Duration) `json:"-"`
+
+	// IncludeRawChunks is a debug flag making the streaming providers attach to each Delta the provider chunk it was
+	// parsed from (Delta.RawChunk), to diagnose mis-parsed deltas. It is off by default as it copies every chunk.
+	IncludeRawChunks bool `json:"-"`
+
+	// IncludeSentMessages is a debug flag making the providers return in LLMResponse.SentMessages the messages
+	// sent, after the OnRequest hook and the normalization steps (e.g. the language hint injected in the system prompt).
+	IncludeSentMessages bool `json:"-"`
+
+	// MaxTokensCheck enables an opt-in check, before sending, that MaxTokens fits in the model context window
+	// (from the catalog) alongside the estimated prompt tokens. See MaxTokensCheckMode.
+	MaxTokensCheck MaxTokensCheckMode `json:"-"`
+
 	// ProviderExtras allows per-provider flags without polluting the core schema
 	ProviderExtras map[string]any `json:"-"`
 	// ExtraHeaders (per-request) merged with ProviderConfig.ExtraHeaders
@@ -74,6 +138,9 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Estimated is true when some counts were not reported by the provider and were approximated
+	// from the text length (see EstimateTokens), they should then only be taken as an order of magnitude.
+	Estimated bool `json:"estimated,omitempty"`
 }
 
 type LLMResponse struct {
@@ -81,19 +148,191 @@ type LLMResponse struct {
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason,omitempty"`
 	Usage        *Usage     `json:"usage,omitempty"`
+	// Choices holds all the candidate completions when several were requested with LLMRequest.N,
+	// Text, FinishReason and ToolCalls are then the ones of the first choice. It is nil for a single completion.
+	Choices []Choice `json:"choices,omitempty"`
+	// LogProbs holds the log probabilities of the generated tokens when requested with LLMRequest.LogProbs
+	LogProbs []TokenLogProb `json:"logprobs,omitempty"`
+	// Reasoning is the reasoning returned apart from the answer by thinking models
+	// (reasoning_content of DeepSeek-R1, reasoning of OpenRouter, Gemini thoughts, Ollama thinking), empty otherwise
+	Reasoning string `json:"reasoning,omitempty"`
+	// ServiceTier is the OpenAI processing tier that actually served the request, when reported
+	ServiceTier string `json:"service_tier,omitempty"`
+	// Status is the response status when reported apart from the finish reason ("completed", "incomplete", ...)
+	Status string `json:"status,omitempty"`
+	// IncompleteReason is why an incomplete output stopped, when reported with the status
+	// (IncompleteReasonMaxOutputTokens, IncompleteReasonContentFilter), see Incomplete
+	IncompleteReason string `json:"incomplete_reason,omitempty"`
+	// Parts holds the content parts in order when the provider returned structured content
+	// (several segments or non text parts like images), Text is then the concatenation of the text parts.
+	// It is nil for a plain text answer and for streamed responses.
+	Parts []ContentPart `json:"parts,omitempty"`
+	// OriginalText is the text before the JSON extraction requested by LLMRequest.ExtractJSONResponse,
+	// only set when Text was replaced
+	OriginalText string `json:"original_text,omitempty"`
+	// Safety holds the content safety feedback of the provider when reported (Gemini)
+	Safety *SafetyInfo `json:"safety,omitempty"`
+	// Metrics holds the timings of the call, set by the providers for successful queries and streams
+	Metrics *Metrics `json:"metrics,omitempty"`
+	// SentMessages are the messages sent to the provider, for reproducibility and debugging, only set when requested
+	// with LLMRequest.IncludeSentMessages. They are recorded after the OnRequest hook, the normalization steps and the
+	// provider adaptations of the request, but before the conversion to the wire format of the provider
+	// (e.g. the Gemini contents), use BuildRequestPayload to get the exact payload.
+	SentMessages []LLMMessage `json:"sent_messages,omitempty"`
 	// Raw provider response for debugging
 	Raw json.RawMessage `json:"raw,omitempty"`
 }
 
+// StatusIncomplete is the LLMResponse.Status of an output cut before its end.
+const StatusIncomplete = "incomplete"
+
+// Reasons of an incomplete output, as reported in the incomplete_details of OpenAI or derived from a finish reason.
+const (
+	IncompleteReasonMaxOutputTokens = "max_output_tokens"
+	IncompleteReasonContentFilter   = "content_filter"
+)
+
+// Incomplete tells if the output was cut before its end and why: the reported IncompleteReason
+// or, when the provider has no status, the one matching the finish reason ("length" and "MAX_TOKENS"
+// for max_output_tokens, "content_filter" and "SAFETY" for content_filter).
+// The reason is empty for an incomplete status without details.
+func (r *LLMResponse) Incomplete() (reason string, incomplete bool) {
+	if r == nil {
+		return "", false
+	}
+	if r.IncompleteReason != "" {
+		return r.IncompleteReason, true
+	}
+	switch r.FinishReason {
+	case "length", "max_tokens", "MAX_TOKENS":
+		return IncompleteReasonMaxOutputTokens, true
+	case "content_filter", "SAFETY", "RECITATION":
+		return IncompleteReasonContentFilter, true
+	}
+	return "", r.Status == StatusIncomplete
+}
+
+// Metrics are the timings of a response.
+type Metrics struct {
+	// Duration is the wall-clock time of the call, from sending the request to the complete response
+	Duration time.Duration `json:"duration"`
+	// GenerationDuration is the time the server spent generating the completion tokens, when reported (Ollama)
+	GenerationDuration time.Duration `json:"generation_duration,omitempty"`
+}
+
+// TokensPerSecond returns the generation throughput of the response: the completion tokens divided by
+// the server generation duration when reported, else by the wall-clock duration of the call, which includes
+// the network latency and the prompt processing. It returns 0 when the usage or the metrics are unknown.
+func (r *LLMResponse) TokensPerSecond() float64 {
+	if r == nil || r.Usage == nil || r.Usage.CompletionTokens <= 0 || r.Metrics == nil {
+		return 0
+	}
+	d := r.Metrics.GenerationDuration
+	if d <= 0 {
+		d = r.Metrics.Duration
+	}
+	if d <= 0 {
+		return 0
+	}
+	return float64(r.Usage.CompletionTokens) / d.Seconds()
+}
+
+// Choice is a candidate completion of a response.
+type Choice struct {
+	Index        int        `json:"index"`
+	Text         string     `json:"text"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
+	// LogProbs of the tokens of the choice, when requested
+	LogProbs []TokenLogProb `json:"logprobs,omitempty"`
+}
+
+// TokenLogProb is the log probability of a generated token, with the most likely alternatives when requested.
+type TokenLogProb struct {
+	Token       string         `json:"token"`
+	LogProb     float64        `json:"logprob"`
+	TopLogProbs []TokenLogProb `json:"top_logprobs,omitempty"`
+}
+
+// Prob returns the probability of the token, between 0 and 1.
+func (t TokenLogProb) Prob() float64 {
+	return math.Exp(t.LogProb)
+}
+
+// SafetyInfo explains the content filtering decisions of a provider.
+type SafetyInfo struct {
+	// BlockReason is set when the prompt was blocked, e.g. "SAFETY", "BLOCKLIST" or "OTHER"
+	BlockReason string         `json:"block_reason,omitempty"`
+	Ratings     []SafetyRating `json:"ratings,omitempty"`
+}
+
+// SafetyRating is the probability of harm of the content for a category, e.g. "HARM_CATEGORY_DANGEROUS_CONTENT".
+type SafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability,omitempty"` // NEGLIGIBLE, LOW, MEDIUM or HIGH
+	Blocked     bool   `json:"blocked,omitempty"`
+}
+
+// ContentPartType is the kind of content held by a ContentPart.
+type ContentPartType string
+
+const (
+	ContentPartText  ContentPartType = "text"
+	ContentPartImage ContentPartType = "image"
+)
+
+// ContentPart is a segment of a multimodal response.
+type ContentPart struct {
+	Type ContentPartType `json:"type"`
+	// Text of a text part
+	Text string `json:"text,omitempty"`
+	// MIMEType and Data hold inline binary content (e.g. a generated image), URL a remote or data: URL
+	MIMEType string `json:"mime_type,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// structuredParts returns parts when they carry more than a single text segment, nil otherwise.
+func structuredParts(parts []ContentPart) []ContentPart {
+	if len(parts) == 0 || (len(parts) == 1 && parts[0].Type == ContentPartText) {
+		return nil
+	}
+	return parts
+}
+
 type Delta struct {
 	// Text delta for streaming
 	Text string `json:"text,omitempty"`
+	// Reasoning delta of thinking models, streamed apart from Text so a UI can render it distinctly
+	Reasoning string `json:"reasoning,omitempty"`
 	// ToolCall deltas when tools are emitted
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallArgsFragment is a piece of a tool call arguments as it arrives, for UIs showing them being typed out.
+	// Fragments are raw and the concatenated arguments are usually invalid JSON until the tool call completes,
+	// the reassembled tool call is still emitted in ToolCalls at the end of the stream.
+	ToolCallArgsFragment *ToolCallFragment `json:"tool_call_args_fragment,omitempty"`
 	// Whether this is the final chunk
 	Done bool `json:"done,omitempty"`
 	// Optional reason on done
 	FinishReason string `json:"finish_reason,omitempty"`
+	// Elapsed is the arrival time of the delta since the request start, only set with LLMRequest.TimestampDeltas
+	Elapsed time.Duration `json:"elapsed,omitempty"`
+	// RawChunk is the provider chunk the delta was parsed from, for debugging only and set with LLMRequest.IncludeRawChunks.
+	// It is nil for the final done delta and for the deltas of a stream emulated with a regular query.
+	RawChunk json.RawMessage `json:"raw_chunk,omitempty"`
+	// Err is only set on the done delta of a stream that failed or was cancelled (see FinishReasonError)
+	Err error `json:"-"`
+}
+
+// ToolCallFragment is an incremental piece of a streamed tool call arguments.
+type ToolCallFragment struct {
+	// Index of the tool call in the response, fragments of the same tool call share it
+	Index int `json:"index"`
+	// ID and Name of the tool call, when already known
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Arguments is the raw text fragment to append to the previous ones
+	Arguments string `json:"arguments"`
 }
 
 type ModelInfo struct {
@@ -102,6 +341,10 @@ type ModelInfo struct {
 	Size          int64  `json:"size,omitempty"`
 	ParameterSize string `json:"parameter_size,omitempty"`
 	ContextSize   int    `json:"context_size,omitempty"`
+	Priority      int    `json:"priority,omitempty"` // sampling weight, used by SampleModels
+	// Pricing in dollars per million tokens, zero when unknown, used by EstimateCost
+	InputCostPer1M  float64 `json:"input_cost_per_1m,omitempty"`
+	OutputCostPer1M float64 `json:"output_cost_per_1m,omitempty"`
 	// Feature flags
 	SupportsTools      bool `json:"supports_tools,omitempty"`
 	SupportsThinking   bool `json:"supports_thinking,omitempty"`
@@ -109,7 +352,17 @@ type ModelInfo struct {
 	SupportsStreaming  bool `json:"supports_streaming,omitempty"`
 	SupportsJSONMode   bool `json:"supports_json_mode,omitempty"`
 	SupportsStructured bool `json:"supports_structured,omitempty"`
+	// RequestOverrides holds the payload quirks of the model, applied to OpenAI-compatible requests
+	RequestOverrides *RequestOverrides `json:"request_overrides,omitempty"`
 }
 
-//To calculate how fast the response is generated in tokens per second
-// (token/s), divide eval_count / eval_duration * 10^9.
+// RequestOverrides describes model specific adjustments of the request payload, defined in the model catalog
+// so that new models needing workarounds are handled without code changes. They are applied in this order:
+//   - Omit: payload fields to remove, e.g. ["temperature"] for reasoning models rejecting it
+//   - Rename: payload fields to rename, e.g. {"max_tokens": "max_completion_tokens"}
+//   - Set: payload fields to add or overwrite, e.g. {"stop": ["<|end|>"]}
+type RequestOverrides struct {
+	Omit   []string          `json:"omit,omitempty"`
+	Rename map[string]string `json:"rename,omitempty"`
+	Set    map[string]any    `json:"set,omitempty"`
+}
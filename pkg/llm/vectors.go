@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrDimensionMismatch is returned when comparing vectors of different dimensions.
+var ErrDimensionMismatch = errors.New("vectors dimensions mismatch")
+
+// NormalizeL2 scales v in place to a unit length (L2 norm of 1) and returns it, so that the cosine similarity
+// of normalized vectors is their dot product. A zero vector is returned unchanged.
+func NormalizeL2(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := math.Sqrt(sum)
+	for i, x := range v {
+		v[i] = float32(float64(x) / norm)
+	}
+	return v
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, from -1 (opposite) to 1 (same direction),
+// to rank embeddings by similarity. It is 0 when a vector is zero, and an ErrDimensionMismatch error
+// when they don't have the same dimension, e.g. embeddings of different models.
+func CosineSimilarity(a, b []float32) (float32, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("%w: %d and %d", ErrDimensionMismatch, len(a), len(b))
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0, nil
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB))), nil
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float32
+	}{
+		{name: "SameDirection", a: []float32{1, 2, 3}, b: []float32{2, 4, 6}, want: 1},
+		{name: "Opposite", a: []float32{1, 0}, b: []float32{-3, 0}, want: -1},
+		{name: "Orthogonal", a: []float32{1, 0}, b: []float32{0, 5}, want: 0},
+		{name: "Angle45", a: []float32{1, 0}, b: []float32{1, 1}, want: float32(math.Sqrt2 / 2)},
+		{name: "Known", a: []float32{1, 2, 3}, b: []float32{4, 5, 6}, want: float32(32 / (math.Sqrt(14) * math.Sqrt(77)))},
+		{name: "ZeroVector", a: []float32{0, 0}, b: []float32{1, 1}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CosineSimilarity(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("CosineSimilarity failed: %v", err)
+			}
+			if math.Abs(float64(got-tt.want)) > 1e-6 {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := CosineSimilarity([]float32{1, 2}, []float32{1, 2, 3}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestNormalizeL2(t *testing.T) {
+	v := NormalizeL2([]float32{3, 4})
+	if math.Abs(float64(v[0]-0.6)) > 1e-6 || math.Abs(float64(v[1]-0.8)) > 1e-6 {
+		t.Errorf("Expected [0.6 0.8], got %v", v)
+	}
+	if zero := NormalizeL2([]float32{0, 0}); zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("Expected the zero vector unchanged, got %v", zero)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"index": 0, "embedding": [3, 4]}, {"index": 1, "embedding": [0, 2]}]}`)
+	}))
+	defer server.Close()
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	provider := &openAICompatibleProvider{BaseURL: server.URL, Client: server.Client(), l: l}
+	resp, err := provider.Embed(context.Background(), &EmbedRequest{Model: "m", Input: []string{"a", "b"}, Normalize: true})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	// the dot product of the normalized vectors is their cosine similarity, 0.8
+	similarity, _ := CosineSimilarity(resp.Embeddings[0], resp.Embeddings[1])
+	if resp.Embeddings[1][1] != 1 || math.Abs(float64(similarity-0.8)) > 1e-6 {
+		t.Errorf("Expected unit vectors with a similarity of 0.8, got %v (%v)", resp.Embeddings, similarity)
+	}
+}
@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// VerifyStage is the step of the request/response path at which Verify failed.
+type VerifyStage string
+
+const (
+	// VerifyStageConnection means the endpoint could not be reached (DNS, TLS, refused connection, timeout)
+	VerifyStageConnection VerifyStage = "connection"
+	// VerifyStageAuth means the API key was refused (401 or 403)
+	VerifyStageAuth VerifyStage = "auth"
+	// VerifyStageEndpoint means the endpoint does not exist, usually a wrong base URL
+	VerifyStageEndpoint VerifyStage = "endpoint"
+	// VerifyStageModel means the model is unknown or not available for this account
+	VerifyStageModel VerifyStage = "model"
+	// VerifyStageAPI means the provider answered with another error status
+	VerifyStageAPI VerifyStage = "api"
+	// VerifyStageResponse means the answer could not be parsed or was empty
+	VerifyStageResponse VerifyStage = "response"
+)
+
+// verifyPrompt is the minimal prompt sent by Verify.
+const verifyPrompt = "Reply with OK"
+
+// VerifyError is returned by Verify, Stage tells which part of the configuration is wrong.
+type VerifyError struct {
+	Stage VerifyStage
+	Model string
+	Err   error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verify model %s failed at %s stage: %v", e.Model, e.Stage, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Verify sends a minimal real prompt to model with provider, to confirm the full request/response path works:
+// reaching the endpoint, authentication, model availability and response parsing.
+// It is more thorough than listing the models, at the cost of a (tiny) billed request.
+// On failure, the error is a *VerifyError giving the failed stage.
+func Verify(ctx context.Context, provider Provider, model string) error {
+	if provider == nil {
+		return errors.New("provider cannot be nil")
+	}
+	req := &LLMRequest{
+		Model:    model,
+		Messages: []LLMMessage{{Role: RoleUser, Content: verifyPrompt}},
+	}
+	resp, err := provider.Query(ctx, req)
+	if err != nil {
+		return &VerifyError{Stage: verifyStage(err), Model: model, Err: err}
+	}
+	if strings.TrimSpace(resp.Text) == "" && len(resp.ToolCalls) == 0 {
+		return &VerifyError{Stage: VerifyStageResponse, Model: model, Err: errors.New("empty answer")}
+	}
+	return nil
+}
+
+// verifyStage classifies a Query error into the stage that failed.
+func verifyStage(err error) VerifyStage {
+	var apiErr *APIError
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &apiErr):
+		switch {
+		case IsAuthError(err):
+			return VerifyStageAuth
+		case apiErr.StatusCode == http.StatusNotFound && strings.Contains(strings.ToLower(apiErr.Message), "model"):
+			return VerifyStageModel
+		case apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusMethodNotAllowed:
+			return VerifyStageEndpoint
+		case apiErr.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(apiErr.Message), "model"):
+			return VerifyStageModel
+		default:
+			return VerifyStageAPI
+		}
+	case errors.As(err, &urlErr):
+		return VerifyStageConnection
+	default:
+		return VerifyStageResponse
+	}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantStage VerifyStage
+	}{
+		{name: "OK", status: http.StatusOK, body: `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": "OK"}}]}`},
+		{name: "Auth", status: http.StatusUnauthorized, body: `{"error": {"message": "Incorrect API key provided"}}`, wantStage: VerifyStageAuth},
+		{name: "UnknownModel", status: http.StatusNotFound, body: `{"error": {"message": "The model 'gpt-9' does not exist"}}`, wantStage: VerifyStageModel},
+		{name: "WrongEndpoint", status: http.StatusNotFound, body: `404 page not found`, wantStage: VerifyStageEndpoint},
+		{name: "OtherAPIError", status: http.StatusUnprocessableEntity, body: `{"error": {"message": "invalid messages"}}`, wantStage: VerifyStageAPI},
+		{name: "Unparsable", status: http.StatusOK, body: `<html>proxy login</html>`, wantStage: VerifyStageResponse},
+		{name: "EmptyAnswer", status: http.StatusOK, body: `{"choices": [{"finish_reason": "stop", "message": {"role": "assistant", "content": ""}}]}`, wantStage: VerifyStageResponse},
+	}
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+			provider, err := NewOpenAICompatAdapter(ProviderConfig{Model: "gpt-test", APIKey: "test-api-key", BaseURL: server.URL}, ProviderOpenAI, server.URL, l)
+			if err != nil {
+				t.Fatalf("NewOpenAICompatAdapter failed: %v", err)
+			}
+
+			err = Verify(context.Background(), provider, "gpt-test")
+			if tt.wantStage == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			var verifyErr *VerifyError
+			if !errors.As(err, &verifyErr) {
+				t.Fatalf("Expected a *VerifyError, got %v", err)
+			}
+			if verifyErr.Stage != tt.wantStage {
+				t.Errorf("Expected stage %q, got %q (%v)", tt.wantStage, verifyErr.Stage, err)
+			}
+		})
+	}
+
+	t.Run("Connection", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		baseURL := server.URL
+		server.Close()
+		provider, _ := NewOpenAICompatAdapter(ProviderConfig{Model: "gpt-test", APIKey: "test-api-key", BaseURL: baseURL}, ProviderOpenAI, baseURL, l)
+		var verifyErr *VerifyError
+		if err := Verify(context.Background(), provider, "gpt-test"); !errors.As(err, &verifyErr) || verifyErr.Stage != VerifyStageConnection {
+			t.Errorf("Expected a connection stage error, got %v", err)
+		}
+	})
+}
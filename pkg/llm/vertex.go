@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+	"golang.org/x/oauth2"
+)
+
+// ProviderExtraVertexProject is the ProviderConfig.Extras key holding the Google Cloud project of Vertex AI.
+const ProviderExtraVertexProject = "project"
+
+// ProviderExtraVertexRegion is the ProviderConfig.Extras key holding the Vertex AI region, like "europe-west6"
+// or "global", DefaultVertexRegion when missing.
+const ProviderExtraVertexRegion = "region"
+
+// DefaultVertexRegion is the Vertex AI region used when none is configured.
+const DefaultVertexRegion = "us-central1"
+
+// vertexRegionPattern matches the Vertex AI region names, which end up in the host name of the endpoint.
+var vertexRegionPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// vertexTarget holds what a GeminiProvider needs to call Vertex AI instead of the Gemini API.
+type vertexTarget struct {
+	project     string
+	region      string
+	tokenSource oauth2.TokenSource
+}
+
+// NewVertexGeminiAdapter returns a provider for the Gemini models of Vertex AI (Google Cloud), the project and
+// region being given by cfg.Extras["project"] and cfg.Extras["region"]. The requests go to
+// https://{region}-aiplatform.googleapis.com/v1/projects/{project}/locations/{region}/publishers/google/models/{model}:generateContent
+// with an "Authorization: Bearer" header from tokenSource, e.g. google.DefaultTokenSource of golang.org/x/oauth2/google,
+// the request and response formats being the Gemini ones. The tokens are reused until they expire, so tokenSource
+// doesn't need to cache them. cfg.BaseURL replaces the regional endpoint when set,
+// e.g. for a private endpoint. ListModels returns the Gemini models of the catalog, as Vertex AI has no stable
+// API listing the publisher models.
+func NewVertexGeminiAdapter(cfg ProviderConfig, tokenSource oauth2.TokenSource, l golog.MyLogger) (Provider, error) {
+	if tokenSource == nil {
+		return nil, fmt.Errorf("vertex gemini: missing token source")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("vertex gemini: missing model")
+	}
+	project, err := stringFromExtras(cfg.Extras, ProviderExtraVertexProject, "")
+	if err != nil {
+		return nil, err
+	}
+	if project == "" {
+		return nil, fmt.Errorf("vertex gemini: missing %s in the provider extras", ProviderExtraVertexProject)
+	}
+	region, err := stringFromExtras(cfg.Extras, ProviderExtraVertexRegion, DefaultVertexRegion)
+	if err != nil {
+		return nil, err
+	}
+	if !vertexRegionPattern.MatchString(region) {
+		return nil, fmt.Errorf("vertex gemini: invalid %s %q, expected lowercase letters, digits and dashes", ProviderExtraVertexRegion, region)
+	}
+	vertexCfg := cfg
+	vertexCfg.BaseURL = FirstNonEmpty(cfg.BaseURL, vertexEndpoint(region))
+	g, err := newGeminiProvider(vertexCfg, l)
+	if err != nil {
+		return nil, err
+	}
+	g.vertex = &vertexTarget{project: project, region: region, tokenSource: oauth2.ReuseTokenSource(nil, tokenSource)}
+	return g, nil
+}
+
+// vertexEndpoint returns the regional endpoint of Vertex AI, the global one having no region prefix.
+func vertexEndpoint(region string) string {
+	if region == "global" {
+		return "https://aiplatform.googleapis.com"
+	}
+	return "https://" + region + "-aiplatform.googleapis.com"
+}
+
+// modelURL returns the Vertex AI URL of method (":generateContent" or ":streamGenerateContent") of modelName.
+func (v *vertexTarget) modelURL(baseURL, modelName, method string) string {
+	return baseURL + "/v1/projects/" + url.PathEscape(v.project) + "/locations/" + url.PathEscape(v.region) +
+		"/publishers/google/models/" + url.PathEscape(modelName) + method
+}
+
+// authHeaders returns the Authorization header with a token of the token source, which may refresh it.
+func (v *vertexTarget) authHeaders() (http.Header, error) {
+	token, err := v.tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("vertex gemini: error getting the OAuth token: %w", err)
+	}
+	return http.Header{"Authorization": []string{token.Type() + " " + token.AccessToken}}, nil
+}
+
+// vertexModels returns the Gemini models of the catalog, sorted by name.
+func (g *GeminiProvider) vertexModels() []ModelInfo {
+	modelInfos := make([]ModelInfo, 0, len(g.ModelsInfo.Models))
+	for name, overrides := range g.ModelsInfo.Models {
+		if IsModelExcluded(name, g.ModelsInfo.ExcludePatterns) {
+			continue
+		}
+		info := MergeModelInfo(g.ModelsInfo.Defaults, overrides)
+		info.Name = name
+		modelInfos = append(modelInfos, info)
+	}
+	slices.SortStableFunc(modelInfos, func(i, j ModelInfo) int {
+		return cmp.Compare(i.Name, j.Name)
+	})
+	return modelInfos
+}
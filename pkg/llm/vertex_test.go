@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lao-tseu-is-alive/go-cloud-k8s-common/pkg/golog"
+	"golang.org/x/oauth2"
+)
+
+// failingTokenSource is an oauth2.TokenSource failing like expired credentials.
+type failingTokenSource struct{}
+
+func (failingTokenSource) Token() (*oauth2.Token, error) {
+	return nil, errors.New("credentials expired")
+}
+
+// countingTokenSource is an oauth2.TokenSource counting the tokens it creates, valid for an hour.
+type countingTokenSource struct {
+	calls int
+}
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	s.calls++
+	return &oauth2.Token{AccessToken: "ya29.test-token", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestVertexGeminiProvider(t *testing.T) {
+	const modelPath = "/v1/projects/my-project/locations/europe-west6/publishers/google/models/gemini-2.5-flash"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer ya29.test-token" {
+			t.Errorf("Expected the bearer token of the token source, got %q", got)
+		}
+		if r.Header.Get("x-goog-api-key") != "" {
+			t.Errorf("Expected no API key header, got %q", r.Header.Get("x-goog-api-key"))
+		}
+		switch r.URL.Path {
+		case modelPath + ":generateContent":
+			fmt.Fprint(w, `{"candidates": [{"content": {"parts": [{"text": "Grüezi"}]}, "finishReason": "STOP"}],
+				"usageMetadata": {"promptTokenCount": 3, "candidatesTokenCount": 1, "totalTokenCount": 4}}`)
+		case modelPath + ":streamGenerateContent":
+			fmt.Fprint(w, `[{"candidates": [{"content": {"parts": [{"text": "Grü"}]}}]}, {"candidates": [{"content": {"parts": [{"text": "ezi"}]}, "finishReason": "STOP"}]}]`)
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "ya29.test-token"})
+	cfg := ProviderConfig{
+		Model:   "gemini-2.5-flash",
+		BaseURL: server.URL,
+		Extras:  map[string]any{ProviderExtraVertexProject: "my-project", ProviderExtraVertexRegion: "europe-west6"},
+	}
+	provider, err := NewVertexGeminiAdapter(cfg, tokenSource, l)
+	if err != nil {
+		t.Fatalf("NewVertexGeminiAdapter failed: %v", err)
+	}
+	req := &LLMRequest{Messages: []LLMMessage{{Role: RoleUser, Content: "Hello"}}}
+
+	resp, err := provider.Query(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if resp.Text != "Grüezi" || resp.Usage == nil || resp.Usage.TotalTokens != 4 {
+		t.Errorf("Expected the Gemini response mapping, got %q and %#v", resp.Text, resp.Usage)
+	}
+	var deltas string
+	resp, err = provider.Stream(context.Background(), req, func(d Delta) { deltas += d.Text })
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if deltas != "Grüezi" || resp.FinishReason != "STOP" {
+		t.Errorf("Expected the streamed text, got deltas %q and finish reason %q", deltas, resp.FinishReason)
+	}
+
+	payload, err := BuildRequestPayload(provider, req)
+	if err != nil {
+		t.Fatalf("BuildRequestPayload failed: %v", err)
+	}
+	if payload.URL != server.URL+modelPath+":generateContent" || payload.Header.Get("Authorization") != redactedValue {
+		t.Errorf("Expected the Vertex URL with the redacted token, got %s and %q", payload.URL, payload.Header.Get("Authorization"))
+	}
+
+	models, err := provider.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if !slices.ContainsFunc(models, func(m ModelInfo) bool { return m.Name == "gemini-2.5-flash" }) {
+		t.Errorf("Expected the Gemini models of the catalog, got %v", models)
+	}
+
+	t.Run("TokenReused", func(t *testing.T) {
+		counting := &countingTokenSource{}
+		reusing, err := NewVertexGeminiAdapter(cfg, counting, l)
+		if err != nil {
+			t.Fatalf("NewVertexGeminiAdapter failed: %v", err)
+		}
+		for range 3 {
+			if _, err := reusing.Query(context.Background(), req); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+		}
+		if counting.calls != 1 {
+			t.Errorf("Expected the token to be reused until it expires, got %d tokens for 3 queries", counting.calls)
+		}
+	})
+
+	t.Run("TokenError", func(t *testing.T) {
+		failing, err := NewVertexGeminiAdapter(cfg, failingTokenSource{}, l)
+		if err != nil {
+			t.Fatalf("NewVertexGeminiAdapter failed: %v", err)
+		}
+		if _, err := failing.Query(context.Background(), req); err == nil {
+			t.Error("Expected the error of the token source, got nil")
+		}
+	})
+}
+
+func TestNewVertexGeminiAdapter(t *testing.T) {
+	l, _ := golog.NewLogger("simple", io.Discard, golog.FatalLevel, "test")
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "ya29.test-token"})
+
+	provider, err := NewVertexGeminiAdapter(ProviderConfig{Model: "gemini-2.5-pro", Extras: map[string]any{ProviderExtraVertexProject: "p"}}, tokenSource, l)
+	if err != nil {
+		t.Fatalf("NewVertexGeminiAdapter failed: %v", err)
+	}
+	want := "https://us-central1-aiplatform.googleapis.com/v1/projects/p/locations/us-central1/publishers/google/models/gemini-2.5-pro:streamGenerateContent"
+	if got := provider.(*GeminiProvider).modelURL("gemini-2.5-pro", ":streamGenerateContent"); got != want {
+		t.Errorf("Expected the default region URL %s, got %s", want, got)
+	}
+	global, _ := NewVertexGeminiAdapter(ProviderConfig{Model: "m", Extras: map[string]any{ProviderExtraVertexProject: "p", ProviderExtraVertexRegion: "global"}}, tokenSource, l)
+	if got := global.(*GeminiProvider).BaseURL; got != "https://aiplatform.googleapis.com" {
+		t.Errorf("Expected the global endpoint without region prefix, got %s", got)
+	}
+
+	invalid := []struct {
+		name        string
+		cfg         ProviderConfig
+		tokenSource oauth2.TokenSource
+	}{
+		{name: "MissingProject", cfg: ProviderConfig{Model: "m"}, tokenSource: tokenSource},
+		{name: "MissingModel", cfg: ProviderConfig{Extras: map[string]any{ProviderExtraVertexProject: "p"}}, tokenSource: tokenSource},
+		{name: "MissingTokenSource", cfg: ProviderConfig{Model: "m", Extras: map[string]any{ProviderExtraVertexProject: "p"}}},
+		{name: "InvalidRegion", cfg: ProviderConfig{Model: "m", Extras: map[string]any{ProviderExtraVertexProject: "p", ProviderExtraVertexRegion: 6}}, tokenSource: tokenSource},
+		{name: "RegionWithAHost", cfg: ProviderConfig{Model: "m", Extras: map[string]any{ProviderExtraVertexProject: "p", ProviderExtraVertexRegion: "evil.example.com/x"}}, tokenSource: tokenSource},
+		{name: "UppercaseRegion", cfg: ProviderConfig{Model: "m", Extras: map[string]any{ProviderExtraVertexProject: "p", ProviderExtraVertexRegion: "Europe-West6"}}, tokenSource: tokenSource},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVertexGeminiAdapter(tt.cfg, tt.tokenSource, l); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}